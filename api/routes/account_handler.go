@@ -0,0 +1,68 @@
+package routes
+
+import (
+	"time"
+
+	"github.com/SinisterSup/auth-service/internal/models"
+	"github.com/SinisterSup/auth-service/internal/services"
+	"github.com/SinisterSup/auth-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+func handleDeleteAccount(accountService *services.AccountService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		var input models.DeleteAccountInput
+		if ctx.Request.ContentLength != 0 {
+			if err := ctx.ShouldBindJSON(&input); err != nil {
+				ctx.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		var issuedAt time.Time
+		if claims, exists := ctx.Get("claims"); exists {
+			if jwtClaims, ok := claims.(*utils.JWTClaim); ok && jwtClaims.IssuedAt != nil {
+				issuedAt = jwtClaims.IssuedAt.Time
+			}
+		}
+
+		err := accountService.RequestDeletion(userId, input, issuedAt, requestMeta(ctx))
+		if respondHashingOverloaded(ctx, err) || respondLockout(ctx, err) {
+			return
+		}
+		if err == services.ErrReauthenticationRequired {
+			ctx.JSON(401, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			ctx.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"message": "account scheduled for deletion"})
+	}
+}
+
+func handleExportAccount(accountService *services.AccountService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		export, err := accountService.Export(userId, requestMeta(ctx))
+		if err != nil {
+			ctx.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.Header("Content-Disposition", `attachment; filename="account-export.json"`)
+		ctx.JSON(200, export)
+	}
+}
@@ -0,0 +1,326 @@
+package routes
+
+import (
+	"strconv"
+
+	"github.com/SinisterSup/auth-service/internal/models"
+	"github.com/SinisterSup/auth-service/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func handleSearchUsers(adminService *services.AdminService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		actorId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		var query models.UserSearchQuery
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			ctx.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		page, err := adminService.SearchUsers(actorId, query, requestMeta(ctx))
+		if err != nil {
+			ctx.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(200, page)
+	}
+}
+
+func handleGetUser(adminService *services.AdminService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		actorId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		user, err := adminService.GetUser(actorId, ctx.Param("id"), requestMeta(ctx))
+		if err != nil {
+			respondAdminError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, user)
+	}
+}
+
+func handleDisableUser(adminService *services.AdminService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		actorId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		var input models.DisableUserInput
+		if ctx.Request.ContentLength != 0 {
+			if err := ctx.ShouldBindJSON(&input); err != nil {
+				ctx.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		if err := adminService.DisableUser(actorId, ctx.Param("id"), input, requestMeta(ctx)); err != nil {
+			respondAdminError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"message": "user suspended"})
+	}
+}
+
+func handleEnableUser(adminService *services.AdminService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		actorId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		if err := adminService.EnableUser(actorId, ctx.Param("id"), requestMeta(ctx)); err != nil {
+			respondAdminError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"message": "user enabled"})
+	}
+}
+
+func handleSetUserStatus(adminService *services.AdminService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		actorId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		var input models.UpdateStatusInput
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			ctx.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := adminService.SetStatus(actorId, ctx.Param("id"), input, requestMeta(ctx)); err != nil {
+			respondAdminError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"message": "status updated", "status": input.Status})
+	}
+}
+
+func handleUnlockUser(adminService *services.AdminService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		actorId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		if err := adminService.UnlockUser(actorId, ctx.Param("id"), requestMeta(ctx)); err != nil {
+			respondAdminError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"message": "user unlocked"})
+	}
+}
+
+func handleUnlockIP(adminService *services.AdminService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		actorId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		if err := adminService.UnlockIP(actorId, ctx.Param("ip"), requestMeta(ctx)); err != nil {
+			respondAdminError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"message": "address unlocked"})
+	}
+}
+
+func handleForcePasswordReset(adminService *services.AdminService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		actorId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		if err := adminService.ForcePasswordReset(actorId, ctx.Param("id"), requestMeta(ctx)); err != nil {
+			respondAdminError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"message": "password reset required"})
+	}
+}
+
+func handleForceLogout(adminService *services.AdminService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		actorId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		if err := adminService.ForceLogout(actorId, ctx.Param("id"), requestMeta(ctx)); err != nil {
+			respondAdminError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"message": "user signed out of all sessions"})
+	}
+}
+
+func handleUpdateRoles(adminService *services.AdminService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		actorId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		var input models.UpdateRolesInput
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			ctx.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := adminService.UpdateRoles(actorId, ctx.Param("id"), input, requestMeta(ctx)); err != nil {
+			respondAdminError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"message": "roles updated"})
+	}
+}
+
+func handleUpdatePermissions(adminService *services.AdminService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		actorId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		var input models.UpdatePermissionsInput
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			ctx.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := adminService.UpdatePermissions(actorId, ctx.Param("id"), input, requestMeta(ctx)); err != nil {
+			respondAdminError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"message": "permissions updated"})
+	}
+}
+
+func handleListRoles(adminService *services.AdminService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		actorId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		roles, err := adminService.ListRoles(actorId, requestMeta(ctx))
+		if err != nil {
+			ctx.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"roles": roles})
+	}
+}
+
+func handlePutRole(adminService *services.AdminService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		actorId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		var input models.RoleInput
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			ctx.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		role, err := adminService.PutRole(actorId, ctx.Param("name"), input, requestMeta(ctx))
+		if err != nil {
+			respondAdminError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, role)
+	}
+}
+
+func handleDeleteRole(adminService *services.AdminService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		actorId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		if err := adminService.DeleteRole(actorId, ctx.Param("name"), requestMeta(ctx)); err != nil {
+			respondAdminError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"message": "role deleted"})
+	}
+}
+
+func handleAdminDeleteUser(adminService *services.AdminService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		actorId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		if err := adminService.DeleteUser(actorId, ctx.Param("id"), requestMeta(ctx)); err != nil {
+			respondAdminError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"message": "user scheduled for deletion"})
+	}
+}
+
+func handleUserAudit(adminService *services.AdminService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		actorId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		limit, _ := strconv.ParseInt(ctx.Query("limit"), 10, 64)
+		events, err := adminService.UserAudit(actorId, ctx.Param("id"), limit, requestMeta(ctx))
+		if err != nil {
+			respondAdminError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"events": events})
+	}
+}
+
+func respondAdminError(ctx *gin.Context, err error) {
+	switch err {
+	case services.ErrUserNotFound, services.ErrRoleNotFound, services.ErrTenantNotFound:
+		ctx.JSON(404, gin.H{"error": err.Error()})
+		return
+	case services.ErrInvalidStatus, services.ErrUnknownRole, services.ErrInvalidRoleName, models.ErrInvalidPermission,
+		models.ErrInvalidTenantID, models.ErrInvalidTenantSettings:
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	case services.ErrBuiltInRole, services.ErrTenantInUse, services.ErrHostTaken, services.ErrLastAdmin:
+		ctx.JSON(409, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(500, gin.H{"error": err.Error()})
+}
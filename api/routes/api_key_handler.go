@@ -0,0 +1,143 @@
+package routes
+
+import (
+	"errors"
+
+	"github.com/SinisterSup/auth-service/internal/models"
+	"github.com/SinisterSup/auth-service/internal/scope"
+	"github.com/SinisterSup/auth-service/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func handleCreatePersonalToken(apiKeyService *services.APIKeyService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		var input models.CreatePersonalTokenInput
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			ctx.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		key, err := apiKeyService.CreatePersonal(ctx.Request.Context(), userId, input, requestMeta(ctx))
+		if err != nil {
+			respondAPIKeyError(ctx, err)
+			return
+		}
+
+		ctx.JSON(201, key)
+	}
+}
+
+func handleListPersonalTokens(apiKeyService *services.APIKeyService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		keys, err := apiKeyService.ListPersonal(ctx.Request.Context(), userId)
+		if err != nil {
+			respondAPIKeyError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"tokens": keys})
+	}
+}
+
+func handleRevokePersonalToken(apiKeyService *services.APIKeyService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		if err := apiKeyService.RevokePersonal(ctx.Request.Context(), userId, ctx.Param("id"), requestMeta(ctx)); err != nil {
+			respondAPIKeyError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"message": "token revoked"})
+	}
+}
+
+func handleCreateServiceKey(apiKeyService *services.APIKeyService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		actorId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		var input models.CreateServiceKeyInput
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			ctx.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		key, err := apiKeyService.CreateService(ctx.Request.Context(), actorId, input, requestMeta(ctx))
+		if err != nil {
+			respondAPIKeyError(ctx, err)
+			return
+		}
+
+		ctx.JSON(201, key)
+	}
+}
+
+func handleListAPIKeys(apiKeyService *services.APIKeyService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var query models.APIKeyQuery
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			ctx.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		keys, err := apiKeyService.List(ctx.Request.Context(), query)
+		if err != nil {
+			respondAPIKeyError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"keys": keys})
+	}
+}
+
+func handleAdminRevokeAPIKey(apiKeyService *services.APIKeyService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		actorId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		if err := apiKeyService.Revoke(ctx.Request.Context(), actorId, ctx.Param("id"), requestMeta(ctx)); err != nil {
+			respondAPIKeyError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"message": "API key revoked"})
+	}
+}
+
+func respondAPIKeyError(ctx *gin.Context, err error) {
+	if errors.Is(err, models.ErrAccountInactive) {
+		ctx.JSON(403, gin.H{"error": err.Error()})
+		return
+	}
+	switch err {
+	case services.ErrAPIKeyNotFound, services.ErrUserNotFound, services.ErrTenantNotFound:
+		ctx.JSON(404, gin.H{"error": err.Error()})
+		return
+	case services.ErrInvalidExpiry, models.ErrInvalidPermission:
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	case scope.ErrInvalidScope:
+		ctx.JSON(400, gin.H{"error": "invalid_scope", "error_description": err.Error()})
+		return
+	}
+	ctx.JSON(500, gin.H{"error": err.Error()})
+}
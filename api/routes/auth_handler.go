@@ -1,51 +1,118 @@
 package routes
 
 import (
+	"errors"
+	"io"
+	"math"
+	"strconv"
+
 	// "github.com/SinisterSup/auth-service/internal/verify"
+	"github.com/SinisterSup/auth-service/internal/mail"
 	"github.com/SinisterSup/auth-service/internal/models"
+	"github.com/SinisterSup/auth-service/internal/passwordhash"
+	"github.com/SinisterSup/auth-service/internal/passwordpolicy"
+	"github.com/SinisterSup/auth-service/internal/scope"
 	"github.com/SinisterSup/auth-service/internal/services"
+	"github.com/SinisterSup/auth-service/internal/session"
+	"github.com/SinisterSup/auth-service/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
-func handleSignUp(authService *services.AuthService) gin.HandlerFunc {
+// handleSignUp answers 202 whether or not the email was already registered;
+// the owner of the address learns which by email.
+func handleSignUp(registrationService *services.RegistrationService) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		var input models.SignUpInput
 		if err := ctx.ShouldBindJSON(&input); err != nil {
 			ctx.JSON(400, gin.H{"error": err.Error()})
 			return
 		}
+		input.RequestMeta = requestMeta(ctx)
 
-		user, err := authService.SignUp(input)
+		err := registrationService.Register(ctx.Request.Context(), input)
+		if respondPasswordPolicyError(ctx, err) || respondHashingOverloaded(ctx, err) {
+			return
+		}
+		if err == mail.ErrInvalidAddress {
+			ctx.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
 		if err != nil {
+			ctx.JSON(500, gin.H{"error": "failed to send verification email"})
+			return
+		}
+
+		ctx.JSON(202, gin.H{"message": "check your email to finish signing up"})
+	}
+}
+
+func handleVerifyEmail(registrationService *services.RegistrationService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var input models.VerifyEmailInput
+		if err := ctx.ShouldBindJSON(&input); err != nil {
 			ctx.JSON(400, gin.H{"error": err.Error()})
 			return
 		}
 
-		ctx.JSON(201, user)
+		err := registrationService.VerifyEmail(input, requestMeta(ctx))
+		if err == services.ErrInvalidVerificationToken {
+			ctx.JSON(401, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			ctx.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"message": "email verified; you can now sign in"})
 	}
 }
 
-func handleSignIn(authService *services.AuthService) gin.HandlerFunc {
+// handleSignIn answers 202 instead of issuing tokens when the user's tenant
+// requires MFA; the emailed code is then entered at /auth/otp/verify. With
+// cookie sessions enabled, a client may ask for its tokens in cookies.
+func handleSignIn(authService *services.AuthService, passwordlessService *services.PasswordlessService, sessions *session.Config) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		var input models.SignInInput
 		if err := ctx.ShouldBindJSON(&input); err != nil {
 			ctx.JSON(400, gin.H{"error": err.Error()})
 			return
 		}
+		input.RequestMeta = requestMeta(ctx)
 
-		tokens, err := authService.SignIn(input)
+		tokens, err := authService.SignInContext(ctx.Request.Context(), input)
+		var mfa *services.MFARequiredError
+		if errors.As(err, &mfa) {
+			if err := passwordlessService.SendSecondFactor(ctx.Request.Context(), mfa); err != nil {
+				ctx.JSON(500, gin.H{"error": "failed to send sign-in code"})
+				return
+			}
+			ctx.JSON(202, gin.H{"mfa_required": true, "message": "enter the code sent to your email"})
+			return
+		}
 		if err != nil {
-			ctx.JSON(401, gin.H{"error": err.Error()})
+			respondSignInError(ctx, err)
 			return
 		}
 
-		ctx.JSON(200, tokens)
+		respondTokens(ctx, sessions, tokens, sessions.Requested(ctx.Request))
 	}
 }
 
-func handleRevokeToken(authService *services.AuthService) gin.HandlerFunc {
+// handleRevokeToken revokes the token the request was made with. An API key
+// is revoked for good. A cookie session's cookies are cleared.
+func handleRevokeToken(authService *services.AuthService, apiKeyService *services.APIKeyService, sessions *session.Config) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
+		if claims, ok := ctx.MustGet("claims").(*utils.JWTClaim); ok && claims.KeyID != "" {
+			if err := apiKeyService.Revoke(ctx.Request.Context(), "", claims.KeyID, requestMeta(ctx)); err != nil {
+				respondAPIKeyError(ctx, err)
+				return
+			}
+			ctx.JSON(200, gin.H{"message": "API key revoked successfully"})
+			return
+		}
+
 		userId, userExists := ctx.Get("userId")
 		if !userExists {
             ctx.JSON(401, gin.H{"error": "user ID not found in context"})
@@ -75,26 +142,56 @@ func handleRevokeToken(authService *services.AuthService) gin.HandlerFunc {
             return
         }
 
+		if sessions.Enabled && usesSessionCookies(ctx) {
+			sessions.Clear(ctx.Writer, refreshPath(ctx))
+		}
+
 		// log.Println("Token revocation successful")
 		ctx.JSON(200, gin.H{"message": "token revoked successfully"})
 	}
 }
 
-func handleRefreshToken(authService *services.AuthService) gin.HandlerFunc {
+// handleRefreshToken takes the refresh token from the body or, in a cookie
+// session, from the refresh cookie, in which case the request must also carry
+// the CSRF token and the new tokens are set as cookies again.
+func handleRefreshToken(authService *services.AuthService, sessions *session.Config) gin.HandlerFunc {
     return func(c *gin.Context) {
         var input models.RefreshTokenInput
-        if err := c.ShouldBindJSON(&input); err != nil {
+        if err := c.ShouldBindJSON(&input); err != nil && !(sessions.Enabled && errors.Is(err, io.EOF)) {
             c.JSON(400, gin.H{"error": err.Error()})
             return
         }
+        input.RequestMeta = requestMeta(c)
+
+        fromCookie := false
+        if input.RefreshToken == "" && sessions.Enabled {
+            if cookie, err := c.Request.Cookie(session.RefreshCookie); err == nil && cookie.Value != "" {
+                input.RefreshToken, fromCookie = cookie.Value, true
+            }
+        }
+        if input.RefreshToken == "" {
+            c.JSON(400, gin.H{"error": "refresh_token is required"})
+            return
+        }
+        if fromCookie {
+            claims, err := utils.ValidateRefreshToken(input.RefreshToken)
+            if err != nil {
+                c.JSON(401, gin.H{"error": err.Error()})
+                return
+            }
+            if !session.CheckCSRF(c.Request, claims.UserId) {
+                c.JSON(403, gin.H{"error": "missing or invalid CSRF token"})
+                return
+            }
+        }
 
-        tokens, err := authService.RefreshToken(input.RefreshToken)
+        tokens, err := authService.Refresh(input)
         if err != nil {
-            c.JSON(401, gin.H{"error": err.Error()})
+            respondSignInError(c, err)
             return
         }
 
-        c.JSON(200, tokens)
+        respondTokens(c, sessions, tokens, fromCookie || sessions.Requested(c.Request))
     }
 }
 
@@ -107,4 +204,72 @@ func handleProfile() gin.HandlerFunc {
 			"email":   email,
 		})
 	}
-}
\ No newline at end of file
+}
+
+// respondSignInError answers a failed sign-in or refresh. Lockouts get 429
+// with Retry-After, accounts that may not sign in get 403 with their status
+// only, an overloaded hashing pool gets 503, a scope that cannot be granted
+// gets 400 invalid_scope, and everything else is a plain 401.
+func respondSignInError(ctx *gin.Context, err error) {
+	if respondHashingOverloaded(ctx, err) {
+		return
+	}
+	if err == scope.ErrInvalidScope {
+		ctx.JSON(400, gin.H{"error": "invalid_scope", "error_description": err.Error()})
+		return
+	}
+	if respondLockout(ctx, err) {
+		return
+	}
+	if errors.Is(err, models.ErrAccountInactive) || err == services.ErrPasswordResetRequired {
+		ctx.JSON(403, gin.H{"error": err.Error()})
+		return
+	}
+	if err == services.ErrLinkRequired {
+		ctx.JSON(409, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(401, gin.H{"error": err.Error()})
+}
+
+// respondPasswordPolicyError answers 400 with every violated rule when err is
+// a password policy rejection, and reports whether it did.
+func respondPasswordPolicyError(ctx *gin.Context, err error) bool {
+	var policyErr *passwordpolicy.ViolationError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+	ctx.JSON(400, gin.H{"error": err.Error(), "violations": policyErr.Violations})
+	return true
+}
+
+// respondLockout answers 429 with Retry-After when err is a sign-in lockout,
+// and reports whether it did.
+func respondLockout(ctx *gin.Context, err error) bool {
+	var lockout *services.LockoutError
+	if !errors.As(err, &lockout) {
+		return false
+	}
+	ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(lockout.RetryAfter.Seconds()))))
+	ctx.JSON(429, gin.H{"error": err.Error()})
+	return true
+}
+
+// respondHashingOverloaded answers 503 with Retry-After when the password
+// hashing pool turned the request away, and reports whether it did.
+func respondHashingOverloaded(ctx *gin.Context, err error) bool {
+	if !errors.Is(err, passwordhash.ErrSaturated) {
+		return false
+	}
+	ctx.Header("Retry-After", "1")
+	ctx.JSON(503, gin.H{"error": err.Error()})
+	return true
+}
+
+func requestMeta(ctx *gin.Context) models.RequestMeta {
+	return models.RequestMeta{
+		IP:        ctx.ClientIP(),
+		UserAgent: ctx.Request.UserAgent(),
+		TenantID:  ctx.GetString("tenantId"),
+	}
+}
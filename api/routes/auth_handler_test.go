@@ -10,8 +10,12 @@ import (
     "testing"
 
     "github.com/SinisterSup/auth-service/db"
+    "github.com/SinisterSup/auth-service/internal/mail"
     "github.com/SinisterSup/auth-service/internal/models"
+    "github.com/SinisterSup/auth-service/internal/services"
+    "github.com/SinisterSup/auth-service/internal/session"
     "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
     "go.mongodb.org/mongo-driver/mongo"
     "go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -19,6 +23,9 @@ import (
 func setupTestEnv(t *testing.T) (*gin.Engine, func()) {
     os.Setenv("JWT_SECRET", "CFRVAbtWMSrDdQbh9WOFUGGPsfsGasHKsaikAspYL6HRLE")
     os.Setenv("JWT_EXPIRY", "24h")
+    os.Setenv("PASSWORD_MIN_SCORE", "0")
+    os.Setenv("MAIL_BACKEND", "log")
+    os.Setenv("FORWARD_AUTH_HEADERS", "traefik")
     
     ctx := context.Background()
     client, err := mongo.Connect(ctx, options.Client().ApplyURI("mongodb://localhost:27017"))
@@ -27,10 +34,18 @@ func setupTestEnv(t *testing.T) (*gin.Engine, func()) {
     }
     
     db.DB = client.Database("auth_service_test")
+    if err := db.EnsureIndexes(ctx); err != nil {
+        t.Fatal(err)
+    }
     
+    mailer, err := mail.NewMailer()
+    if err != nil {
+        t.Fatal(err)
+    }
+
     gin.SetMode(gin.TestMode)
     router := gin.Default()
-    SetupAuthRoutes(router)
+    SetupAuthRoutes(router, services.NewAuthService(), mailer, nil)
 
     cleanup := func() {
         if err := db.DB.Drop(ctx); err != nil {
@@ -44,6 +59,49 @@ func setupTestEnv(t *testing.T) (*gin.Engine, func()) {
     return router, cleanup
 }
 
+// newRequest builds a request to the router under test, with input as its
+// JSON body and token, if set, as its bearer token.
+func newRequest(method, path, token string, input interface{}) *http.Request {
+    var body bytes.Buffer
+    if input != nil {
+        json.NewEncoder(&body).Encode(input)
+    }
+    req := httptest.NewRequest(method, path, &body)
+    if input != nil {
+        req.Header.Set("Content-Type", "application/json")
+    }
+    if token != "" {
+        req.Header.Set("Authorization", "Bearer "+token)
+    }
+    return req
+}
+
+func serve(router *gin.Engine, req *http.Request) *httptest.ResponseRecorder {
+    w := httptest.NewRecorder()
+    router.ServeHTTP(w, req)
+    return w
+}
+
+// signedInUser signs up test@example.com, marks it verified and signs in,
+// returning the credentials and the tokens.
+func signedInUser(t *testing.T, router *gin.Engine) (models.SignInInput, models.TokenResponse) {
+    t.Helper()
+    credentials := models.SignInInput{Email: "test@example.com", Password: "password123"}
+    serve(router, newRequest("POST", "/auth/signup", "", models.SignUpInput{Email: credentials.Email, Password: credentials.Password}))
+    _, err := db.DB.Collection("users").UpdateOne(context.Background(), bson.M{"email": credentials.Email}, bson.M{"$set": bson.M{"status": models.StatusActive}})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    w := serve(router, newRequest("POST", "/auth/signin", "", credentials))
+    if w.Code != http.StatusOK {
+        t.Fatalf("Failed to sign in: %d %s", w.Code, w.Body.String())
+    }
+    var tokens models.TokenResponse
+    json.Unmarshal(w.Body.Bytes(), &tokens)
+    return credentials, tokens
+}
+
 func TestSignUpEndpoint(t *testing.T) {
     router, cleanup := setupTestEnv(t)
     defer cleanup()
@@ -52,24 +110,16 @@ func TestSignUpEndpoint(t *testing.T) {
         Email:    "test@example.com",
         Password: "password123",
     }
-    body, _ := json.Marshal(input)
-
-    w := httptest.NewRecorder()
-    req, _ := http.NewRequest("POST", "/auth/signup", bytes.NewBuffer(body))
-    req.Header.Set("Content-Type", "application/json")
-    router.ServeHTTP(w, req)
 
-    if w.Code != http.StatusCreated {
-        t.Errorf("Expected status 201, got %d", w.Code)
+    w := serve(router, newRequest("POST", "/auth/signup", "", input))
+    if w.Code != http.StatusAccepted {
+        t.Errorf("Expected status 202, got %d", w.Code)
     }
+    firstBody := w.Body.String()
 
-    w = httptest.NewRecorder()
-    req, _ = http.NewRequest("POST", "/auth/signup", bytes.NewBuffer(body))
-    req.Header.Set("Content-Type", "application/json")
-    router.ServeHTTP(w, req)
-
-    if w.Code != http.StatusBadRequest {
-        t.Errorf("Expected status 400 for duplicate email, got %d", w.Code)
+    w = serve(router, newRequest("POST", "/auth/signup", "", input))
+    if w.Code != http.StatusAccepted || w.Body.String() != firstBody {
+        t.Errorf("Expected duplicate email to get the same response, got %d %s", w.Code, w.Body.String())
     }
 }
 
@@ -77,26 +127,26 @@ func TestSignInEndpoint(t *testing.T) {
     router, cleanup := setupTestEnv(t)
     defer cleanup()
 
-    signUpInput := models.SignUpInput{
+    serve(router, newRequest("POST", "/auth/signup", "", models.SignUpInput{
         Email:    "test@example.com",
         Password: "password123",
-    }
-    body, _ := json.Marshal(signUpInput)
-    w := httptest.NewRecorder()
-    req, _ := http.NewRequest("POST", "/auth/signup", bytes.NewBuffer(body))
-    req.Header.Set("Content-Type", "application/json")
-    router.ServeHTTP(w, req)
+    }))
 
     signInInput := models.SignInInput{
         Email:    "test@example.com",
         Password: "password123",
     }
-    body, _ = json.Marshal(signInInput)
-    w = httptest.NewRecorder()
-    req, _ = http.NewRequest("POST", "/auth/signin", bytes.NewBuffer(body))
-    req.Header.Set("Content-Type", "application/json")
-    router.ServeHTTP(w, req)
+    w := serve(router, newRequest("POST", "/auth/signin", "", signInInput))
+    if w.Code != http.StatusUnauthorized {
+        t.Errorf("Expected status 401 before the email is verified, got %d", w.Code)
+    }
+
+    _, err := db.DB.Collection("users").UpdateOne(context.Background(), bson.M{"email": "test@example.com"}, bson.M{"$set": bson.M{"status": models.StatusActive}})
+    if err != nil {
+        t.Fatal(err)
+    }
 
+    w = serve(router, newRequest("POST", "/auth/signin", "", signInInput))
     if w.Code != http.StatusOK {
         t.Errorf("Expected status 200, got %d", w.Code)
     }
@@ -107,3 +157,160 @@ func TestSignInEndpoint(t *testing.T) {
         t.Error("Expected non-empty tokens in response")
     }
 }
+
+func TestPersonalAccessTokenEndpoints(t *testing.T) {
+    router, cleanup := setupTestEnv(t)
+    defer cleanup()
+    _, tokens := signedInUser(t, router)
+
+    w := serve(router, newRequest("POST", "/auth/tokens", tokens.AccessToken, models.CreatePersonalTokenInput{Name: "ci"}))
+    if w.Code != http.StatusCreated {
+        t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+    }
+    var created models.CreatedAPIKey
+    json.Unmarshal(w.Body.Bytes(), &created)
+
+    if w := serve(router, newRequest("GET", "/protected/profile", created.Token, nil)); w.Code != http.StatusOK {
+        t.Errorf("Expected the token to be accepted, got %d: %s", w.Code, w.Body.String())
+    }
+    if w := serve(router, newRequest("POST", "/auth/tokens", created.Token, models.CreatePersonalTokenInput{Name: "more"})); w.Code != http.StatusForbidden {
+        t.Errorf("Expected a token not to create tokens, got %d", w.Code)
+    }
+    if w := serve(router, newRequest("POST", "/auth/revoke", created.Token, nil)); w.Code != http.StatusOK {
+        t.Errorf("Expected the token to revoke itself, got %d: %s", w.Code, w.Body.String())
+    }
+    if w := serve(router, newRequest("GET", "/protected/profile", created.Token, nil)); w.Code != http.StatusUnauthorized {
+        t.Errorf("Expected the revoked token to be refused, got %d", w.Code)
+    }
+}
+
+func TestAdminRefusesPersonalAccessTokens(t *testing.T) {
+    t.Setenv("OAUTH_SCOPES", "profile admin")
+    router, cleanup := setupTestEnv(t)
+    defer cleanup()
+    credentials, _ := signedInUser(t, router)
+    _, err := db.DB.Collection("users").UpdateOne(context.Background(), bson.M{"email": credentials.Email}, bson.M{"$set": bson.M{"roles": []string{"admin"}}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    var tokens models.TokenResponse
+    json.Unmarshal(serve(router, newRequest("POST", "/auth/signin", "", credentials)).Body.Bytes(), &tokens)
+
+    w := serve(router, newRequest("POST", "/auth/tokens", tokens.AccessToken, models.CreatePersonalTokenInput{Name: "ci", Scope: "profile"}))
+    if w.Code != http.StatusCreated {
+        t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+    }
+    var created models.CreatedAPIKey
+    json.Unmarshal(w.Body.Bytes(), &created)
+
+    if w := serve(router, newRequest("GET", "/admin/users", tokens.AccessToken, nil)); w.Code != http.StatusOK {
+        t.Errorf("Expected the admin's session to be accepted, got %d: %s", w.Code, w.Body.String())
+    }
+    if w := serve(router, newRequest("GET", "/admin/users", created.Token, nil)); w.Code != http.StatusForbidden {
+        t.Errorf("Expected the admin's scoped token to be refused, got %d", w.Code)
+    }
+}
+
+func TestCookieSession(t *testing.T) {
+    t.Setenv("SESSION_COOKIES", "true")
+    router, cleanup := setupTestEnv(t)
+    defer cleanup()
+    credentials, _ := signedInUser(t, router)
+
+    request := func(method, path string, cookies []*http.Cookie, csrf string, input interface{}) *httptest.ResponseRecorder {
+        req := newRequest(method, path, "", input)
+        req.Header.Set(session.ModeHeader, "cookie")
+        for _, cookie := range cookies {
+            req.AddCookie(cookie)
+        }
+        if csrf != "" {
+            req.Header.Set(session.CSRFHeader, csrf)
+        }
+        return serve(router, req)
+    }
+
+    w := request("POST", "/auth/signin", nil, "", credentials)
+    if w.Code != http.StatusOK {
+        t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+    }
+    var response map[string]string
+    json.Unmarshal(w.Body.Bytes(), &response)
+    if response["access_token"] != "" || response["csrf_token"] == "" {
+        t.Fatalf("Expected only a CSRF token in the body, got %s", w.Body.String())
+    }
+    cookies := w.Result().Cookies()
+    for _, cookie := range cookies {
+        if cookie.Name == session.RefreshCookie && cookie.Path != "/auth/refresh" {
+            t.Errorf("Expected the refresh cookie to be scoped to /auth/refresh, got %q", cookie.Path)
+        }
+        if cookie.Name != session.CSRFCookie && !cookie.HttpOnly {
+            t.Errorf("Expected cookie %s to be HttpOnly", cookie.Name)
+        }
+    }
+
+    if w := request("GET", "/protected/profile", cookies, "", nil); w.Code != http.StatusOK {
+        t.Errorf("Expected the access cookie to be accepted, got %d: %s", w.Code, w.Body.String())
+    }
+    if w := request("POST", "/auth/refresh", cookies, "", nil); w.Code != http.StatusForbidden {
+        t.Errorf("Expected a refresh without the CSRF token to be refused, got %d", w.Code)
+    }
+    if w := request("POST", "/auth/refresh", cookies, response["csrf_token"], nil); w.Code != http.StatusOK {
+        t.Errorf("Expected the refresh cookie to be accepted, got %d: %s", w.Code, w.Body.String())
+    }
+    if w := request("POST", "/auth/revoke", cookies, "", nil); w.Code != http.StatusForbidden {
+        t.Errorf("Expected a sign-out without the CSRF token to be refused, got %d", w.Code)
+    }
+}
+
+func TestForwardAuthEndpoint(t *testing.T) {
+    t.Setenv("FORWARD_AUTH_RULES", `{"login_url": "https://auth.example.com/signin", "rules": [{"host": "grafana.example.com", "public_paths": ["/public/*"], "roles": ["admin"]}, {"host": "*.example.com"}]}`)
+    router, cleanup := setupTestEnv(t)
+    defer cleanup()
+    credentials, tokens := signedInUser(t, router)
+
+    forward := func(host, uri, token, accept string) *httptest.ResponseRecorder {
+        req := newRequest("GET", "/auth/forward", token, nil)
+        req.Header.Set("X-Forwarded-Host", host)
+        req.Header.Set("X-Forwarded-Uri", uri)
+        req.Header.Set("X-Forwarded-Proto", "https")
+        if accept != "" {
+            req.Header.Set("Accept", accept)
+        }
+        return serve(router, req)
+    }
+
+    w := forward("wiki.example.com", "/pages/1", tokens.AccessToken, "")
+    if w.Code != http.StatusOK || w.Header().Get("X-User-Email") != credentials.Email {
+        t.Errorf("Expected 200 with the user's email, got %d %q", w.Code, w.Header().Get("X-User-Email"))
+    }
+    if w := forward("wiki.example.com", "/pages/1", "", ""); w.Code != http.StatusUnauthorized {
+        t.Errorf("Expected 401 without a token, got %d", w.Code)
+    }
+    w = forward("wiki.example.com", "/pages/1", "", "text/html")
+    if w.Code != http.StatusFound || w.Header().Get("Location") != "https://auth.example.com/signin?rd=https%3A%2F%2Fwiki.example.com%2Fpages%2F1" {
+        t.Errorf("Expected a browser to be sent to sign in, got %d %q", w.Code, w.Header().Get("Location"))
+    }
+    if w := forward("grafana.example.com", "/d/home", tokens.AccessToken, ""); w.Code != http.StatusForbidden {
+        t.Errorf("Expected a user without the admin role to be refused, got %d", w.Code)
+    }
+    if w := forward("grafana.example.com", "/public/logo.png", "", ""); w.Code != http.StatusOK {
+        t.Errorf("Expected a public path to need no token, got %d", w.Code)
+    }
+    if w := forward("example.org", "/", tokens.AccessToken, ""); w.Code != http.StatusForbidden {
+        t.Errorf("Expected a host without a rule to be refused, got %d", w.Code)
+    }
+    for _, uri := range []string{"/public/..%2fd/home", "/d%2f..%2fpublic/x", "/public/%2e%2e/d/home"} {
+        if w := forward("grafana.example.com", uri, "", ""); w.Code != http.StatusUnauthorized {
+            t.Errorf("Expected %q to need a token, got %d", uri, w.Code)
+        }
+    }
+
+    // Behind Traefik, X-Original-* headers come from the client
+    req := newRequest("GET", "/auth/forward", "", nil)
+    req.Header.Set("X-Forwarded-Host", "grafana.example.com")
+    req.Header.Set("X-Forwarded-Uri", "/d/home")
+    req.Header.Set("X-Original-Uri", "/public/logo.png")
+    if w := serve(router, req); w.Code != http.StatusUnauthorized {
+        t.Errorf("Expected X-Original-Uri to be ignored, got %d", w.Code)
+    }
+}
@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"github.com/SinisterSup/auth-service/internal/models"
+	"github.com/SinisterSup/auth-service/internal/policy"
+	"github.com/SinisterSup/auth-service/internal/verify"
+	"github.com/SinisterSup/auth-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleAuthzCheck answers whether the holder of the access token may
+// perform an action on a resource. A denial is still a 200; the decision is
+// in the body.
+func handleAuthzCheck(engine *policy.Engine) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var input models.AuthzCheckInput
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			ctx.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		claims, _ := ctx.MustGet("claims").(*utils.JWTClaim)
+
+		decision := engine.Decide(policy.Input{
+			Subject:  verify.Subject(claims),
+			Resource: input.Resource,
+			Action:   input.Action,
+			Context:  input.Context,
+		})
+		ctx.JSON(200, decision)
+	}
+}
@@ -0,0 +1,165 @@
+package routes
+
+import (
+	"github.com/SinisterSup/auth-service/internal/models"
+	"github.com/SinisterSup/auth-service/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func handleOIDCLogin(federationService *services.FederationService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		authURL, err := federationService.BeginLogin(ctx.Param("provider"), "")
+		if err == services.ErrUnknownProvider {
+			ctx.JSON(404, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			ctx.JSON(502, gin.H{"error": "failed to start login: " + err.Error()})
+			return
+		}
+
+		ctx.Redirect(302, authURL)
+	}
+}
+
+func handleOIDCLink(federationService *services.FederationService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		authURL, err := federationService.BeginLogin(ctx.Param("provider"), userId)
+		if err == services.ErrUnknownProvider {
+			ctx.JSON(404, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			ctx.JSON(502, gin.H{"error": "failed to start linking: " + err.Error()})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"authorization_url": authURL})
+	}
+}
+
+// handleLDAPLink links the directory account whose login and password are
+// given to the signed-in user.
+func handleLDAPLink(authService *services.AuthService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		var input models.LinkDirectoryInput
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			ctx.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		err := authService.LinkDirectory(userId, input)
+		if err == services.ErrNoDirectory {
+			ctx.JSON(404, gin.H{"error": err.Error()})
+			return
+		}
+		if err == services.ErrIdentityLinked {
+			ctx.JSON(409, gin.H{"error": err.Error()})
+			return
+		}
+		if err == services.ErrInvalidCredentials {
+			ctx.JSON(401, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			ctx.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"message": "directory account linked"})
+	}
+}
+
+func handleOIDCCallback(federationService *services.FederationService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if errCode := ctx.Query("error"); errCode != "" {
+			ctx.JSON(401, gin.H{"error": "identity provider returned " + errCode})
+			return
+		}
+
+		user, tokens, err := federationService.CompleteLogin(ctx.Param("provider"), ctx.Query("code"), ctx.Query("state"))
+		if err == services.ErrUnknownProvider {
+			ctx.JSON(404, gin.H{"error": err.Error()})
+			return
+		}
+		if err == services.ErrIdentityLinked || err == services.ErrEmailTaken || err == services.ErrLinkRequired {
+			ctx.JSON(409, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			respondSignInError(ctx, err)
+			return
+		}
+
+		if tokens == nil {
+			ctx.JSON(200, gin.H{"message": "identity linked successfully", "identities": user.Identities})
+			return
+		}
+		ctx.JSON(200, tokens)
+	}
+}
+
+func handleListIdentities(federationService *services.FederationService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		identities, err := federationService.ListIdentities(userId)
+		if err != nil {
+			ctx.JSON(404, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"identities": identities})
+	}
+}
+
+func handleUnlinkIdentity(federationService *services.FederationService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		err := federationService.UnlinkIdentity(userId, ctx.Param("provider"), ctx.Param("subject"))
+		if err == services.ErrLastSignInMethod {
+			ctx.JSON(409, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			ctx.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"message": "identity unlinked successfully"})
+	}
+}
+
+// currentUserId reads the user set by verify.AuthVerify and writes the error
+// response itself when it is missing.
+func currentUserId(ctx *gin.Context) (string, bool) {
+	userId, userExists := ctx.Get("userId")
+	if !userExists {
+		ctx.JSON(401, gin.H{"error": "user ID not found in context"})
+		return "", false
+	}
+	userIdStr, ok := userId.(string)
+	if !ok {
+		ctx.JSON(500, gin.H{"error": "invalid user ID format"})
+		return "", false
+	}
+	return userIdStr, true
+}
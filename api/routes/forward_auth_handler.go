@@ -0,0 +1,85 @@
+package routes
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/SinisterSup/auth-service/internal/forwardauth"
+	"github.com/SinisterSup/auth-service/internal/verify"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleForwardAuth answers a reverse proxy asking whether to pass on a
+// request, described by X-Forwarded-* headers (Traefik, Caddy) or
+// X-Original-* headers (Nginx auth_request), whichever config trusts. It checks the credentials the
+// request carried exactly like AuthVerify, then the rule for its host. It
+// answers 200 with the user in X-User-* headers, 401, or, for a browser that
+// is not signed in and a configured login URL, a redirect to sign in.
+func handleForwardAuth(config *forwardauth.Config) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		method := forwardedHeader(ctx, config, "Method", "GET")
+		host := forwardedHeader(ctx, config, "Host", ctx.Request.Host)
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		uri := forwardedHeader(ctx, config, "Uri", "/")
+
+		rule, ok := config.Match(host)
+		if !ok {
+			ctx.JSON(403, gin.H{"error": "host is not protected by this service"})
+			return
+		}
+		if requestPath, ok := forwardauth.RequestPath(uri); ok && rule.Public(requestPath) {
+			ctx.Status(200)
+			return
+		}
+
+		claims, _, err := verify.Authenticate(ctx, method)
+		if err != nil {
+			loginURL := config.LoginURLFor(rule)
+			if err.Status == 401 && loginURL != "" && strings.Contains(ctx.GetHeader("Accept"), "text/html") {
+				proto := forwardedHeader(ctx, config, "Proto", "https")
+				ctx.Redirect(302, withReturnTo(loginURL, proto+"://"+host+uri))
+				return
+			}
+			if err.Challenge != "" {
+				ctx.Header("WWW-Authenticate", err.Challenge)
+			}
+			ctx.JSON(err.Status, gin.H{"error": err.Message})
+			return
+		}
+		if !rule.Allows(claims) {
+			ctx.JSON(403, gin.H{"error": "access denied"})
+			return
+		}
+
+		ctx.Header("X-User-Id", claims.UserId)
+		ctx.Header("X-User-Email", claims.Email)
+		ctx.Header("X-User-Roles", strings.Join(claims.Roles, ","))
+		ctx.Status(200)
+	}
+}
+
+// forwardedHeader reads the <name> header of the original request under the
+// prefix config trusts.
+func forwardedHeader(ctx *gin.Context, config *forwardauth.Config, name, fallback string) string {
+	if value := ctx.GetHeader(config.HeaderPrefix() + name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// withReturnTo adds the address to come back to after signing in to loginURL
+// as the rd query parameter.
+func withReturnTo(loginURL, returnTo string) string {
+	u, err := url.Parse(loginURL)
+	if err != nil {
+		return loginURL
+	}
+	query := u.Query()
+	query.Set("rd", returnTo)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"github.com/SinisterSup/auth-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleJWKS publishes the public keys access tokens are signed with, for
+// services that verify tokens themselves. The set is empty while tokens are
+// signed with JWT_SECRET.
+func handleJWKS() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		keys, err := utils.JWKS()
+		if err != nil {
+			ctx.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.Header("Cache-Control", "public, max-age=300")
+		ctx.JSON(200, keys)
+	}
+}
@@ -0,0 +1,279 @@
+package routes
+
+import (
+	"github.com/SinisterSup/auth-service/internal/mail"
+	"github.com/SinisterSup/auth-service/internal/models"
+	"github.com/SinisterSup/auth-service/internal/scope"
+	"github.com/SinisterSup/auth-service/internal/services"
+	"github.com/SinisterSup/auth-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+func handleCreateOrganization(organizationService *services.OrganizationService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		var input models.CreateOrganizationInput
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			ctx.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		org, err := organizationService.Create(ctx.Request.Context(), userId, input, requestMeta(ctx))
+		if err != nil {
+			respondOrgError(ctx, err)
+			return
+		}
+
+		ctx.JSON(201, org)
+	}
+}
+
+func handleListOrganizations(organizationService *services.OrganizationService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		orgs, err := organizationService.List(ctx.Request.Context(), userId)
+		if err != nil {
+			respondOrgError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"organizations": orgs})
+	}
+}
+
+func handleListMembers(organizationService *services.OrganizationService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		members, err := organizationService.Members(ctx.Request.Context(), userId, ctx.Param("org"))
+		if err != nil {
+			respondOrgError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"members": members})
+	}
+}
+
+func handleUpdateMember(organizationService *services.OrganizationService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		var input models.UpdateMemberInput
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			ctx.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		err := organizationService.UpdateMember(ctx.Request.Context(), userId, ctx.Param("org"), ctx.Param("user"), input, requestMeta(ctx))
+		if err != nil {
+			respondOrgError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"message": "member updated"})
+	}
+}
+
+func handleRemoveMember(organizationService *services.OrganizationService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		err := organizationService.RemoveMember(ctx.Request.Context(), userId, ctx.Param("org"), ctx.Param("user"), requestMeta(ctx))
+		if err != nil {
+			respondOrgError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"message": "member removed"})
+	}
+}
+
+func handleInviteMember(organizationService *services.OrganizationService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		var input models.InviteMemberInput
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			ctx.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		invitation, err := organizationService.Invite(ctx.Request.Context(), userId, ctx.Param("org"), input, requestMeta(ctx))
+		if err != nil {
+			respondOrgError(ctx, err)
+			return
+		}
+
+		ctx.JSON(201, invitation)
+	}
+}
+
+func handleListInvitations(organizationService *services.OrganizationService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		invitations, err := organizationService.Invitations(ctx.Request.Context(), userId, ctx.Param("org"))
+		if err != nil {
+			respondOrgError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"invitations": invitations})
+	}
+}
+
+func handleRevokeInvitation(organizationService *services.OrganizationService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		err := organizationService.RevokeInvitation(ctx.Request.Context(), userId, ctx.Param("org"), ctx.Param("id"), requestMeta(ctx))
+		if err != nil {
+			respondOrgError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"message": "invitation revoked"})
+	}
+}
+
+// handleAcceptInvitation accepts an invitation for the signed-in user.
+func handleAcceptInvitation(organizationService *services.OrganizationService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		var input models.DeclineInvitationInput
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			ctx.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		membership, err := organizationService.Accept(ctx.Request.Context(), userId, input.Token, requestMeta(ctx))
+		if err != nil {
+			respondOrgError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, membership)
+	}
+}
+
+// handleAcceptInvitationSignUp accepts an invitation by creating an account
+// for the invited email, and signs the new user in.
+func handleAcceptInvitationSignUp(organizationService *services.OrganizationService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var input models.AcceptInvitationInput
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			ctx.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		input.RequestMeta = requestMeta(ctx)
+
+		tokens, err := organizationService.AcceptWithSignUp(ctx.Request.Context(), input)
+		if respondPasswordPolicyError(ctx, err) || respondHashingOverloaded(ctx, err) {
+			return
+		}
+		if err != nil {
+			respondOrgError(ctx, err)
+			return
+		}
+
+		ctx.JSON(201, tokens)
+	}
+}
+
+func handleDeclineInvitation(organizationService *services.OrganizationService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var input models.DeclineInvitationInput
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			ctx.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := organizationService.Decline(ctx.Request.Context(), input, requestMeta(ctx)); err != nil {
+			respondOrgError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"message": "invitation declined"})
+	}
+}
+
+// handleSwitchOrganization reissues the caller's tokens acting in another
+// organization, keeping the scope of the access token presented.
+func handleSwitchOrganization(organizationService *services.OrganizationService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+		claims, _ := ctx.MustGet("claims").(*utils.JWTClaim)
+
+		var input models.SwitchOrganizationInput
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			ctx.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		tokens, err := organizationService.Switch(ctx.Request.Context(), userId, scope.Parse(claims.Scope), input)
+		if err != nil {
+			respondOrgError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, tokens)
+	}
+}
+
+// respondOrgError answers a failed organization request. Invitation tokens
+// that are unknown, used or expired get 401 like other bad tokens.
+func respondOrgError(ctx *gin.Context, err error) {
+	switch err {
+	case services.ErrOrganizationNotFound, services.ErrUserNotFound, services.ErrInvitationNotFound:
+		ctx.JSON(404, gin.H{"error": err.Error()})
+		return
+	case services.ErrNotOrgMember, services.ErrOrgForbidden, services.ErrInvitationEmailMismatch, services.ErrPasswordResetRequired:
+		ctx.JSON(403, gin.H{"error": err.Error()})
+		return
+	case models.ErrInvalidOrgRole, mail.ErrInvalidAddress:
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	case services.ErrLastOwner, services.ErrAlreadyMember, services.ErrSignInToAccept:
+		ctx.JSON(409, gin.H{"error": err.Error()})
+		return
+	case services.ErrInvalidInvitation:
+		ctx.JSON(401, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(500, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,83 @@
+package routes
+
+import (
+	"log"
+
+	"github.com/SinisterSup/auth-service/internal/models"
+	"github.com/SinisterSup/auth-service/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func handleForgotPassword(resetService *services.PasswordResetService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var input models.ForgotPasswordInput
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			ctx.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		// As for magic links, a failure is only logged so the answer does
+		// not tell which emails are registered
+		if err := resetService.RequestReset(input, requestMeta(ctx)); err != nil {
+			log.Printf("Password reset request failed: %v", err)
+		}
+
+		ctx.JSON(202, gin.H{"message": "if the account exists, a password reset email has been sent"})
+	}
+}
+
+func handleResetPassword(resetService *services.PasswordResetService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var input models.ResetPasswordInput
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			ctx.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		err := resetService.ResetPassword(input, requestMeta(ctx))
+		if respondPasswordPolicyError(ctx, err) || respondHashingOverloaded(ctx, err) || respondLockout(ctx, err) {
+			return
+		}
+		if err == services.ErrInvalidResetToken {
+			ctx.JSON(401, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			ctx.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"message": "password has been reset"})
+	}
+}
+
+func handleChangePassword(authService *services.AuthService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		var input models.ChangePasswordInput
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			ctx.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		err := authService.ChangePassword(userId, input, requestMeta(ctx))
+		if respondPasswordPolicyError(ctx, err) || respondHashingOverloaded(ctx, err) {
+			return
+		}
+		if err == services.ErrInvalidCurrentPassword {
+			ctx.JSON(401, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			ctx.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"message": "password changed; sign in again with the new password"})
+	}
+}
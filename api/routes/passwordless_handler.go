@@ -0,0 +1,68 @@
+package routes
+
+import (
+	"log"
+
+	"github.com/SinisterSup/auth-service/internal/models"
+	"github.com/SinisterSup/auth-service/internal/services"
+	"github.com/SinisterSup/auth-service/internal/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+func handleRequestMagicLink(passwordlessService *services.PasswordlessService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var input models.MagicLinkInput
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			ctx.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		input.RequestMeta = requestMeta(ctx)
+
+		// A failure is only logged: failing only for registered emails would
+		// tell callers which emails are registered.
+		if err := passwordlessService.RequestMagicLink(input); err != nil {
+			log.Printf("Magic link request failed: %v", err)
+		}
+
+		ctx.JSON(202, gin.H{"message": "if the email is registered, a sign-in link and code have been sent"})
+	}
+}
+
+func handleVerifyMagicLink(passwordlessService *services.PasswordlessService, sessions *session.Config) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var input models.MagicLinkVerifyInput
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			ctx.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		input.RequestMeta = requestMeta(ctx)
+
+		tokens, err := passwordlessService.VerifyMagicLink(input)
+		if err != nil {
+			respondSignInError(ctx, err)
+			return
+		}
+
+		respondTokens(ctx, sessions, tokens, sessions.Requested(ctx.Request))
+	}
+}
+
+func handleVerifyOTP(passwordlessService *services.PasswordlessService, sessions *session.Config) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var input models.OTPVerifyInput
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			ctx.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		input.RequestMeta = requestMeta(ctx)
+
+		tokens, err := passwordlessService.VerifyOTP(input)
+		if err != nil {
+			respondSignInError(ctx, err)
+			return
+		}
+
+		respondTokens(ctx, sessions, tokens, sessions.Requested(ctx.Request))
+	}
+}
@@ -1,26 +1,165 @@
 package routes
 
 import (
+	"expvar"
+	"log"
+	"os"
+	"slices"
+
+	"github.com/SinisterSup/auth-service/internal/forwardauth"
+	"github.com/SinisterSup/auth-service/internal/mail"
+	"github.com/SinisterSup/auth-service/internal/oidc"
+	"github.com/SinisterSup/auth-service/internal/policy"
+	"github.com/SinisterSup/auth-service/internal/ratelimit"
+	"github.com/SinisterSup/auth-service/internal/saml"
+	"github.com/SinisterSup/auth-service/internal/session"
 	"github.com/SinisterSup/auth-service/internal/verify"
 	"github.com/SinisterSup/auth-service/internal/services"
+	"github.com/SinisterSup/auth-service/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetupAuthRoutes(router *gin.Engine) {
-	authService := services.NewAuthService()
+// SetupAuthRoutes serves the REST API on router. The auth service, mailer and
+// rate limiter, which may be nil, are shared with the gRPC server.
+func SetupAuthRoutes(router *gin.Engine, authService *services.AuthService, mailer mail.Mailer, limiter *ratelimit.Limiter) {
+	passwordlessService := services.NewPasswordlessService(authService, mailer)
+	passwordResetService := services.NewPasswordResetService(authService, mailer)
+	registrationService := services.NewRegistrationService(authService, mailer)
+	accountService := services.NewAccountService(authService)
+	adminService := services.NewAdminService(accountService, passwordResetService)
+	federationService := services.NewFederationService(authService, oidc.LoadConfigsFromEnv(), saml.LoadConfigsFromEnv())
+	tenantService := services.NewTenantService()
+	organizationService := services.NewOrganizationService(authService, mailer)
+	apiKeyService := services.NewAPIKeyService(authService)
+	verify.AcceptAPIKeys(apiKeyService)
+	tenantStrategies, tenantHeader := tenantResolution()
 
-	auth := router.Group("/auth")
-	{
-		auth.POST("/signup", handleSignUp(authService))
-		auth.POST("/signin", handleSignIn(authService))
-		auth.POST("/refresh", handleRefreshToken(authService))
-		auth.POST("/revoke", verify.AuthVerify(), handleRevokeToken(authService))
+	policies, err := policy.LoadFromEnv()
+	if err != nil {
+		log.Fatalf("Authorization policies: %v", err)
+	}
+	sessions, err := session.LoadConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Session cookies: %v", err)
 	}
+	forwardAuth, err := forwardauth.LoadConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Forward auth: %v", err)
+	}
+	if _, err := utils.JWKS(); err != nil {
+		log.Fatalf("Signing keys: %v", err)
+	}
+
+	// Auth routes are also served under /t/:tenant when tenants may be named
+	// in the path
+	authRoutes := func(group *gin.RouterGroup) {
+		// The proxy asks about every request from its own address, so forward
+		// auth is not rate limited, or all users behind it would share one limit
+		group.GET("/forward", resolveTenant(tenantService, tenantStrategies, tenantHeader), handleForwardAuth(forwardAuth))
 
-	protected := router.Group("/protected")
-	protected.Use(verify.AuthVerify())
+		auth := group.Group("", limiter.Middleware(), resolveTenant(tenantService, tenantStrategies, tenantHeader))
+		auth.POST("/signup", handleSignUp(registrationService))
+		auth.POST("/signup/verify", handleVerifyEmail(registrationService))
+		auth.POST("/signin", handleSignIn(authService, passwordlessService, sessions))
+		auth.POST("/refresh", handleRefreshToken(authService, sessions))
+		auth.POST("/revoke", verify.AuthVerify(), handleRevokeToken(authService, apiKeyService, sessions))
+		auth.POST("/password/forgot", handleForgotPassword(passwordResetService))
+		auth.POST("/password/reset", handleResetPassword(passwordResetService))
+		auth.POST("/password/change", verify.AuthVerify(), handleChangePassword(authService))
+		auth.POST("/magic-link", handleRequestMagicLink(passwordlessService))
+		auth.POST("/magic-link/verify", handleVerifyMagicLink(passwordlessService, sessions))
+		auth.POST("/otp/verify", handleVerifyOTP(passwordlessService, sessions))
+		auth.GET("/oidc/:provider/login", defaultTenantOnly(), handleOIDCLogin(federationService))
+		auth.GET("/oidc/:provider/callback", defaultTenantOnly(), handleOIDCCallback(federationService))
+		auth.POST("/oidc/:provider/link", defaultTenantOnly(), verify.AuthVerify(), handleOIDCLink(federationService))
+		auth.POST("/ldap/link", defaultTenantOnly(), verify.AuthVerify(), verify.RequireSession(), handleLDAPLink(authService))
+		auth.GET("/saml/:provider/metadata", defaultTenantOnly(), handleSAMLMetadata(federationService))
+		auth.GET("/saml/:provider/login", defaultTenantOnly(), handleSAMLLogin(federationService))
+		auth.POST("/saml/:provider/acs", defaultTenantOnly(), handleSAMLACS(federationService))
+		auth.GET("/identities", verify.AuthVerify(), handleListIdentities(federationService))
+		auth.DELETE("/identities/:provider/:subject", verify.AuthVerify(), handleUnlinkIdentity(federationService))
+		auth.DELETE("/account", verify.AuthVerify(), verify.RequireSession(), handleDeleteAccount(accountService))
+		auth.GET("/account/export", verify.AuthVerify(), handleExportAccount(accountService))
+		auth.POST("/invitations/accept", handleAcceptInvitationSignUp(organizationService))
+		auth.POST("/invitations/decline", handleDeclineInvitation(organizationService))
+		auth.POST("/tokens", verify.AuthVerify(), verify.RequireSession(), handleCreatePersonalToken(apiKeyService))
+		auth.GET("/tokens", verify.AuthVerify(), handleListPersonalTokens(apiKeyService))
+		auth.DELETE("/tokens/:id", verify.AuthVerify(), handleRevokePersonalToken(apiKeyService))
+	}
+	authRoutes(router.Group("/auth"))
+	if slices.Contains(tenantStrategies, tenantFromPath) {
+		authRoutes(router.Group("/t/:tenant/auth"))
+	}
+
+	orgRoutes := func(orgs *gin.RouterGroup) {
+		orgs.Use(limiter.Middleware(), resolveTenant(tenantService, tenantStrategies, tenantHeader), verify.AuthVerify())
+		orgs.POST("", handleCreateOrganization(organizationService))
+		orgs.GET("", handleListOrganizations(organizationService))
+		orgs.POST("/switch", verify.RequireSession(), handleSwitchOrganization(organizationService))
+		orgs.POST("/invitations/accept", handleAcceptInvitation(organizationService))
+		orgs.GET("/:org/members", handleListMembers(organizationService))
+		orgs.PUT("/:org/members/:user", handleUpdateMember(organizationService))
+		orgs.DELETE("/:org/members/:user", handleRemoveMember(organizationService))
+		orgs.POST("/:org/invitations", handleInviteMember(organizationService))
+		orgs.GET("/:org/invitations", handleListInvitations(organizationService))
+		orgs.DELETE("/:org/invitations/:id", handleRevokeInvitation(organizationService))
+	}
+	orgRoutes(router.Group("/orgs"))
+	if slices.Contains(tenantStrategies, tenantFromPath) {
+		orgRoutes(router.Group("/t/:tenant/orgs"))
+	}
+
+	authzRoutes := func(authz *gin.RouterGroup) {
+		authz.Use(resolveTenant(tenantService, tenantStrategies, tenantHeader), verify.AuthVerify())
+		authz.POST("/check", handleAuthzCheck(policies))
+	}
+	authzRoutes(router.Group("/authz"))
+	if slices.Contains(tenantStrategies, tenantFromPath) {
+		authzRoutes(router.Group("/t/:tenant/authz"))
+	}
+
+	admin := router.Group("/admin")
+	// API keys never reach the admin API, or a narrowly scoped personal token
+	// of an admin would carry all of it
+	admin.Use(verify.AuthVerify(), verify.RequireSession(), verify.RequireRole("admin"))
 	{
+		admin.GET("/users", handleSearchUsers(adminService))
+		admin.GET("/users/:id", handleGetUser(adminService))
+		admin.POST("/users/:id/disable", handleDisableUser(adminService))
+		admin.POST("/users/:id/enable", handleEnableUser(adminService))
+		admin.PUT("/users/:id/status", handleSetUserStatus(adminService))
+		admin.POST("/users/:id/unlock", handleUnlockUser(adminService))
+		admin.POST("/users/:id/force-password-reset", handleForcePasswordReset(adminService))
+		admin.POST("/users/:id/logout", handleForceLogout(adminService))
+		admin.PUT("/users/:id/roles", handleUpdateRoles(adminService))
+		admin.PUT("/users/:id/permissions", handleUpdatePermissions(adminService))
+		admin.DELETE("/users/:id", handleAdminDeleteUser(adminService))
+		admin.GET("/users/:id/audit", handleUserAudit(adminService))
+		admin.DELETE("/lockouts/:ip", handleUnlockIP(adminService))
+		admin.GET("/roles", handleListRoles(adminService))
+		admin.PUT("/roles/:name", handlePutRole(adminService))
+		admin.DELETE("/roles/:name", handleDeleteRole(adminService))
+		admin.GET("/tenants", handleListTenants(adminService))
+		admin.PUT("/tenants/:id", handlePutTenant(adminService))
+		admin.DELETE("/tenants/:id", handleDeleteTenant(adminService))
+		admin.GET("/api-keys", handleListAPIKeys(apiKeyService))
+		admin.POST("/api-keys", handleCreateServiceKey(apiKeyService))
+		admin.DELETE("/api-keys/:id", handleAdminRevokeAPIKey(apiKeyService))
+	}
+
+	router.GET("/.well-known/jwks.json", handleJWKS())
+
+	if os.Getenv("EXPOSE_METRICS") == "true" {
+		router.GET("/debug/vars", gin.WrapH(expvar.Handler()))
+	}
+
+	protectedRoutes := func(protected *gin.RouterGroup) {
+		protected.Use(resolveTenant(tenantService, tenantStrategies, tenantHeader), verify.AuthVerify())
 		protected.GET("/profile", handleProfile())
 	}
+	protectedRoutes(router.Group("/protected"))
+	if slices.Contains(tenantStrategies, tenantFromPath) {
+		protectedRoutes(router.Group("/t/:tenant/protected"))
+	}
 }
\ No newline at end of file
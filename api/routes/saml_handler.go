@@ -0,0 +1,59 @@
+package routes
+
+import (
+	"github.com/SinisterSup/auth-service/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func handleSAMLMetadata(federationService *services.FederationService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		metadata, err := federationService.SAMLMetadata(ctx.Param("provider"))
+		if err == services.ErrUnknownProvider {
+			ctx.JSON(404, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			ctx.JSON(500, gin.H{"error": "failed to build metadata"})
+			return
+		}
+
+		ctx.Data(200, "application/samlmetadata+xml", metadata)
+	}
+}
+
+func handleSAMLLogin(federationService *services.FederationService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		redirectURL, err := federationService.BeginSAMLLogin(ctx.Param("provider"))
+		if err == services.ErrUnknownProvider {
+			ctx.JSON(404, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			ctx.JSON(502, gin.H{"error": "failed to start login: " + err.Error()})
+			return
+		}
+
+		ctx.Redirect(302, redirectURL)
+	}
+}
+
+func handleSAMLACS(federationService *services.FederationService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		tokens, err := federationService.CompleteSAMLLogin(ctx.Param("provider"), ctx.Request)
+		if err == services.ErrUnknownProvider {
+			ctx.JSON(404, gin.H{"error": err.Error()})
+			return
+		}
+		if err == services.ErrIdentityLinked || err == services.ErrEmailTaken || err == services.ErrLinkRequired {
+			ctx.JSON(409, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			respondSignInError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, tokens)
+	}
+}
@@ -0,0 +1,63 @@
+package routes
+
+import (
+	"strings"
+
+	"github.com/SinisterSup/auth-service/internal/models"
+	"github.com/SinisterSup/auth-service/internal/session"
+	"github.com/SinisterSup/auth-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondTokens answers a successful sign-in or refresh. A client that asked
+// for a cookie session gets the tokens as cookies, and only the scope and a
+// CSRF token in the body.
+func respondTokens(ctx *gin.Context, sessions *session.Config, tokens *models.TokenResponse, cookies bool) {
+	if !cookies {
+		ctx.JSON(200, tokens)
+		return
+	}
+
+	claims, err := utils.ValidateTokenWithOptions(tokens.AccessToken, true)
+	if err != nil {
+		ctx.JSON(500, gin.H{"error": "failed to read issued token"})
+		return
+	}
+	csrf, err := session.NewCSRFToken(claims.UserId)
+	if err != nil {
+		ctx.JSON(500, gin.H{"error": "failed to create CSRF token"})
+		return
+	}
+	cookie := session.Tokens{
+		Access:      tokens.AccessToken,
+		Refresh:     tokens.RefreshToken,
+		RefreshPath: refreshPath(ctx),
+		CSRF:        csrf,
+	}
+	if _, expiresAt := utils.TokenLifetime(tokens.AccessToken); expiresAt != nil {
+		cookie.AccessExpires = *expiresAt
+	}
+	if _, expiresAt := utils.TokenLifetime(tokens.RefreshToken); expiresAt != nil {
+		cookie.RefreshExpires = *expiresAt
+	}
+	sessions.SetTokens(ctx.Writer, cookie)
+
+	ctx.JSON(200, gin.H{"scope": tokens.Scope, "csrf_token": csrf})
+}
+
+// refreshPath is the path of the refresh route next to the current one, so
+// the refresh cookie is scoped right under /t/:tenant/auth as well.
+func refreshPath(ctx *gin.Context) string {
+	path := ctx.Request.URL.Path
+	if i := strings.LastIndex(path, "/auth/"); i >= 0 {
+		return path[:i] + "/auth/refresh"
+	}
+	return "/auth/refresh"
+}
+
+// usesSessionCookies reports whether the request authenticated with the
+// access token cookie rather than a bearer token.
+func usesSessionCookies(ctx *gin.Context) bool {
+	return ctx.GetHeader("Authorization") == ""
+}
@@ -0,0 +1,156 @@
+package routes
+
+import (
+	"log"
+	"os"
+	"strings"
+
+	"github.com/SinisterSup/auth-service/internal/models"
+	"github.com/SinisterSup/auth-service/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	tenantFromPath   = "path"
+	tenantFromHeader = "header"
+	tenantFromHost   = "host"
+)
+
+// tenantResolution reads TENANT_RESOLUTION, the comma-separated order in
+// which requests are matched to a tenant, and TENANT_HEADER.
+func tenantResolution() (strategies []string, header string) {
+	value := os.Getenv("TENANT_RESOLUTION")
+	if value == "" {
+		value = "path,header,host"
+	}
+	for _, strategy := range strings.Split(value, ",") {
+		switch strategy = strings.TrimSpace(strategy); strategy {
+		case tenantFromPath, tenantFromHeader, tenantFromHost:
+			strategies = append(strategies, strategy)
+		case "", "none":
+		default:
+			log.Fatalf("TENANT_RESOLUTION: unknown strategy %q", strategy)
+		}
+	}
+
+	header = os.Getenv("TENANT_HEADER")
+	if header == "" {
+		header = "X-Tenant-ID"
+	}
+	return strategies, header
+}
+
+// resolveTenant sets "tenantId" to the tenant a request is for: the first of
+// the /t/:tenant path prefix, the tenant header and a tenant's host name that
+// applies, in the configured order. A tenant named in the path or header must
+// exist; requests that match none are for the default tenant.
+func resolveTenant(tenantService *services.TenantService, strategies []string, header string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		for _, strategy := range strategies {
+			var id string
+			switch strategy {
+			case tenantFromPath:
+				id = ctx.Param("tenant")
+			case tenantFromHeader:
+				id = ctx.GetHeader(header)
+			case tenantFromHost:
+				tenant, err := tenantService.ByHost(ctx.Request.Context(), ctx.Request.Host)
+				if err == services.ErrTenantNotFound {
+					continue
+				}
+				if err != nil {
+					ctx.JSON(500, gin.H{"error": err.Error()})
+					ctx.Abort()
+					return
+				}
+				id = tenant.ID
+			}
+			if id == "" {
+				continue
+			}
+
+			if _, err := tenantService.Get(ctx.Request.Context(), id); err != nil {
+				code := 500
+				if err == services.ErrTenantNotFound {
+					code = 404
+				}
+				ctx.JSON(code, gin.H{"error": err.Error()})
+				ctx.Abort()
+				return
+			}
+			ctx.Set("tenantId", id)
+			break
+		}
+		ctx.Next()
+	}
+}
+
+// defaultTenantOnly guards sign-in methods that only serve the default
+// tenant, such as federated identity providers.
+func defaultTenantOnly() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.GetString("tenantId") != models.DefaultTenant {
+			ctx.JSON(404, gin.H{"error": services.ErrUnknownProvider.Error()})
+			ctx.Abort()
+			return
+		}
+		ctx.Next()
+	}
+}
+
+func handleListTenants(adminService *services.AdminService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		actorId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		tenants, err := adminService.ListTenants(actorId, requestMeta(ctx))
+		if err != nil {
+			ctx.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"tenants": tenants})
+	}
+}
+
+func handlePutTenant(adminService *services.AdminService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		actorId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		var input models.TenantInput
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			ctx.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		tenant, err := adminService.PutTenant(actorId, ctx.Param("id"), input, requestMeta(ctx))
+		if err != nil {
+			respondAdminError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, tenant)
+	}
+}
+
+func handleDeleteTenant(adminService *services.AdminService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		actorId, ok := currentUserId(ctx)
+		if !ok {
+			return
+		}
+
+		if err := adminService.DeleteTenant(actorId, ctx.Param("id"), requestMeta(ctx)); err != nil {
+			respondAdminError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"message": "tenant deleted"})
+	}
+}
@@ -0,0 +1,229 @@
+// Package rpc serves the auth API over gRPC, as defined in
+// api/proto/auth/v1/auth.proto, for services that do not speak REST. It is
+// backed by the same services as the REST handlers in api/routes.
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	authv1 "github.com/SinisterSup/auth-service/api/proto/auth/v1"
+	"github.com/SinisterSup/auth-service/internal/mail"
+	"github.com/SinisterSup/auth-service/internal/models"
+	"github.com/SinisterSup/auth-service/internal/passwordhash"
+	"github.com/SinisterSup/auth-service/internal/passwordpolicy"
+	"github.com/SinisterSup/auth-service/internal/ratelimit"
+	"github.com/SinisterSup/auth-service/internal/scope"
+	"github.com/SinisterSup/auth-service/internal/services"
+	"github.com/SinisterSup/auth-service/internal/verify"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// TenantMetadata names the tenant of a call, like the tenant header of the
+// REST API.
+const TenantMetadata = "x-tenant-id"
+
+// publicMethods may be called without a token.
+var publicMethods = []string{"SignUp", "SignIn", "Refresh", "ValidateToken"}
+
+type Server struct {
+	authv1.UnimplementedAuthServiceServer
+	authService         *services.AuthService
+	registrationService *services.RegistrationService
+	passwordlessService *services.PasswordlessService
+	apiKeyService       *services.APIKeyService
+	tenantService       *services.TenantService
+}
+
+func NewServer(authService *services.AuthService, registrationService *services.RegistrationService, passwordlessService *services.PasswordlessService, apiKeyService *services.APIKeyService, tenantService *services.TenantService) *Server {
+	return &Server{
+		authService:         authService,
+		registrationService: registrationService,
+		passwordlessService: passwordlessService,
+		apiKeyService:       apiKeyService,
+		tenantService:       tenantService,
+	}
+}
+
+// Register adds the auth service to server, which must have been created
+// with Interceptors.
+func (s *Server) Register(server *grpc.Server) {
+	authv1.RegisterAuthServiceServer(server, s)
+}
+
+// restRoutes maps methods to the REST routes whose rate limits they share.
+var restRoutes = map[string]string{
+	authv1.AuthService_SignUp_FullMethodName:     "POST /auth/signup",
+	authv1.AuthService_SignIn_FullMethodName:     "POST /auth/signin",
+	authv1.AuthService_Refresh_FullMethodName:    "POST /auth/refresh",
+	authv1.AuthService_Revoke_FullMethodName:     "POST /auth/revoke",
+	authv1.AuthService_GetProfile_FullMethodName: "GET /protected/profile",
+}
+
+// Interceptors rate limits calls to the auth service with limiter, which may
+// be nil, then resolves their tenant and authenticates them, as the REST
+// routes do.
+func (s *Server) Interceptors(limiter *ratelimit.Limiter) grpc.ServerOption {
+	return grpc.ChainUnaryInterceptor(
+		limiter.UnaryInterceptor(restRoutes),
+		s.resolveTenant,
+		verify.UnaryAuthInterceptor(authv1.AuthService_ServiceDesc.ServiceName, publicMethods...),
+	)
+}
+
+func (s *Server) resolveTenant(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !strings.HasPrefix(info.FullMethod, "/"+authv1.AuthService_ServiceDesc.ServiceName+"/") {
+		return handler(ctx, req)
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	tenant := firstValue(md, TenantMetadata)
+	if tenant != "" {
+		if _, err := s.tenantService.Get(ctx, tenant); err != nil {
+			if err == services.ErrTenantNotFound {
+				return nil, status.Error(codes.NotFound, err.Error())
+			}
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+	return handler(verify.ContextWithTenant(ctx, tenant), req)
+}
+
+func (s *Server) SignUp(ctx context.Context, req *authv1.SignUpRequest) (*authv1.SignUpResponse, error) {
+	err := s.registrationService.Register(ctx, models.SignUpInput{Email: req.Email, Password: req.Password, RequestMeta: requestMeta(ctx)})
+	if err != nil {
+		var policyErr *passwordpolicy.ViolationError
+		if errors.As(err, &policyErr) || err == mail.ErrInvalidAddress {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, passwordhash.ErrSaturated) {
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "failed to send verification email")
+	}
+	return &authv1.SignUpResponse{Message: "check your email to finish signing up"}, nil
+}
+
+func (s *Server) SignIn(ctx context.Context, req *authv1.SignInRequest) (*authv1.SignInResponse, error) {
+	tokens, err := s.authService.SignInContext(ctx, models.SignInInput{Email: req.Email, Password: req.Password, Scope: req.Scope, RequestMeta: requestMeta(ctx)})
+	var mfa *services.MFARequiredError
+	if errors.As(err, &mfa) {
+		if err := s.passwordlessService.SendSecondFactor(ctx, mfa); err != nil {
+			return nil, status.Error(codes.Internal, "failed to send sign-in code")
+		}
+		return &authv1.SignInResponse{MfaRequired: true}, nil
+	}
+	if err != nil {
+		return nil, signInError(err)
+	}
+	return &authv1.SignInResponse{Tokens: tokenResponse(tokens)}, nil
+}
+
+func (s *Server) Refresh(ctx context.Context, req *authv1.RefreshRequest) (*authv1.TokenResponse, error) {
+	if req.RefreshToken == "" {
+		return nil, status.Error(codes.InvalidArgument, "refresh_token is required")
+	}
+	tokens, err := s.authService.Refresh(models.RefreshTokenInput{RefreshToken: req.RefreshToken, Scope: req.Scope, RequestMeta: requestMeta(ctx)})
+	if err != nil {
+		return nil, signInError(err)
+	}
+	return tokenResponse(tokens), nil
+}
+
+// Revoke revokes the token the call was made with. An API key is revoked for
+// good.
+func (s *Server) Revoke(ctx context.Context, req *authv1.RevokeRequest) (*authv1.RevokeResponse, error) {
+	claims, token, _ := verify.ClaimsFromContext(ctx)
+	if claims.KeyID != "" {
+		if err := s.apiKeyService.Revoke(ctx, "", claims.KeyID, requestMeta(ctx)); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		return &authv1.RevokeResponse{Message: "API key revoked successfully"}, nil
+	}
+	if err := s.authService.RevokeToken(claims.UserId, token); err != nil {
+		return nil, status.Error(codes.Internal, "failed to revoke token: "+err.Error())
+	}
+	return &authv1.RevokeResponse{Message: "token revoked successfully"}, nil
+}
+
+// ValidateToken accepts what the interceptor would accept in the
+// authorization metadata, in the call's tenant.
+func (s *Server) ValidateToken(ctx context.Context, req *authv1.ValidateTokenRequest) (*authv1.ValidateTokenResponse, error) {
+	meta := requestMeta(ctx)
+	claims, authErr := verify.CheckBearer(ctx, req.Token, meta.IP, meta.TenantID)
+	if authErr != nil {
+		code := codes.Unauthenticated
+		if authErr.Status == 403 {
+			code = codes.PermissionDenied
+		}
+		return nil, status.Error(code, authErr.Message)
+	}
+
+	response := &authv1.ValidateTokenResponse{
+		UserId:      claims.UserId,
+		Email:       claims.Email,
+		Roles:       claims.Roles,
+		Permissions: claims.Permissions,
+		Scope:       claims.Scope,
+		Tenant:      claims.Tenant,
+		Org:         claims.Org,
+		OrgRole:     claims.OrgRole,
+	}
+	if claims.ExpiresAt != nil {
+		response.ExpiresAt = timestamppb.New(claims.ExpiresAt.Time)
+	}
+	return response, nil
+}
+
+func (s *Server) GetProfile(ctx context.Context, req *authv1.GetProfileRequest) (*authv1.Profile, error) {
+	claims, _, _ := verify.ClaimsFromContext(ctx)
+	return &authv1.Profile{UserId: claims.UserId, Email: claims.Email}, nil
+}
+
+// signInError maps a failed sign-in or refresh to a status the way
+// respondSignInError maps it to an HTTP answer.
+func signInError(err error) error {
+	var lockout *services.LockoutError
+	switch {
+	case errors.Is(err, passwordhash.ErrSaturated):
+		return status.Error(codes.Unavailable, err.Error())
+	case err == scope.ErrInvalidScope:
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.As(err, &lockout):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, models.ErrAccountInactive), err == services.ErrPasswordResetRequired:
+		return status.Error(codes.PermissionDenied, err.Error())
+	case err == services.ErrLinkRequired:
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return status.Error(codes.Unauthenticated, err.Error())
+}
+
+func tokenResponse(tokens *models.TokenResponse) *authv1.TokenResponse {
+	return &authv1.TokenResponse{AccessToken: tokens.AccessToken, RefreshToken: tokens.RefreshToken, Scope: tokens.Scope}
+}
+
+func requestMeta(ctx context.Context) models.RequestMeta {
+	meta := models.RequestMeta{TenantID: verify.TenantFromContext(ctx)}
+	if p, ok := peer.FromContext(ctx); ok {
+		meta.IP, _, _ = net.SplitHostPort(p.Addr.String())
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		meta.UserAgent = firstValue(md, "user-agent")
+	}
+	return meta
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
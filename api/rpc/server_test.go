@@ -0,0 +1,119 @@
+package rpc
+
+import (
+    "context"
+    "net"
+    "os"
+    "testing"
+
+    authv1 "github.com/SinisterSup/auth-service/api/proto/auth/v1"
+    "github.com/SinisterSup/auth-service/db"
+    "github.com/SinisterSup/auth-service/internal/mail"
+    "github.com/SinisterSup/auth-service/internal/models"
+    "github.com/SinisterSup/auth-service/internal/services"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/credentials/insecure"
+    "google.golang.org/grpc/metadata"
+    "google.golang.org/grpc/status"
+    "google.golang.org/grpc/test/bufconn"
+)
+
+func setupTestServer(t *testing.T) (authv1.AuthServiceClient, func()) {
+    os.Setenv("JWT_SECRET", "CFRVAbtWMSrDdQbh9WOFUGGPsfsGasHKsaikAspYL6HRLE")
+    os.Setenv("JWT_EXPIRY", "24h")
+    os.Setenv("PASSWORD_MIN_SCORE", "0")
+
+    ctx := context.Background()
+    client, err := mongo.Connect(ctx, options.Client().ApplyURI("mongodb://localhost:27017"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    db.DB = client.Database("auth_service_test")
+    if err := db.EnsureIndexes(ctx); err != nil {
+        t.Fatal(err)
+    }
+
+    authService := services.NewAuthService()
+    os.Setenv("MAIL_BACKEND", "log")
+    mailer, err := mail.NewMailer()
+    if err != nil {
+        t.Fatal(err)
+    }
+    authServer := NewServer(authService, services.NewRegistrationService(authService, mailer), services.NewPasswordlessService(authService, mailer), services.NewAPIKeyService(authService), services.NewTenantService())
+    server := grpc.NewServer(authServer.Interceptors(nil))
+    authServer.Register(server)
+    listener := bufconn.Listen(1 << 20)
+    go server.Serve(listener)
+
+    conn, err := grpc.NewClient("passthrough:///bufnet",
+        grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+        grpc.WithTransportCredentials(insecure.NewCredentials()))
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    cleanup := func() {
+        conn.Close()
+        server.Stop()
+        if err := db.DB.Drop(ctx); err != nil {
+            t.Logf("Failed to drop test database: %v", err)
+        }
+        if err := client.Disconnect(ctx); err != nil {
+            t.Logf("Failed to disconnect test client: %v", err)
+        }
+    }
+    return authv1.NewAuthServiceClient(conn), cleanup
+}
+
+func TestAuthService(t *testing.T) {
+    client, cleanup := setupTestServer(t)
+    defer cleanup()
+    ctx := context.Background()
+
+    if _, err := client.SignUp(ctx, &authv1.SignUpRequest{Email: "test@example.com", Password: "password123"}); err != nil {
+        t.Fatal(err)
+    }
+    _, err := db.DB.Collection("users").UpdateOne(ctx, bson.M{"email": "test@example.com"}, bson.M{"$set": bson.M{"status": models.StatusActive}})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if _, err := client.SignIn(ctx, &authv1.SignInRequest{Email: "test@example.com", Password: "wrong"}); status.Code(err) != codes.Unauthenticated {
+        t.Errorf("Expected a wrong password to be refused, got %v", err)
+    }
+    signIn, err := client.SignIn(ctx, &authv1.SignInRequest{Email: "test@example.com", Password: "password123"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    authed := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+signIn.Tokens.AccessToken)
+
+    if _, err := client.GetProfile(ctx, &authv1.GetProfileRequest{}); status.Code(err) != codes.Unauthenticated {
+        t.Errorf("Expected GetProfile without a token to be refused, got %v", err)
+    }
+    profile, err := client.GetProfile(authed, &authv1.GetProfileRequest{})
+    if err != nil || profile.Email != "test@example.com" {
+        t.Errorf("Expected the profile, got %v, %v", profile, err)
+    }
+
+    validated, err := client.ValidateToken(ctx, &authv1.ValidateTokenRequest{Token: signIn.Tokens.AccessToken})
+    if err != nil || validated.UserId != profile.UserId || validated.ExpiresAt == nil {
+        t.Errorf("Expected the token to be described, got %v, %v", validated, err)
+    }
+    if _, err := client.Refresh(ctx, &authv1.RefreshRequest{RefreshToken: signIn.Tokens.RefreshToken}); err != nil {
+        t.Errorf("Expected the refresh token to be accepted, got %v", err)
+    }
+
+    if _, err := client.Revoke(authed, &authv1.RevokeRequest{}); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := client.GetProfile(authed, &authv1.GetProfileRequest{}); status.Code(err) != codes.Unauthenticated {
+        t.Errorf("Expected the revoked token to be refused, got %v", err)
+    }
+    if _, err := client.ValidateToken(ctx, &authv1.ValidateTokenRequest{Token: signIn.Tokens.AccessToken}); status.Code(err) != codes.Unauthenticated {
+        t.Errorf("Expected the revoked token not to validate, got %v", err)
+    }
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EmailCollation compares emails case-insensitively. The unique email index
+// uses it, so "Ann@example.com" and "ann@example.com" can never both exist in
+// one tenant even if a writer skips normalization.
+var EmailCollation = &options.Collation{Locale: "en", Strength: 2}
+
+// indexes lists the indexes each collection needs. Token collections expire
+// their documents through a TTL index on expires_at.
+var indexes = map[string][]mongo.IndexModel{
+	"users": {
+		// Users of the default tenant have no tenant_id, which indexes as null,
+		// so their emails are unique among themselves as before.
+		{
+			Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "email", Value: 1}},
+			Options: options.Index().SetName("tenant_email_unique").SetUnique(true).SetCollation(EmailCollation),
+		},
+		// Queries only use a collated index when they pass the same collation;
+		// emails are stored normalized, so plain lookups use this one.
+		{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "email", Value: 1}}, Options: options.Index().SetName("tenant_email")},
+		{Keys: bson.D{{Key: "identities.provider", Value: 1}, {Key: "identities.subject", Value: 1}}},
+		{Keys: bson.D{{Key: "purge_after", Value: 1}}, Options: options.Index().SetSparse(true)},
+	},
+	"password_resets": {
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	},
+	"email_verifications": {
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	},
+	"login_challenges": {
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}},
+		{Keys: bson.D{{Key: "email", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	},
+	"oidc_states": {
+		{Keys: bson.D{{Key: "state", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	},
+	"saml_requests": {
+		{Keys: bson.D{{Key: "relay_state", Value: 1}, {Key: "provider", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	},
+	"tenants": {
+		{Keys: bson.D{{Key: "hosts", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)},
+	},
+	"organizations": {
+		{Keys: bson.D{{Key: "tenant_id", Value: 1}}},
+	},
+	"memberships": {
+		{Keys: bson.D{{Key: "org_id", Value: 1}, {Key: "user_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+	},
+	"invitations": {
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "org_id", Value: 1}, {Key: "email", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	},
+	"api_keys": {
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	},
+	"audit_events": {
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetSparse(true)},
+	},
+	"login_attempts": {
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	},
+	"rate_limits": {
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	},
+}
+
+// obsoleteIndexes lists indexes that earlier versions created and that the
+// ones above replace. email_unique in particular keeps an email to a single
+// tenant.
+var obsoleteIndexes = map[string][]string{
+	"users": {"email_unique", "email"},
+}
+
+// EnsureIndexes creates any missing indexes and drops obsolete ones. Existing
+// indexes are left alone, so it is safe to run on every start. It fails if
+// existing data breaks a unique index, for example two accounts in a tenant
+// whose emails differ only in case.
+func EnsureIndexes(ctx context.Context) error {
+	for collection, models := range indexes {
+		if _, err := DB.Collection(collection).Indexes().CreateMany(ctx, models); err != nil {
+			return fmt.Errorf("failed to create indexes on %s: %v", collection, err)
+		}
+	}
+	for collection, names := range obsoleteIndexes {
+		for _, name := range names {
+			_, err := DB.Collection(collection).Indexes().DropOne(ctx, name)
+			var cmdErr mongo.CommandError
+			if errors.As(err, &cmdErr) && (cmdErr.Name == "IndexNotFound" || cmdErr.Name == "NamespaceNotFound") {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to drop index %s on %s: %v", name, collection, err)
+			}
+		}
+	}
+	return nil
+}
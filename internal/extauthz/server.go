@@ -0,0 +1,102 @@
+// Package extauthz serves Envoy's external authorization API over gRPC, so
+// a service mesh can check requests with this service without an HTTP hop
+// through the forward-auth endpoint.
+package extauthz
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/SinisterSup/auth-service/internal/verify"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// TenantExtension is the context extension a route sets, in Envoy's
+// per-route ext_authz config, to name the tenant its tokens must belong to.
+// Routes without it accept tokens of the default tenant only.
+const TenantExtension = "tenant"
+
+// Server implements envoy.service.auth.v3.Authorization. It accepts what
+// AuthVerify accepts as a bearer token: access tokens, checked for revocation,
+// and API keys once verify.AcceptAPIKeys has been called.
+type Server struct {
+	authv3.UnimplementedAuthorizationServer
+}
+
+func NewServer() *Server {
+	return &Server{}
+}
+
+// Register adds the authorization service to server.
+func (s *Server) Register(server *grpc.Server) {
+	authv3.RegisterAuthorizationServer(server, s)
+}
+
+// Check allows a request with the user in x-user-* headers, replacing any
+// the client sent, or denies it with a JSON error body like AuthVerify's.
+// Failures to authorize are answered, not returned as gRPC errors, which
+// Envoy would treat as the service being down.
+func (s *Server) Check(ctx context.Context, req *authv3.CheckRequest) (*authv3.CheckResponse, error) {
+	attributes := req.GetAttributes()
+	headers := attributes.GetRequest().GetHttp().GetHeaders()
+
+	authHeader := headers["authorization"]
+	if authHeader == "" {
+		return denied(codes.Unauthenticated, typev3.StatusCode_Unauthorized, "Bearer", "authorization header is required"), nil
+	}
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return denied(codes.Unauthenticated, typev3.StatusCode_Unauthorized, `Bearer error="invalid_request"`, "invalid authorization header format"), nil
+	}
+
+	ip := attributes.GetSource().GetAddress().GetSocketAddress().GetAddress()
+	claims, authErr := verify.CheckBearer(ctx, parts[1], ip, attributes.GetContextExtensions()[TenantExtension])
+	if authErr != nil && authErr.Status == 403 {
+		return denied(codes.PermissionDenied, typev3.StatusCode_Forbidden, authErr.Challenge, authErr.Message), nil
+	}
+	if authErr != nil {
+		return denied(codes.Unauthenticated, typev3.StatusCode_Unauthorized, authErr.Challenge, authErr.Message), nil
+	}
+
+	return &authv3.CheckResponse{
+		Status: &status.Status{Code: int32(codes.OK)},
+		HttpResponse: &authv3.CheckResponse_OkResponse{OkResponse: &authv3.OkHttpResponse{
+			Headers: []*corev3.HeaderValueOption{
+				header("x-user-id", claims.UserId),
+				header("x-user-email", claims.Email),
+				header("x-user-roles", strings.Join(claims.Roles, ",")),
+				header("x-user-tenant", claims.Tenant),
+			},
+		}},
+	}, nil
+}
+
+func denied(code codes.Code, httpStatus typev3.StatusCode, challenge, message string) *authv3.CheckResponse {
+	body, _ := json.Marshal(map[string]string{"error": message})
+	headers := []*corev3.HeaderValueOption{header("content-type", "application/json")}
+	if challenge != "" {
+		headers = append(headers, header("www-authenticate", challenge))
+	}
+	return &authv3.CheckResponse{
+		Status: &status.Status{Code: int32(code), Message: message},
+		HttpResponse: &authv3.CheckResponse_DeniedResponse{DeniedResponse: &authv3.DeniedHttpResponse{
+			Status:  &typev3.HttpStatus{Code: httpStatus},
+			Headers: headers,
+			Body:    string(body),
+		}},
+	}
+}
+
+func header(key, value string) *corev3.HeaderValueOption {
+	return &corev3.HeaderValueOption{
+		Header:       &corev3.HeaderValue{Key: key, Value: value},
+		AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+	}
+}
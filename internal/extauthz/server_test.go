@@ -0,0 +1,77 @@
+package extauthz
+
+import (
+    "context"
+    "testing"
+
+    "github.com/SinisterSup/auth-service/internal/models"
+    "github.com/SinisterSup/auth-service/internal/verify"
+    "github.com/SinisterSup/auth-service/utils"
+
+    authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+    typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+    "google.golang.org/grpc/codes"
+)
+
+type fakeKeys map[string]*utils.JWTClaim
+
+func (k fakeKeys) Authenticate(ctx context.Context, token, ip string) (*utils.JWTClaim, error) {
+    if claims, ok := k[token]; ok {
+        return claims, nil
+    }
+    return nil, models.ErrAccountInactive
+}
+
+func checkRequest(authorization, tenant string) *authv3.CheckRequest {
+    return &authv3.CheckRequest{Attributes: &authv3.AttributeContext{
+        Request: &authv3.AttributeContext_Request{Http: &authv3.AttributeContext_HttpRequest{
+            Headers: map[string]string{"authorization": authorization},
+        }},
+        ContextExtensions: map[string]string{TenantExtension: tenant},
+    }}
+}
+
+func TestCheck(t *testing.T) {
+    t.Setenv("JWT_SECRET", "test-secret")
+    verify.AcceptAPIKeys(fakeKeys{
+        "aspat_alice": {UserId: "u1", Email: "alice@example.com", Roles: []string{"user", "admin"}},
+    })
+    defer verify.AcceptAPIKeys(nil)
+    server := NewServer()
+
+    response, err := server.Check(context.Background(), checkRequest("Bearer aspat_alice", ""))
+    if err != nil || codes.Code(response.Status.Code) != codes.OK {
+        t.Fatalf("Expected the request to be allowed, got %v, %v", response, err)
+    }
+    headers := map[string]string{}
+    for _, option := range response.GetOkResponse().Headers {
+        headers[option.Header.Key] = option.Header.Value
+    }
+    if headers["x-user-id"] != "u1" || headers["x-user-email"] != "alice@example.com" || headers["x-user-roles"] != "user,admin" {
+        t.Errorf("Unexpected identity headers: %v", headers)
+    }
+
+    tests := []struct {
+        name          string
+        authorization string
+        tenant        string
+        code          codes.Code
+        status        typev3.StatusCode
+    }{
+        {"missing header", "", "", codes.Unauthenticated, typev3.StatusCode_Unauthorized},
+        {"wrong scheme", "Basic abc", "", codes.Unauthenticated, typev3.StatusCode_Unauthorized},
+        {"invalid token", "Bearer not-a-jwt", "", codes.Unauthenticated, typev3.StatusCode_Unauthorized},
+        {"inactive account", "Bearer aspat_bob", "", codes.PermissionDenied, typev3.StatusCode_Forbidden},
+        {"other tenant", "Bearer aspat_alice", "acme", codes.Unauthenticated, typev3.StatusCode_Unauthorized},
+    }
+    for _, tt := range tests {
+        response, err := server.Check(context.Background(), checkRequest(tt.authorization, tt.tenant))
+        if err != nil {
+            t.Fatalf("%s: %v", tt.name, err)
+        }
+        denied := response.GetDeniedResponse()
+        if codes.Code(response.Status.Code) != tt.code || denied == nil || denied.Status.Code != tt.status {
+            t.Errorf("%s: expected %v / %v, got %v", tt.name, tt.code, tt.status, response)
+        }
+    }
+}
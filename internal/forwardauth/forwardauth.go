@@ -0,0 +1,195 @@
+// Package forwardauth holds the per-host rules of the forward-auth endpoint,
+// which reverse proxies such as Nginx, Traefik and Caddy ask whether to let a
+// request through to the app behind them.
+package forwardauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/SinisterSup/auth-service/internal/models"
+	"github.com/SinisterSup/auth-service/utils"
+)
+
+// Rule says who may reach a host. A request needs a valid token unless its
+// path is one of PublicPaths, and then any of Roles, if given, and every one
+// of Permissions. Host may start with "*." to cover subdomains, or be "*"
+// for every host; paths ending in "*" match by prefix.
+type Rule struct {
+	Host        string   `json:"host"`
+	PublicPaths []string `json:"public_paths"`
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+	// LoginURL overrides Config.LoginURL for this host.
+	LoginURL string `json:"login_url"`
+}
+
+// Proxies describe the original request in headers with one of these
+// prefixes. Only the prefix the proxy sets can be trusted; the proxy may pass
+// the other on from the client unchanged, so exactly one must be configured.
+const (
+	HeadersNginx   = "nginx"   // X-Original-*
+	HeadersTraefik = "traefik" // X-Forwarded-*, as Traefik and Caddy send
+)
+
+// Config is the forward-auth configuration. Browsers that are not signed in
+// are sent to LoginURL, if set, rather than answered 401. Without rules any
+// signed-in user may reach any host; with rules, hosts no rule covers are
+// refused.
+type Config struct {
+	LoginURL string `json:"login_url"`
+	Rules    []Rule `json:"rules"`
+	// Headers is HeadersNginx or HeadersTraefik.
+	Headers string `json:"-"`
+}
+
+func (c *Config) Validate() error {
+	if c.Headers != HeadersNginx && c.Headers != HeadersTraefik {
+		return fmt.Errorf("FORWARD_AUTH_HEADERS must be %q or %q", HeadersNginx, HeadersTraefik)
+	}
+	if err := validateLoginURL(c.LoginURL); err != nil {
+		return err
+	}
+	for _, rule := range c.Rules {
+		if rule.Host == "" {
+			return fmt.Errorf("every rule needs a host")
+		}
+		if err := validateLoginURL(rule.LoginURL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateLoginURL(loginURL string) error {
+	if loginURL == "" {
+		return nil
+	}
+	if u, err := url.Parse(loginURL); err != nil || !u.IsAbs() {
+		return fmt.Errorf("login_url %q must be an absolute URL", loginURL)
+	}
+	return nil
+}
+
+// LoadConfigFromEnv reads the JSON config from the file named by
+// FORWARD_AUTH_RULES_FILE or inline from FORWARD_AUTH_RULES. Without either
+// it has no rules. FORWARD_AUTH_HEADERS sets Headers and is required.
+func LoadConfigFromEnv() (*Config, error) {
+	data := []byte(os.Getenv("FORWARD_AUTH_RULES"))
+	if path := os.Getenv("FORWARD_AUTH_RULES_FILE"); path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("error reading FORWARD_AUTH_RULES_FILE: %v", err)
+		}
+	}
+	config := &Config{}
+	if len(strings.TrimSpace(string(data))) > 0 {
+		if err := json.Unmarshal(data, config); err != nil {
+			return nil, fmt.Errorf("invalid forward auth config: %v", err)
+		}
+	}
+	config.Headers = strings.ToLower(os.Getenv("FORWARD_AUTH_HEADERS"))
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid forward auth config: %v", err)
+	}
+	return config, nil
+}
+
+// HeaderPrefix is the prefix of the headers the original request is read
+// from. There is no fallback to the other prefix.
+func (c *Config) HeaderPrefix() string {
+	if c.Headers == HeadersNginx {
+		return "X-Original-"
+	}
+	return "X-Forwarded-"
+}
+
+// RequestPath returns the percent-decoded path of a request URI. It reports
+// false for URIs that do not decode or that hold encoded slashes,
+// backslashes or dot segments, since the app behind the proxy may resolve
+// those differently; such paths are never public.
+func RequestPath(uri string) (string, bool) {
+	requestPath, _, _ := strings.Cut(uri, "?")
+	lower := strings.ToLower(requestPath)
+	if strings.Contains(lower, "%2f") || strings.Contains(lower, "%5c") {
+		return "", false
+	}
+	decoded, err := url.PathUnescape(requestPath)
+	if err != nil || strings.Contains(decoded, "\\") {
+		return "", false
+	}
+	for _, segment := range strings.Split(decoded, "/") {
+		if segment == "." || segment == ".." {
+			return "", false
+		}
+	}
+	return path.Clean("/" + decoded), true
+}
+
+// Match returns the rule for host: an exact match, else the longest matching
+// "*." rule, else a "*" rule. Without rules every host gets an empty rule.
+func (c *Config) Match(host string) (*Rule, bool) {
+	if len(c.Rules) == 0 {
+		return &Rule{}, true
+	}
+	host = strings.ToLower(host)
+	var best *Rule
+	for i, rule := range c.Rules {
+		pattern := strings.ToLower(rule.Host)
+		switch {
+		case pattern == host:
+			return &c.Rules[i], true
+		case pattern == "*":
+			if best == nil {
+				best = &c.Rules[i]
+			}
+		case strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:]):
+			if best == nil || best.Host == "*" || len(pattern) > len(best.Host) {
+				best = &c.Rules[i]
+			}
+		}
+	}
+	return best, best != nil
+}
+
+// LoginURLFor is where a browser that is not signed in is sent under rule.
+func (c *Config) LoginURLFor(rule *Rule) string {
+	if rule.LoginURL != "" {
+		return rule.LoginURL
+	}
+	return c.LoginURL
+}
+
+// Public reports whether path may be reached without signing in.
+func (r *Rule) Public(path string) bool {
+	for _, pattern := range r.PublicPaths {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		} else if path == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether the holder of claims may reach the host.
+func (r *Rule) Allows(claims *utils.JWTClaim) bool {
+	if len(r.Roles) > 0 && !slices.ContainsFunc(r.Roles, func(role string) bool {
+		return slices.Contains(claims.Roles, role)
+	}) {
+		return false
+	}
+	for _, permission := range r.Permissions {
+		if !models.HasPermission(claims.Permissions, permission) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,107 @@
+package forwardauth
+
+import (
+    "testing"
+
+    "github.com/SinisterSup/auth-service/utils"
+)
+
+func TestMatch(t *testing.T) {
+    config := &Config{Rules: []Rule{
+        {Host: "*"},
+        {Host: "*.example.com"},
+        {Host: "*.admin.example.com"},
+        {Host: "grafana.example.com"},
+    }}
+
+    tests := []struct {
+        host string
+        want string
+    }{
+        {"grafana.example.com", "grafana.example.com"},
+        {"GRAFANA.example.com", "grafana.example.com"},
+        {"wiki.example.com", "*.example.com"},
+        {"db.admin.example.com", "*.admin.example.com"},
+        {"example.org", "*"},
+    }
+    for _, tt := range tests {
+        rule, ok := config.Match(tt.host)
+        if !ok || rule.Host != tt.want {
+            t.Errorf("Match(%q) = %v, want %q", tt.host, rule, tt.want)
+        }
+    }
+
+    config.Rules = config.Rules[1:]
+    if _, ok := config.Match("example.org"); ok {
+        t.Error("Expected a host no rule covers to be refused")
+    }
+    if _, ok := (&Config{}).Match("example.org"); !ok {
+        t.Error("Expected every host to be allowed without rules")
+    }
+}
+
+func TestRule(t *testing.T) {
+    rule := &Rule{PublicPaths: []string{"/health", "/static/*"}, Roles: []string{"admin", "ops"}, Permissions: []string{"grafana:view"}}
+
+    for path, want := range map[string]bool{"/health": true, "/static/app.js": true, "/healthz": false, "/dashboards": false} {
+        if got := rule.Public(path); got != want {
+            t.Errorf("Public(%q) = %v, want %v", path, got, want)
+        }
+    }
+
+    if !rule.Allows(&utils.JWTClaim{Roles: []string{"ops"}, Permissions: []string{"grafana:*"}}) {
+        t.Error("Expected a user with a listed role and the permission to be allowed")
+    }
+    if rule.Allows(&utils.JWTClaim{Roles: []string{"ops"}}) {
+        t.Error("Expected a user without the permission to be refused")
+    }
+    if rule.Allows(&utils.JWTClaim{Roles: []string{"user"}, Permissions: []string{"grafana:view"}}) {
+        t.Error("Expected a user without a listed role to be refused")
+    }
+}
+
+func TestRequestPath(t *testing.T) {
+    for uri, want := range map[string]string{
+        "/public/logo.png?v=2":  "/public/logo.png",
+        "/public//logo%20a.png": "/public/logo a.png",
+        "":                      "/",
+    } {
+        if got, ok := RequestPath(uri); !ok || got != want {
+            t.Errorf("RequestPath(%q) = %q, want %q", uri, got, want)
+        }
+    }
+    for _, uri := range []string{"/public/%zz", "/public/../admin", "/public/..%2fadmin", "/admin%2f..%2fpublic/x", "/public/%2e%2e/admin", "/public/.%2E/admin", "/admin%5c..%5cpublic", "/public/./x"} {
+        if _, ok := RequestPath(uri); ok {
+            t.Errorf("Expected RequestPath(%q) to be refused", uri)
+        }
+    }
+}
+
+func TestHeaderPrefix(t *testing.T) {
+    for headers, want := range map[string]string{HeadersNginx: "X-Original-", HeadersTraefik: "X-Forwarded-"} {
+        if got := (&Config{Headers: headers}).HeaderPrefix(); got != want {
+            t.Errorf("HeaderPrefix() with %q = %q, want %q", headers, got, want)
+        }
+    }
+    for _, headers := range []string{"", "apache"} {
+        t.Setenv("FORWARD_AUTH_HEADERS", headers)
+        if _, err := LoadConfigFromEnv(); err == nil {
+            t.Errorf("Expected FORWARD_AUTH_HEADERS=%q to be refused", headers)
+        }
+    }
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+    t.Setenv("FORWARD_AUTH_HEADERS", "traefik")
+    if config, err := LoadConfigFromEnv(); err != nil || config.Headers != HeadersTraefik {
+        t.Errorf("Expected the traefik header set, got %v, %v", config, err)
+    }
+    t.Setenv("FORWARD_AUTH_RULES", `{"login_url": "/signin", "rules": []}`)
+    if _, err := LoadConfigFromEnv(); err == nil {
+        t.Error("Expected a relative login URL to be refused")
+    }
+    t.Setenv("FORWARD_AUTH_RULES", `{"rules": [{"roles": ["admin"]}]}`)
+    if _, err := LoadConfigFromEnv(); err == nil {
+        t.Error("Expected a rule without a host to be refused")
+    }
+}
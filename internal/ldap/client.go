@@ -0,0 +1,262 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid LDAP credentials")
+	ErrUserNotFound       = errors.New("LDAP user not found")
+)
+
+type Config struct {
+	URL                string
+	StartTLS           bool
+	InsecureSkipVerify bool
+	CAFile             string
+	BindDN             string
+	BindPassword       string
+	BaseDN             string
+	UserFilter         string
+	EmailAttribute     string
+	NameAttribute      string
+	GroupAttribute     string
+	GroupBaseDN        string
+	GroupFilter        string
+	RoleMapping        map[string]string
+	Timeout            time.Duration
+}
+
+// LoadConfigFromEnv reads the LDAP_* settings. LDAP_ROLE_MAPPING is a JSON
+// object from group DN to local role name.
+func LoadConfigFromEnv() (Config, error) {
+	config := Config{
+		URL:                os.Getenv("LDAP_URL"),
+		StartTLS:           os.Getenv("LDAP_START_TLS") == "true",
+		InsecureSkipVerify: os.Getenv("LDAP_TLS_INSECURE_SKIP_VERIFY") == "true",
+		CAFile:             os.Getenv("LDAP_CA_FILE"),
+		BindDN:             os.Getenv("LDAP_BIND_DN"),
+		BindPassword:       os.Getenv("LDAP_BIND_PASSWORD"),
+		BaseDN:             os.Getenv("LDAP_BASE_DN"),
+		UserFilter:         os.Getenv("LDAP_USER_FILTER"),
+		EmailAttribute:     os.Getenv("LDAP_EMAIL_ATTRIBUTE"),
+		NameAttribute:      os.Getenv("LDAP_NAME_ATTRIBUTE"),
+		GroupAttribute:     os.Getenv("LDAP_GROUP_ATTRIBUTE"),
+		GroupBaseDN:        os.Getenv("LDAP_GROUP_BASE_DN"),
+		GroupFilter:        os.Getenv("LDAP_GROUP_FILTER"),
+		Timeout:            10 * time.Second,
+	}
+	if mapping := os.Getenv("LDAP_ROLE_MAPPING"); mapping != "" {
+		if err := json.Unmarshal([]byte(mapping), &config.RoleMapping); err != nil {
+			return config, fmt.Errorf("invalid LDAP_ROLE_MAPPING: %v", err)
+		}
+	}
+	if config.URL == "" || config.BaseDN == "" {
+		return config, errors.New("LDAP_URL and LDAP_BASE_DN are required")
+	}
+	return config, nil
+}
+
+// Entry is the directory user a successful bind resolved to.
+type Entry struct {
+	DN     string
+	Email  string
+	Name   string
+	Groups []string
+	Roles  []string
+}
+
+type Client struct {
+	config Config
+	tls    *tls.Config
+}
+
+func NewClient(config Config) (*Client, error) {
+	if config.UserFilter == "" {
+		config.UserFilter = "(&(objectClass=person)(mail=%s))"
+	}
+	if config.EmailAttribute == "" {
+		config.EmailAttribute = "mail"
+	}
+	if config.NameAttribute == "" {
+		config.NameAttribute = "cn"
+	}
+	if config.GroupAttribute == "" {
+		config.GroupAttribute = "memberOf"
+	}
+	if config.GroupFilter == "" {
+		config.GroupFilter = "(|(member=%s)(uniqueMember=%s))"
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+	if config.CAFile != "" {
+		pem, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read LDAP CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("LDAP CA file contains no certificates")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return &Client{config: config, tls: tlsConfig}, nil
+}
+
+// Authenticate finds the user with the service account, then binds as the
+// user's DN to check the password (search-then-bind).
+func (c *Client) Authenticate(login, password string) (*Entry, error) {
+	// An empty password would be an unauthenticated bind, which most servers accept
+	if password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if c.config.BindDN != "" {
+		if err := conn.Bind(c.config.BindDN, c.config.BindPassword); err != nil {
+			return nil, fmt.Errorf("LDAP service bind failed: %v", err)
+		}
+	}
+
+	filter := strings.ReplaceAll(c.config.UserFilter, "%s", goldap.EscapeFilter(login))
+	result, err := conn.Search(goldap.NewSearchRequest(
+		c.config.BaseDN,
+		goldap.ScopeWholeSubtree,
+		goldap.NeverDerefAliases,
+		2,
+		int(c.config.Timeout.Seconds()),
+		false,
+		filter,
+		[]string{c.config.EmailAttribute, c.config.NameAttribute, c.config.GroupAttribute},
+		nil,
+	))
+	if err != nil && !goldap.IsErrorWithCode(err, goldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("LDAP user search failed: %v", err)
+	}
+	if result == nil || len(result.Entries) != 1 {
+		return nil, ErrUserNotFound
+	}
+	userEntry := result.Entries[0]
+
+	if err := conn.Bind(userEntry.DN, password); err != nil {
+		if goldap.IsErrorWithCode(err, goldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("LDAP user bind failed: %v", err)
+	}
+
+	entry := &Entry{
+		DN:     userEntry.DN,
+		Email:  userEntry.GetAttributeValue(c.config.EmailAttribute),
+		Name:   userEntry.GetAttributeValue(c.config.NameAttribute),
+		Groups: userEntry.GetAttributeValues(c.config.GroupAttribute),
+	}
+
+	if c.config.GroupBaseDN != "" {
+		groups, err := c.searchGroups(conn, userEntry.DN)
+		if err != nil {
+			return nil, err
+		}
+		entry.Groups = append(entry.Groups, groups...)
+	}
+	entry.Roles = c.mapRoles(entry.Groups)
+
+	return entry, nil
+}
+
+func (c *Client) dial() (*goldap.Conn, error) {
+	conn, err := goldap.DialURL(c.config.URL, goldap.DialWithTLSConfig(c.tls))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to LDAP: %v", err)
+	}
+	conn.SetTimeout(c.config.Timeout)
+
+	if c.config.StartTLS {
+		if err := conn.StartTLS(c.tls); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("LDAP StartTLS failed: %v", err)
+		}
+	}
+	return conn, nil
+}
+
+// searchGroups is used for directories without a memberOf overlay. It
+// rebinds as the service account, when one is configured, so users need no
+// read access to group entries; anonymous setups search as the bound user.
+func (c *Client) searchGroups(conn *goldap.Conn, userDN string) ([]string, error) {
+	if c.config.BindDN != "" {
+		if err := conn.Bind(c.config.BindDN, c.config.BindPassword); err != nil {
+			return nil, fmt.Errorf("LDAP service bind failed: %v", err)
+		}
+	}
+
+	filter := strings.ReplaceAll(c.config.GroupFilter, "%s", goldap.EscapeFilter(userDN))
+	result, err := conn.Search(goldap.NewSearchRequest(
+		c.config.GroupBaseDN,
+		goldap.ScopeWholeSubtree,
+		goldap.NeverDerefAliases,
+		0,
+		int(c.config.Timeout.Seconds()),
+		false,
+		filter,
+		[]string{"dn"},
+		nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("LDAP group search failed: %v", err)
+	}
+
+	groups := make([]string, 0, len(result.Entries))
+	for _, entry := range result.Entries {
+		groups = append(groups, entry.DN)
+	}
+	return groups, nil
+}
+
+func (c *Client) mapRoles(groups []string) []string {
+	seen := make(map[string]bool)
+	var roles []string
+	for groupDN, role := range c.config.RoleMapping {
+		for _, group := range groups {
+			if strings.EqualFold(normalizeDN(group), normalizeDN(groupDN)) && !seen[role] {
+				seen[role] = true
+				roles = append(roles, role)
+			}
+		}
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+func normalizeDN(dn string) string {
+	parsed, err := goldap.ParseDN(dn)
+	if err != nil {
+		return strings.TrimSpace(dn)
+	}
+	parts := make([]string, 0, len(parsed.RDNs))
+	for _, rdn := range parsed.RDNs {
+		for _, attr := range rdn.Attributes {
+			parts = append(parts, strings.ToLower(attr.Type)+"="+attr.Value)
+		}
+	}
+	return strings.Join(parts, ",")
+}
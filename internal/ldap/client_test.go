@@ -0,0 +1,83 @@
+package ldap_test
+
+import (
+    "testing"
+
+    "github.com/SinisterSup/auth-service/internal/ldap"
+    "github.com/SinisterSup/auth-service/internal/ldap/ldaptest"
+)
+
+func newTestClient(t *testing.T) (*ldap.Client, func()) {
+    server := ldaptest.NewServer(
+        ldaptest.Entry{
+            DN:       "cn=service,dc=example,dc=com",
+            Password: "service-secret",
+        },
+        ldaptest.Entry{
+            DN:       "uid=jdoe,ou=people,dc=example,dc=com",
+            Password: "password123",
+            Attributes: map[string][]string{
+                "objectClass": {"person"},
+                "mail":        {"jdoe@example.com"},
+                "cn":          {"John Doe"},
+                "memberOf":    {"cn=Admins,ou=groups,dc=example,dc=com"},
+            },
+        },
+        ldaptest.Entry{
+            DN: "cn=developers,ou=groups,dc=example,dc=com",
+            Attributes: map[string][]string{
+                "member": {"uid=jdoe,ou=people,dc=example,dc=com"},
+            },
+        },
+    )
+
+    client, err := ldap.NewClient(ldap.Config{
+        URL:          server.URL,
+        BindDN:       "cn=service,dc=example,dc=com",
+        BindPassword: "service-secret",
+        BaseDN:       "ou=people,dc=example,dc=com",
+        GroupBaseDN:  "ou=groups,dc=example,dc=com",
+        RoleMapping: map[string]string{
+            "cn=admins,ou=groups,dc=example,dc=com":     "admin",
+            "cn=developers,ou=groups,dc=example,dc=com": "developer",
+        },
+    })
+    if err != nil {
+        t.Fatalf("Failed to create client: %v", err)
+    }
+    return client, server.Close
+}
+
+func TestAuthenticate(t *testing.T) {
+    client, cleanup := newTestClient(t)
+    defer cleanup()
+
+    entry, err := client.Authenticate("jdoe@example.com", "password123")
+    if err != nil {
+        t.Fatalf("Failed to authenticate: %v", err)
+    }
+    if entry.DN != "uid=jdoe,ou=people,dc=example,dc=com" || entry.Email != "jdoe@example.com" || entry.Name != "John Doe" {
+        t.Errorf("Unexpected entry: %+v", entry)
+    }
+    if len(entry.Roles) != 2 || entry.Roles[0] != "admin" || entry.Roles[1] != "developer" {
+        t.Errorf("Expected roles [admin developer], got %v", entry.Roles)
+    }
+}
+
+func TestAuthenticateRejectsBadCredentials(t *testing.T) {
+    client, cleanup := newTestClient(t)
+    defer cleanup()
+
+    if _, err := client.Authenticate("jdoe@example.com", "wrong"); err != ldap.ErrInvalidCredentials {
+        t.Errorf("Expected ErrInvalidCredentials, got %v", err)
+    }
+    if _, err := client.Authenticate("jdoe@example.com", ""); err != ldap.ErrInvalidCredentials {
+        t.Errorf("Expected ErrInvalidCredentials for empty password, got %v", err)
+    }
+    if _, err := client.Authenticate("nobody@example.com", "password123"); err != ldap.ErrUserNotFound {
+        t.Errorf("Expected ErrUserNotFound, got %v", err)
+    }
+    if _, err := client.Authenticate("*", "password123"); err != ldap.ErrUserNotFound {
+        t.Errorf("Expected escaped wildcard not to match, got %v", err)
+    }
+}
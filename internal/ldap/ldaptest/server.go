@@ -0,0 +1,239 @@
+// Package ldaptest runs a minimal in-process LDAP server for tests. It speaks
+// just enough of the protocol for simple binds and searches with equality,
+// presence, and/or/not filters over a fixed set of entries.
+package ldaptest
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+const (
+	appBindRequest       = 0
+	appBindResponse      = 1
+	appUnbindRequest     = 2
+	appSearchRequest     = 3
+	appSearchResultEntry = 4
+	appSearchResultDone  = 5
+	appExtendedRequest   = 23
+	appExtendedResponse  = 24
+	resultSuccess        = 0
+	resultProtocolError  = 2
+	resultInvalidCreds   = 49
+	resultUnwillingToDo  = 53
+	filterAnd            = 0
+	filterOr             = 1
+	filterNot            = 2
+	filterEqualityMatch  = 3
+	filterPresent        = 7
+	scopeBaseObject      = 0
+	scopeSingleLevel     = 1
+)
+
+type Entry struct {
+	DN         string
+	Password   string
+	Attributes map[string][]string
+}
+
+type Server struct {
+	URL string
+
+	listener net.Listener
+	entries  []Entry
+	wg       sync.WaitGroup
+}
+
+func NewServer(entries ...Entry) *Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+
+	s := &Server{
+		URL:      "ldap://" + listener.Addr().String(),
+		listener: listener,
+		entries:  entries,
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+func (s *Server) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageID, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case appBindRequest:
+			conn.Write(s.bind(messageID, op).Bytes())
+		case appSearchRequest:
+			for _, response := range s.search(messageID, op) {
+				conn.Write(response.Bytes())
+			}
+		case appExtendedRequest:
+			conn.Write(result(messageID, appExtendedResponse, resultProtocolError, "extended operations are not supported").Bytes())
+		case appUnbindRequest:
+			return
+		default:
+			return
+		}
+	}
+}
+
+func (s *Server) bind(messageID int64, op *ber.Packet) *ber.Packet {
+	if len(op.Children) < 3 || op.Children[2].Tag != 0 {
+		return result(messageID, appBindResponse, resultUnwillingToDo, "only simple bind is supported")
+	}
+	name, _ := op.Children[1].Value.(string)
+	password := op.Children[2].Data.String()
+
+	// Anonymous and unauthenticated binds succeed, as on most real servers
+	if password == "" {
+		return result(messageID, appBindResponse, resultSuccess, "")
+	}
+	for _, entry := range s.entries {
+		if strings.EqualFold(entry.DN, name) && entry.Password != "" && entry.Password == password {
+			return result(messageID, appBindResponse, resultSuccess, "")
+		}
+	}
+	return result(messageID, appBindResponse, resultInvalidCreds, "invalid credentials")
+}
+
+func (s *Server) search(messageID int64, op *ber.Packet) []*ber.Packet {
+	if len(op.Children) < 8 {
+		return []*ber.Packet{result(messageID, appSearchResultDone, resultProtocolError, "malformed search")}
+	}
+	baseDN, _ := op.Children[0].Value.(string)
+	scope, _ := op.Children[1].Value.(int64)
+	filter := op.Children[6]
+
+	var responses []*ber.Packet
+	for _, entry := range s.entries {
+		if !inScope(entry.DN, baseDN, scope) || !matches(entry, filter) {
+			continue
+		}
+
+		response := envelope(messageID)
+		body := ber.Encode(ber.ClassApplication, ber.TypeConstructed, appSearchResultEntry, nil, "")
+		body.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, ""))
+		attributes := ber.NewSequence("")
+		for name, values := range entry.Attributes {
+			attribute := ber.NewSequence("")
+			attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+			set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+			for _, value := range values {
+				set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, ""))
+			}
+			attribute.AppendChild(set)
+			attributes.AppendChild(attribute)
+		}
+		body.AppendChild(attributes)
+		response.AppendChild(body)
+		responses = append(responses, response)
+	}
+
+	return append(responses, result(messageID, appSearchResultDone, resultSuccess, ""))
+}
+
+func inScope(dn, baseDN string, scope int64) bool {
+	dn, baseDN = strings.ToLower(dn), strings.ToLower(baseDN)
+	switch scope {
+	case scopeBaseObject:
+		return dn == baseDN
+	case scopeSingleLevel:
+		parts := strings.SplitN(dn, ",", 2)
+		return len(parts) == 2 && parts[1] == baseDN
+	default:
+		return dn == baseDN || strings.HasSuffix(dn, ","+baseDN)
+	}
+}
+
+func matches(entry Entry, filter *ber.Packet) bool {
+	switch filter.Tag {
+	case filterAnd:
+		for _, child := range filter.Children {
+			if !matches(entry, child) {
+				return false
+			}
+		}
+		return true
+	case filterOr:
+		for _, child := range filter.Children {
+			if matches(entry, child) {
+				return true
+			}
+		}
+		return false
+	case filterNot:
+		return len(filter.Children) == 1 && !matches(entry, filter.Children[0])
+	case filterEqualityMatch:
+		if len(filter.Children) != 2 {
+			return false
+		}
+		name, _ := filter.Children[0].Value.(string)
+		value, _ := filter.Children[1].Value.(string)
+		for _, candidate := range attributeValues(entry, name) {
+			if strings.EqualFold(candidate, value) {
+				return true
+			}
+		}
+		return false
+	case filterPresent:
+		return len(attributeValues(entry, filter.Data.String())) > 0
+	default:
+		return false
+	}
+}
+
+func attributeValues(entry Entry, name string) []string {
+	for key, values := range entry.Attributes {
+		if strings.EqualFold(key, name) {
+			return values
+		}
+	}
+	return nil
+}
+
+func envelope(messageID int64) *ber.Packet {
+	packet := ber.NewSequence("")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, ""))
+	return packet
+}
+
+func result(messageID int64, tag ber.Tag, code int64, message string) *ber.Packet {
+	packet := envelope(messageID)
+	body := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	body.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, ""))
+	body.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	body.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, message, ""))
+	packet.AppendChild(body)
+	return packet
+}
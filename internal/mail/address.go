@@ -0,0 +1,44 @@
+package mail
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/text/unicode/norm"
+)
+
+var ErrInvalidAddress = errors.New("invalid email address")
+
+// NormalizeAddress returns the form an email address is stored and looked up
+// in: trimmed, with the local part lowercased and NFC-normalized and the domain
+// converted to lowercase ASCII (punycode for internationalized domains), so
+// "Ann@Bücher.Example " and "ann@xn--bcher-kva.example" are the same account.
+func NormalizeAddress(address string) (string, error) {
+	address = strings.TrimSpace(address)
+	at := strings.LastIndex(address, "@")
+	if at <= 0 || at == len(address)-1 {
+		return "", ErrInvalidAddress
+	}
+
+	local := strings.ToLower(norm.NFC.String(address[:at]))
+	if strings.ContainsAny(local, " \t\r\n<>") {
+		return "", ErrInvalidAddress
+	}
+
+	domain, err := idna.Lookup.ToASCII(strings.TrimSuffix(address[at+1:], "."))
+	if err != nil || !strings.Contains(domain, ".") && domain != "localhost" {
+		return "", ErrInvalidAddress
+	}
+	return local + "@" + domain, nil
+}
+
+// LookupAddress normalizes an address for finding an account. Input that is
+// not a valid address is only trimmed and lowercased; it cannot match a
+// stored account, but callers still go through their usual not-found path.
+func LookupAddress(address string) string {
+	if normalized, err := NormalizeAddress(address); err == nil {
+		return normalized
+	}
+	return strings.ToLower(strings.TrimSpace(address))
+}
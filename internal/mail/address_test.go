@@ -0,0 +1,31 @@
+package mail
+
+import "testing"
+
+func TestNormalizeAddress(t *testing.T) {
+    cases := map[string]string{
+        "user@example.com":          "user@example.com",
+        "  User@Example.COM ":       "user@example.com",
+        "ann@Bücher.example":        "ann@xn--bcher-kva.example",
+        "ann@xn--bcher-kva.example": "ann@xn--bcher-kva.example",
+        "ANN@BÜCHER.EXAMPLE.":       "ann@xn--bcher-kva.example",
+        "José@example.com":          "josé@example.com",
+        "root@localhost":            "root@localhost",
+    }
+    for input, expected := range cases {
+        normalized, err := NormalizeAddress(input)
+        if err != nil {
+            t.Errorf("NormalizeAddress(%q) failed: %v", input, err)
+            continue
+        }
+        if normalized != expected {
+            t.Errorf("NormalizeAddress(%q) = %q, expected %q", input, normalized, expected)
+        }
+    }
+
+    for _, input := range []string{"", "user", "@example.com", "user@", "user@example", "a b@example.com", "user@exa mple.com"} {
+        if _, err := NormalizeAddress(input); err != ErrInvalidAddress {
+            t.Errorf("Expected NormalizeAddress(%q) to be rejected, got %v", input, err)
+        }
+    }
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+type DeleteAccountInput struct {
+	Password string `json:"password"`
+}
+
+type SessionExport struct {
+	Kind      string     `json:"kind"`
+	IssuedAt  *time.Time `json:"issued_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+type LoginChallengeExport struct {
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	ConsumedAt *time.Time `json:"consumed_at,omitempty"`
+	Attempts   int        `json:"attempts"`
+}
+
+// AccountExport is the archive returned by GET /auth/account/export. Secrets
+// (password hash, raw tokens, code hashes) are never included.
+type AccountExport struct {
+	ExportedAt      time.Time              `json:"exported_at"`
+	User            User                   `json:"user"`
+	Sessions        []SessionExport        `json:"sessions"`
+	LoginChallenges []LoginChallengeExport `json:"login_challenges"`
+	AuditEvents     []AuditEvent           `json:"audit_events"`
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+type AccountStatus string
+
+const (
+	StatusActive     AccountStatus = "active"
+	StatusUnverified AccountStatus = "unverified"
+	StatusLocked     AccountStatus = "locked"
+	StatusSuspended  AccountStatus = "suspended"
+	StatusDeleted    AccountStatus = "deleted"
+)
+
+var ErrAccountInactive = errors.New("account is not active")
+
+func (s AccountStatus) Valid() bool {
+	switch s {
+	case StatusActive, StatusUnverified, StatusLocked, StatusSuspended, StatusDeleted:
+		return true
+	}
+	return false
+}
+
+// AccountStatusError is returned once credentials have been checked but the
+// account may not be used. It only carries the status, never the reason an
+// admin recorded, and matches ErrAccountInactive with errors.Is.
+type AccountStatusError struct {
+	Status AccountStatus
+}
+
+func (e *AccountStatusError) Error() string {
+	switch e.Status {
+	case StatusUnverified:
+		return "email address has not been verified"
+	case StatusLocked:
+		return "account is temporarily locked"
+	case StatusSuspended:
+		return "account is suspended"
+	default:
+		return ErrAccountInactive.Error()
+	}
+}
+
+func (e *AccountStatusError) Is(target error) bool {
+	return target == ErrAccountInactive
+}
+
+// EffectiveStatus resolves the stored status at the given time. Users created
+// before statuses existed count as active, and locks or suspensions with an
+// expiry lapse on their own.
+func (u *User) EffectiveStatus(now time.Time) AccountStatus {
+	if u.DeletedAt != nil {
+		return StatusDeleted
+	}
+	switch u.Status {
+	case "", StatusActive:
+		return StatusActive
+	case StatusLocked, StatusSuspended:
+		if u.StatusUntil != nil && !now.Before(*u.StatusUntil) {
+			return StatusActive
+		}
+	}
+	return u.Status
+}
+
+// StatusError returns an *AccountStatusError unless the account is active.
+func (u *User) StatusError(now time.Time) error {
+	if status := u.EffectiveStatus(now); status != StatusActive {
+		return &AccountStatusError{Status: status}
+	}
+	return nil
+}
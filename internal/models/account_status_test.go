@@ -0,0 +1,49 @@
+package models
+
+import (
+    "errors"
+    "testing"
+    "time"
+)
+
+func TestEffectiveStatus(t *testing.T) {
+    now := time.Now()
+    past, future := now.Add(-time.Minute), now.Add(time.Minute)
+
+    tests := []struct {
+        name string
+        user User
+        want AccountStatus
+    }{
+        {"legacy user without status", User{}, StatusActive},
+        {"active", User{Status: StatusActive}, StatusActive},
+        {"locked until later", User{Status: StatusLocked, StatusUntil: &future}, StatusLocked},
+        {"lock expired", User{Status: StatusLocked, StatusUntil: &past}, StatusActive},
+        {"suspended indefinitely", User{Status: StatusSuspended}, StatusSuspended},
+        {"unverified ignores expiry", User{Status: StatusUnverified, StatusUntil: &past}, StatusUnverified},
+        {"soft-deleted", User{Status: StatusActive, DeletedAt: &past}, StatusDeleted},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := tt.user.EffectiveStatus(now); got != tt.want {
+                t.Errorf("EffectiveStatus() = %q, want %q", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestStatusErrorDoesNotLeakReason(t *testing.T) {
+    user := User{Status: StatusSuspended, StatusReason: "fraud investigation #123"}
+
+    err := user.StatusError(time.Now())
+    if !errors.Is(err, ErrAccountInactive) {
+        t.Fatalf("Expected ErrAccountInactive, got %v", err)
+    }
+    if err.Error() != "account is suspended" {
+        t.Errorf("Unexpected message %q", err.Error())
+    }
+    if (&User{}).StatusError(time.Now()) != nil {
+        t.Error("Expected no error for active user")
+    }
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type UserSearchQuery struct {
+	Email   string `form:"email"`
+	Role    string `form:"role"`
+	Status  string `form:"status"`
+	Tenant  string `form:"tenant"`
+	Deleted bool   `form:"deleted"`
+	Page    int64  `form:"page"`
+	Limit   int64  `form:"limit"`
+}
+
+type UserPage struct {
+	Users []User `json:"users"`
+	Page  int64  `json:"page"`
+	Limit int64  `json:"limit"`
+	Total int64  `json:"total"`
+}
+
+type DisableUserInput struct {
+	Reason string     `json:"reason"`
+	Until  *time.Time `json:"until"`
+}
+
+type UpdateStatusInput struct {
+	Status AccountStatus `json:"status" binding:"required"`
+	Reason string        `json:"reason"`
+	Until  *time.Time    `json:"until"`
+}
+
+type UpdateRolesInput struct {
+	Roles []string `json:"roles" binding:"required"`
+}
+
+// PasswordReset is a single-use reset token, stored only as a hash.
+type PasswordReset struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	UserID     primitive.ObjectID `bson:"user_id"`
+	TokenHash  string             `bson:"token_hash"`
+	ExpiresAt  time.Time          `bson:"expires_at"`
+	ConsumedAt *time.Time         `bson:"consumed_at,omitempty"`
+	CreatedAt  time.Time          `bson:"created_at"`
+}
+
+type ForgotPasswordInput struct {
+	Email string `json:"email" binding:"required"`
+}
+
+type ResetPasswordInput struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
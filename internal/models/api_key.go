@@ -0,0 +1,72 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// API keys are either personal access tokens, which act as the user who
+// created them, or service keys, which an admin issues to a service with
+// their own permissions. The prefixes let secret scanners recognize them.
+const (
+	APIKeyPersonal = "personal"
+	APIKeyService  = "service"
+
+	PersonalTokenPrefix = "aspat_"
+	ServiceKeyPrefix    = "assk_"
+)
+
+// APIKey is a long-lived bearer credential, stored only as a hash. Prefix
+// is the start of the key, kept so users can tell their keys apart.
+type APIKey struct {
+	ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	Kind        string              `bson:"kind" json:"kind"`
+	TenantID    string              `bson:"tenant_id,omitempty" json:"tenant,omitempty"`
+	UserID      *primitive.ObjectID `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	Service     string              `bson:"service,omitempty" json:"service,omitempty"`
+	Name        string              `bson:"name" json:"name"`
+	Prefix      string              `bson:"prefix" json:"prefix"`
+	TokenHash   string              `bson:"token_hash" json:"-"`
+	Scopes      []string            `bson:"scopes,omitempty" json:"scopes,omitempty"`
+	Permissions []string            `bson:"permissions,omitempty" json:"permissions,omitempty"`
+	ExpiresAt   *time.Time          `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	LastUsedAt  *time.Time          `bson:"last_used_at,omitempty" json:"last_used_at,omitempty"`
+	LastUsedIP  string              `bson:"last_used_ip,omitempty" json:"last_used_ip,omitempty"`
+	CreatedBy   primitive.ObjectID  `bson:"created_by" json:"created_by"`
+	CreatedAt   time.Time           `bson:"created_at" json:"created_at"`
+	RevokedAt   *time.Time          `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+}
+
+// CreatedAPIKey is a new key along with its secret, which is only ever
+// shown this once.
+type CreatedAPIKey struct {
+	APIKey
+	Token string `json:"token"`
+}
+
+type CreatePersonalTokenInput struct {
+	Name      string     `json:"name" binding:"required"`
+	Scope     string     `json:"scope"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type CreateServiceKeyInput struct {
+	Name        string     `json:"name" binding:"required"`
+	Service     string     `json:"service" binding:"required"`
+	Tenant      string     `json:"tenant"`
+	Permissions []string   `json:"permissions"`
+	Scope       string     `json:"scope"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+type APIKeyQuery struct {
+	Kind string `form:"kind"`
+	User string `form:"user"`
+}
+
+// IsAPIKey reports whether a bearer token is an API key rather than a JWT.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, PersonalTokenPrefix) || strings.HasPrefix(token, ServiceKeyPrefix)
+}
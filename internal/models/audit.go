@@ -0,0 +1,74 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	AuditSignUp                   = "signup"
+	AuditSignUpDuplicate          = "signup_duplicate"
+	AuditEmailVerified            = "email_verified"
+	AuditSignIn                   = "signin"
+	AuditSignInFailed             = "signin_failed"
+	AuditSignInLocked             = "signin_locked"
+	AuditTokenRevoked             = "token_revoked"
+	AuditAccountDeletionRequested = "account_deletion_requested"
+	AuditAccountPurged            = "account_purged"
+	AuditAccountExported          = "account_exported"
+	AuditPasswordResetRequested   = "password_reset_requested"
+	AuditPasswordReset            = "password_reset"
+	AuditPasswordChanged          = "password_changed"
+	AuditAdminUsersSearched       = "admin_users_searched"
+	AuditAdminUserViewed          = "admin_user_viewed"
+	AuditAdminUserAuditViewed     = "admin_user_audit_viewed"
+	AuditAdminUserDisabled        = "admin_user_disabled"
+	AuditAdminUserEnabled         = "admin_user_enabled"
+	AuditAdminUserUnlocked        = "admin_user_unlocked"
+	AuditAdminIPUnlocked          = "admin_ip_unlocked"
+	AuditAdminStatusChanged       = "admin_status_changed"
+	AuditAdminPasswordResetForced = "admin_password_reset_forced"
+	AuditAdminUserLoggedOut       = "admin_user_logged_out"
+	AuditAdminRolesUpdated        = "admin_roles_updated"
+	AuditAdminPermissionsUpdated  = "admin_permissions_updated"
+	AuditAdminRolesListed         = "admin_roles_listed"
+	AuditAdminRoleSaved           = "admin_role_saved"
+	AuditAdminRoleDeleted         = "admin_role_deleted"
+	AuditAdminTenantsListed       = "admin_tenants_listed"
+	AuditAdminTenantSaved         = "admin_tenant_saved"
+	AuditAdminTenantDeleted       = "admin_tenant_deleted"
+	AuditAdminUserDeleted         = "admin_user_deleted"
+	AuditOrgCreated               = "org_created"
+	AuditOrgMemberUpdated         = "org_member_updated"
+	AuditOrgMemberRemoved         = "org_member_removed"
+	AuditOrgInvitationSent        = "org_invitation_sent"
+	AuditOrgInvitationAccepted    = "org_invitation_accepted"
+	AuditOrgInvitationDeclined    = "org_invitation_declined"
+	AuditOrgInvitationRevoked     = "org_invitation_revoked"
+	AuditAPIKeyCreated            = "api_key_created"
+	AuditAPIKeyRevoked            = "api_key_revoked"
+)
+
+// AuditEvent records a security relevant action. UserID is the account the
+// action applies to and ActorID who performed it when that is someone else.
+// Email, IP and UserAgent are personal data and are scrubbed on purge.
+type AuditEvent struct {
+	ID        primitive.ObjectID     `bson:"_id,omitempty" json:"id"`
+	UserID    *primitive.ObjectID    `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	ActorID   *primitive.ObjectID    `bson:"actor_id,omitempty" json:"actor_id,omitempty"`
+	Action    string                 `bson:"action" json:"action"`
+	Email     string                 `bson:"email,omitempty" json:"email,omitempty"`
+	IP        string                 `bson:"ip,omitempty" json:"ip,omitempty"`
+	UserAgent string                 `bson:"user_agent,omitempty" json:"user_agent,omitempty"`
+	Metadata  map[string]interface{} `bson:"metadata,omitempty" json:"metadata,omitempty"`
+	CreatedAt time.Time              `bson:"created_at" json:"created_at"`
+}
+
+// RequestMeta carries details of the HTTP request into the services.
+type RequestMeta struct {
+	IP        string `json:"-"`
+	UserAgent string `json:"-"`
+	// TenantID is the tenant the request was resolved to.
+	TenantID string `json:"-"`
+}
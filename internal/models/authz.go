@@ -0,0 +1,9 @@
+package models
+
+// AuthzCheckInput asks whether the caller may perform Action on a resource.
+// The subject is always the holder of the access token presented.
+type AuthzCheckInput struct {
+	Action   string                 `json:"action" binding:"required"`
+	Resource map[string]interface{} `json:"resource"`
+	Context  map[string]interface{} `json:"context"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LinkedIdentity is an upstream identity provider account that can sign in as the user.
+type LinkedIdentity struct {
+	Provider string    `bson:"provider" json:"provider"`
+	Subject  string    `bson:"subject" json:"subject"`
+	Email    string    `bson:"email,omitempty" json:"email,omitempty"`
+	LinkedAt time.Time `bson:"linked_at" json:"linked_at"`
+}
+
+// OIDCState tracks an authorization request between the redirect to the
+// provider and its callback. LinkUserID is set for explicit account linking.
+type OIDCState struct {
+	ID           primitive.ObjectID  `bson:"_id,omitempty"`
+	State        string              `bson:"state"`
+	Provider     string              `bson:"provider"`
+	Nonce        string              `bson:"nonce"`
+	CodeVerifier string              `bson:"code_verifier"`
+	LinkUserID   *primitive.ObjectID `bson:"link_user_id,omitempty"`
+	ExpiresAt    time.Time           `bson:"expires_at"`
+	CreatedAt    time.Time           `bson:"created_at"`
+}
+
+// SAMLRequest ties an outstanding AuthnRequest to the RelayState sent with it,
+// so the response can be checked against the request that started the login.
+type SAMLRequest struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	RelayState string             `bson:"relay_state"`
+	Provider   string             `bson:"provider"`
+	RequestID  string             `bson:"request_id"`
+	ExpiresAt  time.Time          `bson:"expires_at"`
+	CreatedAt  time.Time          `bson:"created_at"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// LoginAttempts counts recent failed sign-ins for one key, either
+// "account:<hashed email>" or "ip:<address>". Keeping them in the database
+// lets every replica see the same counters. Documents expire once both the
+// counter and any lock have lapsed.
+type LoginAttempts struct {
+	Key         string     `bson:"_id" json:"key"`
+	Failures    int        `bson:"failures" json:"failures"`
+	LastFailure time.Time  `bson:"last_failure" json:"last_failure"`
+	LockedUntil *time.Time `bson:"locked_until,omitempty" json:"locked_until,omitempty"`
+	ExpiresAt   time.Time  `bson:"expires_at" json:"expires_at"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LoginChallenge is a single passwordless sign-in attempt. The magic-link
+// token and the OTP code are stored only as hashes; consuming either one
+// consumes the whole challenge.
+type LoginChallenge struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	UserID     primitive.ObjectID `bson:"user_id"`
+	TenantID   string             `bson:"tenant_id,omitempty"`
+	Email      string             `bson:"email"`
+	TokenHash  string             `bson:"token_hash"`
+	CodeHash   string             `bson:"code_hash"`
+	Attempts   int                `bson:"attempts"`
+	ExpiresAt  time.Time          `bson:"expires_at"`
+	ConsumedAt *time.Time         `bson:"consumed_at,omitempty"`
+	CreatedAt  time.Time          `bson:"created_at"`
+	// SecondFactor marks challenges sent after a password check, which are
+	// the only ones that can sign in to tenants that require MFA.
+	SecondFactor bool `bson:"second_factor,omitempty"`
+	// Scope is the OAuth scope granted at the password check.
+	Scope string `bson:"scope,omitempty"`
+}
+
+type MagicLinkInput struct {
+	Email string `json:"email" binding:"required"`
+	RequestMeta
+}
+
+type MagicLinkVerifyInput struct {
+	Token string `json:"token" binding:"required"`
+	RequestMeta
+}
+
+type OTPVerifyInput struct {
+	Email string `json:"email" binding:"required"`
+	Code  string `json:"code" binding:"required"`
+	RequestMeta
+}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Organization roles, from most to least privileged. Owners manage everything
+// including other owners, admins manage members and invitations, and members
+// have no management rights.
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+var ErrInvalidOrgRole = errors.New("organization role must be owner, admin or member")
+
+// Organization is a team of users within a tenant. Users may belong to any
+// number of organizations, with a role in each.
+type Organization struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TenantID  string             `bson:"tenant_id,omitempty" json:"-"`
+	Name      string             `bson:"name" json:"name"`
+	CreatedBy primitive.ObjectID `bson:"created_by" json:"created_by"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// Membership puts a user in an organization with a role.
+type Membership struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	OrgID     primitive.ObjectID `bson:"org_id" json:"org_id"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Email     string             `bson:"email" json:"email"`
+	Role      string             `bson:"role" json:"role"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// UserOrganization is an organization as listed for one of its members.
+type UserOrganization struct {
+	Organization `bson:",inline"`
+	Role         string `json:"role"`
+}
+
+// Invitation asks someone to join an organization by email. The token is
+// stored only as a hash and works once, to accept or to decline.
+type Invitation struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	OrgID      primitive.ObjectID `bson:"org_id" json:"org_id"`
+	Email      string             `bson:"email" json:"email"`
+	Role       string             `bson:"role" json:"role"`
+	TokenHash  string             `bson:"token_hash" json:"-"`
+	InvitedBy  primitive.ObjectID `bson:"invited_by" json:"invited_by"`
+	ExpiresAt  time.Time          `bson:"expires_at" json:"expires_at"`
+	ConsumedAt *time.Time         `bson:"consumed_at,omitempty" json:"-"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+}
+
+type CreateOrganizationInput struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type InviteMemberInput struct {
+	Email string `json:"email" binding:"required"`
+	Role  string `json:"role" binding:"required"`
+}
+
+type UpdateMemberInput struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// AcceptInvitationInput accepts an invitation. Password is only used when
+// the invitation creates a new account.
+type AcceptInvitationInput struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password"`
+	RequestMeta
+}
+
+type DeclineInvitationInput struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// SwitchOrganizationInput selects the organization new tokens act in. An
+// empty OrgID switches back to no organization.
+type SwitchOrganizationInput struct {
+	OrgID string `json:"org_id"`
+}
+
+func ValidateOrgRole(role string) error {
+	switch role {
+	case OrgRoleOwner, OrgRoleAdmin, OrgRoleMember:
+		return nil
+	}
+	return ErrInvalidOrgRole
+}
+
+// CanManageMembers reports whether role may invite, change and remove members.
+func CanManageMembers(role string) bool {
+	return role == OrgRoleOwner || role == OrgRoleAdmin
+}
@@ -0,0 +1,19 @@
+package models
+
+import "testing"
+
+func TestValidateOrgRole(t *testing.T) {
+    for _, role := range []string{OrgRoleOwner, OrgRoleAdmin, OrgRoleMember} {
+        if err := ValidateOrgRole(role); err != nil {
+            t.Errorf("Expected %q to be valid, got %v", role, err)
+        }
+    }
+    for _, role := range []string{"", "Owner", "guest"} {
+        if err := ValidateOrgRole(role); err != ErrInvalidOrgRole {
+            t.Errorf("Expected %q to be rejected, got %v", role, err)
+        }
+    }
+    if !CanManageMembers(OrgRoleAdmin) || CanManageMembers(OrgRoleMember) {
+        t.Error("Expected only owners and admins to manage members")
+    }
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// EmailVerification is a single-use sign-up confirmation token, stored only as
+// a hash.
+type EmailVerification struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	UserID     primitive.ObjectID `bson:"user_id"`
+	TokenHash  string             `bson:"token_hash"`
+	ExpiresAt  time.Time          `bson:"expires_at"`
+	ConsumedAt *time.Time         `bson:"consumed_at,omitempty"`
+	CreatedAt  time.Time          `bson:"created_at"`
+}
+
+type VerifyEmailInput struct {
+	Token string `json:"token" binding:"required"`
+}
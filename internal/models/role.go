@@ -0,0 +1,62 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// AdminRole is the built-in role that guards the /admin API. It is created
+// with every permission if it does not exist.
+const AdminRole = "admin"
+
+var ErrInvalidPermission = errors.New("permissions must be non-empty and contain no whitespace")
+
+// Role is a named set of permissions, stored in the roles collection. A
+// permission is a string such as "reports:read"; "reports:*" grants every
+// permission under "reports:" and "*" grants everything.
+type Role struct {
+	Name        string    `bson:"_id" json:"name"`
+	Description string    `bson:"description,omitempty" json:"description,omitempty"`
+	Permissions []string  `bson:"permissions" json:"permissions"`
+	CreatedAt   time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+type RoleInput struct {
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+type UpdatePermissionsInput struct {
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+// ValidatePermissions rejects empty permissions and ones containing
+// whitespace, which could not be told apart in a scope-like list.
+func ValidatePermissions(permissions []string) error {
+	for _, permission := range permissions {
+		if permission == "" || strings.IndexFunc(permission, isSpace) >= 0 {
+			return ErrInvalidPermission
+		}
+	}
+	return nil
+}
+
+// HasPermission reports whether any of granted covers required, directly or
+// through a wildcard.
+func HasPermission(granted []string, required string) bool {
+	for _, permission := range granted {
+		if permission == "*" || permission == required {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(permission, "*"); ok && strings.HasPrefix(required, prefix) && strings.HasSuffix(prefix, ":") {
+			return true
+		}
+	}
+	return false
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r'
+}
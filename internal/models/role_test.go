@@ -0,0 +1,36 @@
+package models
+
+import "testing"
+
+func TestHasPermission(t *testing.T) {
+    cases := []struct {
+        granted  []string
+        required string
+        expected bool
+    }{
+        {[]string{"reports:read"}, "reports:read", true},
+        {[]string{"reports:read"}, "reports:write", false},
+        {[]string{"reports:*"}, "reports:write", true},
+        {[]string{"reports:*"}, "reports:exports:create", true},
+        {[]string{"reports:*"}, "reportsadmin:read", false},
+        {[]string{"report*"}, "reports:read", false},
+        {[]string{"*"}, "anything", true},
+        {nil, "reports:read", false},
+    }
+    for _, c := range cases {
+        if got := HasPermission(c.granted, c.required); got != c.expected {
+            t.Errorf("HasPermission(%v, %q) = %v, expected %v", c.granted, c.required, got, c.expected)
+        }
+    }
+}
+
+func TestValidatePermissions(t *testing.T) {
+    if err := ValidatePermissions([]string{"reports:read", "*"}); err != nil {
+        t.Errorf("Expected valid permissions, got %v", err)
+    }
+    for _, permissions := range [][]string{{""}, {"reports read"}, {"reports:read\n"}} {
+        if err := ValidatePermissions(permissions); err != ErrInvalidPermission {
+            t.Errorf("Expected %q to be rejected, got %v", permissions, err)
+        }
+    }
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"time"
+)
+
+// DefaultTenant is the tenant of requests that resolve to no tenant.
+// Its users are stored without a tenant_id, as every user was before tenants
+// existed, and it has no settings document.
+const DefaultTenant = ""
+
+var (
+	ErrInvalidTenantID       = errors.New("tenant IDs must be 1-63 lowercase letters, digits or hyphens")
+	ErrInvalidTenantSettings = errors.New("invalid tenant settings")
+)
+
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// Tenant is a customer whose users, tokens and settings are kept apart from
+// every other one. Users sign up and sign in within a tenant, and the
+// same email may be registered once per tenant.
+type Tenant struct {
+	ID        string         `bson:"_id" json:"id"`
+	Name      string         `bson:"name,omitempty" json:"name,omitempty"`
+	Hosts     []string       `bson:"hosts,omitempty" json:"hosts,omitempty"`
+	Settings  TenantSettings `bson:"settings" json:"settings"`
+	CreatedAt time.Time      `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time      `bson:"updated_at" json:"updated_at"`
+}
+
+// TenantSettings override the service-wide configuration for one tenant.
+// Unset fields keep the service-wide value.
+type TenantSettings struct {
+	PasswordMinLength *int `bson:"password_min_length,omitempty" json:"password_min_length,omitempty"`
+	PasswordMinScore  *int `bson:"password_min_score,omitempty" json:"password_min_score,omitempty"`
+	// RequireMFA makes password sign-in send a one-time code to the user's
+	// email, and only issues tokens once it is entered.
+	RequireMFA bool `bson:"require_mfa,omitempty" json:"require_mfa,omitempty"`
+	// Token lifetimes are Go durations such as "15m" or "72h".
+	AccessTokenLifetime  string `bson:"access_token_lifetime,omitempty" json:"access_token_lifetime,omitempty"`
+	RefreshTokenLifetime string `bson:"refresh_token_lifetime,omitempty" json:"refresh_token_lifetime,omitempty"`
+}
+
+type TenantInput struct {
+	Name     string         `json:"name"`
+	Hosts    []string       `json:"hosts"`
+	Settings TenantSettings `json:"settings"`
+}
+
+func ValidateTenantID(id string) error {
+	if !tenantIDPattern.MatchString(id) {
+		return ErrInvalidTenantID
+	}
+	return nil
+}
+
+func (s TenantSettings) Validate() error {
+	if s.PasswordMinLength != nil && *s.PasswordMinLength < 1 {
+		return ErrInvalidTenantSettings
+	}
+	if s.PasswordMinScore != nil && (*s.PasswordMinScore < 0 || *s.PasswordMinScore > 4) {
+		return ErrInvalidTenantSettings
+	}
+	for _, lifetime := range []string{s.AccessTokenLifetime, s.RefreshTokenLifetime} {
+		if lifetime == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(lifetime); err != nil || d <= 0 {
+			return ErrInvalidTenantSettings
+		}
+	}
+	return nil
+}
+
+// AccessTokenTTL returns the access token lifetime, or zero for the default.
+func (s TenantSettings) AccessTokenTTL() time.Duration {
+	d, _ := time.ParseDuration(s.AccessTokenLifetime)
+	return d
+}
+
+// RefreshTokenTTL returns the refresh token lifetime, or zero for the default.
+func (s TenantSettings) RefreshTokenTTL() time.Duration {
+	d, _ := time.ParseDuration(s.RefreshTokenLifetime)
+	return d
+}
@@ -0,0 +1,41 @@
+package models
+
+import "testing"
+
+func TestValidateTenantID(t *testing.T) {
+    for _, id := range []string{"acme", "acme-eu", "a1"} {
+        if err := ValidateTenantID(id); err != nil {
+            t.Errorf("Expected %q to be valid, got %v", id, err)
+        }
+    }
+    for _, id := range []string{"", "Acme", "-acme", "acme-", "acme/eu", "acme eu"} {
+        if err := ValidateTenantID(id); err != ErrInvalidTenantID {
+            t.Errorf("Expected %q to be rejected, got %v", id, err)
+        }
+    }
+}
+
+func TestTenantSettingsValidate(t *testing.T) {
+    zero, five := 0, 5
+    valid := TenantSettings{AccessTokenLifetime: "15m", RefreshTokenLifetime: "72h", PasswordMinScore: &zero}
+    if err := valid.Validate(); err != nil {
+        t.Errorf("Expected valid settings, got %v", err)
+    }
+    if valid.AccessTokenTTL().Minutes() != 15 || valid.RefreshTokenTTL().Hours() != 72 {
+        t.Errorf("Unexpected lifetimes %v, %v", valid.AccessTokenTTL(), valid.RefreshTokenTTL())
+    }
+    if (TenantSettings{}).AccessTokenTTL() != 0 {
+        t.Error("Expected unset lifetime to be zero")
+    }
+
+    for _, settings := range []TenantSettings{
+        {AccessTokenLifetime: "soon"},
+        {RefreshTokenLifetime: "-1h"},
+        {PasswordMinLength: &zero},
+        {PasswordMinScore: &five},
+    } {
+        if err := settings.Validate(); err != ErrInvalidTenantSettings {
+            t.Errorf("Expected %+v to be rejected, got %v", settings, err)
+        }
+    }
+}
@@ -8,12 +8,32 @@ import (
 
 type User struct {
 	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	TenantID     string            `bson:"tenant_id,omitempty" json:"tenant_id,omitempty"`
 	Email        string            `bson:"email" json:"email"`
+	Name         string            `bson:"name,omitempty" json:"name,omitempty"`
+	Roles        []string          `bson:"roles,omitempty" json:"roles,omitempty"`
+	Permissions  []string          `bson:"permissions,omitempty" json:"permissions,omitempty"`
+	// DirectoryRoles are the roles an LDAP directory granted at the last
+	// sign-in, which the next sign-in may take away again.
+	DirectoryRoles []string        `bson:"directory_roles,omitempty" json:"-"`
 	Password     string            `bson:"password" json:"-"`
 	CreatedAt    time.Time         `bson:"created_at" json:"created_at"`
 	UpdatedAt    time.Time         `bson:"updated_at" json:"updated_at"`
 	RefreshToken string            `bson:"refresh_token,omitempty" json:"-"`
 	RevokedTokens []RevokedToken    `bson:"revoked_tokens,omitempty" json:"-"`
+	Identities    []LinkedIdentity  `bson:"identities,omitempty" json:"identities,omitempty"`
+	Status        AccountStatus     `bson:"status,omitempty" json:"status,omitempty"`
+	// EmailVerifiedAt is when the user last proved they own Email, by an
+	// emailed token or a verified email from an identity provider.
+	EmailVerifiedAt *time.Time      `bson:"email_verified_at,omitempty" json:"email_verified_at,omitempty"`
+	StatusReason  string            `bson:"status_reason,omitempty" json:"status_reason,omitempty"`
+	StatusUntil   *time.Time        `bson:"status_until,omitempty" json:"status_until,omitempty"`
+	PasswordResetRequired bool      `bson:"password_reset_required,omitempty" json:"password_reset_required,omitempty"`
+	// TokenGeneration is raised to invalidate every token issued before;
+	// tokens carry the generation they were issued in.
+	TokenGeneration int64           `bson:"token_generation,omitempty" json:"-"`
+	DeletedAt     *time.Time        `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+	PurgeAfter    *time.Time        `bson:"purge_after,omitempty" json:"purge_after,omitempty"`
 }
 
 type RevokedToken struct {
@@ -24,18 +44,36 @@ type RevokedToken struct {
 type SignUpInput struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	RequestMeta
 }
 
 type SignInInput struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	// Scope is the space-separated OAuth scope requested; empty asks for
+	// the default scope.
+	Scope string `json:"scope"`
+	RequestMeta
 }
 
 type TokenResponse struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope,omitempty"`
 }
 
 type RefreshTokenInput struct {
-	RefreshToken string `json:"refresh_token" binding:"required"`
-}
\ No newline at end of file
+	// RefreshToken may be left out in a cookie session, where it is read
+	// from the refresh cookie.
+	RefreshToken string `json:"refresh_token"`
+	// Scope narrows the new access token; empty keeps the scope originally
+	// granted.
+	Scope string `json:"scope"`
+	RequestMeta
+}
+// LinkDirectoryInput is the directory login and password of the LDAP account
+// to link to the signed-in user.
+type LinkDirectoryInput struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
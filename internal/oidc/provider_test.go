@@ -0,0 +1,82 @@
+package oidc_test
+
+import (
+    "context"
+    "net/http"
+    "net/url"
+    "testing"
+
+    "github.com/SinisterSup/auth-service/internal/oidc"
+    "github.com/SinisterSup/auth-service/internal/oidc/oidctest"
+)
+
+func authorize(t *testing.T, authURL string) url.Values {
+    client := &http.Client{
+        CheckRedirect: func(req *http.Request, via []*http.Request) error {
+            return http.ErrUseLastResponse
+        },
+    }
+    resp, err := client.Get(authURL)
+    if err != nil {
+        t.Fatalf("Authorize request failed: %v", err)
+    }
+    defer resp.Body.Close()
+
+    location, err := url.Parse(resp.Header.Get("Location"))
+    if err != nil {
+        t.Fatalf("Invalid redirect: %v", err)
+    }
+    return location.Query()
+}
+
+func TestAuthCodeFlowWithPKCE(t *testing.T) {
+    idp := oidctest.NewServer("test-client")
+    defer idp.Close()
+    idp.SetUser(oidctest.User{Subject: "user-1", Email: "test@example.com", EmailVerified: true})
+
+    provider := oidc.NewProvider(idp.Config("mock", "http://localhost/callback"))
+    ctx := context.Background()
+
+    verifier, challenge, err := oidc.NewPKCE()
+    if err != nil {
+        t.Fatalf("Failed to create PKCE pair: %v", err)
+    }
+    authURL, err := provider.AuthCodeURL(ctx, "state-1", "nonce-1", challenge)
+    if err != nil {
+        t.Fatalf("Failed to build auth URL: %v", err)
+    }
+
+    params := authorize(t, authURL)
+    if params.Get("state") != "state-1" {
+        t.Errorf("Expected state to round-trip, got %q", params.Get("state"))
+    }
+
+    claims, err := provider.Exchange(ctx, params.Get("code"), verifier, "nonce-1")
+    if err != nil {
+        t.Fatalf("Failed to exchange code: %v", err)
+    }
+    if claims.Subject != "user-1" || claims.Email != "test@example.com" || !claims.EmailVerified {
+        t.Errorf("Unexpected claims: %+v", claims)
+    }
+}
+
+func TestExchangeRejectsWrongVerifierAndNonce(t *testing.T) {
+    idp := oidctest.NewServer("test-client")
+    defer idp.Close()
+    idp.SetUser(oidctest.User{Subject: "user-1"})
+
+    provider := oidc.NewProvider(idp.Config("mock", "http://localhost/callback"))
+    ctx := context.Background()
+
+    _, challenge, _ := oidc.NewPKCE()
+    authURL, _ := provider.AuthCodeURL(ctx, "state", "nonce", challenge)
+    if _, err := provider.Exchange(ctx, authorize(t, authURL).Get("code"), "wrong-verifier", "nonce"); err == nil {
+        t.Error("Expected error for wrong code verifier, got nil")
+    }
+
+    verifier, challenge, _ := oidc.NewPKCE()
+    authURL, _ = provider.AuthCodeURL(ctx, "state", "nonce", challenge)
+    if _, err := provider.Exchange(ctx, authorize(t, authURL).Get("code"), verifier, "other-nonce"); err == nil {
+        t.Error("Expected error for nonce mismatch, got nil")
+    }
+}
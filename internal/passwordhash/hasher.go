@@ -0,0 +1,205 @@
+// Package passwordhash hashes and verifies passwords with argon2id, scrypt or
+// bcrypt, stores them in PHC string format, and tells callers when a stored
+// hash should be upgraded to the current algorithm and parameters.
+package passwordhash
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// pepperParam records in the hash which pepper it was made with.
+const pepperParam = "pk"
+
+// PasswordHasher hashes new passwords and checks them against stored hashes.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(password, encoded string) (bool, error)
+	// NeedsRehash reports whether encoded was made with an older algorithm,
+	// other parameters or another pepper than Hash would use now.
+	NeedsRehash(encoded string) bool
+}
+
+// Hasher makes new hashes with one scheme and verifies hashes from all of them,
+// including plain bcrypt hashes from before PHC strings were used. With a
+// pepper configured the password is first keyed with HMAC-SHA256, so a leaked
+// database alone is not enough to test guesses.
+type Hasher struct {
+	scheme   scheme
+	schemes  map[string]scheme
+	pepperID string
+	peppers  map[string][]byte
+}
+
+type Option func(*Hasher)
+
+// WithPepper sets the pepper for new hashes. Peppers added with
+// WithPreviousPepper still verify until each user signs in and is rehashed.
+func WithPepper(id string, key []byte) Option {
+	return func(h *Hasher) {
+		h.pepperID = id
+		h.peppers[id] = key
+	}
+}
+
+func WithPreviousPepper(id string, key []byte) Option {
+	return func(h *Hasher) {
+		h.peppers[id] = key
+	}
+}
+
+func New(current scheme, options ...Option) *Hasher {
+	h := &Hasher{
+		scheme: current,
+		schemes: map[string]scheme{
+			"argon2id":      DefaultArgon2id,
+			"scrypt":        DefaultScrypt,
+			"bcrypt-sha256": DefaultBcrypt,
+		},
+		peppers: make(map[string][]byte),
+	}
+	h.schemes[current.id()] = current
+	for _, option := range options {
+		option(h)
+	}
+	return h
+}
+
+var (
+	DefaultArgon2id = Argon2id{Memory: 64 * 1024, Iterations: 3, Parallelism: 2, SaltLength: 16, KeyLength: 32}
+	DefaultScrypt   = Scrypt{N: 1 << 15, R: 8, P: 1, SaltLength: 16, KeyLength: 32}
+	DefaultBcrypt   = Bcrypt{Cost: 12}
+)
+
+// NewFromEnv selects PASSWORD_HASH_ALGORITHM (argon2id by default, scrypt or
+// bcrypt) with its ARGON2_*, SCRYPT_* or BCRYPT_COST parameters, and the
+// pepper from PASSWORD_PEPPER / PASSWORD_PEPPER_ID. Retired peppers go in
+// PASSWORD_PREVIOUS_PEPPERS as "id:key,id:key".
+func NewFromEnv() (*Hasher, error) {
+	var current scheme
+	switch algorithm := os.Getenv("PASSWORD_HASH_ALGORITHM"); algorithm {
+	case "", "argon2id":
+		a := DefaultArgon2id
+		a.Memory = uint32(intFromEnv("ARGON2_MEMORY", int(a.Memory)))
+		a.Iterations = uint32(intFromEnv("ARGON2_ITERATIONS", int(a.Iterations)))
+		a.Parallelism = uint8(intFromEnv("ARGON2_PARALLELISM", int(a.Parallelism)))
+		current = a
+	case "scrypt":
+		s := DefaultScrypt
+		s.N = intFromEnv("SCRYPT_N", s.N)
+		s.R = intFromEnv("SCRYPT_R", s.R)
+		s.P = intFromEnv("SCRYPT_P", s.P)
+		if s.N < 2 || s.N&(s.N-1) != 0 {
+			return nil, errors.New("SCRYPT_N must be a power of two")
+		}
+		current = s
+	case "bcrypt":
+		b := DefaultBcrypt
+		b.Cost = intFromEnv("BCRYPT_COST", b.Cost)
+		if b.Cost < bcrypt.MinCost || b.Cost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		current = b
+	default:
+		return nil, fmt.Errorf("unknown PASSWORD_HASH_ALGORITHM %q", algorithm)
+	}
+
+	var options []Option
+	if pepper := os.Getenv("PASSWORD_PEPPER"); pepper != "" {
+		id := os.Getenv("PASSWORD_PEPPER_ID")
+		if id == "" {
+			id = "1"
+		}
+		options = append(options, WithPepper(id, []byte(pepper)))
+	}
+	for _, entry := range strings.Split(os.Getenv("PASSWORD_PREVIOUS_PEPPERS"), ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		id, key, ok := strings.Cut(entry, ":")
+		if !ok || id == "" || key == "" {
+			return nil, errors.New(`PASSWORD_PREVIOUS_PEPPERS must look like "id:key,id:key"`)
+		}
+		options = append(options, WithPreviousPepper(id, []byte(key)))
+	}
+	return New(current, options...), nil
+}
+
+func (h *Hasher) secret(password, pepperID string) ([]byte, error) {
+	if pepperID == "" {
+		return []byte(password), nil
+	}
+	key, ok := h.peppers[pepperID]
+	if !ok {
+		return nil, fmt.Errorf("unknown pepper %q", pepperID)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(password))
+	return mac.Sum(nil), nil
+}
+
+func (h *Hasher) Hash(password string) (string, error) {
+	secret, err := h.secret(password, h.pepperID)
+	if err != nil {
+		return "", err
+	}
+	encoded, err := h.scheme.hash(secret)
+	if err != nil {
+		return "", err
+	}
+	if h.pepperID != "" {
+		encoded.setParam(pepperParam, h.pepperID)
+	}
+	return encoded.String(), nil
+}
+
+func (h *Hasher) Verify(password, encoded string) (bool, error) {
+	if isLegacyBcrypt(encoded) {
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	parsed, err := parsePHC(encoded)
+	if err != nil {
+		return false, err
+	}
+	scheme, ok := h.schemes[parsed.id]
+	if !ok {
+		return false, fmt.Errorf("unsupported password hash %q", parsed.id)
+	}
+	secret, err := h.secret(password, parsed.param(pepperParam))
+	if err != nil {
+		return false, err
+	}
+	return scheme.verify(secret, parsed)
+}
+
+func (h *Hasher) NeedsRehash(encoded string) bool {
+	parsed, err := parsePHC(encoded)
+	if err != nil || isLegacyBcrypt(encoded) {
+		return true
+	}
+	return !h.scheme.current(parsed) || parsed.param(pepperParam) != h.pepperID
+}
+
+func isLegacyBcrypt(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func intFromEnv(name string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,140 @@
+package passwordhash
+
+import (
+    "strings"
+    "testing"
+
+    "golang.org/x/crypto/bcrypt"
+)
+
+var (
+    fastArgon2id = Argon2id{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+    fastScrypt   = Scrypt{N: 1 << 10, R: 8, P: 1, SaltLength: 16, KeyLength: 32}
+    fastBcrypt   = Bcrypt{Cost: bcrypt.MinCost}
+)
+
+func TestRoundTrip(t *testing.T) {
+    for _, scheme := range []scheme{fastArgon2id, fastScrypt, fastBcrypt} {
+        t.Run(scheme.id(), func(t *testing.T) {
+            hasher := New(scheme)
+
+            encoded, err := hasher.Hash("correct horse")
+            if err != nil {
+                t.Fatalf("Failed to hash: %v", err)
+            }
+            if !strings.HasPrefix(encoded, "$"+scheme.id()+"$") {
+                t.Errorf("Expected PHC string for %s, got %q", scheme.id(), encoded)
+            }
+            if ok, err := hasher.Verify("correct horse", encoded); !ok || err != nil {
+                t.Errorf("Expected password to verify, got %v, %v", ok, err)
+            }
+            if ok, _ := hasher.Verify("wrong horse", encoded); ok {
+                t.Error("Expected wrong password to fail")
+            }
+            if hasher.NeedsRehash(encoded) {
+                t.Error("Expected fresh hash to be current")
+            }
+        })
+    }
+}
+
+func TestPHCFormat(t *testing.T) {
+    encoded, err := New(fastArgon2id).Hash("secret")
+    if err != nil {
+        t.Fatalf("Failed to hash: %v", err)
+    }
+    parts := strings.Split(encoded, "$")
+    if len(parts) != 6 || parts[1] != "argon2id" || parts[2] != "v=19" || parts[3] != "m=1024,t=1,p=1" {
+        t.Errorf("Unexpected argon2id encoding %q", encoded)
+    }
+
+    encoded, _ = New(fastScrypt).Hash("secret")
+    if parts := strings.Split(encoded, "$"); len(parts) != 5 || parts[2] != "ln=10,r=8,p=1" {
+        t.Errorf("Unexpected scrypt encoding %q", encoded)
+    }
+
+    if _, err := New(fastArgon2id).Verify("secret", "$argon2id$v=19$m=1024"); err == nil {
+        t.Error("Expected malformed hash to be rejected")
+    }
+}
+
+func TestBcryptDoesNotTruncate(t *testing.T) {
+    hasher := New(fastBcrypt)
+    long := strings.Repeat("a", 72)
+
+    encoded, err := hasher.Hash(long + "1")
+    if err != nil {
+        t.Fatalf("Failed to hash: %v", err)
+    }
+    if ok, _ := hasher.Verify(long+"2", encoded); ok {
+        t.Error("Expected passwords differing after 72 bytes to differ")
+    }
+}
+
+func TestLegacyBcryptIsUpgraded(t *testing.T) {
+    legacy, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    hasher := New(fastArgon2id)
+    if ok, err := hasher.Verify("password123", string(legacy)); !ok || err != nil {
+        t.Errorf("Expected legacy bcrypt hash to verify, got %v, %v", ok, err)
+    }
+    if !hasher.NeedsRehash(string(legacy)) {
+        t.Error("Expected legacy bcrypt hash to need a rehash")
+    }
+}
+
+func TestParameterChangeNeedsRehash(t *testing.T) {
+    encoded, _ := New(fastArgon2id).Hash("secret")
+
+    stronger := fastArgon2id
+    stronger.Iterations = 2
+    hasher := New(stronger)
+    if !hasher.NeedsRehash(encoded) {
+        t.Error("Expected hash with old parameters to need a rehash")
+    }
+    if ok, _ := hasher.Verify("secret", encoded); !ok {
+        t.Error("Expected hash with old parameters to still verify")
+    }
+    if !New(fastScrypt).NeedsRehash(encoded) {
+        t.Error("Expected hash from another algorithm to need a rehash")
+    }
+}
+
+func TestPepper(t *testing.T) {
+    old := New(fastArgon2id, WithPepper("1", []byte("old pepper")))
+    encoded, err := old.Hash("secret")
+    if err != nil {
+        t.Fatalf("Failed to hash: %v", err)
+    }
+    if !strings.Contains(encoded, ",pk=1$") {
+        t.Errorf("Expected pepper ID in hash, got %q", encoded)
+    }
+
+    if ok, _ := New(fastArgon2id).Verify("secret", encoded); ok {
+        t.Error("Expected peppered hash not to verify without the pepper")
+    }
+
+    rotated := New(fastArgon2id, WithPepper("2", []byte("new pepper")), WithPreviousPepper("1", []byte("old pepper")))
+    if ok, err := rotated.Verify("secret", encoded); !ok || err != nil {
+        t.Errorf("Expected previous pepper to verify, got %v, %v", ok, err)
+    }
+    if !rotated.NeedsRehash(encoded) {
+        t.Error("Expected hash with a previous pepper to need a rehash")
+    }
+}
+
+func TestNewFromEnv(t *testing.T) {
+    t.Setenv("PASSWORD_HASH_ALGORITHM", "scrypt")
+    t.Setenv("SCRYPT_N", "1000")
+    if _, err := NewFromEnv(); err == nil {
+        t.Error("Expected non power of two SCRYPT_N to be rejected")
+    }
+
+    t.Setenv("PASSWORD_HASH_ALGORITHM", "md5")
+    if _, err := NewFromEnv(); err == nil {
+        t.Error("Expected unknown algorithm to be rejected")
+    }
+}
@@ -0,0 +1,94 @@
+package passwordhash
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var ErrMalformedHash = errors.New("malformed password hash")
+
+// phc is a hash in PHC string format:
+// $<id>[$v=<version>][$<param>=<value>(,<param>=<value>)*][$<salt>[$<hash>]]
+type phc struct {
+	id      string
+	version string
+	params  [][2]string
+	salt    string
+	hash    string
+}
+
+func parsePHC(encoded string) (*phc, error) {
+	fields := strings.Split(encoded, "$")
+	if len(fields) < 2 || fields[0] != "" || fields[1] == "" {
+		return nil, ErrMalformedHash
+	}
+
+	p := &phc{id: fields[1]}
+	rest := fields[2:]
+	if len(rest) > 0 && strings.HasPrefix(rest[0], "v=") && !strings.Contains(rest[0], ",") {
+		p.version = strings.TrimPrefix(rest[0], "v=")
+		rest = rest[1:]
+	}
+	if len(rest) > 0 && strings.Contains(rest[0], "=") {
+		for _, pair := range strings.Split(rest[0], ",") {
+			name, value, ok := strings.Cut(pair, "=")
+			if !ok || name == "" {
+				return nil, ErrMalformedHash
+			}
+			p.params = append(p.params, [2]string{name, value})
+		}
+		rest = rest[1:]
+	}
+	if len(rest) != 2 || rest[0] == "" || rest[1] == "" {
+		return nil, ErrMalformedHash
+	}
+	p.salt, p.hash = rest[0], rest[1]
+	return p, nil
+}
+
+func (p *phc) String() string {
+	var b strings.Builder
+	b.WriteString("$" + p.id)
+	if p.version != "" {
+		b.WriteString("$v=" + p.version)
+	}
+	if len(p.params) > 0 {
+		b.WriteString("$")
+		for i, param := range p.params {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString(param[0] + "=" + param[1])
+		}
+	}
+	b.WriteString("$" + p.salt + "$" + p.hash)
+	return b.String()
+}
+
+func (p *phc) param(name string) string {
+	for _, param := range p.params {
+		if param[0] == name {
+			return param[1]
+		}
+	}
+	return ""
+}
+
+func (p *phc) intParam(name string) (int, error) {
+	value, err := strconv.Atoi(p.param(name))
+	if err != nil || value <= 0 {
+		return 0, ErrMalformedHash
+	}
+	return value, nil
+}
+
+func (p *phc) setParam(name, value string) {
+	for i, param := range p.params {
+		if param[0] == name {
+			p.params[i][1] = value
+			return
+		}
+	}
+	p.params = append(p.params, [2]string{name, value})
+}
@@ -0,0 +1,273 @@
+package passwordhash
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrSaturated is returned when the pool's queue is full or a job waited
+// longer than the pool allows. Callers should answer 503 and let the client
+// retry instead of piling more work onto a busy CPU.
+var ErrSaturated = errors.New("password hashing is overloaded, try again later")
+
+// waitBuckets are the upper bounds of the queue wait histogram.
+var waitBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+const (
+	jobQueued int32 = iota
+	jobRunning
+	jobAbandoned
+)
+
+type PoolConfig struct {
+	// Workers is how many hashes run at once. It defaults to the CPU count.
+	Workers int
+	// QueueSize is how many jobs may wait for a worker before new ones are
+	// rejected. It defaults to eight per worker.
+	QueueSize int
+	// MaxWait bounds how long a job waits for a worker. Zero means until the
+	// caller's context is done.
+	MaxWait time.Duration
+}
+
+// Pool runs a PasswordHasher on a fixed number of workers behind a bounded
+// queue, so a burst of sign-ins cannot occupy every CPU. Jobs whose caller
+// gave up before a worker picked them up are skipped.
+type Pool struct {
+	hasher  PasswordHasher
+	jobs    chan *job
+	config  PoolConfig
+	metrics poolMetrics
+}
+
+type job struct {
+	run      func()
+	enqueued time.Time
+	state    atomic.Int32
+	done     chan struct{}
+}
+
+type poolMetrics struct {
+	running   atomic.Int64
+	completed atomic.Uint64
+	rejected  atomic.Uint64
+	abandoned atomic.Uint64
+	waitTotal atomic.Int64
+	waitMax   atomic.Int64
+	waits     []atomic.Uint64
+}
+
+// PoolStats is a snapshot of a pool's load and of how long jobs waited for a
+// worker.
+type PoolStats struct {
+	Workers       int          `json:"workers"`
+	QueueSize     int          `json:"queue_size"`
+	Queued        int          `json:"queued"`
+	Running       int64        `json:"running"`
+	Completed     uint64       `json:"completed"`
+	Rejected      uint64       `json:"rejected"`
+	Abandoned     uint64       `json:"abandoned"`
+	WaitTotal     float64      `json:"wait_seconds_total"`
+	WaitMax       float64      `json:"wait_seconds_max"`
+	WaitHistogram []WaitBucket `json:"wait_histogram"`
+}
+
+// WaitBucket counts jobs that waited at most LessOrEqual, a duration such as
+// "10ms". Counts are cumulative like a Prometheus histogram, and the last
+// bucket is "+Inf".
+type WaitBucket struct {
+	LessOrEqual string `json:"le"`
+	Count       uint64 `json:"count"`
+}
+
+func NewPool(hasher PasswordHasher, config PoolConfig) *Pool {
+	if config.Workers <= 0 {
+		config.Workers = runtime.NumCPU()
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = config.Workers * 8
+	}
+
+	p := &Pool{
+		hasher:  hasher,
+		jobs:    make(chan *job, config.QueueSize),
+		config:  config,
+		metrics: poolMetrics{waits: make([]atomic.Uint64, len(waitBuckets)+1)},
+	}
+	for i := 0; i < config.Workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// NewPoolFromEnv sizes the pool from PASSWORD_HASH_WORKERS,
+// PASSWORD_HASH_QUEUE and PASSWORD_HASH_MAX_WAIT (2s by default).
+func NewPoolFromEnv(hasher PasswordHasher) *Pool {
+	maxWait, err := time.ParseDuration(os.Getenv("PASSWORD_HASH_MAX_WAIT"))
+	if err != nil || maxWait <= 0 {
+		maxWait = 2 * time.Second
+	}
+	return NewPool(hasher, PoolConfig{
+		Workers:   intFromEnv("PASSWORD_HASH_WORKERS", 0),
+		QueueSize: intFromEnv("PASSWORD_HASH_QUEUE", 0),
+		MaxWait:   maxWait,
+	})
+}
+
+func (p *Pool) Hash(ctx context.Context, password string) (string, error) {
+	var encoded string
+	var err error
+	if submitErr := p.submit(ctx, func() { encoded, err = p.hasher.Hash(password) }); submitErr != nil {
+		return "", submitErr
+	}
+	return encoded, err
+}
+
+func (p *Pool) Verify(ctx context.Context, password, encoded string) (bool, error) {
+	var ok bool
+	var err error
+	if submitErr := p.submit(ctx, func() { ok, err = p.hasher.Verify(password, encoded) }); submitErr != nil {
+		return false, submitErr
+	}
+	return ok, err
+}
+
+// NeedsRehash only parses the hash, so it runs on the caller's goroutine.
+func (p *Pool) NeedsRehash(encoded string) bool {
+	return p.hasher.NeedsRehash(encoded)
+}
+
+// submit queues run and waits for it to finish. It fails fast with
+// ErrSaturated when the queue is full, and gives up with ErrSaturated or the
+// context's error if no worker picks the job up in time. Once a worker has
+// started the job, submit always waits for it.
+func (p *Pool) submit(ctx context.Context, run func()) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	j := &job{run: run, enqueued: time.Now(), done: make(chan struct{})}
+	select {
+	case p.jobs <- j:
+	default:
+		p.metrics.rejected.Add(1)
+		return ErrSaturated
+	}
+
+	var timeout <-chan time.Time
+	if p.config.MaxWait > 0 {
+		timer := time.NewTimer(p.config.MaxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-j.done:
+		return nil
+	case <-ctx.Done():
+		if j.state.CompareAndSwap(jobQueued, jobAbandoned) {
+			return ctx.Err()
+		}
+	case <-timeout:
+		if j.state.CompareAndSwap(jobQueued, jobAbandoned) {
+			p.metrics.rejected.Add(1)
+			return ErrSaturated
+		}
+	}
+	<-j.done
+	return nil
+}
+
+func (p *Pool) work() {
+	for j := range p.jobs {
+		if !j.state.CompareAndSwap(jobQueued, jobRunning) {
+			p.metrics.abandoned.Add(1)
+			continue
+		}
+		p.metrics.observeWait(time.Since(j.enqueued))
+
+		p.metrics.running.Add(1)
+		j.run()
+		p.metrics.running.Add(-1)
+		p.metrics.completed.Add(1)
+		close(j.done)
+	}
+}
+
+func (m *poolMetrics) observeWait(wait time.Duration) {
+	m.waitTotal.Add(int64(wait))
+	for {
+		longest := m.waitMax.Load()
+		if int64(wait) <= longest || m.waitMax.CompareAndSwap(longest, int64(wait)) {
+			break
+		}
+	}
+
+	bucket := len(waitBuckets)
+	for i, bound := range waitBuckets {
+		if wait <= bound {
+			bucket = i
+			break
+		}
+	}
+	m.waits[bucket].Add(1)
+}
+
+func (p *Pool) Stats() PoolStats {
+	stats := PoolStats{
+		Workers:   p.config.Workers,
+		QueueSize: p.config.QueueSize,
+		Queued:    len(p.jobs),
+		Running:   p.metrics.running.Load(),
+		Completed: p.metrics.completed.Load(),
+		Rejected:  p.metrics.rejected.Load(),
+		Abandoned: p.metrics.abandoned.Load(),
+		WaitTotal: time.Duration(p.metrics.waitTotal.Load()).Seconds(),
+		WaitMax:   time.Duration(p.metrics.waitMax.Load()).Seconds(),
+	}
+
+	var cumulative uint64
+	for i := range p.metrics.waits {
+		cumulative += p.metrics.waits[i].Load()
+		le := "+Inf"
+		if i < len(waitBuckets) {
+			le = waitBuckets[i].String()
+		}
+		stats.WaitHistogram = append(stats.WaitHistogram, WaitBucket{LessOrEqual: le, Count: cumulative})
+	}
+	return stats
+}
+
+var (
+	publishOnce sync.Once
+	published   atomic.Pointer[Pool]
+)
+
+// Publish exposes the pool's stats as the expvar "password_hashing". Only the
+// most recently published pool is reported.
+func (p *Pool) Publish() {
+	published.Store(p)
+	publishOnce.Do(func() {
+		expvar.Publish("password_hashing", expvar.Func(func() any {
+			if pool := published.Load(); pool != nil {
+				return pool.Stats()
+			}
+			return nil
+		}))
+	})
+}
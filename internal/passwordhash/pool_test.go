@@ -0,0 +1,113 @@
+package passwordhash
+
+import (
+    "context"
+    "testing"
+    "time"
+)
+
+// blockingHasher holds every call until release is closed.
+type blockingHasher struct {
+    started chan struct{}
+    release chan struct{}
+}
+
+func newBlockingHasher() *blockingHasher {
+    return &blockingHasher{started: make(chan struct{}, 16), release: make(chan struct{})}
+}
+
+func (h *blockingHasher) Hash(password string) (string, error) {
+    h.started <- struct{}{}
+    <-h.release
+    return "hashed:" + password, nil
+}
+
+func (h *blockingHasher) Verify(password, encoded string) (bool, error) {
+    h.started <- struct{}{}
+    <-h.release
+    return encoded == "hashed:"+password, nil
+}
+
+func (h *blockingHasher) NeedsRehash(encoded string) bool { return false }
+
+func TestPoolRunsJobs(t *testing.T) {
+    pool := NewPool(New(fastArgon2id), PoolConfig{Workers: 2, QueueSize: 2})
+
+    encoded, err := pool.Hash(context.Background(), "secret")
+    if err != nil {
+        t.Fatalf("Failed to hash: %v", err)
+    }
+    if ok, err := pool.Verify(context.Background(), "secret", encoded); !ok || err != nil {
+        t.Errorf("Expected password to verify, got %v, %v", ok, err)
+    }
+
+    stats := pool.Stats()
+    if stats.Completed != 2 {
+        t.Errorf("Expected 2 completed jobs, got %d", stats.Completed)
+    }
+    if last := stats.WaitHistogram[len(stats.WaitHistogram)-1]; last.LessOrEqual != "+Inf" || last.Count != 2 {
+        t.Errorf("Expected 2 waits in the +Inf bucket, got %+v", last)
+    }
+}
+
+func TestPoolRejectsWhenSaturated(t *testing.T) {
+    hasher := newBlockingHasher()
+    pool := NewPool(hasher, PoolConfig{Workers: 1, QueueSize: 1})
+
+    results := make(chan error, 2)
+    go func() {
+        _, err := pool.Hash(context.Background(), "running")
+        results <- err
+    }()
+    <-hasher.started
+    go func() {
+        _, err := pool.Hash(context.Background(), "queued")
+        results <- err
+    }()
+    for len(pool.jobs) == 0 {
+        time.Sleep(time.Millisecond)
+    }
+
+    if _, err := pool.Hash(context.Background(), "rejected"); err != ErrSaturated {
+        t.Errorf("Expected ErrSaturated with a full queue, got %v", err)
+    }
+
+    close(hasher.release)
+    for i := 0; i < 2; i++ {
+        if err := <-results; err != nil {
+            t.Errorf("Expected accepted jobs to finish, got %v", err)
+        }
+    }
+    if stats := pool.Stats(); stats.Rejected != 1 || stats.Completed != 2 {
+        t.Errorf("Expected 1 rejected and 2 completed, got %+v", stats)
+    }
+}
+
+func TestPoolGivesUpOnQueuedJobs(t *testing.T) {
+    hasher := newBlockingHasher()
+    pool := NewPool(hasher, PoolConfig{Workers: 1, QueueSize: 4, MaxWait: 20 * time.Millisecond})
+
+    go pool.Hash(context.Background(), "running")
+    <-hasher.started
+
+    if _, err := pool.Hash(context.Background(), "waiting"); err != ErrSaturated {
+        t.Errorf("Expected ErrSaturated after MaxWait, got %v", err)
+    }
+
+    ctx, cancel := context.WithCancel(context.Background())
+    go func() {
+        time.Sleep(5 * time.Millisecond)
+        cancel()
+    }()
+    if _, err := pool.Verify(ctx, "waiting", "hashed:waiting"); err != context.Canceled {
+        t.Errorf("Expected context.Canceled, got %v", err)
+    }
+
+    close(hasher.release)
+    for pool.Stats().Abandoned != 2 {
+        time.Sleep(time.Millisecond)
+    }
+    if stats := pool.Stats(); stats.Completed != 1 {
+        t.Errorf("Expected abandoned jobs to be skipped, got %+v", stats)
+    }
+}
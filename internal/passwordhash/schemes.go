@@ -0,0 +1,216 @@
+package passwordhash
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"math/bits"
+	"strconv"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+// scheme is one hashing algorithm with the parameters new hashes should use.
+type scheme interface {
+	id() string
+	hash(secret []byte) (*phc, error)
+	verify(secret []byte, h *phc) (bool, error)
+	// current reports whether h was made with this scheme's parameters.
+	current(h *phc) bool
+}
+
+var b64 = base64.RawStdEncoding
+
+func randomSalt(length int) ([]byte, error) {
+	salt := make([]byte, length)
+	_, err := rand.Read(salt)
+	return salt, err
+}
+
+type Argon2id struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  int
+	KeyLength   uint32
+}
+
+func (a Argon2id) id() string { return "argon2id" }
+
+func (a Argon2id) hash(secret []byte) (*phc, error) {
+	salt, err := randomSalt(a.SaltLength)
+	if err != nil {
+		return nil, err
+	}
+	key := argon2.IDKey(secret, salt, a.Iterations, a.Memory, a.Parallelism, a.KeyLength)
+	return &phc{
+		id:      a.id(),
+		version: strconv.Itoa(argon2.Version),
+		params: [][2]string{
+			{"m", strconv.FormatUint(uint64(a.Memory), 10)},
+			{"t", strconv.FormatUint(uint64(a.Iterations), 10)},
+			{"p", strconv.Itoa(int(a.Parallelism))},
+		},
+		salt: b64.EncodeToString(salt),
+		hash: b64.EncodeToString(key),
+	}, nil
+}
+
+func (a Argon2id) verify(secret []byte, h *phc) (bool, error) {
+	if h.version != strconv.Itoa(argon2.Version) {
+		return false, fmt.Errorf("unsupported argon2 version %q", h.version)
+	}
+	memory, err := h.intParam("m")
+	if err != nil {
+		return false, err
+	}
+	iterations, err := h.intParam("t")
+	if err != nil {
+		return false, err
+	}
+	parallelism, err := h.intParam("p")
+	if err != nil || parallelism > 255 {
+		return false, ErrMalformedHash
+	}
+	salt, err := b64.DecodeString(h.salt)
+	if err != nil {
+		return false, ErrMalformedHash
+	}
+	want, err := b64.DecodeString(h.hash)
+	if err != nil || len(want) == 0 {
+		return false, ErrMalformedHash
+	}
+
+	got := argon2.IDKey(secret, salt, uint32(iterations), uint32(memory), uint8(parallelism), uint32(len(want)))
+	return subtle.ConstantTimeCompare(got, want) == 1, nil
+}
+
+func (a Argon2id) current(h *phc) bool {
+	want, _ := b64.DecodeString(h.hash)
+	return h.id == a.id() &&
+		h.version == strconv.Itoa(argon2.Version) &&
+		h.param("m") == strconv.FormatUint(uint64(a.Memory), 10) &&
+		h.param("t") == strconv.FormatUint(uint64(a.Iterations), 10) &&
+		h.param("p") == strconv.Itoa(int(a.Parallelism)) &&
+		len(want) == int(a.KeyLength)
+}
+
+// Scrypt takes N as a power of two; it is stored as ln = log2(N).
+type Scrypt struct {
+	N          int
+	R          int
+	P          int
+	SaltLength int
+	KeyLength  int
+}
+
+func (s Scrypt) id() string { return "scrypt" }
+
+func (s Scrypt) hash(secret []byte) (*phc, error) {
+	salt, err := randomSalt(s.SaltLength)
+	if err != nil {
+		return nil, err
+	}
+	key, err := scrypt.Key(secret, salt, s.N, s.R, s.P, s.KeyLength)
+	if err != nil {
+		return nil, err
+	}
+	return &phc{
+		id: s.id(),
+		params: [][2]string{
+			{"ln", strconv.Itoa(bits.Len(uint(s.N)) - 1)},
+			{"r", strconv.Itoa(s.R)},
+			{"p", strconv.Itoa(s.P)},
+		},
+		salt: b64.EncodeToString(salt),
+		hash: b64.EncodeToString(key),
+	}, nil
+}
+
+func (s Scrypt) verify(secret []byte, h *phc) (bool, error) {
+	ln, err := h.intParam("ln")
+	if err != nil || ln > 30 {
+		return false, ErrMalformedHash
+	}
+	r, err := h.intParam("r")
+	if err != nil {
+		return false, err
+	}
+	p, err := h.intParam("p")
+	if err != nil {
+		return false, err
+	}
+	salt, err := b64.DecodeString(h.salt)
+	if err != nil {
+		return false, ErrMalformedHash
+	}
+	want, err := b64.DecodeString(h.hash)
+	if err != nil || len(want) == 0 {
+		return false, ErrMalformedHash
+	}
+
+	got, err := scrypt.Key(secret, salt, 1<<ln, r, p, len(want))
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(got, want) == 1, nil
+}
+
+func (s Scrypt) current(h *phc) bool {
+	want, _ := b64.DecodeString(h.hash)
+	return h.id == s.id() &&
+		h.param("ln") == strconv.Itoa(bits.Len(uint(s.N))-1) &&
+		h.param("r") == strconv.Itoa(s.R) &&
+		h.param("p") == strconv.Itoa(s.P) &&
+		len(want) == s.KeyLength
+}
+
+// Bcrypt pre-hashes the secret with SHA-256 so passwords longer than bcrypt's
+// 72-byte limit are not silently truncated. Hashes are stored as
+// $bcrypt-sha256$v=2,r=<cost>$<salt>$<hash> using bcrypt's own alphabet.
+type Bcrypt struct {
+	Cost int
+}
+
+func (b Bcrypt) id() string { return "bcrypt-sha256" }
+
+func prehash(secret []byte) []byte {
+	sum := sha256.Sum256(secret)
+	return []byte(base64.StdEncoding.EncodeToString(sum[:]))
+}
+
+func (b Bcrypt) hash(secret []byte) (*phc, error) {
+	encoded, err := bcrypt.GenerateFromPassword(prehash(secret), b.Cost)
+	if err != nil {
+		return nil, err
+	}
+	// encoded is $2a$<cost>$<22 salt chars><31 hash chars>
+	tail := string(encoded[len(encoded)-53:])
+	return &phc{
+		id:     b.id(),
+		params: [][2]string{{"v", "2"}, {"r", strconv.Itoa(b.Cost)}},
+		salt:   tail[:22],
+		hash:   tail[22:],
+	}, nil
+}
+
+func (b Bcrypt) verify(secret []byte, h *phc) (bool, error) {
+	cost, err := h.intParam("r")
+	if err != nil || len(h.salt) != 22 || len(h.hash) != 31 {
+		return false, ErrMalformedHash
+	}
+	encoded := fmt.Sprintf("$2a$%02d$%s%s", cost, h.salt, h.hash)
+	err = bcrypt.CompareHashAndPassword([]byte(encoded), prehash(secret))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (b Bcrypt) current(h *phc) bool {
+	return h.id == b.id() && h.param("r") == strconv.Itoa(b.Cost)
+}
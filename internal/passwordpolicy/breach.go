@@ -0,0 +1,155 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// BreachCorpus reports how often a password appears in known breaches.
+type BreachCorpus interface {
+	Count(password string) (int, error)
+}
+
+// OpenBreachCorpus opens a local copy of the Pwned Passwords SHA-1 data. A
+// directory is read as k-anonymity range files, one per 5-character hash
+// prefix holding "SUFFIX:COUNT" lines, so only one small file is read per
+// lookup. A regular file must hold "HASH:COUNT" lines sorted by hash and is
+// binary searched.
+func OpenBreachCorpus(path string) (BreachCorpus, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return rangeDirectory(path), nil
+	}
+	return sortedHashFile(path), nil
+}
+
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+type rangeDirectory string
+
+func (d rangeDirectory) Count(password string) (int, error) {
+	hash := sha1Hex(password)
+	prefix, suffix := hash[:5], hash[5:]
+
+	file, err := os.Open(filepath.Join(string(d), prefix))
+	if os.IsNotExist(err) {
+		file, err = os.Open(filepath.Join(string(d), prefix+".txt"))
+	}
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineSuffix, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if ok && strings.EqualFold(lineSuffix, suffix) {
+			return strconv.Atoi(count)
+		}
+	}
+	return 0, scanner.Err()
+}
+
+type sortedHashFile string
+
+func (f sortedHashFile) Count(password string) (int, error) {
+	hash := []byte(sha1Hex(password))
+
+	file, err := os.Open(string(f))
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	// Find the first line starting at or after offset low whose hash is >= the
+	// target by bisecting on byte offsets, then read lines from there.
+	low, high := int64(0), info.Size()
+	for high-low > 4096 {
+		mid := (low + high) / 2
+		line, err := lineAfter(file, mid)
+		if err == io.EOF {
+			high = mid
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if bytes.Compare(bytes.ToUpper(hashField(line)), hash) < 0 {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+
+	if _, err := file.Seek(low, io.SeekStart); err != nil {
+		return 0, err
+	}
+	reader := bufio.NewReader(file)
+	if low > 0 {
+		// Skip the partial line we landed in
+		if _, err := reader.ReadBytes('\n'); err != nil {
+			return 0, nil
+		}
+	}
+	for {
+		line, err := reader.ReadBytes('\n')
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			switch bytes.Compare(bytes.ToUpper(hashField(line)), hash) {
+			case 0:
+				_, count, _ := bytes.Cut(line, []byte(":"))
+				return strconv.Atoi(string(count))
+			case 1:
+				return 0, nil
+			}
+		}
+		if err == io.EOF {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("error reading breach corpus: %v", err)
+		}
+	}
+}
+
+// lineAfter returns the first complete line starting after offset.
+func lineAfter(file *os.File, offset int64) ([]byte, error) {
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(file)
+	if _, err := reader.ReadBytes('\n'); err != nil {
+		return nil, err
+	}
+	line, err := reader.ReadBytes('\n')
+	if err != nil && (err != io.EOF || len(line) == 0) {
+		return nil, err
+	}
+	return bytes.TrimSpace(line), nil
+}
+
+func hashField(line []byte) []byte {
+	hash, _, _ := bytes.Cut(line, []byte(":"))
+	return hash
+}
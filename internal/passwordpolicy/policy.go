@@ -0,0 +1,138 @@
+// Package passwordpolicy decides whether a new password is acceptable: long
+// enough, hard enough to guess, not derived from the account's email, and not
+// known from public breaches.
+package passwordpolicy
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	ViolationTooShort      = "too_short"
+	ViolationTooLong       = "too_long"
+	ViolationTooWeak       = "too_weak"
+	ViolationContainsEmail = "contains_email"
+	ViolationBreached      = "breached"
+)
+
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ViolationError lists every rule a password broke.
+type ViolationError struct {
+	Violations []Violation
+}
+
+func (e *ViolationError) Error() string {
+	return "password does not meet the password policy"
+}
+
+type Policy struct {
+	MinLength     int
+	MaxLength     int
+	MinScore      int
+	DisallowEmail bool
+	// Passwords seen at least BreachThreshold times in Breaches are refused.
+	Breaches        BreachCorpus
+	BreachThreshold int
+}
+
+// NewPolicyFromEnv reads PASSWORD_* settings. A breach corpus that cannot be
+// opened is logged and skipped rather than blocking start-up.
+func NewPolicyFromEnv() *Policy {
+	policy := &Policy{
+		MinLength:       intFromEnv("PASSWORD_MIN_LENGTH", 8),
+		MaxLength:       intFromEnv("PASSWORD_MAX_LENGTH", 128),
+		MinScore:        intFromEnv("PASSWORD_MIN_SCORE", 2),
+		DisallowEmail:   os.Getenv("PASSWORD_ALLOW_EMAIL") != "true",
+		BreachThreshold: intFromEnv("PASSWORD_BREACH_THRESHOLD", 1),
+	}
+
+	if path := os.Getenv("PASSWORD_BREACH_CORPUS"); path != "" {
+		corpus, err := OpenBreachCorpus(path)
+		if err != nil {
+			log.Printf("Breached password check disabled: %v", err)
+		} else {
+			policy.Breaches = corpus
+		}
+	}
+	return policy
+}
+
+// Validate returns a *ViolationError listing every broken rule, or nil.
+func (p *Policy) Validate(password, email string) error {
+	var violations []Violation
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, Violation{ViolationTooShort, fmt.Sprintf("password must be at least %d characters", p.MinLength)})
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, Violation{ViolationTooLong, fmt.Sprintf("password must be at most %d characters", p.MaxLength)})
+	}
+
+	if p.DisallowEmail && derivedFromEmail(password, email) {
+		violations = append(violations, Violation{ViolationContainsEmail, "password must not contain your email address"})
+	}
+
+	if p.MinScore > 0 {
+		if score := Score(password, emailTokens(email)...); score < p.MinScore {
+			violations = append(violations, Violation{ViolationTooWeak, fmt.Sprintf("password is too easy to guess (strength %d of 4, need %d)", score, p.MinScore)})
+		}
+	}
+
+	if p.Breaches != nil && password != "" {
+		count, err := p.Breaches.Count(password)
+		if err != nil {
+			log.Printf("Breached password lookup failed: %v", err)
+		} else if count >= p.BreachThreshold && count > 0 {
+			violations = append(violations, Violation{ViolationBreached, "password has appeared in a data breach; choose a different one"})
+		}
+	}
+
+	if len(violations) > 0 {
+		return &ViolationError{Violations: violations}
+	}
+	return nil
+}
+
+// emailTokens splits the local part of an email into the words a user is
+// likely to build a password from, e.g. "john.doe+work" gives john, doe, work.
+func emailTokens(email string) []string {
+	local, domain, _ := strings.Cut(strings.ToLower(strings.TrimSpace(email)), "@")
+	tokens := strings.FieldsFunc(local, func(r rune) bool {
+		return strings.ContainsRune("._-+", r)
+	})
+	if local != "" {
+		tokens = append(tokens, local)
+	}
+	if name, _, _ := strings.Cut(domain, "."); name != "" {
+		tokens = append(tokens, name)
+	}
+	return tokens
+}
+
+func derivedFromEmail(password, email string) bool {
+	normalized := unleet(strings.ToLower(password))
+	for _, token := range emailTokens(email) {
+		if utf8.RuneCountInString(token) >= 3 && strings.Contains(normalized, unleet(token)) {
+			return true
+		}
+	}
+	return false
+}
+
+func intFromEnv(name string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || value < 0 {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,110 @@
+package passwordpolicy
+
+import (
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "testing"
+)
+
+func TestScore(t *testing.T) {
+    tests := []struct {
+        password string
+        maxScore int
+        minScore int
+    }{
+        {"password", 0, 0},
+        {"P@ssw0rd", 0, 0},
+        {"password123", 1, 0},
+        {"qwertyuiop", 0, 0},
+        {"abcdefgh", 0, 0},
+        {"aaaaaaaaaa", 0, 0},
+        {"Summer2019", 2, 0},
+        {"jx7#Lq2v", 4, 2},
+        {"correct horse battery staple", 4, 4},
+        {"v9$Qm2!xR7pL", 4, 4},
+    }
+
+    for _, tt := range tests {
+        score := Score(tt.password)
+        if score < tt.minScore || score > tt.maxScore {
+            t.Errorf("Score(%q) = %d, want %d..%d (guesses %.3g)", tt.password, score, tt.minScore, tt.maxScore, Guesses(tt.password))
+        }
+    }
+
+    if with, without := Guesses("janedoe1994", "janedoe"), Guesses("janedoe1994"); with >= without {
+        t.Errorf("Expected user inputs to lower the estimate, got %.3g with and %.3g without", with, without)
+    }
+}
+
+func TestValidate(t *testing.T) {
+    policy := &Policy{MinLength: 10, MaxLength: 64, MinScore: 3, DisallowEmail: true}
+
+    if err := policy.Validate("v9$Qm2!xR7pL", "jane.doe@example.com"); err != nil {
+        t.Errorf("Expected strong password to pass, got %v", err)
+    }
+
+    err := policy.Validate("JaneDoe!", "jane.doe@example.com")
+    violations, ok := err.(*ViolationError)
+    if !ok {
+        t.Fatalf("Expected *ViolationError, got %v", err)
+    }
+    codes := map[string]bool{}
+    for _, v := range violations.Violations {
+        codes[v.Code] = true
+    }
+    for _, code := range []string{ViolationTooShort, ViolationContainsEmail, ViolationTooWeak} {
+        if !codes[code] {
+            t.Errorf("Expected violation %q, got %+v", code, violations.Violations)
+        }
+    }
+
+    if err := policy.Validate(strings.Repeat("v9$Qm2!xR7pL", 6), ""); err == nil {
+        t.Error("Expected too long password to fail")
+    }
+}
+
+func TestBreachCorpus(t *testing.T) {
+    dir := t.TempDir()
+
+    // sha1("password") = 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+    rangeDir := filepath.Join(dir, "ranges")
+    os.Mkdir(rangeDir, 0o755)
+    os.WriteFile(filepath.Join(rangeDir, "5BAA6"), []byte("003D68EB55068C33ACE09247EE4C639306B:3\r\n1E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\r\n"), 0o644)
+
+    var sorted strings.Builder
+    for i := 0; i < 2000; i++ {
+        sorted.WriteString(sha1Hex(strings.Repeat("x", i+1)) + ":1\n")
+    }
+    sorted.WriteString("5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\n")
+    lines := strings.Split(strings.TrimSpace(sorted.String()), "\n")
+    sort.Strings(lines)
+    sortedPath := filepath.Join(dir, "pwned.txt")
+    os.WriteFile(sortedPath, []byte(strings.Join(lines, "\n")+"\n"), 0o644)
+
+    for _, path := range []string{rangeDir, sortedPath} {
+        corpus, err := OpenBreachCorpus(path)
+        if err != nil {
+            t.Fatalf("Failed to open %s: %v", path, err)
+        }
+        if count, err := corpus.Count("password"); err != nil || count != 9545824 {
+            t.Errorf("%s: expected password to be found, got %d, %v", path, count, err)
+        }
+        if count, err := corpus.Count("v9$Qm2!xR7pL"); err != nil || count != 0 {
+            t.Errorf("%s: expected unknown password to be absent, got %d, %v", path, count, err)
+        }
+    }
+
+    corpus, _ := OpenBreachCorpus(sortedPath)
+    for _, i := range []int{0, 999, 1999} {
+        if count, err := corpus.Count(strings.Repeat("x", i+1)); err != nil || count != 1 {
+            t.Errorf("Expected line %d to be found, got %d, %v", i, count, err)
+        }
+    }
+
+    policy := &Policy{Breaches: corpus, BreachThreshold: 1}
+    if err, ok := policy.Validate("password", "").(*ViolationError); !ok || err.Violations[0].Code != ViolationBreached {
+        t.Errorf("Expected breached violation, got %v", err)
+    }
+}
@@ -0,0 +1,274 @@
+package passwordpolicy
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// commonPasswords is ordered by popularity; a match's rank is its index + 1.
+var commonPasswords = strings.Fields(`
+	password 123456 12345678 qwerty 123456789 12345 1234 111111 1234567 dragon
+	123123 baseball abc123 football monkey letmein 696969 shadow master 666666
+	qwertyuiop 123321 mustang 1234567890 michael 654321 superman 1qaz2wsx 7777777 121212
+	000000 qazwsx 123qwe killer trustno1 jordan jennifer zxcvbnm asdfgh hunter
+	buster soccer harley batman andrew tigger sunshine iloveyou 2000 charlie
+	robert thomas hockey ranger daniel starwars klaster 112233 george computer
+	michelle jessica pepper 1111 zxcvbn 555555 11111111 131313 freedom 777777
+	pass maggie 159753 aaaaaa ginger princess joshua cheese amanda summer
+	love ashley nicole chelsea biteme matthew access yankees 987654321 dallas
+	austin thunder taylor matrix welcome admin administrator login secret changeme
+	default guest root user test passw0rd whatever flower hello orange
+	banana cookie chocolate coffee butter silver golden diamond angel family
+	friend forever pokemon ninja corvette ferrari winter spring autumn money
+	internet service google apple purple london paris america monday qwerty123
+`)
+
+var keyboardRows = []string{"qwertyuiop", "asdfghjkl", "zxcvbnm", "1234567890", "!@#$%^&*()", "1qaz2wsx3edc", "qazwsxedc"}
+
+var leetSubstitutions = map[rune]rune{
+	'4': 'a', '@': 'a', '8': 'b', '3': 'e', '6': 'g', '1': 'i', '!': 'i', '|': 'i',
+	'0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z',
+}
+
+var dictionary = func() map[string]int {
+	ranks := make(map[string]int, len(commonPasswords))
+	for i, word := range commonPasswords {
+		if _, exists := ranks[word]; !exists {
+			ranks[word] = i + 1
+		}
+	}
+	return ranks
+}()
+
+// Score rates a password from 0 (trivially guessable) to 4 (very hard) like
+// zxcvbn: it finds the cheapest way to build the password out of common
+// passwords, the user's own details, keyboard walks, sequences, repeats and
+// years, and buckets the estimated number of guesses.
+func Score(password string, userInputs ...string) int {
+	guesses := Guesses(password, userInputs...)
+	switch {
+	case guesses < 1e3:
+		return 0
+	case guesses < 1e6:
+		return 1
+	case guesses < 1e8:
+		return 2
+	case guesses < 1e10:
+		return 3
+	default:
+		return 4
+	}
+}
+
+type match struct {
+	start, end int
+	guesses    float64
+}
+
+// Guesses estimates how many attempts an informed attacker needs.
+func Guesses(password string, userInputs ...string) float64 {
+	runes := []rune(password)
+	if len(runes) == 0 {
+		return 1
+	}
+
+	matches := dictionaryMatches(runes, userInputs)
+	matches = append(matches, sequenceMatches(runes)...)
+	matches = append(matches, repeatMatches(runes)...)
+	matches = append(matches, keyboardMatches(runes)...)
+	matches = append(matches, yearMatches(runes)...)
+
+	byEnd := make(map[int][]match)
+	for _, m := range matches {
+		byEnd[m.end] = append(byEnd[m.end], m)
+	}
+
+	// best[i] is the cheapest way to produce the first i characters
+	best := make([]float64, len(runes)+1)
+	best[0] = 1
+	for i := 1; i <= len(runes); i++ {
+		best[i] = best[i-1] * cardinality(runes[i-1])
+		for _, m := range byEnd[i] {
+			if guesses := best[m.start] * math.Max(m.guesses, 10); guesses < best[i] {
+				best[i] = guesses
+			}
+		}
+	}
+	return best[len(runes)]
+}
+
+func unleet(value string) string {
+	return strings.Map(func(r rune) rune {
+		if plain, ok := leetSubstitutions[r]; ok {
+			return plain
+		}
+		return r
+	}, value)
+}
+
+func dictionaryMatches(runes []rune, userInputs []string) []match {
+	ranks := dictionary
+	if len(userInputs) > 0 {
+		ranks = make(map[string]int, len(dictionary)+len(userInputs))
+		for word, rank := range dictionary {
+			ranks[word] = rank
+		}
+		for i, input := range userInputs {
+			if input = unleet(strings.ToLower(input)); len([]rune(input)) >= 3 {
+				ranks[input] = i + 1
+			}
+		}
+	}
+
+	lower := []rune(strings.ToLower(string(runes)))
+	if len(lower) != len(runes) {
+		lower = runes
+	}
+	normalized := []rune(unleet(string(lower)))
+
+	var matches []match
+	for start := 0; start < len(runes); start++ {
+		for end := start + 3; end <= len(runes); end++ {
+			word := string(normalized[start:end])
+			rank, ok := ranks[word]
+			if !ok {
+				continue
+			}
+			guesses := float64(rank) * uppercaseVariations(runes[start:end])
+			if string(lower[start:end]) != word {
+				guesses *= 2
+			}
+			matches = append(matches, match{start, end, guesses})
+		}
+	}
+	return matches
+}
+
+func uppercaseVariations(word []rune) float64 {
+	upper := 0
+	for _, r := range word {
+		if unicode.IsUpper(r) {
+			upper++
+		}
+	}
+	switch {
+	case upper == 0:
+		return 1
+	case upper == len(word), upper == 1 && unicode.IsUpper(word[0]):
+		return 2
+	default:
+		return math.Pow(2, float64(upper))
+	}
+}
+
+// sequenceMatches finds runs like "abcd", "9876" or "ace" with a constant step.
+func sequenceMatches(runes []rune) []match {
+	var matches []match
+	for start := 0; start < len(runes)-2; {
+		delta := unicode.ToLower(runes[start+1]) - unicode.ToLower(runes[start])
+		end := start + 1
+		for end < len(runes) && unicode.ToLower(runes[end])-unicode.ToLower(runes[end-1]) == delta {
+			end++
+		}
+		if end-start >= 3 && delta != 0 && delta >= -2 && delta <= 2 {
+			base := 26.0
+			if unicode.IsDigit(runes[start]) {
+				base = 10
+			}
+			if strings.ContainsRune("aAzZ019", runes[start]) {
+				base = 4
+			}
+			guesses := base * float64(end-start)
+			if delta < 0 {
+				guesses *= 2
+			}
+			matches = append(matches, match{start, end, guesses})
+		}
+		if end-start >= 3 {
+			start = end - 1
+		} else {
+			start++
+		}
+	}
+	return matches
+}
+
+func repeatMatches(runes []rune) []match {
+	var matches []match
+	for start := 0; start < len(runes); {
+		end := start + 1
+		for end < len(runes) && runes[end] == runes[start] {
+			end++
+		}
+		if end-start >= 3 {
+			matches = append(matches, match{start, end, cardinality(runes[start]) * float64(end-start)})
+		}
+		start = end
+	}
+	return matches
+}
+
+func keyboardMatches(runes []rune) []match {
+	lower := strings.ToLower(string(runes))
+	lowerRunes := []rune(lower)
+	if len(lowerRunes) != len(runes) {
+		return nil
+	}
+
+	var matches []match
+	for start := 0; start < len(lowerRunes); start++ {
+		for end := start + 4; end <= len(lowerRunes); end++ {
+			walk := string(lowerRunes[start:end])
+			for _, row := range keyboardRows {
+				if strings.Contains(row, walk) {
+					matches = append(matches, match{start, end, 20 * float64(end-start)})
+				} else if strings.Contains(row, reverse(walk)) {
+					matches = append(matches, match{start, end, 40 * float64(end-start)})
+				}
+			}
+		}
+	}
+	return matches
+}
+
+func yearMatches(runes []rune) []match {
+	var matches []match
+	for start := 0; start+4 <= len(runes); start++ {
+		year := string(runes[start : start+4])
+		if (strings.HasPrefix(year, "19") || strings.HasPrefix(year, "20")) && isDigits(year) {
+			matches = append(matches, match{start, start + 4, 120})
+		}
+	}
+	return matches
+}
+
+func cardinality(r rune) float64 {
+	switch {
+	case r >= '0' && r <= '9':
+		return 10
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		return 26
+	case r < 128:
+		return 33
+	default:
+		return 100
+	}
+}
+
+func isDigits(value string) bool {
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func reverse(value string) string {
+	runes := []rune(value)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
@@ -0,0 +1,68 @@
+package policy
+
+import "testing"
+
+func TestExpressionEval(t *testing.T) {
+    vars, _ := normalize(map[string]interface{}{
+        "subject":  map[string]interface{}{"sub": "u1", "roles": []string{"editor"}, "level": 3},
+        "resource": map[string]interface{}{"owner": "u1", "editors": []string{"editor", "admin"}, "tags": map[string]interface{}{"public": true}},
+        "action":   "documents:write",
+        "context":  map[string]interface{}{"ip": "10.0.0.7"},
+    })
+
+    cases := map[string]bool{
+        ``:                                        true,
+        `resource.owner == subject.sub`:           true,
+        `resource.owner != subject.sub`:           false,
+        `action in ["documents:read", 'documents:write']`: true,
+        `"editor" in subject.roles && !("viewer" in subject.roles)`: true,
+        `intersects(subject.roles, resource.editors)`:              true,
+        `context.ip.startsWith("10.") || false`:                    true,
+        `endsWith(context.ip, ".8")`:                               false,
+        `subject.level >= 3 && subject.level < 4 && -subject.level == -3`: true,
+        `size(resource.editors) == 2 && resource.editors[1] == "admin"`:   true,
+        `resource.tags.public && "public" in resource.tags`:               true,
+        `resource.missing == null && resource.missing.deeper == null`:     true,
+        `contains(context.ip, "0.0") && !contains(resource.missing, "x")`: true,
+        // The right side is not evaluated once the left decides
+        `false && resource.owner < 1`: false,
+    }
+    for source, want := range cases {
+        expr, err := Compile(source)
+        if err != nil {
+            t.Errorf("Compile(%q): %v", source, err)
+            continue
+        }
+        got, err := expr.Eval(vars.(map[string]interface{}))
+        if err != nil || got != want {
+            t.Errorf("Eval(%q) = %v, %v; want %v", source, got, err, want)
+        }
+    }
+}
+
+func TestExpressionErrors(t *testing.T) {
+    for _, source := range []string{
+        `resource.owner ==`,
+        `user.id == "1"`,
+        `unknown(resource)`,
+        `size(resource, action)`,
+        `"unterminated`,
+        `resource.owner == subject.sub)`,
+        `action # 1`,
+    } {
+        if _, err := Compile(source); err == nil {
+            t.Errorf("Expected Compile(%q) to fail", source)
+        }
+    }
+
+    vars := map[string]interface{}{"resource": map[string]interface{}{"owner": "u1"}}
+    for _, source := range []string{`resource.owner`, `resource.owner < 1`, `resource.owner && true`, `!resource.owner`} {
+        expr, err := Compile(source)
+        if err != nil {
+            t.Fatalf("Compile(%q): %v", source, err)
+        }
+        if _, err := expr.Eval(vars); err == nil {
+            t.Errorf("Expected Eval(%q) to fail", source)
+        }
+    }
+}
@@ -0,0 +1,201 @@
+// Package policy makes attribute-based authorization decisions: whether a
+// subject may perform an action on a resource, given policies whose
+// conditions look at the attributes of all three and of the request context.
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/SinisterSup/auth-service/internal/models"
+)
+
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// Policy allows or denies its actions when its condition holds. Actions may
+// end in a wildcard such as "documents:*", and "*" matches every action. An
+// empty condition always holds.
+type Policy struct {
+	ID          string   `json:"id"`
+	Description string   `json:"description,omitempty"`
+	Effect      string   `json:"effect"`
+	Actions     []string `json:"actions"`
+	Condition   string   `json:"condition,omitempty"`
+}
+
+type Config struct {
+	Policies []Policy `json:"policies"`
+}
+
+// Input is what a decision is about. Attribute values are anything that
+// encodes to JSON.
+type Input struct {
+	Subject  map[string]interface{} `json:"subject"`
+	Resource map[string]interface{} `json:"resource"`
+	Action   string                 `json:"action" binding:"required"`
+	Context  map[string]interface{} `json:"context"`
+}
+
+// Decision is the answer to an Input. Policy names the policy that decided,
+// if any.
+type Decision struct {
+	Allowed bool   `json:"allowed"`
+	Policy  string `json:"policy,omitempty"`
+	Reason  string `json:"reason"`
+}
+
+type compiledPolicy struct {
+	Policy
+	condition *Expression
+}
+
+// Engine evaluates a fixed set of policies. Any deny policy that applies
+// wins over every allow policy, and nothing is allowed unless some allow
+// policy applies. A condition that fails to evaluate, for example because
+// an attribute has the wrong type, never allows and always denies.
+type Engine struct {
+	policies []compiledPolicy
+}
+
+// NewEngine compiles policies, failing on the first invalid one.
+func NewEngine(policies []Policy) (*Engine, error) {
+	engine := &Engine{}
+	seen := map[string]bool{}
+	for _, p := range policies {
+		if p.ID == "" || seen[p.ID] {
+			return nil, fmt.Errorf("policy IDs must be set and unique, got %q", p.ID)
+		}
+		seen[p.ID] = true
+		if p.Effect != EffectAllow && p.Effect != EffectDeny {
+			return nil, fmt.Errorf("policy %q: effect must be %q or %q", p.ID, EffectAllow, EffectDeny)
+		}
+		if len(p.Actions) == 0 {
+			return nil, fmt.Errorf("policy %q: actions must not be empty", p.ID)
+		}
+		condition, err := Compile(p.Condition)
+		if err != nil {
+			return nil, fmt.Errorf("policy %q: %v", p.ID, err)
+		}
+		engine.policies = append(engine.policies, compiledPolicy{Policy: p, condition: condition})
+	}
+	return engine, nil
+}
+
+// LoadFromEnv builds an engine from the JSON config in the file named by
+// AUTHZ_POLICIES_FILE or inline in AUTHZ_POLICIES. Without either it has no
+// policies and denies everything.
+func LoadFromEnv() (*Engine, error) {
+	data := []byte(os.Getenv("AUTHZ_POLICIES"))
+	if path := os.Getenv("AUTHZ_POLICIES_FILE"); path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("error reading AUTHZ_POLICIES_FILE: %v", err)
+		}
+	}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return NewEngine(nil)
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid policy config: %v", err)
+	}
+	engine, err := NewEngine(config.Policies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy config: %v", err)
+	}
+	return engine, nil
+}
+
+// Decide evaluates every policy for input's action.
+func (e *Engine) Decide(input Input) Decision {
+	vars, err := normalize(map[string]interface{}{
+		"subject":  input.Subject,
+		"resource": input.Resource,
+		"action":   input.Action,
+		"context":  input.Context,
+	})
+	if err != nil {
+		return Decision{Reason: err.Error()}
+	}
+
+	var allowedBy string
+	for _, p := range e.policies {
+		if !models.HasPermission(p.Actions, input.Action) {
+			continue
+		}
+		holds, err := p.condition.Eval(vars.(map[string]interface{}))
+		if p.Effect == EffectDeny && (holds || err != nil) {
+			reason := "denied by policy " + p.ID
+			if err != nil {
+				reason = fmt.Sprintf("policy %s could not be evaluated: %v", p.ID, err)
+			}
+			return Decision{Policy: p.ID, Reason: reason}
+		}
+		if p.Effect == EffectAllow && holds && allowedBy == "" {
+			allowedBy = p.ID
+		}
+	}
+
+	if allowedBy == "" {
+		return Decision{Reason: "no policy allows " + input.Action}
+	}
+	return Decision{Allowed: true, Policy: allowedBy, Reason: "allowed by policy " + allowedBy}
+}
+
+var errUnsupportedValue = errors.New("attributes must encode to JSON")
+
+// normalize turns attribute values into the types expressions work with,
+// those encoding/json decodes into.
+func normalize(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil, bool, float64, string:
+		return v, nil
+	case []string:
+		items := make([]interface{}, len(v))
+		for i, s := range v {
+			items[i] = s
+		}
+		return items, nil
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			normalized, err := normalize(item)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = normalized
+		}
+		return items, nil
+	case map[string]interface{}:
+		if v == nil {
+			return nil, nil
+		}
+		object := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			normalized, err := normalize(item)
+			if err != nil {
+				return nil, err
+			}
+			object[key] = normalized
+		}
+		return object, nil
+	}
+
+	// Anything else, such as integers, structs or times, goes through JSON
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, errUnsupportedValue
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, errUnsupportedValue
+	}
+	return decoded, nil
+}
@@ -0,0 +1,92 @@
+package policy
+
+import (
+    "os"
+    "testing"
+)
+
+func TestEngineDecide(t *testing.T) {
+    engine, err := NewEngine([]Policy{
+        {ID: "owners", Effect: EffectAllow, Actions: []string{"documents:*"}, Condition: `resource.owner == subject.sub`},
+        {ID: "readers", Effect: EffectAllow, Actions: []string{"documents:read"}, Condition: `resource.public`},
+        {ID: "locked", Effect: EffectDeny, Actions: []string{"documents:write", "documents:delete"}, Condition: `resource.locked == true`},
+        {ID: "admins", Effect: EffectAllow, Actions: []string{"*"}, Condition: `"admin" in subject.roles`},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    owner := map[string]interface{}{"sub": "u1", "roles": []string{}}
+    admin := map[string]interface{}{"sub": "u2", "roles": []string{"admin"}}
+    doc := map[string]interface{}{"owner": "u1", "public": false}
+    locked := map[string]interface{}{"owner": "u1", "locked": true}
+
+    cases := []struct {
+        input   Input
+        allowed bool
+        policy  string
+    }{
+        {Input{Subject: owner, Resource: doc, Action: "documents:write"}, true, "owners"},
+        {Input{Subject: admin, Resource: doc, Action: "documents:read"}, true, "admins"},
+        {Input{Subject: map[string]interface{}{"sub": "u3"}, Resource: doc, Action: "documents:read"}, false, ""},
+        {Input{Subject: owner, Resource: locked, Action: "documents:write"}, false, "locked"},
+        {Input{Subject: admin, Resource: locked, Action: "documents:delete"}, false, "locked"},
+        {Input{Subject: owner, Resource: locked, Action: "documents:read"}, true, "owners"},
+        {Input{Subject: owner, Resource: doc, Action: "billing:read"}, false, ""},
+        // A condition that cannot be evaluated does not allow
+        {Input{Subject: map[string]interface{}{"sub": "u3"}, Resource: map[string]interface{}{"public": "yes"}, Action: "documents:read"}, false, ""},
+    }
+    for i, c := range cases {
+        decision := engine.Decide(c.input)
+        if decision.Allowed != c.allowed || decision.Policy != c.policy {
+            t.Errorf("Case %d: got %+v, want allowed=%v policy=%q", i, decision, c.allowed, c.policy)
+        }
+    }
+
+    strict, err := NewEngine([]Policy{
+        {ID: "strict", Effect: EffectDeny, Actions: []string{"*"}, Condition: `resource.level > 2`},
+        {ID: "all", Effect: EffectAllow, Actions: []string{"*"}},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    if decision := strict.Decide(Input{Resource: map[string]interface{}{"level": "high"}, Action: "x"}); decision.Allowed {
+        t.Errorf("Expected a deny policy that cannot be evaluated to deny, got %+v", decision)
+    }
+}
+
+func TestNewEngineRejectsInvalidPolicies(t *testing.T) {
+    for _, policies := range [][]Policy{
+        {{Effect: EffectAllow, Actions: []string{"*"}}},
+        {{ID: "a", Effect: EffectAllow, Actions: []string{"*"}}, {ID: "a", Effect: EffectDeny, Actions: []string{"*"}}},
+        {{ID: "a", Effect: "maybe", Actions: []string{"*"}}},
+        {{ID: "a", Effect: EffectAllow}},
+        {{ID: "a", Effect: EffectAllow, Actions: []string{"*"}, Condition: `subject.sub ==`}},
+    } {
+        if _, err := NewEngine(policies); err == nil {
+            t.Errorf("Expected %+v to be rejected", policies)
+        }
+    }
+}
+
+func TestLoadFromEnv(t *testing.T) {
+    os.Setenv("AUTHZ_POLICIES", `{"policies": [{"id": "all", "effect": "allow", "actions": ["*"]}]}`)
+    defer os.Unsetenv("AUTHZ_POLICIES")
+
+    engine, err := LoadFromEnv()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !engine.Decide(Input{Action: "anything"}).Allowed {
+        t.Error("Expected the configured policy to allow")
+    }
+
+    os.Setenv("AUTHZ_POLICIES", "")
+    engine, err = LoadFromEnv()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if engine.Decide(Input{Action: "anything"}).Allowed {
+        t.Error("Expected no policies to deny everything")
+    }
+}
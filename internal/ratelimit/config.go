@@ -0,0 +1,118 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	AlgorithmTokenBucket   = "token_bucket"
+	AlgorithmSlidingWindow = "sliding_window"
+
+	KeyIP       = "ip"
+	KeyIdentity = "identity"
+
+	BackendMemory = "memory"
+	BackendMongo  = "mongo"
+)
+
+type Config struct {
+	Backend string `json:"backend"`
+	Rules   []Rule `json:"rules"`
+}
+
+// Rule limits one route, e.g. "POST /auth/signin", keyed by client IP or by
+// the identity the request is about. Limit requests are allowed per Window;
+// token buckets may additionally allow bursts of up to Burst.
+type Rule struct {
+	Route     string   `json:"route"`
+	Key       string   `json:"key"`
+	Algorithm string   `json:"algorithm"`
+	Limit     int      `json:"limit"`
+	Window    Duration `json:"window"`
+	Burst     int      `json:"burst,omitempty"`
+}
+
+// Duration accepts Go duration strings such as "1m" in JSON.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string like \"1m\": %v", err)
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// ID names the rule's counters, so changing any parameter starts afresh.
+func (r Rule) ID() string {
+	return fmt.Sprintf("%s|%s|%s|%d/%s|%d", r.Route, r.Key, r.Algorithm, r.Limit, time.Duration(r.Window), r.Burst)
+}
+
+func (r Rule) validate() error {
+	if len(strings.Fields(r.Route)) != 2 {
+		return fmt.Errorf("route %q must look like \"POST /auth/signin\"", r.Route)
+	}
+	if r.Key != KeyIP && r.Key != KeyIdentity {
+		return fmt.Errorf("route %q: key must be %q or %q", r.Route, KeyIP, KeyIdentity)
+	}
+	if r.Algorithm != AlgorithmTokenBucket && r.Algorithm != AlgorithmSlidingWindow {
+		return fmt.Errorf("route %q: algorithm must be %q or %q", r.Route, AlgorithmTokenBucket, AlgorithmSlidingWindow)
+	}
+	if r.Limit <= 0 || r.Window <= 0 {
+		return fmt.Errorf("route %q: limit and window must be positive", r.Route)
+	}
+	if r.Burst < 0 {
+		return fmt.Errorf("route %q: burst must not be negative", r.Route)
+	}
+	return nil
+}
+
+func (c Config) Validate() error {
+	if c.Backend != "" && c.Backend != BackendMemory && c.Backend != BackendMongo {
+		return fmt.Errorf("backend must be %q or %q", BackendMemory, BackendMongo)
+	}
+	for _, rule := range c.Rules {
+		if err := rule.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadConfigFromEnv reads the JSON config from the file named by
+// RATE_LIMITS_FILE or inline from RATE_LIMITS. It returns nil when neither is
+// set, which leaves rate limiting off.
+func LoadConfigFromEnv() (*Config, error) {
+	data := []byte(os.Getenv("RATE_LIMITS"))
+	if path := os.Getenv("RATE_LIMITS_FILE"); path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("error reading RATE_LIMITS_FILE: %v", err)
+		}
+	}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return nil, nil
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid rate limit config: %v", err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid rate limit config: %v", err)
+	}
+	return &config, nil
+}
@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/SinisterSup/auth-service/internal/mail"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryInterceptor applies to gRPC calls the rules of the REST routes they
+// mirror, which routes gives by full method name, such as
+// "/auth.v1.AuthService/SignIn": "POST /auth/signin". Counters are shared with
+// Middleware, so switching transports does not get around a limit. A denied
+// call fails with ResourceExhausted and a retry-after header.
+func (l *Limiter) UnaryInterceptor(routes map[string]string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		route, ok := routes[info.FullMethod]
+		if l == nil || !ok {
+			return handler(ctx, req)
+		}
+
+		var ip string
+		if p, ok := peer.FromContext(ctx); ok {
+			ip, _, _ = net.SplitHostPort(p.Addr.String())
+		}
+		_, denied := l.check(ctx, route, ip, func() string {
+			return callIdentity(ctx, req)
+		})
+		if denied != nil {
+			grpc.SetHeader(ctx, metadata.Pairs("retry-after", ceilSeconds(denied.RetryAfter)))
+			return nil, status.Error(codes.ResourceExhausted, "too many requests")
+		}
+		return handler(ctx, req)
+	}
+}
+
+// callIdentity is requestIdentity for gRPC: the email or refresh token in the
+// request message, otherwise the bearer token in the metadata. Identities
+// hash the same as over HTTP.
+func callIdentity(ctx context.Context, req interface{}) string {
+	if r, ok := req.(interface{ GetEmail() string }); ok && r.GetEmail() != "" {
+		return hashIdentity("email:" + mail.LookupAddress(r.GetEmail()))
+	}
+	if r, ok := req.(interface{ GetRefreshToken() string }); ok && r.GetRefreshToken() != "" {
+		return hashIdentity("refresh:" + r.GetRefreshToken())
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if authorization := md.Get("authorization"); len(authorization) > 0 {
+		if token, ok := strings.CutPrefix(authorization[0], "Bearer "); ok && token != "" {
+			return hashIdentity("bearer:" + token)
+		}
+	}
+	return ""
+}
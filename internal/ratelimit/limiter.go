@@ -0,0 +1,111 @@
+// Package ratelimit limits requests per route by client IP or by identity,
+// using token buckets or sliding windows, with counters kept in memory or in
+// MongoDB so that replicas share them.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Result describes one rule's decision for a request.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Store applies a rule to the counters for key and persists the outcome.
+type Store interface {
+	Take(ctx context.Context, rule Rule, key string, now time.Time) (Result, error)
+}
+
+// state holds the counters of both algorithms; each uses its own fields.
+type state struct {
+	Tokens      float64   `bson:"tokens"`
+	Updated     time.Time `bson:"updated"`
+	WindowStart time.Time `bson:"window_start"`
+	Count       int       `bson:"count"`
+	PrevCount   int       `bson:"prev_count"`
+}
+
+// apply consumes one request from s and returns the new state. It is pure so
+// every store makes exactly the same decisions.
+func (r Rule) apply(s state, now time.Time) (state, Result) {
+	if r.Algorithm == AlgorithmTokenBucket {
+		return r.takeToken(s, now)
+	}
+	return r.slideWindow(s, now)
+}
+
+// expiry is how long after now an untouched counter still matters.
+func (r Rule) expiry() time.Duration {
+	return 2 * time.Duration(r.Window)
+}
+
+func (r Rule) takeToken(s state, now time.Time) (state, Result) {
+	capacity := float64(r.Limit)
+	if r.Burst > 0 {
+		capacity = float64(r.Burst)
+	}
+	rate := float64(r.Limit) / time.Duration(r.Window).Seconds()
+
+	tokens := capacity
+	if !s.Updated.IsZero() {
+		tokens = math.Min(capacity, s.Tokens+now.Sub(s.Updated).Seconds()*rate)
+	}
+
+	result := Result{Limit: int(capacity)}
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - tokens) / rate)
+	}
+	result.Remaining = int(math.Floor(tokens))
+	result.Reset = seconds((capacity - tokens) / rate)
+
+	return state{Tokens: tokens, Updated: now}, result
+}
+
+// slideWindow approximates a sliding window from the current and previous
+// fixed windows, weighting the previous count by how much of it still overlaps.
+func (r Rule) slideWindow(s state, now time.Time) (state, Result) {
+	window := time.Duration(r.Window)
+	start := now.Truncate(window)
+	if !s.WindowStart.Equal(start) {
+		if s.WindowStart.Equal(start.Add(-window)) {
+			s.PrevCount = s.Count
+		} else {
+			s.PrevCount = 0
+		}
+		s.WindowStart, s.Count = start, 0
+	}
+
+	elapsed := float64(now.Sub(start)) / float64(window)
+	estimate := float64(s.PrevCount)*(1-elapsed) + float64(s.Count)
+	result := Result{Limit: r.Limit, Reset: start.Add(window).Sub(now)}
+
+	if estimate+1 <= float64(r.Limit) {
+		s.Count++
+		result.Allowed = true
+		result.Remaining = int(math.Max(0, math.Floor(float64(r.Limit)-estimate-1)))
+		return s, result
+	}
+
+	if s.Count+1 > r.Limit || s.PrevCount == 0 {
+		result.RetryAfter = result.Reset
+	} else {
+		// Wait until enough of the previous window has slid out
+		needed := 1 - float64(r.Limit-s.Count-1)/float64(s.PrevCount)
+		result.RetryAfter = time.Duration((needed - elapsed) * float64(window))
+	}
+	return s, result
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second))
+}
@@ -0,0 +1,184 @@
+package ratelimit
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/status"
+)
+
+func take(t *testing.T, store Store, rule Rule, now time.Time) Result {
+    t.Helper()
+    result, err := store.Take(context.Background(), rule, "ip:203.0.113.7", now)
+    if err != nil {
+        t.Fatalf("Take failed: %v", err)
+    }
+    return result
+}
+
+func TestTokenBucket(t *testing.T) {
+    store := NewMemoryStore()
+    rule := Rule{Route: "POST /auth/signin", Key: KeyIP, Algorithm: AlgorithmTokenBucket, Limit: 6, Window: Duration(time.Minute), Burst: 3}
+    now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+    for i := 0; i < 3; i++ {
+        if result := take(t, store, rule, now); !result.Allowed || result.Remaining != 2-i {
+            t.Fatalf("Request %d: unexpected result %+v", i+1, result)
+        }
+    }
+
+    result := take(t, store, rule, now)
+    if result.Allowed || result.RetryAfter != 10*time.Second {
+        t.Fatalf("Expected denial with 10s retry, got %+v", result)
+    }
+
+    if result := take(t, store, rule, now.Add(10*time.Second)); !result.Allowed {
+        t.Errorf("Expected a refilled token after 10s, got %+v", result)
+    }
+}
+
+func TestSlidingWindow(t *testing.T) {
+    store := NewMemoryStore()
+    rule := Rule{Route: "POST /auth/signup", Key: KeyIP, Algorithm: AlgorithmSlidingWindow, Limit: 4, Window: Duration(time.Minute)}
+    start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+    for i := 0; i < 4; i++ {
+        if result := take(t, store, rule, start.Add(50*time.Second)); !result.Allowed {
+            t.Fatalf("Request %d: expected to be allowed, got %+v", i+1, result)
+        }
+    }
+    if result := take(t, store, rule, start.Add(55*time.Second)); result.Allowed || result.RetryAfter != 5*time.Second {
+        t.Fatalf("Expected denial until the window ends, got %+v", result)
+    }
+
+    // Half way into the next window, half of the previous 4 requests still count
+    now := start.Add(90 * time.Second)
+    for i := 0; i < 2; i++ {
+        if result := take(t, store, rule, now); !result.Allowed {
+            t.Fatalf("Request %d in next window: expected to be allowed, got %+v", i+1, result)
+        }
+    }
+    result := take(t, store, rule, now)
+    if result.Allowed || result.RetryAfter != 15*time.Second {
+        t.Errorf("Expected denial for 15s while the previous window slides out, got %+v", result)
+    }
+}
+
+func TestMiddleware(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+
+    limiter := NewLimiter(NewMemoryStore(), []Rule{
+        {Route: "POST /auth/signin", Key: KeyIdentity, Algorithm: AlgorithmSlidingWindow, Limit: 2, Window: Duration(time.Minute)},
+        {Route: "POST /auth/signin", Key: KeyIP, Algorithm: AlgorithmSlidingWindow, Limit: 10, Window: Duration(time.Minute)},
+    })
+    now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+    limiter.now = func() time.Time { return now }
+
+    router := gin.New()
+    router.Use(limiter.Middleware())
+    router.POST("/auth/signin", func(c *gin.Context) {
+        var input struct{ Email string }
+        if err := c.ShouldBindJSON(&input); err != nil || input.Email == "" {
+            c.Status(400)
+            return
+        }
+        c.Status(200)
+    })
+    router.POST("/auth/signup", func(c *gin.Context) { c.Status(200) })
+
+    signIn := func(email string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest("POST", "/auth/signin", strings.NewReader(`{"email": "`+email+`"}`))
+        req.Header.Set("Content-Type", "application/json")
+        w := httptest.NewRecorder()
+        router.ServeHTTP(w, req)
+        return w
+    }
+
+    for i := 0; i < 2; i++ {
+        if w := signIn("Test@Example.com"); w.Code != http.StatusOK {
+            t.Fatalf("Request %d: expected 200 with body intact, got %d", i+1, w.Code)
+        }
+    }
+    w := signIn("test@example.com")
+    if w.Code != http.StatusTooManyRequests {
+        t.Fatalf("Expected 429 for the same identity, got %d", w.Code)
+    }
+    if w.Header().Get("Retry-After") != "60" || w.Header().Get("RateLimit-Remaining") != "0" || w.Header().Get("RateLimit-Limit") != "2" {
+        t.Errorf("Unexpected headers: %v", w.Header())
+    }
+
+    w = signIn("other@example.com")
+    if w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "2" {
+        t.Errorf("Expected another identity to pass, got %d %v", w.Code, w.Header())
+    }
+
+    req := httptest.NewRequest("POST", "/auth/signup", nil)
+    w = httptest.NewRecorder()
+    router.ServeHTTP(w, req)
+    if w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "" {
+        t.Errorf("Expected routes without rules to be untouched, got %d %v", w.Code, w.Header())
+    }
+}
+
+type signInRequest struct{ email string }
+
+func (r signInRequest) GetEmail() string { return r.email }
+
+func TestUnaryInterceptor(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+
+    limiter := NewLimiter(NewMemoryStore(), []Rule{
+        {Route: "POST /auth/signin", Key: KeyIdentity, Algorithm: AlgorithmSlidingWindow, Limit: 2, Window: Duration(time.Minute)},
+    })
+    now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+    limiter.now = func() time.Time { return now }
+
+    router := gin.New()
+    router.Use(limiter.Middleware())
+    router.POST("/auth/signin", func(c *gin.Context) { c.Status(200) })
+    req := httptest.NewRequest("POST", "/auth/signin", strings.NewReader(`{"email": "test@example.com"}`))
+    req.Header.Set("Content-Type", "application/json")
+    router.ServeHTTP(httptest.NewRecorder(), req)
+
+    interceptor := limiter.UnaryInterceptor(map[string]string{"/auth.v1.AuthService/SignIn": "POST /auth/signin"})
+    handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil }
+    signIn := &grpc.UnaryServerInfo{FullMethod: "/auth.v1.AuthService/SignIn"}
+
+    if _, err := interceptor(context.Background(), signInRequest{"Test@Example.com"}, signIn, handler); err != nil {
+        t.Fatalf("Expected the second sign-in to pass, got %v", err)
+    }
+    _, err := interceptor(context.Background(), signInRequest{"test@example.com"}, signIn, handler)
+    if status.Code(err) != codes.ResourceExhausted {
+        t.Fatalf("Expected the third sign-in across transports to be limited, got %v", err)
+    }
+    if _, err := interceptor(context.Background(), signInRequest{"other@example.com"}, signIn, handler); err != nil {
+        t.Errorf("Expected another identity to pass, got %v", err)
+    }
+    other := &grpc.UnaryServerInfo{FullMethod: "/auth.v1.AuthService/GetProfile"}
+    if _, err := interceptor(context.Background(), signInRequest{"test@example.com"}, other, handler); err != nil {
+        t.Errorf("Expected methods without a route to be untouched, got %v", err)
+    }
+}
+
+func TestLoadConfigRejectsInvalidRules(t *testing.T) {
+    t.Setenv("RATE_LIMITS", `{"rules": [{"route": "POST /auth/signin", "key": "ip", "algorithm": "leaky", "limit": 1, "window": "1m"}]}`)
+    if _, err := LoadConfigFromEnv(); err == nil {
+        t.Error("Expected an unknown algorithm to be rejected")
+    }
+
+    t.Setenv("RATE_LIMITS", `{"backend": "mongo", "rules": [{"route": "POST /auth/signin", "key": "identity", "algorithm": "token_bucket", "limit": 5, "window": "1m", "burst": 10}]}`)
+    config, err := LoadConfigFromEnv()
+    if err != nil {
+        t.Fatalf("Failed to load config: %v", err)
+    }
+    if config.Backend != BackendMongo || time.Duration(config.Rules[0].Window) != time.Minute || config.Rules[0].Burst != 10 {
+        t.Errorf("Unexpected config: %+v", config)
+    }
+}
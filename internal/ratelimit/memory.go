@@ -0,0 +1,44 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const memorySweepInterval = time.Minute
+
+type memoryEntry struct {
+	state     state
+	expiresAt time.Time
+}
+
+// MemoryStore keeps counters in process. Each replica limits on its own.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]memoryEntry
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry)}
+}
+
+func (m *MemoryStore) Take(ctx context.Context, rule Rule, key string, now time.Time) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.lastSweep) > memorySweepInterval {
+		for id, entry := range m.entries {
+			if now.After(entry.expiresAt) {
+				delete(m.entries, id)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	id := rule.ID() + "|" + key
+	next, result := rule.apply(m.entries[id].state, now)
+	m.entries[id] = memoryEntry{state: next, expiresAt: now.Add(rule.expiry())}
+	return result, nil
+}
@@ -0,0 +1,165 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SinisterSup/auth-service/db"
+	"github.com/SinisterSup/auth-service/internal/mail"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Identities are read from at most this much of a JSON request body.
+const maxIdentityBody = 64 << 10
+
+type Limiter struct {
+	store Store
+	rules map[string][]Rule
+	now   func() time.Time
+}
+
+func NewLimiter(store Store, rules []Rule) *Limiter {
+	byRoute := make(map[string][]Rule)
+	for _, rule := range rules {
+		fields := strings.Fields(rule.Route)
+		route := strings.ToUpper(fields[0]) + " " + fields[1]
+		byRoute[route] = append(byRoute[route], rule)
+	}
+	return &Limiter{store: store, rules: byRoute, now: time.Now}
+}
+
+// NewLimiterFromEnv builds a limiter from LoadConfigFromEnv. It returns nil,
+// whose middleware lets everything through, when no limits are configured.
+func NewLimiterFromEnv() (*Limiter, error) {
+	config, err := LoadConfigFromEnv()
+	if err != nil || config == nil {
+		return nil, err
+	}
+
+	var store Store = NewMemoryStore()
+	if config.Backend == BackendMongo {
+		store = NewMongoStore(db.DB.Collection("rate_limits"))
+	}
+	return NewLimiter(store, config.Rules), nil
+}
+
+// Middleware applies the rules declared for the matched route. It reports the
+// most constrained rule in RateLimit-* headers and answers 429 with
+// Retry-After once any rule is exhausted. Store errors are logged and let the
+// request through rather than take sign-in down with the database.
+func (l *Limiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if l == nil {
+			c.Next()
+			return
+		}
+		// Tenant routes share the limits of the routes they mirror
+		route := strings.TrimPrefix(c.FullPath(), "/t/:tenant")
+		reported, denied := l.check(c.Request.Context(), c.Request.Method+" "+route, c.ClientIP(), func() string {
+			return requestIdentity(c)
+		})
+
+		if reported != nil {
+			c.Header("RateLimit-Limit", strconv.Itoa(reported.Limit))
+			c.Header("RateLimit-Remaining", strconv.Itoa(reported.Remaining))
+			c.Header("RateLimit-Reset", ceilSeconds(reported.Reset))
+		}
+		if denied != nil {
+			c.Header("Retry-After", ceilSeconds(denied.RetryAfter))
+			c.JSON(429, gin.H{"error": "too many requests"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// check takes a request from every rule of route, keyed by ip or by the
+// identity identify returns, which is only asked for if a rule needs it. It
+// returns the result of the most constrained rule, and the denying rule with
+// the longest wait if any denies the request. Both are nil without rules.
+func (l *Limiter) check(ctx context.Context, route, ip string, identify func() string) (reported, denied *Result) {
+	rules := l.rules[route]
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	now := l.now()
+	var identity string
+	for _, rule := range rules {
+		key := ip
+		if rule.Key == KeyIdentity {
+			if identity == "" {
+				identity = identify()
+			}
+			if identity == "" {
+				continue
+			}
+			key = identity
+		}
+
+		result, err := l.store.Take(ctx, rule, rule.Key+":"+key, now)
+		if err != nil {
+			log.Printf("Rate limit check for %s failed: %v", rule.Route, err)
+			continue
+		}
+		if !result.Allowed && (denied == nil || result.RetryAfter > denied.RetryAfter) {
+			denied = &result
+		}
+		if reported == nil || result.Remaining < reported.Remaining {
+			reported = &result
+		}
+	}
+
+	if denied != nil {
+		reported = denied
+	}
+	return reported, denied
+}
+
+// requestIdentity names who a request is about: the email in the JSON body
+// for sign-up and sign-in, otherwise the refresh or bearer token presented.
+// Tokens and emails are hashed so the counters hold no credentials.
+func requestIdentity(c *gin.Context) string {
+	var body struct {
+		Email        string `json:"email"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if c.Request.Body != nil && strings.HasPrefix(c.ContentType(), "application/json") {
+		data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxIdentityBody))
+		if err == nil {
+			c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(data), c.Request.Body))
+			json.Unmarshal(data, &body)
+		}
+	}
+
+	switch {
+	case body.Email != "":
+		return hashIdentity("email:" + mail.LookupAddress(body.Email))
+	case body.RefreshToken != "":
+		return hashIdentity("refresh:" + body.RefreshToken)
+	}
+	if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok && token != "" {
+		return hashIdentity("bearer:" + token)
+	}
+	return ""
+}
+
+func hashIdentity(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:16])
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
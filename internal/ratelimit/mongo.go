@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const mongoMaxRetries = 5
+
+// contendedRetryAfter is how long clients are told to wait when a counter
+// stays too contended to update.
+const contendedRetryAfter = time.Second
+
+type mongoEntry struct {
+	ID        string    `bson:"_id"`
+	State     state     `bson:"state"`
+	Version   int64     `bson:"version"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// MongoStore shares counters between replicas. Updates are compare-and-swap on
+// a version field, so concurrent requests never both spend the last token. A
+// request that loses the race mongoMaxRetries times is denied: a counter that
+// contended is being hammered. Expired counters are removed by the TTL index
+// db.EnsureIndexes creates.
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoStore(collection *mongo.Collection) *MongoStore {
+	return &MongoStore{collection: collection}
+}
+
+func (m *MongoStore) Take(ctx context.Context, rule Rule, key string, now time.Time) (Result, error) {
+	id := rule.ID() + "|" + key
+
+	for attempt := 0; attempt < mongoMaxRetries; attempt++ {
+		var current mongoEntry
+		err := m.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&current)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return Result{}, err
+		}
+		exists := err == nil
+		if exists && now.After(current.ExpiresAt) {
+			current.State = state{}
+		}
+
+		next, result := rule.apply(current.State, now)
+		entry := mongoEntry{ID: id, State: next, Version: current.Version + 1, ExpiresAt: now.Add(rule.expiry())}
+
+		if !exists {
+			_, err = m.collection.InsertOne(ctx, entry)
+			if mongo.IsDuplicateKeyError(err) {
+				continue
+			}
+			if err != nil {
+				return Result{}, err
+			}
+			return result, nil
+		}
+
+		updated, err := m.collection.ReplaceOne(ctx, bson.M{"_id": id, "version": current.Version}, entry)
+		if err != nil {
+			return Result{}, err
+		}
+		if updated.MatchedCount == 1 {
+			return result, nil
+		}
+	}
+	log.Printf("Rate limit counter %q is too contended; denying the request", id)
+	return Result{Limit: rule.Limit, Reset: contendedRetryAfter, RetryAfter: contendedRetryAfter}, nil
+}
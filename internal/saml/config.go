@@ -0,0 +1,59 @@
+package saml
+
+import (
+	"os"
+	"strings"
+)
+
+type Config struct {
+	Name            string
+	BaseURL         string
+	EntityID        string
+	IDPMetadataURL  string
+	IDPMetadataFile string
+	KeyFile         string
+	CertFile        string
+	SignRequests    bool
+	EmailAttributes []string
+	NameAttributes  []string
+}
+
+// LoadConfigsFromEnv reads the identity providers named in SAML_PROVIDERS.
+// SP settings (SAML_SP_BASE_URL, SAML_SP_KEY_FILE, SAML_SP_CERT_FILE) are
+// shared, while each name is configured through SAML_<NAME>_IDP_METADATA_URL
+// or _IDP_METADATA_FILE, an optional _ENTITY_ID and comma separated
+// _ATTRIBUTE_EMAIL / _ATTRIBUTE_NAME lists.
+func LoadConfigsFromEnv() []Config {
+	var configs []Config
+	for _, name := range strings.Split(os.Getenv("SAML_PROVIDERS"), ",") {
+		name = strings.TrimSpace(strings.ToLower(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "SAML_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		configs = append(configs, Config{
+			Name:            name,
+			BaseURL:         strings.TrimSuffix(os.Getenv("SAML_SP_BASE_URL"), "/"),
+			EntityID:        os.Getenv(prefix + "ENTITY_ID"),
+			IDPMetadataURL:  os.Getenv(prefix + "IDP_METADATA_URL"),
+			IDPMetadataFile: os.Getenv(prefix + "IDP_METADATA_FILE"),
+			KeyFile:         os.Getenv("SAML_SP_KEY_FILE"),
+			CertFile:        os.Getenv("SAML_SP_CERT_FILE"),
+			SignRequests:    os.Getenv(prefix+"SIGN_REQUESTS") == "true",
+			EmailAttributes: splitList(os.Getenv(prefix + "ATTRIBUTE_EMAIL")),
+			NameAttributes:  splitList(os.Getenv(prefix + "ATTRIBUTE_NAME")),
+		})
+	}
+	return configs
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
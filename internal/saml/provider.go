@@ -0,0 +1,278 @@
+package saml
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	gosaml "github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+var defaultEmailAttributes = []string{
+	"email",
+	"mail",
+	"urn:oid:0.9.2342.19200300.100.1.3",
+	"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
+}
+
+var defaultNameAttributes = []string{
+	"displayName",
+	"name",
+	"urn:oid:2.16.840.1.113730.3.1.241",
+	"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/name",
+}
+
+// Identity is what an assertion maps to once attributes have been resolved.
+type Identity struct {
+	Subject    string
+	Email      string
+	Name       string
+	Attributes map[string][]string
+}
+
+// Provider is this service acting as a SAML service provider towards one
+// identity provider. The IdP metadata is loaded on first use.
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu sync.Mutex
+	sp *gosaml.ServiceProvider
+}
+
+func NewProvider(config Config) (*Provider, error) {
+	if config.BaseURL == "" {
+		return nil, errors.New("SAML_SP_BASE_URL is required")
+	}
+	if config.IDPMetadataURL == "" && config.IDPMetadataFile == "" {
+		return nil, fmt.Errorf("no IdP metadata configured for %q", config.Name)
+	}
+	if len(config.EmailAttributes) == 0 {
+		config.EmailAttributes = defaultEmailAttributes
+	}
+	if len(config.NameAttributes) == 0 {
+		config.NameAttributes = defaultNameAttributes
+	}
+
+	key, cert, err := loadKeyPair(config)
+	if err != nil {
+		return nil, err
+	}
+
+	root := config.BaseURL + "/auth/saml/" + config.Name
+	metadataURL, err := url.Parse(root + "/metadata")
+	if err != nil {
+		return nil, fmt.Errorf("invalid SAML_SP_BASE_URL: %v", err)
+	}
+	acsURL, _ := url.Parse(root + "/acs")
+
+	sp := &gosaml.ServiceProvider{
+		EntityID:          config.EntityID,
+		Key:               key,
+		Certificate:       cert,
+		MetadataURL:       *metadataURL,
+		AcsURL:            *acsURL,
+		AuthnNameIDFormat: gosaml.PersistentNameIDFormat,
+	}
+	if config.SignRequests {
+		sp.SignatureMethod = dsig.RSASHA256SignatureMethod
+	}
+
+	return &Provider{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+		sp:     sp,
+	}, nil
+}
+
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+// Metadata returns the SP metadata document to register with the IdP.
+func (p *Provider) Metadata() ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return xml.MarshalIndent(p.sp.Metadata(), "", "  ")
+}
+
+// AuthnRequestURL builds an SP-initiated login redirect and returns the
+// request ID that the response must answer.
+func (p *Provider) AuthnRequestURL(ctx context.Context, relayState string) (string, string, error) {
+	sp, err := p.serviceProvider(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	ssoURL := sp.GetSSOBindingLocation(gosaml.HTTPRedirectBinding)
+	if ssoURL == "" {
+		return "", "", errors.New("IdP metadata has no HTTP-Redirect SSO endpoint")
+	}
+
+	req, err := sp.MakeAuthenticationRequest(ssoURL, gosaml.HTTPRedirectBinding, gosaml.HTTPPostBinding)
+	if err != nil {
+		return "", "", err
+	}
+	redirectURL, err := req.Redirect(relayState, sp)
+	if err != nil {
+		return "", "", err
+	}
+
+	return redirectURL.String(), req.ID, nil
+}
+
+// ParseResponse validates the posted SAMLResponse (signature, audience,
+// conditions and InResponseTo) and maps the assertion to an Identity.
+func (p *Provider) ParseResponse(ctx context.Context, r *http.Request, requestID string) (*Identity, error) {
+	sp, err := p.serviceProvider(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	assertion, err := sp.ParseResponse(r, []string{requestID})
+	if err != nil {
+		var invalid *gosaml.InvalidResponseError
+		if errors.As(err, &invalid) {
+			log.Printf("SAML response from %s rejected: %v", p.config.Name, invalid.PrivateErr)
+		}
+		return nil, errors.New("invalid SAML response")
+	}
+
+	return p.MapAssertion(assertion)
+}
+
+func (p *Provider) MapAssertion(assertion *gosaml.Assertion) (*Identity, error) {
+	if assertion.Subject == nil || assertion.Subject.NameID == nil || assertion.Subject.NameID.Value == "" {
+		return nil, errors.New("SAML assertion has no subject")
+	}
+
+	identity := &Identity{
+		Subject:    assertion.Subject.NameID.Value,
+		Attributes: make(map[string][]string),
+	}
+	for _, statement := range assertion.AttributeStatements {
+		for _, attr := range statement.Attributes {
+			for _, value := range attr.Values {
+				identity.Attributes[attr.Name] = append(identity.Attributes[attr.Name], value.Value)
+				if attr.FriendlyName != "" && attr.FriendlyName != attr.Name {
+					identity.Attributes[attr.FriendlyName] = append(identity.Attributes[attr.FriendlyName], value.Value)
+				}
+			}
+		}
+	}
+
+	identity.Email = firstAttribute(identity.Attributes, p.config.EmailAttributes)
+	if identity.Email == "" && assertion.Subject.NameID.Format == string(gosaml.EmailAddressNameIDFormat) {
+		identity.Email = assertion.Subject.NameID.Value
+	}
+	identity.Email = strings.TrimSpace(identity.Email)
+	identity.Name = firstAttribute(identity.Attributes, p.config.NameAttributes)
+
+	return identity, nil
+}
+
+func (p *Provider) serviceProvider(ctx context.Context) (*gosaml.ServiceProvider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.sp.IDPMetadata != nil {
+		return p.sp, nil
+	}
+
+	var metadata *gosaml.EntityDescriptor
+	var err error
+	if p.config.IDPMetadataFile != "" {
+		var data []byte
+		data, err = os.ReadFile(p.config.IDPMetadataFile)
+		if err == nil {
+			metadata, err = samlsp.ParseMetadata(data)
+		}
+	} else {
+		var metadataURL *url.URL
+		metadataURL, err = url.Parse(p.config.IDPMetadataURL)
+		if err == nil {
+			metadata, err = samlsp.FetchMetadata(ctx, p.client, *metadataURL)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load IdP metadata for %q: %v", p.config.Name, err)
+	}
+
+	p.sp.IDPMetadata = metadata
+	return p.sp, nil
+}
+
+func firstAttribute(attributes map[string][]string, names []string) string {
+	for _, name := range names {
+		if values := attributes[name]; len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// loadKeyPair reads the SP signing key and certificate. Without them an
+// ephemeral pair is generated, which means the metadata changes on every
+// restart and must be re-registered with the IdP.
+func loadKeyPair(config Config) (*rsa.PrivateKey, *x509.Certificate, error) {
+	if config.KeyFile != "" || config.CertFile != "" {
+		pair, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load SAML SP key pair: %v", err)
+		}
+		key, ok := pair.PrivateKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, nil, errors.New("SAML SP key must be an RSA key")
+		}
+		cert, err := x509.ParseCertificate(pair.Certificate[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		return key, cert, nil
+	}
+
+	log.Printf("SAML_SP_KEY_FILE is not set, generating an ephemeral SP key pair for %q", config.Name)
+	return GenerateKeyPair(config.BaseURL)
+}
+
+// GenerateKeyPair creates a self-signed RSA key pair for an SP.
+func GenerateKeyPair(commonName string) (*rsa.PrivateKey, *x509.Certificate, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(5, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, cert, nil
+}
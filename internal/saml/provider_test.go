@@ -0,0 +1,195 @@
+package saml
+
+import (
+    "bytes"
+    "context"
+    "encoding/base64"
+    "encoding/xml"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/beevik/etree"
+    gosaml "github.com/crewjam/saml"
+)
+
+func testProvider(t *testing.T, config Config) *Provider {
+    config.Name = "acme"
+    config.BaseURL = "http://localhost:8080"
+    config.IDPMetadataURL = "http://idp.example.com/metadata"
+
+    provider, err := NewProvider(config)
+    if err != nil {
+        t.Fatalf("Failed to create provider: %v", err)
+    }
+    return provider
+}
+
+func TestMetadata(t *testing.T) {
+    provider := testProvider(t, Config{})
+
+    metadata, err := provider.Metadata()
+    if err != nil {
+        t.Fatalf("Failed to build metadata: %v", err)
+    }
+    if !bytes.Contains(metadata, []byte("http://localhost:8080/auth/saml/acme/acs")) {
+        t.Error("Expected metadata to advertise the ACS URL")
+    }
+}
+
+func TestMapAssertion(t *testing.T) {
+    provider := testProvider(t, Config{EmailAttributes: []string{"corpMail"}})
+
+    assertion := &gosaml.Assertion{
+        Subject: &gosaml.Subject{NameID: &gosaml.NameID{Value: "abc123"}},
+        AttributeStatements: []gosaml.AttributeStatement{{
+            Attributes: []gosaml.Attribute{
+                {Name: "corpMail", Values: []gosaml.AttributeValue{{Value: " user@example.com "}}},
+                {Name: "urn:oid:2.16.840.1.113730.3.1.241", FriendlyName: "displayName", Values: []gosaml.AttributeValue{{Value: "Test User"}}},
+            },
+        }},
+    }
+
+    identity, err := provider.MapAssertion(assertion)
+    if err != nil {
+        t.Fatalf("Failed to map assertion: %v", err)
+    }
+    if identity.Subject != "abc123" {
+        t.Errorf("Expected subject abc123, got %s", identity.Subject)
+    }
+    if identity.Email != "user@example.com" {
+        t.Errorf("Expected mapped email, got %q", identity.Email)
+    }
+    if identity.Name != "Test User" {
+        t.Errorf("Expected mapped name, got %q", identity.Name)
+    }
+
+    assertion.Subject.NameID = nil
+    if _, err := provider.MapAssertion(assertion); err == nil {
+        t.Error("Expected error for assertion without subject, got nil")
+    }
+}
+
+// testIDP is an identity provider whose metadata the provider it returns
+// trusts.
+func testIDP(t *testing.T) (*gosaml.IdentityProvider, *Provider) {
+    key, cert, err := GenerateKeyPair("idp.example.com")
+    if err != nil {
+        t.Fatalf("Failed to generate IdP key pair: %v", err)
+    }
+    metadataURL, _ := url.Parse("http://idp.example.com/metadata")
+    ssoURL, _ := url.Parse("http://idp.example.com/sso")
+    idp := &gosaml.IdentityProvider{Key: key, Certificate: cert, MetadataURL: *metadataURL, SSOURL: *ssoURL}
+
+    metadata, err := xml.Marshal(idp.Metadata())
+    if err != nil {
+        t.Fatal(err)
+    }
+    path := filepath.Join(t.TempDir(), "idp.xml")
+    if err := os.WriteFile(path, metadata, 0o600); err != nil {
+        t.Fatal(err)
+    }
+    return idp, testProvider(t, Config{IDPMetadataFile: path})
+}
+
+// makeResponse has idp answer requestID for the user abc123, signed unless
+// unsigned is set. The assertion is not encrypted, so tests can alter it.
+func makeResponse(t *testing.T, idp *gosaml.IdentityProvider, provider *Provider, requestID string, now time.Time, unsigned bool) string {
+    spMetadata := provider.sp.Metadata()
+    spMetadata.SPSSODescriptors[0].KeyDescriptors = nil
+    req := &gosaml.IdpAuthnRequest{
+        IDP:                     idp,
+        HTTPRequest:             httptest.NewRequest(http.MethodGet, "/sso", nil),
+        Request:                 gosaml.AuthnRequest{ID: requestID, IssueInstant: now},
+        ServiceProviderMetadata: spMetadata,
+        SPSSODescriptor:         &spMetadata.SPSSODescriptors[0],
+        ACSEndpoint:             &gosaml.IndexedEndpoint{Binding: gosaml.HTTPPostBinding, Location: provider.sp.AcsURL.String()},
+        Now:                     now,
+    }
+    session := &gosaml.Session{
+        ID:         "session",
+        NameID:     "abc123",
+        CreateTime: now,
+        CustomAttributes: []gosaml.Attribute{
+            {Name: "mail", Values: []gosaml.AttributeValue{{Type: "xs:string", Value: "user@example.com"}}},
+        },
+    }
+    if err := (gosaml.DefaultAssertionMaker{}).MakeAssertion(req, session); err != nil {
+        t.Fatalf("Failed to make assertion: %v", err)
+    }
+
+    var responseEl *etree.Element
+    if unsigned {
+        response := &gosaml.Response{
+            Destination:  req.ACSEndpoint.Location,
+            ID:           "id-unsigned",
+            InResponseTo: requestID,
+            IssueInstant: now,
+            Version:      "2.0",
+            Issuer:       &gosaml.Issuer{Format: "urn:oasis:names:tc:SAML:2.0:nameid-format:entity", Value: idp.MetadataURL.String()},
+            Status:       gosaml.Status{StatusCode: gosaml.StatusCode{Value: gosaml.StatusSuccess}},
+        }
+        responseEl = response.Element()
+        responseEl.AddChild(req.Assertion.Element())
+    } else {
+        if err := req.MakeResponse(); err != nil {
+            t.Fatalf("Failed to make response: %v", err)
+        }
+        responseEl = req.ResponseEl
+    }
+
+    doc := etree.NewDocument()
+    doc.SetRoot(responseEl)
+    raw, err := doc.WriteToString()
+    if err != nil {
+        t.Fatal(err)
+    }
+    return raw
+}
+
+func postResponse(t *testing.T, provider *Provider, raw, requestID string) (*Identity, error) {
+    form := url.Values{"SAMLResponse": {base64.StdEncoding.EncodeToString([]byte(raw))}}
+    r := httptest.NewRequest(http.MethodPost, provider.sp.AcsURL.String(), strings.NewReader(form.Encode()))
+    r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+    if err := r.ParseForm(); err != nil {
+        t.Fatal(err)
+    }
+    return provider.ParseResponse(context.Background(), r, requestID)
+}
+
+func TestParseResponse(t *testing.T) {
+    idp, provider := testIDP(t)
+    now := time.Now()
+
+    identity, err := postResponse(t, provider, makeResponse(t, idp, provider, "id-request", now, false), "id-request")
+    if err != nil {
+        t.Fatalf("Expected a signed response to be accepted, got %v", err)
+    }
+    if identity.Subject != "abc123" || identity.Email != "user@example.com" {
+        t.Errorf("Unexpected identity %+v", identity)
+    }
+
+    tampered := strings.Replace(makeResponse(t, idp, provider, "id-request", now, false), ">abc123<", ">admin<", 1)
+    if !strings.Contains(tampered, ">admin<") {
+        t.Fatal("Expected the tampered response to carry the altered subject")
+    }
+    rejected := map[string]struct {
+        raw       string
+        requestID string
+    }{
+        "unsigned":           {makeResponse(t, idp, provider, "id-request", now, true), "id-request"},
+        "tampered":           {tampered, "id-request"},
+        "expired":            {makeResponse(t, idp, provider, "id-request", now.Add(-time.Hour), false), "id-request"},
+        "wrong InResponseTo": {makeResponse(t, idp, provider, "id-other", now, false), "id-request"},
+    }
+    for name, test := range rejected {
+        if _, err := postResponse(t, provider, test.raw, test.requestID); err == nil {
+            t.Errorf("Expected the %s response to be rejected", name)
+        }
+    }
+}
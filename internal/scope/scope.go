@@ -0,0 +1,118 @@
+// Package scope handles OAuth 2.0 scopes, the space-separated lists of
+// strings that narrow what an access token may be used for (RFC 6749 §3.3).
+package scope
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+var ErrInvalidScope = errors.New("requested scope is unknown or exceeds the granted scope")
+
+// Parse splits a scope string into its scopes, sorted and without duplicates.
+func Parse(scope string) []string {
+	seen := map[string]bool{}
+	scopes := []string{}
+	for _, s := range strings.Fields(scope) {
+		if !seen[s] {
+			seen[s] = true
+			scopes = append(scopes, s)
+		}
+	}
+	sort.Strings(scopes)
+	return scopes
+}
+
+func Format(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// Contains reports whether granted includes every one of required.
+func Contains(granted []string, required ...string) bool {
+	for _, r := range required {
+		found := false
+		for _, g := range granted {
+			if g == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Narrow works out the scope of an access token minted from a refresh token
+// that was granted granted. No request keeps the whole grant; anything else
+// must be a subset of it.
+func Narrow(granted []string, requested string) ([]string, error) {
+	if strings.TrimSpace(requested) == "" {
+		return granted, nil
+	}
+	scopes := Parse(requested)
+	if !Contains(granted, scopes...) {
+		return nil, ErrInvalidScope
+	}
+	return scopes, nil
+}
+
+// Config lists the scopes this deployment issues. With none configured,
+// tokens carry no scope claim and scope requests are refused.
+type Config struct {
+	Supported []string
+	// Default is granted when a sign-in asks for no scope. It defaults to
+	// every supported scope.
+	Default []string
+}
+
+// LoadConfigFromEnv reads OAUTH_SCOPES and OAUTH_DEFAULT_SCOPE, both
+// space-separated.
+func LoadConfigFromEnv() (*Config, error) {
+	config := &Config{
+		Supported: Parse(os.Getenv("OAUTH_SCOPES")),
+		Default:   Parse(os.Getenv("OAUTH_DEFAULT_SCOPE")),
+	}
+	for _, s := range config.Supported {
+		if !valid(s) {
+			return nil, fmt.Errorf("OAUTH_SCOPES: %q is not a valid scope", s)
+		}
+	}
+	if !Contains(config.Supported, config.Default...) {
+		return nil, errors.New("OAUTH_DEFAULT_SCOPE must only name scopes listed in OAUTH_SCOPES")
+	}
+	if len(config.Default) == 0 {
+		config.Default = config.Supported
+	}
+	return config, nil
+}
+
+func (c *Config) Enabled() bool {
+	return len(c.Supported) > 0
+}
+
+// Grant works out the scope of a new sign-in from the requested scope string.
+func (c *Config) Grant(requested string) ([]string, error) {
+	if strings.TrimSpace(requested) == "" {
+		return c.Default, nil
+	}
+	scopes := Parse(requested)
+	if !c.Enabled() || !Contains(c.Supported, scopes...) {
+		return nil, ErrInvalidScope
+	}
+	return scopes, nil
+}
+
+// valid reports whether s only uses the characters RFC 6749 allows in a scope.
+func valid(s string) bool {
+	for _, r := range s {
+		if r < 0x21 || r == 0x22 || r == 0x5c || r > 0x7e {
+			return false
+		}
+	}
+	return s != ""
+}
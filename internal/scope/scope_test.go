@@ -0,0 +1,73 @@
+package scope
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestParseAndFormat(t *testing.T) {
+    scopes := Parse("  reports:read profile  reports:read email ")
+    if !reflect.DeepEqual(scopes, []string{"email", "profile", "reports:read"}) {
+        t.Errorf("Unexpected scopes %v", scopes)
+    }
+    if Format(scopes) != "email profile reports:read" {
+        t.Errorf("Unexpected format %q", Format(scopes))
+    }
+    if len(Parse("")) != 0 {
+        t.Error("Expected empty scope to parse to nothing")
+    }
+}
+
+func TestGrant(t *testing.T) {
+    t.Setenv("OAUTH_SCOPES", "profile email reports:read reports:write")
+    t.Setenv("OAUTH_DEFAULT_SCOPE", "profile email")
+    config, err := LoadConfigFromEnv()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if granted, _ := config.Grant(""); !reflect.DeepEqual(granted, []string{"email", "profile"}) {
+        t.Errorf("Expected default scope, got %v", granted)
+    }
+    if granted, err := config.Grant("reports:read profile"); err != nil || !reflect.DeepEqual(granted, []string{"profile", "reports:read"}) {
+        t.Errorf("Expected requested scope, got %v, %v", granted, err)
+    }
+    if _, err := config.Grant("reports:read admin"); err != ErrInvalidScope {
+        t.Errorf("Expected unknown scope to be refused, got %v", err)
+    }
+
+    t.Setenv("OAUTH_DEFAULT_SCOPE", "")
+    config, _ = LoadConfigFromEnv()
+    if granted, _ := config.Grant(""); len(granted) != 4 {
+        t.Errorf("Expected every supported scope by default, got %v", granted)
+    }
+
+    t.Setenv("OAUTH_DEFAULT_SCOPE", "admin")
+    if _, err := LoadConfigFromEnv(); err == nil {
+        t.Error("Expected default scope outside OAUTH_SCOPES to be rejected")
+    }
+
+    t.Setenv("OAUTH_SCOPES", "")
+    t.Setenv("OAUTH_DEFAULT_SCOPE", "")
+    config, _ = LoadConfigFromEnv()
+    if granted, err := config.Grant(""); err != nil || len(granted) != 0 {
+        t.Errorf("Expected no scope without configuration, got %v, %v", granted, err)
+    }
+    if _, err := config.Grant("profile"); err != ErrInvalidScope {
+        t.Errorf("Expected scope requests to be refused without configuration, got %v", err)
+    }
+}
+
+func TestNarrow(t *testing.T) {
+    granted := []string{"email", "profile", "reports:read"}
+
+    if scopes, _ := Narrow(granted, ""); !reflect.DeepEqual(scopes, granted) {
+        t.Errorf("Expected the whole grant, got %v", scopes)
+    }
+    if scopes, err := Narrow(granted, "profile"); err != nil || !reflect.DeepEqual(scopes, []string{"profile"}) {
+        t.Errorf("Expected narrower scope, got %v, %v", scopes, err)
+    }
+    if _, err := Narrow(granted, "profile reports:write"); err != ErrInvalidScope {
+        t.Errorf("Expected wider scope to be refused, got %v", err)
+    }
+}
@@ -0,0 +1,244 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/SinisterSup/auth-service/db"
+	"github.com/SinisterSup/auth-service/internal/models"
+	"github.com/SinisterSup/auth-service/internal/passwordhash"
+	"github.com/SinisterSup/auth-service/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Accounts without a password can re-authenticate by signing in again; the
+// access token used for deletion must then be this fresh.
+const recentSignInWindow = 5 * time.Minute
+
+var ErrReauthenticationRequired = errors.New("re-authentication required")
+
+type AccountService struct {
+	users       *mongo.Collection
+	challenges  *mongo.Collection
+	oidcStates  *mongo.Collection
+	memberships *mongo.Collection
+	apiKeys     *mongo.Collection
+	authService *AuthService
+	audit       *AuditService
+	gracePeriod time.Duration
+}
+
+func NewAccountService(authService *AuthService) *AccountService {
+	grace, err := time.ParseDuration(os.Getenv("ACCOUNT_DELETION_GRACE"))
+	if err != nil || grace < 0 {
+		grace = 30 * 24 * time.Hour
+	}
+
+	return &AccountService{
+		users:       db.DB.Collection("users"),
+		challenges:  db.DB.Collection("login_challenges"),
+		oidcStates:  db.DB.Collection("oidc_states"),
+		memberships: authService.memberships,
+		apiKeys:     db.DB.Collection("api_keys"),
+		authService: authService,
+		audit:       authService.audit,
+		gracePeriod: grace,
+	}
+}
+
+// RequestDeletion soft-deletes the account and ends its sessions. The user is
+// re-authenticated with their password. Only accounts without one, which sign
+// in through another method, may instead use a token issued within
+// recentSignInWindow.
+func (s *AccountService) RequestDeletion(userId string, input models.DeleteAccountInput, tokenIssuedAt time.Time, meta models.RequestMeta) error {
+	objectId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	err = s.users.FindOne(ctx, bson.M{"_id": objectId, "deleted_at": bson.M{"$exists": false}}).Decode(&user)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	if input.Password != "" || user.Password != "" {
+		// The password check counts towards the sign-in lockout, so an access
+		// token is no way around it
+		login := tenantLogin(user.TenantID, user.Email)
+		if err := s.authService.throttle.Check(ctx, login, meta.IP); err != nil {
+			return err
+		}
+		authenticated, err := s.authService.authenticator.Authenticate(ctx, user.TenantID, user.Email, input.Password)
+		if err != nil && (errors.Is(err, passwordhash.ErrSaturated) || ctx.Err() != nil) {
+			return err
+		}
+		if err != nil || authenticated.ID != user.ID {
+			s.authService.recordSignInFailure(ctx, login, user.Email, meta)
+			return ErrReauthenticationRequired
+		}
+		if err := s.authService.throttle.RecordSuccess(ctx, login); err != nil {
+			log.Printf("Failed to reset sign-in failures: %v", err)
+		}
+	} else if time.Since(tokenIssuedAt) > recentSignInWindow {
+		return ErrReauthenticationRequired
+	}
+
+	now := time.Now()
+	purgeAfter := now.Add(s.gracePeriod)
+	_, err = s.users.UpdateOne(
+		ctx,
+		bson.M{"_id": objectId},
+		bson.M{"$set": bson.M{
+			"status":        models.StatusDeleted,
+			"deleted_at":    now,
+			"purge_after":   purgeAfter,
+			"refresh_token": "",
+			"updated_at":    now,
+		}},
+	)
+	if err != nil {
+		return errors.New("failed to delete account")
+	}
+
+	event := auditEvent(models.AuditAccountDeletionRequested, objectId, user.Email, meta)
+	event.Metadata = map[string]interface{}{"purge_after": purgeAfter}
+	s.audit.Record(ctx, event)
+	return nil
+}
+
+func (s *AccountService) Export(userId string, meta models.RequestMeta) (*models.AccountExport, error) {
+	objectId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := s.users.FindOne(ctx, bson.M{"_id": objectId}).Decode(&user); err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	export := &models.AccountExport{
+		ExportedAt:      time.Now(),
+		User:            user,
+		Sessions:        []models.SessionExport{},
+		LoginChallenges: []models.LoginChallengeExport{},
+	}
+
+	if user.RefreshToken != "" {
+		issuedAt, expiresAt := utils.TokenLifetime(user.RefreshToken)
+		export.Sessions = append(export.Sessions, models.SessionExport{Kind: "refresh", IssuedAt: issuedAt, ExpiresAt: expiresAt})
+	}
+	for _, revoked := range user.RevokedTokens {
+		issuedAt, expiresAt := utils.TokenLifetime(revoked.Token)
+		revokedAt := revoked.RevokedAt
+		export.Sessions = append(export.Sessions, models.SessionExport{Kind: "revoked", IssuedAt: issuedAt, ExpiresAt: expiresAt, RevokedAt: &revokedAt})
+	}
+
+	cursor, err := s.challenges.Find(ctx, bson.M{"user_id": objectId})
+	if err != nil {
+		return nil, fmt.Errorf("error reading sign-in challenges: %v", err)
+	}
+	var challenges []models.LoginChallenge
+	if err := cursor.All(ctx, &challenges); err != nil {
+		return nil, fmt.Errorf("error reading sign-in challenges: %v", err)
+	}
+	for _, challenge := range challenges {
+		export.LoginChallenges = append(export.LoginChallenges, models.LoginChallengeExport{
+			CreatedAt:  challenge.CreatedAt,
+			ExpiresAt:  challenge.ExpiresAt,
+			ConsumedAt: challenge.ConsumedAt,
+			Attempts:   challenge.Attempts,
+		})
+	}
+
+	s.audit.Record(ctx, auditEvent(models.AuditAccountExported, objectId, user.Email, meta))
+
+	export.AuditEvents, err = s.audit.ListForUser(ctx, objectId, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error reading audit history: %v", err)
+	}
+	return export, nil
+}
+
+// PurgeDeleted permanently removes accounts whose grace period has ended,
+// together with their pending challenges, and scrubs their audit history.
+func (s *AccountService) PurgeDeleted(ctx context.Context) (int, error) {
+	cursor, err := s.users.Find(ctx, bson.M{"purge_after": bson.M{"$lte": time.Now()}})
+	if err != nil {
+		return 0, err
+	}
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, user := range users {
+		if err := s.purgeUser(ctx, &user); err != nil {
+			return purged, fmt.Errorf("failed to purge user %s: %v", user.ID.Hex(), err)
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+func (s *AccountService) purgeUser(ctx context.Context, user *models.User) error {
+	userId := user.ID
+	if _, err := s.challenges.DeleteMany(ctx, bson.M{"user_id": userId}); err != nil {
+		return err
+	}
+	if _, err := s.oidcStates.DeleteMany(ctx, bson.M{"link_user_id": userId}); err != nil {
+		return err
+	}
+	if _, err := s.memberships.DeleteMany(ctx, bson.M{"user_id": userId}); err != nil {
+		return err
+	}
+	if _, err := s.apiKeys.DeleteMany(ctx, bson.M{"user_id": userId}); err != nil {
+		return err
+	}
+	if err := s.audit.ScrubUser(ctx, userId, user.Email); err != nil {
+		return err
+	}
+	if _, err := s.users.DeleteOne(ctx, bson.M{"_id": userId}); err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, auditEvent(models.AuditAccountPurged, userId, "", models.RequestMeta{}))
+	return nil
+}
+
+// StartPurger runs PurgeDeleted every interval until ctx is cancelled.
+func (s *AccountService) StartPurger(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				purged, err := s.PurgeDeleted(ctx)
+				if err != nil {
+					log.Printf("Account purge failed: %v", err)
+				} else if purged > 0 {
+					log.Printf("Purged %d deleted accounts", purged)
+				}
+			}
+		}
+	}()
+}
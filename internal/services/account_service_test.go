@@ -0,0 +1,68 @@
+package services
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    "github.com/SinisterSup/auth-service/internal/models"
+
+    "go.mongodb.org/mongo-driver/bson"
+)
+
+func TestAccountDeletionAndPurge(t *testing.T) {
+    cleanup := setupTestDB(t)
+    defer cleanup()
+
+    accountService := NewAccountService(testService)
+    accountService.gracePeriod = 0
+
+    user, err := testService.SignUp(models.SignUpInput{Email: "test@example.com", Password: "password123"})
+    if err != nil {
+        t.Fatalf("Failed to create test user: %v", err)
+    }
+    userId := user.ID.Hex()
+
+    err = accountService.RequestDeletion(userId, models.DeleteAccountInput{}, time.Now().Add(-time.Hour), models.RequestMeta{})
+    if err != ErrReauthenticationRequired {
+        t.Errorf("Expected re-authentication to be required, got %v", err)
+    }
+
+    err = accountService.RequestDeletion(userId, models.DeleteAccountInput{}, time.Now(), models.RequestMeta{})
+    if err != ErrReauthenticationRequired {
+        t.Errorf("Expected the password to be required despite a fresh token, got %v", err)
+    }
+
+    err = accountService.RequestDeletion(userId, models.DeleteAccountInput{Password: "password123"}, time.Time{}, models.RequestMeta{})
+    if err != nil {
+        t.Fatalf("Failed to delete account: %v", err)
+    }
+
+    _, err = testService.SignIn(models.SignInInput{Email: "test@example.com", Password: "password123"})
+    if err == nil {
+        t.Error("Expected sign-in to fail for deleted account, got nil")
+    }
+
+    export, err := accountService.Export(userId, models.RequestMeta{})
+    if err != nil {
+        t.Fatalf("Failed to export account: %v", err)
+    }
+    if export.User.Email != "test@example.com" || len(export.AuditEvents) == 0 {
+        t.Errorf("Expected export with user and audit history, got %+v", export)
+    }
+
+    purged, err := accountService.PurgeDeleted(context.Background())
+    if err != nil {
+        t.Fatalf("Failed to purge accounts: %v", err)
+    }
+    if purged != 1 {
+        t.Errorf("Expected 1 purged account, got %d", purged)
+    }
+    if _, err := accountService.Export(userId, models.RequestMeta{}); err == nil {
+        t.Error("Expected purged user to be gone, got nil")
+    }
+    // The failed re-authentications above were recorded without the user
+    if n, _ := accountService.audit.collection.CountDocuments(context.Background(), bson.M{"email": "test@example.com"}); n != 0 {
+        t.Errorf("Expected the email to be scrubbed from every audit event, found %d", n)
+    }
+}
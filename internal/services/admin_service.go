@@ -0,0 +1,482 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/SinisterSup/auth-service/db"
+	"github.com/SinisterSup/auth-service/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+var (
+	ErrUserNotFound  = errors.New("user not found")
+	ErrInvalidStatus = errors.New("invalid account status")
+	// ErrLastAdmin is returned when the only remaining admin would demote,
+	// suspend or delete themselves, leaving nobody to run the admin API.
+	ErrLastAdmin = errors.New("the last admin cannot demote, suspend or delete themselves")
+)
+
+// AdminService backs the /admin API. Every method takes the acting admin's
+// ID and records an audit event against the target user.
+type AdminService struct {
+	users          *mongo.Collection
+	audit          *AuditService
+	accountService *AccountService
+	resetService   *PasswordResetService
+	throttle       *LoginThrottle
+	roles          *RoleService
+	tenants        *TenantService
+}
+
+func NewAdminService(accountService *AccountService, resetService *PasswordResetService) *AdminService {
+	return &AdminService{
+		users:          db.DB.Collection("users"),
+		audit:          accountService.audit,
+		accountService: accountService,
+		resetService:   resetService,
+		throttle:       accountService.authService.throttle,
+		roles:          accountService.authService.roles,
+		tenants:        accountService.authService.tenants,
+	}
+}
+
+func (s *AdminService) SearchUsers(actorId string, query models.UserSearchQuery, meta models.RequestMeta) (*models.UserPage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if query.Limit <= 0 {
+		query.Limit = defaultPageSize
+	}
+	if query.Limit > maxPageSize {
+		query.Limit = maxPageSize
+	}
+	if query.Page <= 0 {
+		query.Page = 1
+	}
+
+	filter := bson.M{}
+	if query.Email != "" {
+		filter["email"] = bson.M{"$regex": "^" + regexp.QuoteMeta(query.Email), "$options": "i"}
+	}
+	if query.Role != "" {
+		filter["roles"] = query.Role
+	}
+	if query.Tenant != "" {
+		filter["tenant_id"] = query.Tenant
+	}
+	switch models.AccountStatus(query.Status) {
+	case "":
+	case models.StatusActive:
+		filter["status"] = bson.M{"$in": bson.A{nil, models.StatusActive}}
+	case models.StatusDeleted:
+		filter["deleted_at"] = bson.M{"$exists": true}
+	default:
+		filter["status"] = query.Status
+	}
+	if !query.Deleted && query.Status != string(models.StatusDeleted) {
+		filter["deleted_at"] = bson.M{"$exists": false}
+	}
+
+	total, err := s.users.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := s.users.Find(
+		ctx,
+		filter,
+		options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+			SetSkip((query.Page-1)*query.Limit).
+			SetLimit(query.Limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	users := []models.User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	event := s.actorEvent(models.AuditAdminUsersSearched, actorId, primitive.NilObjectID, meta)
+	event.Metadata = map[string]interface{}{"email": query.Email, "role": query.Role, "status": query.Status, "tenant": query.Tenant, "page": query.Page}
+	s.audit.Record(ctx, event)
+
+	return &models.UserPage{Users: users, Page: query.Page, Limit: query.Limit, Total: total}, nil
+}
+
+func (s *AdminService) GetUser(actorId, userId string, meta models.RequestMeta) (*models.User, error) {
+	objectId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := s.users.FindOne(ctx, bson.M{"_id": objectId}).Decode(&user); err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	s.audit.Record(ctx, s.actorEvent(models.AuditAdminUserViewed, actorId, objectId, meta))
+	return &user, nil
+}
+
+func (s *AdminService) DisableUser(actorId, userId string, input models.DisableUserInput, meta models.RequestMeta) error {
+	if err := s.checkNotLastAdmin(actorId, userId); err != nil {
+		return err
+	}
+	now := time.Now()
+	event := models.AuditEvent{Action: models.AuditAdminUserDisabled, Metadata: map[string]interface{}{"reason": input.Reason, "until": input.Until}}
+	return s.updateUser(actorId, userId, statusUpdate(models.StatusSuspended, input.Reason, input.Until, now), event, meta)
+}
+
+func (s *AdminService) EnableUser(actorId, userId string, meta models.RequestMeta) error {
+	return s.updateUser(actorId, userId, statusUpdate(models.StatusActive, "", nil, time.Now()), models.AuditEvent{Action: models.AuditAdminUserEnabled}, meta)
+}
+
+// SetStatus moves the account to any status other than deleted, which goes
+// through DeleteUser. Setting a deleted account active cancels its deletion.
+func (s *AdminService) SetStatus(actorId, userId string, input models.UpdateStatusInput, meta models.RequestMeta) error {
+	if !input.Status.Valid() || input.Status == models.StatusDeleted {
+		return ErrInvalidStatus
+	}
+	if input.Status != models.StatusActive {
+		if err := s.checkNotLastAdmin(actorId, userId); err != nil {
+			return err
+		}
+	}
+
+	event := models.AuditEvent{Action: models.AuditAdminStatusChanged, Metadata: map[string]interface{}{
+		"status": input.Status,
+		"reason": input.Reason,
+		"until":  input.Until,
+	}}
+	return s.updateUser(actorId, userId, statusUpdate(input.Status, input.Reason, input.Until, time.Now()), event, meta)
+}
+
+// UnlockUser clears the account's failed sign-in counter and lifts a locked
+// status. It does not touch suspensions.
+func (s *AdminService) UnlockUser(actorId, userId string, meta models.RequestMeta) error {
+	objectId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return ErrUserNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := s.users.FindOne(ctx, bson.M{"_id": objectId}).Decode(&user); err != nil {
+		return ErrUserNotFound
+	}
+
+	if err := s.throttle.UnlockAccount(ctx, tenantLogin(user.TenantID, user.Email)); err != nil {
+		return fmt.Errorf("failed to clear sign-in failures: %v", err)
+	}
+	if user.Status == models.StatusLocked {
+		if _, err := s.users.UpdateOne(ctx, bson.M{"_id": objectId}, statusUpdate(models.StatusActive, "", nil, time.Now())); err != nil {
+			return errors.New("failed to update user")
+		}
+	}
+
+	s.audit.Record(ctx, s.actorEvent(models.AuditAdminUserUnlocked, actorId, objectId, meta))
+	return nil
+}
+
+func (s *AdminService) UnlockIP(actorId, ip string, meta models.RequestMeta) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := s.throttle.UnlockIP(ctx, ip); err != nil {
+		return fmt.Errorf("failed to clear sign-in failures: %v", err)
+	}
+
+	event := s.actorEvent(models.AuditAdminIPUnlocked, actorId, primitive.NilObjectID, meta)
+	event.Metadata = map[string]interface{}{"ip": ip}
+	s.audit.Record(ctx, event)
+	return nil
+}
+
+func (s *AdminService) ForceLogout(actorId, userId string, meta models.RequestMeta) error {
+	now := time.Now()
+	return s.updateUser(actorId, userId, bson.M{
+		"$set": bson.M{"refresh_token": "", "updated_at": now},
+		"$inc": bson.M{"token_generation": 1},
+	}, models.AuditEvent{Action: models.AuditAdminUserLoggedOut}, meta)
+}
+
+// UpdateRoles replaces the user's roles with defined ones. The user's current
+// access tokens stop working so the next refresh carries the new roles.
+func (s *AdminService) UpdateRoles(actorId, userId string, input models.UpdateRolesInput, meta models.RequestMeta) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.roles.CheckRoles(ctx, input.Roles); err != nil {
+		return err
+	}
+	if !slices.Contains(input.Roles, "admin") {
+		if err := s.checkNotLastAdmin(actorId, userId); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	event := models.AuditEvent{Action: models.AuditAdminRolesUpdated, Metadata: map[string]interface{}{"roles": input.Roles}}
+	return s.updateUser(actorId, userId, bson.M{
+		"$set": bson.M{"roles": input.Roles, "updated_at": now},
+		"$inc": bson.M{"token_generation": 1},
+	}, event, meta)
+}
+
+// UpdatePermissions replaces the permissions granted to the user directly,
+// on top of those from their roles.
+func (s *AdminService) UpdatePermissions(actorId, userId string, input models.UpdatePermissionsInput, meta models.RequestMeta) error {
+	if err := models.ValidatePermissions(input.Permissions); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	event := models.AuditEvent{Action: models.AuditAdminPermissionsUpdated, Metadata: map[string]interface{}{"permissions": input.Permissions}}
+	return s.updateUser(actorId, userId, bson.M{
+		"$set": bson.M{"permissions": input.Permissions, "updated_at": now},
+		"$inc": bson.M{"token_generation": 1},
+	}, event, meta)
+}
+
+func (s *AdminService) ListRoles(actorId string, meta models.RequestMeta) ([]models.Role, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	roles, err := s.roles.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit.Record(ctx, s.actorEvent(models.AuditAdminRolesListed, actorId, primitive.NilObjectID, meta))
+	return roles, nil
+}
+
+func (s *AdminService) PutRole(actorId, name string, input models.RoleInput, meta models.RequestMeta) (*models.Role, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	role, err := s.roles.Put(ctx, name, input)
+	if err != nil {
+		return nil, err
+	}
+
+	event := s.actorEvent(models.AuditAdminRoleSaved, actorId, primitive.NilObjectID, meta)
+	event.Metadata = map[string]interface{}{"role": name, "permissions": input.Permissions}
+	s.audit.Record(ctx, event)
+	return role, nil
+}
+
+func (s *AdminService) DeleteRole(actorId, name string, meta models.RequestMeta) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := s.roles.Delete(ctx, name); err != nil {
+		return err
+	}
+
+	event := s.actorEvent(models.AuditAdminRoleDeleted, actorId, primitive.NilObjectID, meta)
+	event.Metadata = map[string]interface{}{"role": name}
+	s.audit.Record(ctx, event)
+	return nil
+}
+
+func (s *AdminService) ListTenants(actorId string, meta models.RequestMeta) ([]models.Tenant, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tenants, err := s.tenants.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit.Record(ctx, s.actorEvent(models.AuditAdminTenantsListed, actorId, primitive.NilObjectID, meta))
+	return tenants, nil
+}
+
+func (s *AdminService) PutTenant(actorId, id string, input models.TenantInput, meta models.RequestMeta) (*models.Tenant, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tenant, err := s.tenants.Put(ctx, id, input)
+	if err != nil {
+		return nil, err
+	}
+
+	event := s.actorEvent(models.AuditAdminTenantSaved, actorId, primitive.NilObjectID, meta)
+	event.Metadata = map[string]interface{}{"tenant": id, "hosts": tenant.Hosts, "settings": tenant.Settings}
+	s.audit.Record(ctx, event)
+	return tenant, nil
+}
+
+func (s *AdminService) DeleteTenant(actorId, id string, meta models.RequestMeta) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := s.tenants.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	event := s.actorEvent(models.AuditAdminTenantDeleted, actorId, primitive.NilObjectID, meta)
+	event.Metadata = map[string]interface{}{"tenant": id}
+	s.audit.Record(ctx, event)
+	return nil
+}
+
+func (s *AdminService) ForcePasswordReset(actorId, userId string, meta models.RequestMeta) error {
+	objectId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return ErrUserNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := s.resetService.ForceReset(ctx, objectId); err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, s.actorEvent(models.AuditAdminPasswordResetForced, actorId, objectId, meta))
+	return nil
+}
+
+// DeleteUser soft-deletes the account; it is purged after the usual grace period.
+func (s *AdminService) DeleteUser(actorId, userId string, meta models.RequestMeta) error {
+	if err := s.checkNotLastAdmin(actorId, userId); err != nil {
+		return err
+	}
+	now := time.Now()
+	purgeAfter := now.Add(s.accountService.gracePeriod)
+	event := models.AuditEvent{Action: models.AuditAdminUserDeleted, Metadata: map[string]interface{}{"purge_after": purgeAfter}}
+	return s.updateUser(actorId, userId, bson.M{"$set": bson.M{
+		"status":        models.StatusDeleted,
+		"deleted_at":    now,
+		"purge_after":   purgeAfter,
+		"refresh_token": "",
+		"updated_at":    now,
+	}}, event, meta)
+}
+
+func (s *AdminService) UserAudit(actorId, userId string, limit int64, meta models.RequestMeta) ([]models.AuditEvent, error) {
+	objectId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if limit <= 0 || limit > maxPageSize {
+		limit = maxPageSize
+	}
+	events, err := s.audit.ListForUser(ctx, objectId, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit.Record(ctx, s.actorEvent(models.AuditAdminUserAuditViewed, actorId, objectId, meta))
+	return events, nil
+}
+
+// checkNotLastAdmin refuses an admin's change to their own account that would
+// take away their access when no other active admin is left. Changes to other
+// accounts are not limited.
+func (s *AdminService) checkNotLastAdmin(actorId, userId string) error {
+	objectId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil || actorId != userId {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	others, err := s.users.CountDocuments(ctx, tenantFilter(models.DefaultTenant, bson.M{
+		"_id":        bson.M{"$ne": objectId},
+		"roles":      "admin",
+		"status":     bson.M{"$in": bson.A{nil, models.StatusActive}},
+		"deleted_at": bson.M{"$exists": false},
+	}), options.Count().SetLimit(1))
+	if err != nil {
+		return fmt.Errorf("error counting admins: %v", err)
+	}
+	if others == 0 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// statusUpdate builds the update for a status change. Leaving active ends the
+// user's sessions; becoming active clears any reason, expiry or pending deletion.
+func statusUpdate(status models.AccountStatus, reason string, until *time.Time, now time.Time) bson.M {
+	if status == models.StatusActive {
+		return bson.M{
+			"$set":   bson.M{"status": status, "updated_at": now},
+			"$unset": bson.M{"status_reason": "", "status_until": "", "deleted_at": "", "purge_after": ""},
+		}
+	}
+
+	set := bson.M{
+		"status":        status,
+		"status_reason": reason,
+		"refresh_token": "",
+		"updated_at":    now,
+	}
+	update := bson.M{"$set": set, "$inc": bson.M{"token_generation": 1}}
+	if until != nil {
+		set["status_until"] = *until
+	} else {
+		update["$unset"] = bson.M{"status_until": ""}
+	}
+	return update
+}
+
+func (s *AdminService) updateUser(actorId, userId string, update bson.M, event models.AuditEvent, meta models.RequestMeta) error {
+	objectId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return ErrUserNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := s.users.UpdateOne(ctx, bson.M{"_id": objectId}, update)
+	if err != nil {
+		return errors.New("failed to update user")
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+
+	recorded := s.actorEvent(event.Action, actorId, objectId, meta)
+	recorded.Metadata = event.Metadata
+	s.audit.Record(ctx, recorded)
+	return nil
+}
+
+func (s *AdminService) actorEvent(action, actorId string, userId primitive.ObjectID, meta models.RequestMeta) models.AuditEvent {
+	event := auditEvent(action, userId, "", meta)
+	if actorObjectId, err := primitive.ObjectIDFromHex(actorId); err == nil {
+		event.ActorID = &actorObjectId
+	}
+	return event
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "regexp"
+    "testing"
+    "time"
+
+    "github.com/SinisterSup/auth-service/internal/models"
+
+    "go.mongodb.org/mongo-driver/bson"
+)
+
+func TestAdminDisableAndForcePasswordReset(t *testing.T) {
+    cleanup := setupTestDB(t)
+    defer cleanup()
+
+    mailer := &recordingMailer{}
+    resetService := NewPasswordResetService(testService, mailer)
+    adminService := NewAdminService(NewAccountService(testService), resetService)
+
+    admin, err := testService.SignUp(models.SignUpInput{Email: "admin@example.com", Password: "password123"})
+    if err != nil {
+        t.Fatalf("Failed to create admin user: %v", err)
+    }
+    user, err := testService.SignUp(models.SignUpInput{Email: "test@example.com", Password: "password123"})
+    if err != nil {
+        t.Fatalf("Failed to create test user: %v", err)
+    }
+    actorId, userId := admin.ID.Hex(), user.ID.Hex()
+    credentials := models.SignInInput{Email: "test@example.com", Password: "password123"}
+
+    page, err := adminService.SearchUsers(actorId, models.UserSearchQuery{Email: "TEST@"}, models.RequestMeta{})
+    if err != nil {
+        t.Fatalf("Failed to search users: %v", err)
+    }
+    if page.Total != 1 || page.Users[0].ID != user.ID {
+        t.Errorf("Expected search to find only the test user, got %+v", page)
+    }
+
+    if err := adminService.DisableUser(actorId, userId, models.DisableUserInput{Reason: "abuse"}, models.RequestMeta{}); err != nil {
+        t.Fatalf("Failed to disable user: %v", err)
+    }
+    if _, err := testService.SignIn(credentials); !errors.Is(err, ErrAccountInactive) {
+        t.Errorf("Expected ErrAccountInactive for suspended user, got %v", err)
+    }
+
+    expired := time.Now().Add(-time.Minute)
+    err = adminService.SetStatus(actorId, userId, models.UpdateStatusInput{Status: models.StatusLocked, Until: &expired}, models.RequestMeta{})
+    if err != nil {
+        t.Fatalf("Failed to lock user: %v", err)
+    }
+    if _, err := testService.SignIn(credentials); err != nil {
+        t.Errorf("Expected expired lock to allow sign-in, got %v", err)
+    }
+    if err := adminService.SetStatus(actorId, userId, models.UpdateStatusInput{Status: models.StatusDeleted}, models.RequestMeta{}); err != ErrInvalidStatus {
+        t.Errorf("Expected ErrInvalidStatus for deleted, got %v", err)
+    }
+
+    if err := adminService.EnableUser(actorId, userId, models.RequestMeta{}); err != nil {
+        t.Fatalf("Failed to enable user: %v", err)
+    }
+    if err := adminService.ForcePasswordReset(actorId, userId, models.RequestMeta{}); err != nil {
+        t.Fatalf("Failed to force password reset: %v", err)
+    }
+    if _, err := testService.SignIn(credentials); err != ErrPasswordResetRequired {
+        t.Errorf("Expected ErrPasswordResetRequired, got %v", err)
+    }
+    // Signing in without the password must not get around the reset
+    linkMailer := &recordingMailer{}
+    passwordless := NewPasswordlessService(testService, linkMailer)
+    if err := passwordless.RequestMagicLink(models.MagicLinkInput{Email: "test@example.com"}); err != nil {
+        t.Fatalf("Failed to request magic link: %v", err)
+    }
+    code := regexp.MustCompile(`\d{6}`).FindString(linkMailer.bodies[0])
+    if _, err := passwordless.VerifyOTP(models.OTPVerifyInput{Email: "test@example.com", Code: code}); err != ErrPasswordResetRequired {
+        t.Errorf("Expected ErrPasswordResetRequired from a sign-in code, got %v", err)
+    }
+
+    if len(mailer.bodies) != 1 {
+        t.Fatalf("Expected 1 reset email, got %d", len(mailer.bodies))
+    }
+    token := regexp.MustCompile(`Reset token: (\S+)`).FindStringSubmatch(mailer.bodies[0])
+    if token == nil {
+        t.Fatalf("Reset token not found in email: %q", mailer.bodies[0])
+    }
+    if err := resetService.ResetPassword(models.ResetPasswordInput{Token: token[1], NewPassword: "newpassword123"}, models.RequestMeta{}); err != nil {
+        t.Fatalf("Failed to reset password: %v", err)
+    }
+    if err := resetService.ResetPassword(models.ResetPasswordInput{Token: token[1], NewPassword: "another123"}, models.RequestMeta{}); err != ErrInvalidResetToken {
+        t.Errorf("Expected reset token to be single-use, got %v", err)
+    }
+
+    credentials.Password = "newpassword123"
+    if _, err := testService.SignIn(credentials); err != nil {
+        t.Errorf("Failed to sign in with new password: %v", err)
+    }
+
+    events, err := adminService.UserAudit(actorId, userId, 0, models.RequestMeta{})
+    if err != nil {
+        t.Fatalf("Failed to list audit events: %v", err)
+    }
+    actions := map[string]bool{}
+    for _, event := range events {
+        actions[event.Action] = true
+        if event.Action == models.AuditAdminUserDisabled && (event.ActorID == nil || *event.ActorID != admin.ID) {
+            t.Errorf("Expected disable event to record the acting admin, got %+v", event)
+        }
+    }
+    if !actions[models.AuditAdminUserDisabled] || !actions[models.AuditAdminPasswordResetForced] {
+        t.Errorf("Expected admin actions in audit trail, got %v", actions)
+    }
+
+    events, err = adminService.UserAudit(actorId, userId, 0, models.RequestMeta{})
+    if err != nil {
+        t.Fatalf("Failed to list audit events: %v", err)
+    }
+    if events[0].Action != models.AuditAdminUserAuditViewed {
+        t.Errorf("Expected reading the audit trail to be audited, got %s", events[0].Action)
+    }
+}
+
+func TestLastAdminCannotLockThemselvesOut(t *testing.T) {
+    cleanup := setupTestDB(t)
+    defer cleanup()
+    ctx := context.Background()
+
+    adminService := NewAdminService(NewAccountService(testService), NewPasswordResetService(testService, &recordingMailer{}))
+    admin, err := testService.SignUp(models.SignUpInput{Email: "admin@example.com", Password: "password123"})
+    if err != nil {
+        t.Fatalf("Failed to create admin user: %v", err)
+    }
+    other, err := testService.SignUp(models.SignUpInput{Email: "other@example.com", Password: "password123"})
+    if err != nil {
+        t.Fatalf("Failed to create other user: %v", err)
+    }
+    if _, err := testService.collection.UpdateOne(ctx, bson.M{"_id": admin.ID}, bson.M{"$set": bson.M{"roles": []string{"admin"}}}); err != nil {
+        t.Fatalf("Failed to grant admin: %v", err)
+    }
+    actorId := admin.ID.Hex()
+
+    if err := adminService.UpdateRoles(actorId, actorId, models.UpdateRolesInput{Roles: []string{}}, models.RequestMeta{}); err != ErrLastAdmin {
+        t.Errorf("Expected ErrLastAdmin on self-demotion, got %v", err)
+    }
+    if err := adminService.DisableUser(actorId, actorId, models.DisableUserInput{}, models.RequestMeta{}); err != ErrLastAdmin {
+        t.Errorf("Expected ErrLastAdmin on self-disable, got %v", err)
+    }
+    if err := adminService.SetStatus(actorId, actorId, models.UpdateStatusInput{Status: models.StatusLocked}, models.RequestMeta{}); err != ErrLastAdmin {
+        t.Errorf("Expected ErrLastAdmin on self-lock, got %v", err)
+    }
+    if err := adminService.DeleteUser(actorId, actorId, models.RequestMeta{}); err != ErrLastAdmin {
+        t.Errorf("Expected ErrLastAdmin on self-deletion, got %v", err)
+    }
+
+    if err := adminService.UpdateRoles(actorId, other.ID.Hex(), models.UpdateRolesInput{Roles: []string{"admin"}}, models.RequestMeta{}); err != nil {
+        t.Fatalf("Failed to grant admin: %v", err)
+    }
+    if err := adminService.UpdateRoles(actorId, actorId, models.UpdateRolesInput{Roles: []string{}}, models.RequestMeta{}); err != nil {
+        t.Errorf("Expected self-demotion to work with another admin left, got %v", err)
+    }
+}
@@ -0,0 +1,340 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/SinisterSup/auth-service/db"
+	"github.com/SinisterSup/auth-service/internal/models"
+	"github.com/SinisterSup/auth-service/internal/scope"
+	"github.com/SinisterSup/auth-service/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// lastUsedResolution limits how often using a key writes its last use.
+const lastUsedResolution = time.Minute
+
+var (
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	ErrInvalidAPIKey  = errors.New("invalid, expired or revoked API key")
+	ErrInvalidExpiry  = errors.New("expiry must be in the future and within the maximum key lifetime")
+)
+
+// APIKeyService issues and checks API keys: personal access tokens, which
+// act as their user with that user's current roles, and service keys, which
+// carry the permissions an admin gave them. Keys are stored as hashes and
+// never shown again after creation.
+type APIKeyService struct {
+	keys        *mongo.Collection
+	users       *mongo.Collection
+	roles       *RoleService
+	tenants     *TenantService
+	scopes      *scope.Config
+	audit       *AuditService
+	maxLifetime time.Duration
+}
+
+func NewAPIKeyService(authService *AuthService) *APIKeyService {
+	maxLifetime, err := time.ParseDuration(os.Getenv("API_KEY_MAX_LIFETIME"))
+	if err != nil || maxLifetime < 0 {
+		maxLifetime = 0
+	}
+
+	return &APIKeyService{
+		keys:        db.DB.Collection("api_keys"),
+		users:       db.DB.Collection("users"),
+		roles:       authService.roles,
+		tenants:     authService.tenants,
+		scopes:      authService.scopes,
+		audit:       authService.audit,
+		maxLifetime: maxLifetime,
+	}
+}
+
+// CreatePersonal issues a personal access token for the user, granted scope
+// or the default scopes.
+func (s *APIKeyService) CreatePersonal(ctx context.Context, userId string, input models.CreatePersonalTokenInput, meta models.RequestMeta) (*models.CreatedAPIKey, error) {
+	objectId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	var user models.User
+	if err := s.users.FindOne(ctx, bson.M{"_id": objectId}).Decode(&user); err != nil {
+		return nil, ErrUserNotFound
+	}
+	if err := user.StatusError(time.Now()); err != nil {
+		return nil, err
+	}
+
+	scopes, err := s.scopes.Grant(input.Scope)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt, err := s.expiry(input.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := s.create(ctx, models.APIKey{
+		Kind:      models.APIKeyPersonal,
+		TenantID:  user.TenantID,
+		UserID:    &user.ID,
+		Name:      input.Name,
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+		CreatedBy: user.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	event := auditEvent(models.AuditAPIKeyCreated, user.ID, user.Email, meta)
+	event.Metadata = map[string]interface{}{"key_id": created.ID.Hex(), "kind": created.Kind, "name": created.Name}
+	s.audit.Record(ctx, event)
+	return created, nil
+}
+
+// CreateService issues a key for a service in input.Tenant, with its own
+// permissions rather than a user's.
+func (s *APIKeyService) CreateService(ctx context.Context, actorId string, input models.CreateServiceKeyInput, meta models.RequestMeta) (*models.CreatedAPIKey, error) {
+	if _, err := s.tenants.Get(ctx, input.Tenant); err != nil {
+		return nil, err
+	}
+	if err := models.ValidatePermissions(input.Permissions); err != nil {
+		return nil, err
+	}
+	scopes, err := s.scopes.Grant(input.Scope)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt, err := s.expiry(input.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	actor, _ := primitive.ObjectIDFromHex(actorId)
+	created, err := s.create(ctx, models.APIKey{
+		Kind:        models.APIKeyService,
+		TenantID:    input.Tenant,
+		Service:     input.Service,
+		Name:        input.Name,
+		Scopes:      scopes,
+		Permissions: uniqueStrings(input.Permissions),
+		ExpiresAt:   expiresAt,
+		CreatedBy:   actor,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.recordActorEvent(ctx, models.AuditAPIKeyCreated, actorId, primitive.NilObjectID, meta, created.APIKey)
+	return created, nil
+}
+
+// ListPersonal returns the user's personal access tokens that are not
+// revoked, expired ones included.
+func (s *APIKeyService) ListPersonal(ctx context.Context, userId string) ([]models.APIKey, error) {
+	objectId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	return s.find(ctx, bson.M{"user_id": objectId, "revoked_at": bson.M{"$exists": false}})
+}
+
+// List returns the keys of every kind, or only those of query.Kind or of
+// user query.User.
+func (s *APIKeyService) List(ctx context.Context, query models.APIKeyQuery) ([]models.APIKey, error) {
+	filter := bson.M{}
+	if query.Kind != "" {
+		filter["kind"] = query.Kind
+	}
+	if query.User != "" {
+		objectId, err := primitive.ObjectIDFromHex(query.User)
+		if err != nil {
+			return nil, ErrUserNotFound
+		}
+		filter["user_id"] = objectId
+	}
+	return s.find(ctx, filter)
+}
+
+// RevokePersonal revokes one of the user's own personal access tokens.
+func (s *APIKeyService) RevokePersonal(ctx context.Context, userId, keyId string, meta models.RequestMeta) error {
+	user, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return ErrAPIKeyNotFound
+	}
+	key, err := s.revoke(ctx, keyId, bson.M{"user_id": user})
+	if err != nil {
+		return err
+	}
+
+	event := auditEvent(models.AuditAPIKeyRevoked, user, "", meta)
+	event.Metadata = map[string]interface{}{"key_id": keyId, "kind": key.Kind, "name": key.Name}
+	s.audit.Record(ctx, event)
+	return nil
+}
+
+// Revoke revokes any key on behalf of admin actorId or, when actorId is
+// empty, of the key itself.
+func (s *APIKeyService) Revoke(ctx context.Context, actorId, keyId string, meta models.RequestMeta) error {
+	key, err := s.revoke(ctx, keyId, bson.M{})
+	if err != nil {
+		return err
+	}
+
+	userId := primitive.NilObjectID
+	if key.UserID != nil {
+		userId = *key.UserID
+	}
+	s.recordActorEvent(ctx, models.AuditAPIKeyRevoked, actorId, userId, meta, *key)
+	return nil
+}
+
+// Authenticate checks an API key presented as a bearer token and describes
+// the request it authenticates as access token claims would. Personal
+// tokens get their user's current roles and permissions, so they never
+// outlast a change to them; service keys get their own permissions.
+func (s *APIKeyService) Authenticate(ctx context.Context, token, ip string) (*utils.JWTClaim, error) {
+	if !utils.CheckPrefixedToken(token, models.PersonalTokenPrefix) && !utils.CheckPrefixedToken(token, models.ServiceKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var key models.APIKey
+	err := s.keys.FindOne(ctx, bson.M{"token_hash": utils.HashSecret(token)}).Decode(&key)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error looking up API key: %v", err)
+	}
+	now := time.Now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && !now.Before(*key.ExpiresAt)) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	claims := &utils.JWTClaim{
+		Scope:  scope.Format(key.Scopes),
+		Tenant: key.TenantID,
+		KeyID:  key.ID.Hex(),
+	}
+	if key.Kind == models.APIKeyService {
+		claims.Service = key.Service
+		claims.Permissions = key.Permissions
+	} else {
+		var user models.User
+		if err := s.users.FindOne(ctx, bson.M{"_id": key.UserID}).Decode(&user); err != nil {
+			return nil, ErrInvalidAPIKey
+		}
+		if err := user.StatusError(now); err != nil {
+			return nil, err
+		}
+		permissions, err := s.roles.Permissions(ctx, &user)
+		if err != nil {
+			return nil, err
+		}
+		claims.UserId = user.ID.Hex()
+		claims.Email = user.Email
+		claims.Roles = user.Roles
+		claims.Permissions = permissions
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedResolution {
+		_, err := s.keys.UpdateOne(ctx, bson.M{"_id": key.ID}, bson.M{"$set": bson.M{"last_used_at": now, "last_used_ip": ip}})
+		if err != nil {
+			return nil, fmt.Errorf("error recording API key use: %v", err)
+		}
+	}
+	return claims, nil
+}
+
+func (s *APIKeyService) create(ctx context.Context, key models.APIKey) (*models.CreatedAPIKey, error) {
+	prefix := models.PersonalTokenPrefix
+	if key.Kind == models.APIKeyService {
+		prefix = models.ServiceKeyPrefix
+	}
+	token, err := utils.GeneratePrefixedToken(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	key.Prefix = token[:len(prefix)+6]
+	key.TokenHash = utils.HashSecret(token)
+	key.CreatedAt = time.Now()
+	result, err := s.keys.InsertOne(ctx, key)
+	if err != nil {
+		return nil, errors.New("failed to store API key")
+	}
+	key.ID = result.InsertedID.(primitive.ObjectID)
+	return &models.CreatedAPIKey{APIKey: key, Token: token}, nil
+}
+
+// expiry checks a requested expiry against API_KEY_MAX_LIFETIME, which also
+// applies to keys that ask for none.
+func (s *APIKeyService) expiry(requested *time.Time) (*time.Time, error) {
+	now := time.Now()
+	if requested != nil && !requested.After(now) {
+		return nil, ErrInvalidExpiry
+	}
+	if s.maxLifetime == 0 {
+		return requested, nil
+	}
+	latest := now.Add(s.maxLifetime)
+	if requested == nil {
+		return &latest, nil
+	}
+	if requested.After(latest) {
+		return nil, ErrInvalidExpiry
+	}
+	return requested, nil
+}
+
+func (s *APIKeyService) revoke(ctx context.Context, keyId string, filter bson.M) (*models.APIKey, error) {
+	objectId, err := primitive.ObjectIDFromHex(keyId)
+	if err != nil {
+		return nil, ErrAPIKeyNotFound
+	}
+	filter["_id"] = objectId
+	filter["revoked_at"] = bson.M{"$exists": false}
+
+	var key models.APIKey
+	err = s.keys.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"revoked_at": time.Now()}}).Decode(&key)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, errors.New("failed to revoke API key")
+	}
+	return &key, nil
+}
+
+func (s *APIKeyService) find(ctx context.Context, filter bson.M) ([]models.APIKey, error) {
+	cursor, err := s.keys.Find(ctx, filter, options.Find().SetSort(bson.M{"created_at": -1}))
+	if err != nil {
+		return nil, fmt.Errorf("error looking up API keys: %v", err)
+	}
+	keys := []models.APIKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, fmt.Errorf("error looking up API keys: %v", err)
+	}
+	return keys, nil
+}
+
+func (s *APIKeyService) recordActorEvent(ctx context.Context, action, actorId string, userId primitive.ObjectID, meta models.RequestMeta, key models.APIKey) {
+	event := auditEvent(action, userId, "", meta)
+	if actorObjectId, err := primitive.ObjectIDFromHex(actorId); err == nil {
+		event.ActorID = &actorObjectId
+	}
+	event.Metadata = map[string]interface{}{"key_id": key.ID.Hex(), "kind": key.Kind, "name": key.Name}
+	if key.Service != "" {
+		event.Metadata["service"] = key.Service
+	}
+	s.audit.Record(ctx, event)
+}
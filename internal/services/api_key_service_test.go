@@ -0,0 +1,113 @@
+package services
+
+import (
+    "context"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/SinisterSup/auth-service/internal/models"
+)
+
+func TestPersonalAccessTokens(t *testing.T) {
+    cleanup := setupTestDB(t)
+    defer cleanup()
+
+    ctx := context.Background()
+    keys := NewAPIKeyService(testService)
+    user, err := testService.SignUp(models.SignUpInput{Email: "test@example.com", Password: "password123"})
+    if err != nil {
+        t.Fatalf("Failed to create user: %v", err)
+    }
+
+    past := time.Now().Add(-time.Hour)
+    if _, err := keys.CreatePersonal(ctx, user.ID.Hex(), models.CreatePersonalTokenInput{Name: "old", ExpiresAt: &past}, models.RequestMeta{}); err != ErrInvalidExpiry {
+        t.Errorf("Expected an expiry in the past to be refused, got %v", err)
+    }
+
+    created, err := keys.CreatePersonal(ctx, user.ID.Hex(), models.CreatePersonalTokenInput{Name: "ci"}, models.RequestMeta{})
+    if err != nil {
+        t.Fatalf("Failed to create token: %v", err)
+    }
+    if !strings.HasPrefix(created.Token, models.PersonalTokenPrefix) || !strings.HasPrefix(created.Token, created.Prefix) || created.TokenHash == created.Token {
+        t.Errorf("Unexpected token %q with prefix %q", created.Token, created.Prefix)
+    }
+
+    claims, err := keys.Authenticate(ctx, created.Token, "10.0.0.1")
+    if err != nil {
+        t.Fatalf("Failed to authenticate: %v", err)
+    }
+    if claims.UserId != user.ID.Hex() || claims.KeyID != created.ID.Hex() || len(claims.Roles) != 0 {
+        t.Errorf("Unexpected claims %+v", claims)
+    }
+
+    // Tokens act with the user's current roles
+    if err := testService.roles.EnsureDefaults(ctx); err != nil {
+        t.Fatal(err)
+    }
+    admin := NewAdminService(NewAccountService(testService), NewPasswordResetService(testService, &recordingMailer{}))
+    if err := admin.UpdateRoles(user.ID.Hex(), user.ID.Hex(), models.UpdateRolesInput{Roles: []string{"admin"}}, models.RequestMeta{}); err != nil {
+        t.Fatalf("Failed to update roles: %v", err)
+    }
+    claims, err = keys.Authenticate(ctx, created.Token, "10.0.0.1")
+    if err != nil || len(claims.Roles) != 1 {
+        t.Errorf("Expected the new role, got %+v, %v", claims, err)
+    }
+
+    listed, err := keys.ListPersonal(ctx, user.ID.Hex())
+    if err != nil || len(listed) != 1 || listed[0].LastUsedAt == nil || listed[0].LastUsedIP != "10.0.0.1" {
+        t.Errorf("Expected one token with its last use, got %+v, %v", listed, err)
+    }
+
+    if _, err := keys.Authenticate(ctx, created.Token[:len(created.Token)-1]+"x", ""); err != ErrInvalidAPIKey {
+        t.Errorf("Expected a mangled token to be refused, got %v", err)
+    }
+    if err := keys.RevokePersonal(ctx, "000000000000000000000000", created.ID.Hex(), models.RequestMeta{}); err != ErrAPIKeyNotFound {
+        t.Errorf("Expected another user's token to be out of reach, got %v", err)
+    }
+    if err := keys.RevokePersonal(ctx, user.ID.Hex(), created.ID.Hex(), models.RequestMeta{}); err != nil {
+        t.Fatalf("Failed to revoke: %v", err)
+    }
+    if _, err := keys.Authenticate(ctx, created.Token, ""); err != ErrInvalidAPIKey {
+        t.Errorf("Expected a revoked token to be refused, got %v", err)
+    }
+}
+
+func TestServiceKeys(t *testing.T) {
+    cleanup := setupTestDB(t)
+    defer cleanup()
+
+    ctx := context.Background()
+    keys := NewAPIKeyService(testService)
+
+    if _, err := keys.CreateService(ctx, "", models.CreateServiceKeyInput{Name: "x", Service: "billing", Tenant: "missing"}, models.RequestMeta{}); err != ErrTenantNotFound {
+        t.Errorf("Expected an unknown tenant to be refused, got %v", err)
+    }
+
+    created, err := keys.CreateService(ctx, "", models.CreateServiceKeyInput{
+        Name:        "billing sync",
+        Service:     "billing",
+        Permissions: []string{"invoices:read", "invoices:read"},
+    }, models.RequestMeta{})
+    if err != nil {
+        t.Fatalf("Failed to create key: %v", err)
+    }
+    if !strings.HasPrefix(created.Token, models.ServiceKeyPrefix) {
+        t.Errorf("Expected a service key prefix, got %q", created.Token)
+    }
+
+    claims, err := keys.Authenticate(ctx, created.Token, "")
+    if err != nil {
+        t.Fatalf("Failed to authenticate: %v", err)
+    }
+    if claims.UserId != "" || claims.Service != "billing" || len(claims.Permissions) != 1 {
+        t.Errorf("Unexpected claims %+v", claims)
+    }
+
+    if err := keys.Revoke(ctx, "", created.ID.Hex(), models.RequestMeta{}); err != nil {
+        t.Fatalf("Failed to revoke: %v", err)
+    }
+    if _, err := keys.Authenticate(ctx, created.Token, ""); err != ErrInvalidAPIKey {
+        t.Errorf("Expected a revoked key to be refused, got %v", err)
+    }
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/SinisterSup/auth-service/db"
+	"github.com/SinisterSup/auth-service/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AuditService struct {
+	collection *mongo.Collection
+}
+
+func NewAuditService() *AuditService {
+	return &AuditService{
+		collection: db.DB.Collection("audit_events"),
+	}
+}
+
+// Record stores an audit event. It never fails the calling operation; write
+// errors are only logged.
+func (s *AuditService) Record(ctx context.Context, event models.AuditEvent) {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	if _, err := s.collection.InsertOne(ctx, event); err != nil {
+		log.Printf("Failed to record audit event %s: %v", event.Action, err)
+	}
+}
+
+func (s *AuditService) ListForUser(ctx context.Context, userId primitive.ObjectID, limit int64) ([]models.AuditEvent, error) {
+	cursor, err := s.collection.Find(
+		ctx,
+		bson.M{"user_id": userId},
+		options.Find().SetSort(bson.M{"created_at": -1}).SetLimit(limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []models.AuditEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// ScrubUser removes personal data from a user's audit history while keeping
+// the actions and timestamps. Events recorded without a user, such as failed
+// sign-ins, are matched by email.
+func (s *AuditService) ScrubUser(ctx context.Context, userId primitive.ObjectID, email string) error {
+	_, err := s.collection.UpdateMany(
+		ctx,
+		bson.M{"$or": bson.A{
+			bson.M{"user_id": userId},
+			bson.M{"actor_id": userId},
+			bson.M{"user_id": bson.M{"$exists": false}, "email": email},
+		}},
+		bson.M{"$unset": bson.M{"email": "", "ip": "", "user_agent": "", "metadata": ""}},
+	)
+	return err
+}
+
+func auditEvent(action string, userId primitive.ObjectID, email string, meta models.RequestMeta) models.AuditEvent {
+	event := models.AuditEvent{
+		Action:    action,
+		Email:     email,
+		IP:        meta.IP,
+		UserAgent: meta.UserAgent,
+	}
+	if !userId.IsZero() {
+		event.UserID = &userId
+	}
+	return event
+}
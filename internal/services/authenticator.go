@@ -0,0 +1,353 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/SinisterSup/auth-service/internal/ldap"
+	"github.com/SinisterSup/auth-service/internal/mail"
+	"github.com/SinisterSup/auth-service/internal/models"
+	"github.com/SinisterSup/auth-service/internal/passwordhash"
+	"github.com/SinisterSup/auth-service/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const ldapIdentityProvider = "ldap"
+
+// Authenticator checks sign-in credentials within a tenant and returns the
+// local user record that tokens are issued for.
+type Authenticator interface {
+	Authenticate(ctx context.Context, tenantId, email, password string) (*models.User, error)
+}
+
+// newAuthenticatorFromEnv selects the backend named by AUTH_BACKEND ("local"
+// by default, or "ldap").
+func newAuthenticatorFromEnv(users *mongo.Collection, hasher *passwordhash.Pool) Authenticator {
+	switch os.Getenv("AUTH_BACKEND") {
+	case "ldap":
+		config, err := ldap.LoadConfigFromEnv()
+		if err != nil {
+			log.Fatal(err)
+		}
+		client, err := ldap.NewClient(config)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return NewLDAPAuthenticator(client, users)
+	default:
+		authenticator, err := NewLocalAuthenticator(users, hasher)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return authenticator
+	}
+}
+
+// LocalAuthenticator checks the password hash stored on the user document and
+// upgrades it to the current algorithm and parameters after a successful check.
+// Unknown emails and accounts without a password are checked against a dummy
+// hash, so every failure takes as long and reads the same.
+type LocalAuthenticator struct {
+	users  *mongo.Collection
+	hasher *passwordhash.Pool
+	dummy  string
+}
+
+// NewLocalAuthenticator makes the dummy hash. While any account still has a
+// plain bcrypt hash from before PHC strings were used, which costs far more
+// to check than the current scheme, the dummy is a bcrypt hash of the highest
+// cost stored, so that unknown emails take as long as those accounts until
+// the next restart. Otherwise it is made with the current settings.
+func NewLocalAuthenticator(users *mongo.Collection, hasher *passwordhash.Pool) (*LocalAuthenticator, error) {
+	password, err := utils.GenerateOpaqueToken(16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dummy password: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cost, err := legacyBcryptCost(ctx, users)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look for legacy password hashes: %v", err)
+	}
+	var dummy string
+	if cost > 0 {
+		var hashed []byte
+		hashed, err = bcrypt.GenerateFromPassword([]byte(password), cost)
+		dummy = string(hashed)
+	} else {
+		dummy, err = hasher.Hash(ctx, password)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dummy password hash: %v", err)
+	}
+	return &LocalAuthenticator{users: users, hasher: hasher, dummy: dummy}, nil
+}
+
+// legacyBcryptCost returns the highest cost among stored plain bcrypt
+// hashes, or 0 when there are none. The cost is part of the hash prefix, so
+// sorting on the hash finds it.
+func legacyBcryptCost(ctx context.Context, users *mongo.Collection) (int, error) {
+	var user models.User
+	err := users.FindOne(
+		ctx,
+		bson.M{"password": primitive.Regex{Pattern: `^\$2[aby]\$`}},
+		options.FindOne().SetSort(bson.M{"password": -1}).SetProjection(bson.M{"password": 1}),
+	).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return bcrypt.Cost([]byte(user.Password))
+}
+
+func (a *LocalAuthenticator) Authenticate(ctx context.Context, tenantId, email, password string) (*models.User, error) {
+	var user models.User
+	err := a.users.FindOne(ctx, tenantFilter(tenantId, bson.M{"email": email})).Decode(&user)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+	if err == mongo.ErrNoDocuments || user.Password == "" {
+		_, err := a.hasher.Verify(ctx, password, a.dummy)
+		if err != nil && (errors.Is(err, passwordhash.ErrSaturated) || ctx.Err() != nil) {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
+	}
+
+	ok, err := a.hasher.Verify(ctx, password, user.Password)
+	if err != nil && (errors.Is(err, passwordhash.ErrSaturated) || ctx.Err() != nil) {
+		return nil, err
+	}
+	if err != nil {
+		log.Printf("Failed to verify password hash of user %s: %v", user.ID.Hex(), err)
+	}
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	if a.hasher.NeedsRehash(user.Password) {
+		a.rehash(ctx, &user, password)
+	}
+
+	return &user, nil
+}
+
+// rehash replaces the stored hash with one made by the current hasher. The
+// update only applies if the hash is unchanged, so a concurrent password
+// change wins. Failures are logged; the old hash keeps working.
+func (a *LocalAuthenticator) rehash(ctx context.Context, user *models.User, password string) {
+	hashedPassword, err := a.hasher.Hash(ctx, password)
+	if err != nil {
+		log.Printf("Failed to rehash password of user %s: %v", user.ID.Hex(), err)
+		return
+	}
+
+	_, err = a.users.UpdateOne(
+		ctx,
+		bson.M{"_id": user.ID, "password": user.Password},
+		bson.M{"$set": bson.M{"password": hashedPassword}},
+	)
+	if err != nil {
+		log.Printf("Failed to store rehashed password of user %s: %v", user.ID.Hex(), err)
+		return
+	}
+	user.Password = hashedPassword
+}
+
+// LDAPAuthenticator verifies the password with a directory bind and keeps a
+// local shadow user in sync so tokens, revocation and sessions work as usual.
+// The directory serves the default tenant only.
+type LDAPAuthenticator struct {
+	client *ldap.Client
+	users  *mongo.Collection
+}
+
+func NewLDAPAuthenticator(client *ldap.Client, users *mongo.Collection) *LDAPAuthenticator {
+	return &LDAPAuthenticator{client: client, users: users}
+}
+
+func (a *LDAPAuthenticator) Authenticate(ctx context.Context, tenantId, email, password string) (*models.User, error) {
+	if tenantId != models.DefaultTenant {
+		return nil, ErrInvalidCredentials
+	}
+	entry, err := a.bind(email, password)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.syncShadowUser(ctx, email, entry)
+}
+
+// Link links the directory account login signs in as to an existing local
+// account, proven by binding with its password. A local account with the
+// directory account's email is never taken over on sign-in; it has to be
+// linked this way first.
+func (a *LDAPAuthenticator) Link(ctx context.Context, userId primitive.ObjectID, login, password string) (*models.User, error) {
+	entry, err := a.bind(login, password)
+	if err != nil {
+		return nil, err
+	}
+	identity := directoryIdentity(login, entry)
+
+	var owner models.User
+	err = a.users.FindOne(ctx, identityFilter(identity)).Decode(&owner)
+	if err == nil && owner.ID != userId {
+		return nil, ErrIdentityLinked
+	}
+	if err == mongo.ErrNoDocuments {
+		result, err := a.users.UpdateOne(
+			ctx,
+			bson.M{"_id": userId},
+			bson.M{
+				"$push": bson.M{"identities": identity},
+				"$set":  bson.M{"updated_at": time.Now()},
+			},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error linking LDAP user: %v", err)
+		}
+		if result.MatchedCount == 0 {
+			return nil, ErrUserNotFound
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("error looking up LDAP user: %v", err)
+	}
+	return a.syncShadowUser(ctx, login, entry)
+}
+
+func (a *LDAPAuthenticator) bind(login, password string) (*ldap.Entry, error) {
+	entry, err := a.client.Authenticate(login, password)
+	if err == ldap.ErrInvalidCredentials || err == ldap.ErrUserNotFound {
+		return nil, ErrInvalidCredentials
+	}
+	return entry, err
+}
+
+func directoryIdentity(login string, entry *ldap.Entry) models.LinkedIdentity {
+	email := entry.Email
+	if email == "" {
+		email = login
+	}
+	return models.LinkedIdentity{
+		Provider: ldapIdentityProvider,
+		Subject:  entry.DN,
+		Email:    mail.LookupAddress(email),
+		LinkedAt: time.Now(),
+	}
+}
+
+// syncShadowUser updates the user linked to the directory entry, or creates
+// one. The directory manages the roles its groups map to: those it granted
+// last time and no longer grants are removed, while roles granted through
+// the admin API stay. A change of roles invalidates the user's tokens. The
+// account's email follows the directory's only while it is the one the
+// directory gave it, so linking never changes a local account's email.
+func (a *LDAPAuthenticator) syncShadowUser(ctx context.Context, login string, entry *ldap.Entry) (*models.User, error) {
+	identity := directoryIdentity(login, entry)
+	now := time.Now()
+	directoryRoles := entry.Roles
+	if directoryRoles == nil {
+		directoryRoles = []string{}
+	}
+
+	var user models.User
+	err := a.users.FindOne(ctx, identityFilter(identity)).Decode(&user)
+	if err == nil {
+		roles := mergeDirectoryRoles(user.Roles, user.DirectoryRoles, directoryRoles)
+		set := bson.M{
+			"identities.$.email": identity.Email,
+			"name":               entry.Name,
+			"roles":              roles,
+			"directory_roles":    directoryRoles,
+			"updated_at":         now,
+		}
+		if user.Email == linkedEmail(&user, identity) {
+			set["email"] = identity.Email
+		}
+		update := bson.M{"$set": set}
+		if !slices.Equal(slices.Sorted(slices.Values(roles)), slices.Sorted(slices.Values(user.Roles))) {
+			update["$inc"] = bson.M{"token_generation": 1}
+		}
+		filter := identityFilter(identity)
+		filter["_id"] = user.ID
+		err = a.users.FindOneAndUpdate(
+			ctx,
+			filter,
+			update,
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&user)
+		if err != nil {
+			return nil, fmt.Errorf("error updating LDAP user: %v", err)
+		}
+		return &user, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("error looking up LDAP user: %v", err)
+	}
+
+	// A local account with the directory account's email has to be linked
+	// by its owner rather than taken over
+	count, err := a.users.CountDocuments(ctx, tenantFilter(models.DefaultTenant, bson.M{"email": identity.Email}))
+	if err != nil {
+		return nil, fmt.Errorf("error looking up LDAP user: %v", err)
+	}
+	if count > 0 {
+		return nil, ErrLinkRequired
+	}
+
+	user = models.User{
+		Email:          identity.Email,
+		Name:           entry.Name,
+		Roles:          directoryRoles,
+		DirectoryRoles: directoryRoles,
+		Status:         models.StatusActive,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		Identities:     []models.LinkedIdentity{identity},
+	}
+	result, err := a.users.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrLinkRequired
+	}
+	if err != nil {
+		return nil, err
+	}
+	user.ID = result.InsertedID.(primitive.ObjectID)
+	return &user, nil
+}
+
+// mergeDirectoryRoles replaces the roles the directory granted before with
+// the ones it grants now, keeping the rest.
+func mergeDirectoryRoles(roles, previous, current []string) []string {
+	merged := []string{}
+	for _, role := range roles {
+		if !slices.Contains(previous, role) && !slices.Contains(current, role) {
+			merged = append(merged, role)
+		}
+	}
+	return append(merged, current...)
+}
+
+// linkedEmail returns the email the directory gave the user when identity was
+// last synced.
+func linkedEmail(user *models.User, identity models.LinkedIdentity) string {
+	for _, linked := range user.Identities {
+		if linked.Provider == identity.Provider && linked.Subject == identity.Subject {
+			return linked.Email
+		}
+	}
+	return ""
+}
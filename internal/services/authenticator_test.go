@@ -0,0 +1,179 @@
+package services
+
+import (
+    "context"
+    "slices"
+    "testing"
+
+    "github.com/SinisterSup/auth-service/internal/ldap"
+    "github.com/SinisterSup/auth-service/internal/ldap/ldaptest"
+    "github.com/SinisterSup/auth-service/internal/models"
+    "github.com/SinisterSup/auth-service/utils"
+
+    "go.mongodb.org/mongo-driver/bson"
+)
+
+// useTestDirectory makes testService sign in against a directory holding
+// jdoe@example.com, whose admins group maps to the admin role.
+func useTestDirectory(t *testing.T) func() {
+    server := ldaptest.NewServer(ldaptest.Entry{
+        DN:       "uid=jdoe,ou=people,dc=example,dc=com",
+        Password: "password123",
+        Attributes: map[string][]string{
+            "objectClass": {"person"},
+            "mail":        {"jdoe@example.com"},
+            "cn":          {"John Doe"},
+            "memberOf":    {"cn=admins,ou=groups,dc=example,dc=com"},
+        },
+    })
+
+    client, err := ldap.NewClient(ldap.Config{
+        URL:         server.URL,
+        BaseDN:      "dc=example,dc=com",
+        RoleMapping: map[string]string{"cn=admins,ou=groups,dc=example,dc=com": "admin"},
+    })
+    if err != nil {
+        t.Fatalf("Failed to create LDAP client: %v", err)
+    }
+    testService.authenticator = NewLDAPAuthenticator(client, testService.collection)
+
+    return server.Close
+}
+
+func TestLDAPSignInCreatesShadowUser(t *testing.T) {
+    cleanup := setupTestDB(t)
+    defer cleanup()
+
+    closeDirectory := useTestDirectory(t)
+    defer closeDirectory()
+
+    tokens, err := testService.SignIn(models.SignInInput{Email: "jdoe@example.com", Password: "password123"})
+    if err != nil {
+        t.Fatalf("Failed to sign in: %v", err)
+    }
+    if tokens.AccessToken == "" {
+        t.Error("Expected non-empty access token")
+    }
+
+    _, err = testService.SignIn(models.SignInInput{Email: "jdoe@example.com", Password: "password123"})
+    if err != nil {
+        t.Fatalf("Failed to sign in again: %v", err)
+    }
+    count, _ := testService.collection.CountDocuments(context.Background(), map[string]string{"email": "jdoe@example.com"})
+    if count != 1 {
+        t.Errorf("Expected a single shadow user, got %d", count)
+    }
+
+    _, err = testService.SignIn(models.SignInInput{Email: "jdoe@example.com", Password: "wrong"})
+    if err == nil {
+        t.Error("Expected error for invalid password, got nil")
+    }
+}
+
+func TestLDAPSignInKeepsRolesGrantedLocally(t *testing.T) {
+    cleanup := setupTestDB(t)
+    defer cleanup()
+    closeDirectory := useTestDirectory(t)
+    defer closeDirectory()
+    ctx := context.Background()
+
+    first, err := testService.SignIn(models.SignInInput{Email: "jdoe@example.com", Password: "password123"})
+    if err != nil {
+        t.Fatalf("Failed to sign in: %v", err)
+    }
+    _, err = testService.collection.UpdateOne(ctx, bson.M{"email": "jdoe@example.com"}, bson.M{"$push": bson.M{"roles": "auditor"}})
+    if err != nil {
+        t.Fatalf("Failed to grant role: %v", err)
+    }
+
+    second, err := testService.SignIn(models.SignInInput{Email: "jdoe@example.com", Password: "password123"})
+    if err != nil {
+        t.Fatalf("Failed to sign in again: %v", err)
+    }
+    var user models.User
+    if err := testService.collection.FindOne(ctx, bson.M{"email": "jdoe@example.com"}).Decode(&user); err != nil {
+        t.Fatalf("Failed to find user: %v", err)
+    }
+    if !slices.Contains(user.Roles, "auditor") || !slices.Contains(user.Roles, "admin") {
+        t.Errorf("Expected both the local and the directory role, got %v", user.Roles)
+    }
+    if user.TokenGeneration != 0 {
+        t.Errorf("Expected unchanged roles to keep tokens valid, got generation %d", user.TokenGeneration)
+    }
+    if _, err := utils.ValidateToken(first.AccessToken); err != nil {
+        t.Errorf("Expected the first token to stay valid: %v", err)
+    }
+    if _, err := utils.ValidateToken(second.AccessToken); err != nil {
+        t.Errorf("Expected the second token to be valid: %v", err)
+    }
+
+    _, err = testService.collection.UpdateOne(ctx, bson.M{"email": "jdoe@example.com"}, bson.M{"$pull": bson.M{"roles": "admin"}})
+    if err != nil {
+        t.Fatalf("Failed to revoke role: %v", err)
+    }
+    if _, err := testService.SignIn(models.SignInInput{Email: "jdoe@example.com", Password: "password123"}); err != nil {
+        t.Fatalf("Failed to sign in a third time: %v", err)
+    }
+    if _, err := utils.ValidateToken(second.AccessToken); err == nil {
+        t.Error("Expected tokens from before the role change to be rejected")
+    }
+}
+
+func TestLDAPSignInRequiresLinkingLocalAccount(t *testing.T) {
+    cleanup := setupTestDB(t)
+    defer cleanup()
+
+    local, err := testService.SignUp(models.SignUpInput{Email: "jdoe@example.com", Password: "password123"})
+    if err != nil {
+        t.Fatalf("Failed to sign up: %v", err)
+    }
+    closeDirectory := useTestDirectory(t)
+    defer closeDirectory()
+
+    _, err = testService.SignIn(models.SignInInput{Email: "jdoe@example.com", Password: "password123"})
+    if err != ErrLinkRequired {
+        t.Fatalf("Expected ErrLinkRequired, got %v", err)
+    }
+
+    err = testService.LinkDirectory(local.ID.Hex(), models.LinkDirectoryInput{Email: "jdoe@example.com", Password: "wrong"})
+    if err != ErrInvalidCredentials {
+        t.Fatalf("Expected ErrInvalidCredentials, got %v", err)
+    }
+    if err := testService.LinkDirectory(local.ID.Hex(), models.LinkDirectoryInput{Email: "jdoe@example.com", Password: "password123"}); err != nil {
+        t.Fatalf("Failed to link: %v", err)
+    }
+    if _, err := testService.SignIn(models.SignInInput{Email: "jdoe@example.com", Password: "password123"}); err != nil {
+        t.Fatalf("Failed to sign in after linking: %v", err)
+    }
+}
+
+func TestLDAPLinkKeepsLocalEmail(t *testing.T) {
+    cleanup := setupTestDB(t)
+    defer cleanup()
+    ctx := context.Background()
+
+    local, err := testService.SignUp(models.SignUpInput{Email: "john@example.org", Password: "password123"})
+    if err != nil {
+        t.Fatalf("Failed to sign up: %v", err)
+    }
+    closeDirectory := useTestDirectory(t)
+    defer closeDirectory()
+
+    if err := testService.LinkDirectory(local.ID.Hex(), models.LinkDirectoryInput{Email: "jdoe@example.com", Password: "password123"}); err != nil {
+        t.Fatalf("Failed to link: %v", err)
+    }
+    if _, err := testService.SignIn(models.SignInInput{Email: "jdoe@example.com", Password: "password123"}); err != nil {
+        t.Fatalf("Failed to sign in after linking: %v", err)
+    }
+
+    var user models.User
+    if err := testService.collection.FindOne(ctx, bson.M{"_id": local.ID}).Decode(&user); err != nil {
+        t.Fatalf("Failed to find user: %v", err)
+    }
+    if user.Email != "john@example.org" {
+        t.Errorf("Expected the local email to be kept, got %s", user.Email)
+    }
+    if !slices.Contains(user.Roles, "admin") || !slices.Equal(user.DirectoryRoles, []string{"admin"}) {
+        t.Errorf("Expected the directory role to be granted and recorded, got %v and %v", user.Roles, user.DirectoryRoles)
+    }
+}
@@ -0,0 +1,323 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/SinisterSup/auth-service/db"
+	"github.com/SinisterSup/auth-service/internal/mail"
+	"github.com/SinisterSup/auth-service/internal/models"
+	"github.com/SinisterSup/auth-service/internal/oidc"
+	"github.com/SinisterSup/auth-service/internal/saml"
+	"github.com/SinisterSup/auth-service/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const oidcStateTTL = 10 * time.Minute
+
+var (
+	ErrUnknownProvider   = errors.New("unknown identity provider")
+	ErrInvalidLoginState = errors.New("invalid or expired login state")
+	ErrIdentityLinked    = errors.New("identity is already linked to another account")
+	ErrUnverifiedEmail   = errors.New("identity provider did not return a verified email")
+	// ErrLinkRequired is returned when an account with the identity's email
+	// exists but has never proved it owns the email. Linking into it would
+	// let whoever created it sign in as the identity's owner.
+	ErrLinkRequired     = errors.New("an account with this email exists; sign in to it and link the identity")
+	ErrLastSignInMethod = errors.New("cannot unlink the only sign-in method")
+)
+
+type FederationService struct {
+	states        *mongo.Collection
+	samlRequests  *mongo.Collection
+	users         *mongo.Collection
+	authService   *AuthService
+	providers     map[string]*oidc.Provider
+	samlProviders map[string]*saml.Provider
+}
+
+func NewFederationService(authService *AuthService, configs []oidc.Config, samlConfigs []saml.Config) *FederationService {
+	providers := make(map[string]*oidc.Provider)
+	for _, config := range configs {
+		providers[config.Name] = oidc.NewProvider(config)
+	}
+
+	samlProviders := make(map[string]*saml.Provider)
+	for _, config := range samlConfigs {
+		provider, err := saml.NewProvider(config)
+		if err != nil {
+			log.Printf("SAML provider %q disabled: %v", config.Name, err)
+			continue
+		}
+		samlProviders[config.Name] = provider
+	}
+
+	return &FederationService{
+		states:        db.DB.Collection("oidc_states"),
+		samlRequests:  db.DB.Collection("saml_requests"),
+		users:         db.DB.Collection("users"),
+		authService:   authService,
+		providers:     providers,
+		samlProviders: samlProviders,
+	}
+}
+
+// BeginLogin returns the provider authorization URL. When linkUserId is set
+// the callback links the identity to that user instead of signing in.
+func (s *FederationService) BeginLogin(providerName, linkUserId string) (string, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", ErrUnknownProvider
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	state, err := utils.GenerateOpaqueToken(32)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := utils.GenerateOpaqueToken(32)
+	if err != nil {
+		return "", err
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	record := models.OIDCState{
+		State:        state,
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    now.Add(oidcStateTTL),
+		CreatedAt:    now,
+	}
+	if linkUserId != "" {
+		objectId, err := primitive.ObjectIDFromHex(linkUserId)
+		if err != nil {
+			return "", err
+		}
+		record.LinkUserID = &objectId
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, challenge)
+	if err != nil {
+		return "", err
+	}
+	if _, err := s.states.InsertOne(ctx, record); err != nil {
+		return "", errors.New("failed to store login state")
+	}
+
+	return authURL, nil
+}
+
+// CompleteLogin handles the provider callback. For sign-in it returns tokens
+// for the matching local user; for explicit linking the tokens are nil.
+func (s *FederationService) CompleteLogin(providerName, code, state string) (*models.User, *models.TokenResponse, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return nil, nil, ErrUnknownProvider
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	var record models.OIDCState
+	err := s.states.FindOneAndDelete(ctx, bson.M{
+		"state":      state,
+		"provider":   providerName,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&record)
+	if err != nil {
+		return nil, nil, ErrInvalidLoginState
+	}
+
+	claims, err := provider.Exchange(ctx, code, record.CodeVerifier, record.Nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	identity := models.LinkedIdentity{
+		Provider: providerName,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+		LinkedAt: time.Now(),
+	}
+
+	if record.LinkUserID != nil {
+		user, err := s.linkIdentity(ctx, *record.LinkUserID, identity)
+		return user, nil, err
+	}
+
+	user, err := s.resolveUser(ctx, identity, claims.EmailVerified, claims.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tokens, err := s.authService.issueTokens(ctx, user)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, tokens, nil
+}
+
+// resolveUser finds the local account for an upstream identity: an existing
+// link first, then an account with the same email if that account has
+// verified it too, and finally a new passwordless account. Federated
+// accounts belong to the default tenant.
+func (s *FederationService) resolveUser(ctx context.Context, identity models.LinkedIdentity, emailVerified bool, name string) (*models.User, error) {
+	var user models.User
+	err := s.users.FindOne(ctx, identityFilter(identity)).Decode(&user)
+	if err == nil {
+		return &user, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("error looking up identity: %v", err)
+	}
+
+	email, err := mail.NormalizeAddress(identity.Email)
+	if err != nil || !emailVerified {
+		return nil, ErrUnverifiedEmail
+	}
+	identity.Email = email
+
+	err = s.users.FindOne(ctx, tenantFilter(models.DefaultTenant, bson.M{"email": identity.Email})).Decode(&user)
+	if err == nil {
+		if user.EmailVerifiedAt == nil {
+			return nil, ErrLinkRequired
+		}
+		return s.linkIdentity(ctx, user.ID, identity)
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("error looking up user: %v", err)
+	}
+
+	now := time.Now()
+	user = models.User{
+		Email:           identity.Email,
+		Name:            name,
+		Status:          models.StatusActive,
+		EmailVerifiedAt: &now,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+		Identities:      []models.LinkedIdentity{identity},
+	}
+	result, err := s.users.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrEmailTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+	user.ID = result.InsertedID.(primitive.ObjectID)
+	return &user, nil
+}
+
+func (s *FederationService) linkIdentity(ctx context.Context, userId primitive.ObjectID, identity models.LinkedIdentity) (*models.User, error) {
+	var owner models.User
+	err := s.users.FindOne(ctx, identityFilter(identity)).Decode(&owner)
+	if err == nil {
+		if owner.ID != userId {
+			return nil, ErrIdentityLinked
+		}
+		return &owner, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("error looking up identity: %v", err)
+	}
+
+	var user models.User
+	err = s.users.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": userId},
+		bson.M{
+			"$push": bson.M{"identities": identity},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+	return &user, nil
+}
+
+func (s *FederationService) ListIdentities(userId string) ([]models.LinkedIdentity, error) {
+	objectId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := s.users.FindOne(ctx, bson.M{"_id": objectId}).Decode(&user); err != nil {
+		return nil, errors.New("user not found")
+	}
+	if user.Identities == nil {
+		return []models.LinkedIdentity{}, nil
+	}
+	return user.Identities, nil
+}
+
+func (s *FederationService) UnlinkIdentity(userId, providerName, subject string) error {
+	objectId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Refuse to remove the last way a passwordless account can sign in
+	result, err := s.users.UpdateOne(
+		ctx,
+		bson.M{
+			"_id": objectId,
+			"$or": bson.A{
+				bson.M{"password": bson.M{"$nin": bson.A{"", nil}}},
+				bson.M{"identities.1": bson.M{"$exists": true}},
+			},
+		},
+		bson.M{
+			"$pull": bson.M{"identities": bson.M{"provider": providerName, "subject": subject}},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+	)
+	if err != nil {
+		return errors.New("failed to unlink identity")
+	}
+	if result.MatchedCount == 0 {
+		count, err := s.users.CountDocuments(ctx, bson.M{"_id": objectId})
+		if err != nil {
+			return fmt.Errorf("error checking user existence: %v", err)
+		}
+		if count == 0 {
+			return errors.New("user not found")
+		}
+		return ErrLastSignInMethod
+	}
+	return nil
+}
+
+func identityFilter(identity models.LinkedIdentity) bson.M {
+	return bson.M{
+		"identities": bson.M{
+			"$elemMatch": bson.M{
+				"provider": identity.Provider,
+				"subject":  identity.Subject,
+			},
+		},
+	}
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    "github.com/SinisterSup/auth-service/db"
+    "github.com/SinisterSup/auth-service/internal/models"
+    "go.mongodb.org/mongo-driver/bson"
+)
+
+func TestResolveUserLinksOnlyVerifiedAccounts(t *testing.T) {
+    cleanup := setupTestDB(t)
+    defer cleanup()
+    ctx := context.Background()
+    federation := NewFederationService(testService, nil, nil)
+
+    // Someone else registered the address and never proved they own it
+    squatter, err := testService.SignUp(models.SignUpInput{Email: "victim@example.com", Password: "password123"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    identity := models.LinkedIdentity{Provider: "corp", Subject: "victim", Email: "victim@example.com", LinkedAt: time.Now()}
+    if _, err := federation.resolveUser(ctx, identity, true, ""); err != ErrLinkRequired {
+        t.Fatalf("Expected ErrLinkRequired, got %v", err)
+    }
+
+    _, err = db.DB.Collection("users").UpdateOne(ctx, bson.M{"_id": squatter.ID}, bson.M{"$set": bson.M{"email_verified_at": time.Now()}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    user, err := federation.resolveUser(ctx, identity, true, "")
+    if err != nil || user.ID != squatter.ID || len(user.Identities) != 1 {
+        t.Fatalf("Expected the identity to be linked to the verified account, got %v, %v", user, err)
+    }
+
+    created, err := federation.resolveUser(ctx, models.LinkedIdentity{Provider: "corp", Subject: "new", Email: "new@example.com"}, true, "")
+    if err != nil || created.EmailVerifiedAt == nil {
+        t.Fatalf("Expected a new verified account, got %v, %v", created, err)
+    }
+    if err := federation.UnlinkIdentity(created.ID.Hex(), "corp", "new"); err != ErrLastSignInMethod {
+        t.Errorf("Expected ErrLastSignInMethod, got %v", err)
+    }
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SinisterSup/auth-service/db"
+	"github.com/SinisterSup/auth-service/internal/models"
+	"github.com/SinisterSup/auth-service/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrTooManyAttempts = errors.New("too many failed sign-in attempts, try again later")
+
+// LockoutError is returned while an account or source IP is locked out. It
+// matches ErrTooManyAttempts with errors.Is.
+type LockoutError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockoutError) Error() string {
+	return ErrTooManyAttempts.Error()
+}
+
+func (e *LockoutError) Is(target error) bool {
+	return target == ErrTooManyAttempts
+}
+
+// LoginThrottle tracks failed password sign-ins per account and per source IP.
+// Once a key reaches its threshold every further failure locks it out, for
+// twice as long each time up to maxLockout. Locks lapse on their own; counters
+// reset after a successful sign-in or resetAfter without failures.
+type LoginThrottle struct {
+	collection         *mongo.Collection
+	maxAccountFailures int
+	maxIPFailures      int
+	baseLockout        time.Duration
+	maxLockout         time.Duration
+	resetAfter         time.Duration
+}
+
+func NewLoginThrottle() *LoginThrottle {
+	return &LoginThrottle{
+		collection:         db.DB.Collection("login_attempts"),
+		maxAccountFailures: intFromEnv("LOGIN_MAX_ACCOUNT_FAILURES", 5),
+		maxIPFailures:      intFromEnv("LOGIN_MAX_IP_FAILURES", 20),
+		baseLockout:        durationFromEnv("LOGIN_LOCKOUT_BASE", time.Minute),
+		maxLockout:         durationFromEnv("LOGIN_LOCKOUT_MAX", time.Hour),
+		resetAfter:         durationFromEnv("LOGIN_FAILURE_RESET", 24*time.Hour),
+	}
+}
+
+// accountKey keys an account's counter by a hash of its login, so attempts
+// against any email an attacker picks leave no readable addresses behind.
+func accountKey(email string) string {
+	return "account:" + utils.HashSecret(strings.ToLower(strings.TrimSpace(email)))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check returns a *LockoutError if the account or the IP is locked out. It
+// does not care whether the account exists, so it reveals nothing about it.
+func (t *LoginThrottle) Check(ctx context.Context, email, ip string) error {
+	keys := bson.A{accountKey(email)}
+	if ip != "" {
+		keys = append(keys, ipKey(ip))
+	}
+
+	now := time.Now()
+	cursor, err := t.collection.Find(ctx, bson.M{"_id": bson.M{"$in": keys}, "locked_until": bson.M{"$gt": now}})
+	if err != nil {
+		return fmt.Errorf("error checking sign-in attempts: %v", err)
+	}
+	var locked []models.LoginAttempts
+	if err := cursor.All(ctx, &locked); err != nil {
+		return fmt.Errorf("error checking sign-in attempts: %v", err)
+	}
+
+	var retryAfter time.Duration
+	for _, attempts := range locked {
+		if wait := attempts.LockedUntil.Sub(now); wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+	if retryAfter > 0 {
+		return &LockoutError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// RecordFailure counts a failed sign-in. It reports whether the account
+// itself has just been locked out so the caller can audit it.
+func (t *LoginThrottle) RecordFailure(ctx context.Context, email, ip string) (bool, error) {
+	accountLocked, err := t.recordFailure(ctx, accountKey(email), t.maxAccountFailures)
+	if err != nil {
+		return false, err
+	}
+	if ip != "" {
+		if _, err := t.recordFailure(ctx, ipKey(ip), t.maxIPFailures); err != nil {
+			return accountLocked, err
+		}
+	}
+	return accountLocked, nil
+}
+
+func (t *LoginThrottle) recordFailure(ctx context.Context, key string, threshold int) (bool, error) {
+	now := time.Now()
+
+	// A pipeline update lets the database decide atomically whether the
+	// previous failures are stale, so concurrent replicas never lose counts.
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"failures": bson.M{"$cond": bson.A{
+			bson.M{"$lt": bson.A{"$last_failure", now.Add(-t.resetAfter)}},
+			1,
+			bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$failures", 0}}, 1}},
+		}},
+		"last_failure": now,
+		"expires_at":   now.Add(t.resetAfter),
+	}}}}
+
+	var attempts models.LoginAttempts
+	err := t.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": key},
+		update,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&attempts)
+	if err != nil {
+		return false, fmt.Errorf("error recording failed sign-in: %v", err)
+	}
+
+	lockout := lockoutDuration(attempts.Failures, threshold, t.baseLockout, t.maxLockout)
+	if lockout == 0 {
+		return false, nil
+	}
+	lockedUntil := now.Add(lockout)
+	_, err = t.collection.UpdateOne(ctx, bson.M{"_id": key}, bson.M{
+		"$set": bson.M{"locked_until": lockedUntil},
+		"$max": bson.M{"expires_at": lockedUntil},
+	})
+	if err != nil {
+		return false, fmt.Errorf("error locking out %s: %v", key, err)
+	}
+	return true, nil
+}
+
+// RecordSuccess clears the account's counter. The IP counter is left alone so
+// one valid account cannot be used to reset an attacker's address.
+func (t *LoginThrottle) RecordSuccess(ctx context.Context, email string) error {
+	_, err := t.collection.DeleteOne(ctx, bson.M{"_id": accountKey(email)})
+	return err
+}
+
+func (t *LoginThrottle) UnlockAccount(ctx context.Context, email string) error {
+	_, err := t.collection.DeleteOne(ctx, bson.M{"_id": accountKey(email)})
+	return err
+}
+
+// UnlockIP clears an address's counter and reports whether it had one.
+func (t *LoginThrottle) UnlockIP(ctx context.Context, ip string) (bool, error) {
+	result, err := t.collection.DeleteOne(ctx, bson.M{"_id": ipKey(ip)})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// lockoutDuration is zero below the threshold, then base, 2*base, 4*base...
+// capped at max.
+func lockoutDuration(failures, threshold int, base, max time.Duration) time.Duration {
+	if threshold <= 0 || failures < threshold {
+		return 0
+	}
+	exponent := failures - threshold
+	if exponent > 30 {
+		return max
+	}
+	lockout := time.Duration(float64(base) * math.Pow(2, float64(exponent)))
+	if lockout > max || lockout <= 0 {
+		return max
+	}
+	return lockout
+}
+
+func intFromEnv(name string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || value < 0 {
+		return fallback
+	}
+	return value
+}
+
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(name))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/SinisterSup/auth-service/internal/models"
+
+    "go.mongodb.org/mongo-driver/bson"
+)
+
+func TestLockoutDuration(t *testing.T) {
+    tests := []struct {
+        failures int
+        want     time.Duration
+    }{
+        {4, 0},
+        {5, time.Minute},
+        {6, 2 * time.Minute},
+        {8, 8 * time.Minute},
+        {20, time.Hour},
+        {500, time.Hour},
+    }
+
+    for _, tt := range tests {
+        if got := lockoutDuration(tt.failures, 5, time.Minute, time.Hour); got != tt.want {
+            t.Errorf("lockoutDuration(%d) = %v, want %v", tt.failures, got, tt.want)
+        }
+    }
+    if got := lockoutDuration(100, 0, time.Minute, time.Hour); got != 0 {
+        t.Errorf("Expected a zero threshold to disable lockout, got %v", got)
+    }
+}
+
+func TestSignInLockout(t *testing.T) {
+    cleanup := setupTestDB(t)
+    defer cleanup()
+
+    testService.throttle.maxAccountFailures = 3
+
+    user, err := testService.SignUp(models.SignUpInput{Email: "test@example.com", Password: "password123"})
+    if err != nil {
+        t.Fatalf("Failed to create test user: %v", err)
+    }
+
+    wrong := models.SignInInput{Email: "test@example.com", Password: "wrong", RequestMeta: models.RequestMeta{IP: "203.0.113.7"}}
+    for i := 0; i < 3; i++ {
+        if _, err := testService.SignIn(wrong); err == nil || errors.Is(err, ErrTooManyAttempts) {
+            t.Fatalf("Attempt %d: expected invalid credentials, got %v", i+1, err)
+        }
+    }
+
+    correct := wrong
+    correct.Password = "password123"
+    _, err = testService.SignIn(correct)
+    var lockout *LockoutError
+    if !errors.As(err, &lockout) || lockout.RetryAfter <= 0 || lockout.RetryAfter > time.Minute {
+        t.Fatalf("Expected a lockout of up to a minute, got %v", err)
+    }
+
+    adminService := NewAdminService(NewAccountService(testService), NewPasswordResetService(testService, &recordingMailer{}))
+    if err := adminService.UnlockUser(user.ID.Hex(), user.ID.Hex(), models.RequestMeta{}); err != nil {
+        t.Fatalf("Failed to unlock user: %v", err)
+    }
+    if _, err := testService.SignIn(correct); err != nil {
+        t.Errorf("Expected sign-in after unlock, got %v", err)
+    }
+}
+
+func TestLoginAttemptsExpireWithoutEmails(t *testing.T) {
+    cleanup := setupTestDB(t)
+    defer cleanup()
+    ctx := context.Background()
+
+    if _, err := testService.throttle.RecordFailure(ctx, "victim@example.com", ""); err != nil {
+        t.Fatal(err)
+    }
+    var attempts models.LoginAttempts
+    if err := testService.throttle.collection.FindOne(ctx, bson.M{}).Decode(&attempts); err != nil {
+        t.Fatal(err)
+    }
+    if strings.Contains(attempts.Key, "victim") {
+        t.Errorf("Expected the email to be hashed, got %q", attempts.Key)
+    }
+    if wait := time.Until(attempts.ExpiresAt); wait <= 0 || wait > testService.throttle.resetAfter {
+        t.Errorf("Expected the counter to expire after the reset window, got %v", attempts.ExpiresAt)
+    }
+}
+
+func TestChangePasswordLockout(t *testing.T) {
+    cleanup := setupTestDB(t)
+    defer cleanup()
+
+    testService.throttle.maxAccountFailures = 3
+    user, err := testService.SignUp(models.SignUpInput{Email: "test@example.com", Password: "password123"})
+    if err != nil {
+        t.Fatalf("Failed to create test user: %v", err)
+    }
+
+    input := models.ChangePasswordInput{CurrentPassword: "wrong", NewPassword: "newpassword123"}
+    for i := 0; i < 3; i++ {
+        testService.ChangePassword(user.ID.Hex(), input, models.RequestMeta{})
+    }
+    input.CurrentPassword = "password123"
+    if err := testService.ChangePassword(user.ID.Hex(), input, models.RequestMeta{}); !errors.Is(err, ErrTooManyAttempts) {
+        t.Errorf("Expected wrong current passwords to lock the account out, got %v", err)
+    }
+}
@@ -0,0 +1,585 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/SinisterSup/auth-service/db"
+	"github.com/SinisterSup/auth-service/internal/mail"
+	"github.com/SinisterSup/auth-service/internal/models"
+	"github.com/SinisterSup/auth-service/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const invitationTokenSize = 32
+
+var (
+	ErrOrganizationNotFound    = errors.New("organization not found")
+	ErrNotOrgMember            = errors.New("not a member of this organization")
+	ErrOrgForbidden            = errors.New("your organization role does not allow this")
+	ErrLastOwner               = errors.New("an organization must keep at least one owner")
+	ErrAlreadyMember           = errors.New("already a member of this organization")
+	ErrInvitationNotFound      = errors.New("invitation not found")
+	ErrInvalidInvitation       = errors.New("invalid or expired invitation")
+	ErrInvitationEmailMismatch = errors.New("the invitation was sent to another email address")
+	ErrSignInToAccept          = errors.New("an account with this email already exists; sign in to accept the invitation")
+)
+
+// OrganizationService manages organizations, their members and invitations.
+// Organizations live within a tenant and only ever hold users of that tenant.
+// Any change to a member's role or membership cuts off their current access
+// tokens, so the org_role claim is never stale.
+type OrganizationService struct {
+	orgs        *mongo.Collection
+	memberships *mongo.Collection
+	invitations *mongo.Collection
+	users       *mongo.Collection
+	authService *AuthService
+	audit       *AuditService
+	mailer      mail.Mailer
+	ttl         time.Duration
+	inviteURL   string
+}
+
+func NewOrganizationService(authService *AuthService, mailer mail.Mailer) *OrganizationService {
+	ttl, err := time.ParseDuration(os.Getenv("INVITATION_EXPIRY"))
+	if err != nil || ttl <= 0 {
+		ttl = 7 * 24 * time.Hour
+	}
+
+	return &OrganizationService{
+		orgs:        db.DB.Collection("organizations"),
+		memberships: authService.memberships,
+		invitations: db.DB.Collection("invitations"),
+		users:       db.DB.Collection("users"),
+		authService: authService,
+		audit:       authService.audit,
+		mailer:      mailer,
+		ttl:         ttl,
+		inviteURL:   os.Getenv("INVITATION_URL"),
+	}
+}
+
+// Create makes a new organization with the acting user as its owner.
+func (s *OrganizationService) Create(ctx context.Context, actorId string, input models.CreateOrganizationInput, meta models.RequestMeta) (*models.Organization, error) {
+	actor, err := s.findUser(ctx, actorId)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	org := models.Organization{
+		TenantID:  actor.TenantID,
+		Name:      input.Name,
+		CreatedBy: actor.ID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	result, err := s.orgs.InsertOne(ctx, org)
+	if err != nil {
+		return nil, errors.New("failed to create organization")
+	}
+	org.ID = result.InsertedID.(primitive.ObjectID)
+
+	if err := s.addMember(ctx, org.ID, actor, models.OrgRoleOwner); err != nil {
+		return nil, err
+	}
+
+	s.recordOrgEvent(ctx, models.AuditOrgCreated, "", actor.ID, org.ID, meta, nil)
+	return &org, nil
+}
+
+// List returns the organizations the user belongs to, with their role in each.
+func (s *OrganizationService) List(ctx context.Context, userId string) ([]models.UserOrganization, error) {
+	objectId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	cursor, err := s.memberships.Find(ctx, bson.M{"user_id": objectId})
+	if err != nil {
+		return nil, fmt.Errorf("error looking up memberships: %v", err)
+	}
+	var memberships []models.Membership
+	if err := cursor.All(ctx, &memberships); err != nil {
+		return nil, fmt.Errorf("error looking up memberships: %v", err)
+	}
+
+	roles := make(map[primitive.ObjectID]string, len(memberships))
+	orgIds := bson.A{}
+	for _, membership := range memberships {
+		roles[membership.OrgID] = membership.Role
+		orgIds = append(orgIds, membership.OrgID)
+	}
+
+	orgs := []models.UserOrganization{}
+	if len(orgIds) == 0 {
+		return orgs, nil
+	}
+	cursor, err = s.orgs.Find(ctx, bson.M{"_id": bson.M{"$in": orgIds}}, options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("error looking up organizations: %v", err)
+	}
+	var found []models.Organization
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, fmt.Errorf("error looking up organizations: %v", err)
+	}
+	for _, org := range found {
+		orgs = append(orgs, models.UserOrganization{Organization: org, Role: roles[org.ID]})
+	}
+	return orgs, nil
+}
+
+// Members lists the members of an organization to any of its members.
+func (s *OrganizationService) Members(ctx context.Context, actorId, orgId string) ([]models.Membership, error) {
+	org, _, err := s.actorMembership(ctx, actorId, orgId)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := s.memberships.Find(ctx, bson.M{"org_id": org}, options.Find().SetSort(bson.M{"created_at": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("error looking up members: %v", err)
+	}
+	members := []models.Membership{}
+	if err := cursor.All(ctx, &members); err != nil {
+		return nil, fmt.Errorf("error looking up members: %v", err)
+	}
+	return members, nil
+}
+
+// UpdateMember changes a member's role. Owners and admins may do this, but
+// only owners may make or unmake owners.
+func (s *OrganizationService) UpdateMember(ctx context.Context, actorId, orgId, memberId string, input models.UpdateMemberInput, meta models.RequestMeta) error {
+	if err := models.ValidateOrgRole(input.Role); err != nil {
+		return err
+	}
+	org, actorRole, err := s.actorMembership(ctx, actorId, orgId)
+	if err != nil {
+		return err
+	}
+	member, err := s.membership(ctx, org, memberId)
+	if err != nil {
+		return err
+	}
+	if !models.CanManageMembers(actorRole) {
+		return ErrOrgForbidden
+	}
+	if (member.Role == models.OrgRoleOwner || input.Role == models.OrgRoleOwner) && actorRole != models.OrgRoleOwner {
+		return ErrOrgForbidden
+	}
+	if member.Role == models.OrgRoleOwner && input.Role != models.OrgRoleOwner {
+		if err := s.keepAnOwner(ctx, org); err != nil {
+			return err
+		}
+	}
+
+	_, err = s.memberships.UpdateOne(ctx, bson.M{"_id": member.ID}, bson.M{"$set": bson.M{"role": input.Role}})
+	if err != nil {
+		return errors.New("failed to update member")
+	}
+	if err := s.authService.roles.expireAccessTokens(ctx, bson.M{"_id": member.UserID}); err != nil {
+		return err
+	}
+
+	s.recordOrgEvent(ctx, models.AuditOrgMemberUpdated, actorId, member.UserID, org, meta, map[string]interface{}{"role": input.Role})
+	return nil
+}
+
+// RemoveMember takes a user out of an organization. Members may always leave;
+// removing anyone else takes the same rights as changing their role.
+func (s *OrganizationService) RemoveMember(ctx context.Context, actorId, orgId, memberId string, meta models.RequestMeta) error {
+	org, actorRole, err := s.actorMembership(ctx, actorId, orgId)
+	if err != nil {
+		return err
+	}
+	member, err := s.membership(ctx, org, memberId)
+	if err != nil {
+		return err
+	}
+	if member.UserID.Hex() != actorId {
+		if !models.CanManageMembers(actorRole) || (member.Role == models.OrgRoleOwner && actorRole != models.OrgRoleOwner) {
+			return ErrOrgForbidden
+		}
+	}
+	if member.Role == models.OrgRoleOwner {
+		if err := s.keepAnOwner(ctx, org); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.memberships.DeleteOne(ctx, bson.M{"_id": member.ID}); err != nil {
+		return errors.New("failed to remove member")
+	}
+	if err := s.authService.roles.expireAccessTokens(ctx, bson.M{"_id": member.UserID}); err != nil {
+		return err
+	}
+
+	s.recordOrgEvent(ctx, models.AuditOrgMemberRemoved, actorId, member.UserID, org, meta, nil)
+	return nil
+}
+
+// Invite emails an invitation to join the organization with role. Inviting
+// the same email again replaces the earlier invitation.
+func (s *OrganizationService) Invite(ctx context.Context, actorId, orgId string, input models.InviteMemberInput, meta models.RequestMeta) (*models.Invitation, error) {
+	if err := models.ValidateOrgRole(input.Role); err != nil {
+		return nil, err
+	}
+	email, err := mail.NormalizeAddress(input.Email)
+	if err != nil {
+		return nil, err
+	}
+	org, actorRole, err := s.actorMembership(ctx, actorId, orgId)
+	if err != nil {
+		return nil, err
+	}
+	if !models.CanManageMembers(actorRole) || (input.Role == models.OrgRoleOwner && actorRole != models.OrgRoleOwner) {
+		return nil, ErrOrgForbidden
+	}
+	count, err := s.memberships.CountDocuments(ctx, bson.M{"org_id": org, "email": email})
+	if err != nil {
+		return nil, fmt.Errorf("error looking up members: %v", err)
+	}
+	if count > 0 {
+		return nil, ErrAlreadyMember
+	}
+
+	var organization models.Organization
+	if err := s.orgs.FindOne(ctx, bson.M{"_id": org}).Decode(&organization); err != nil {
+		return nil, ErrOrganizationNotFound
+	}
+
+	token, err := utils.GenerateOpaqueToken(invitationTokenSize)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.invitations.DeleteMany(ctx, bson.M{"org_id": org, "email": email}); err != nil {
+		return nil, fmt.Errorf("error clearing previous invitations: %v", err)
+	}
+
+	now := time.Now()
+	invitation := models.Invitation{
+		OrgID:     org,
+		Email:     email,
+		Role:      input.Role,
+		TokenHash: utils.HashSecret(token),
+		ExpiresAt: now.Add(s.ttl),
+		CreatedAt: now,
+	}
+	invitation.InvitedBy, _ = primitive.ObjectIDFromHex(actorId)
+	result, err := s.invitations.InsertOne(ctx, invitation)
+	if err != nil {
+		return nil, errors.New("failed to store invitation")
+	}
+	invitation.ID = result.InsertedID.(primitive.ObjectID)
+
+	body := fmt.Sprintf("You have been invited to join %s as %s. The invitation expires in %s.\n\n", organization.Name, input.Role, s.ttl)
+	if s.inviteURL != "" {
+		body += fmt.Sprintf("%s?token=%s\n", s.inviteURL, url.QueryEscape(token))
+	} else {
+		body += fmt.Sprintf("Invitation token: %s\n", token)
+	}
+	body += "\nIf you were not expecting this, you can ignore this email.\n"
+	if err := s.mailer.Send(email, "You have been invited to "+organization.Name, body); err != nil {
+		return nil, err
+	}
+
+	s.recordOrgEvent(ctx, models.AuditOrgInvitationSent, actorId, primitive.NilObjectID, org, meta, map[string]interface{}{"email": email, "role": input.Role})
+	return &invitation, nil
+}
+
+// Invitations lists the pending invitations of an organization.
+func (s *OrganizationService) Invitations(ctx context.Context, actorId, orgId string) ([]models.Invitation, error) {
+	org, actorRole, err := s.actorMembership(ctx, actorId, orgId)
+	if err != nil {
+		return nil, err
+	}
+	if !models.CanManageMembers(actorRole) {
+		return nil, ErrOrgForbidden
+	}
+
+	cursor, err := s.invitations.Find(ctx, bson.M{
+		"org_id":      org,
+		"expires_at":  bson.M{"$gt": time.Now()},
+		"consumed_at": bson.M{"$exists": false},
+	}, options.Find().SetSort(bson.M{"created_at": -1}))
+	if err != nil {
+		return nil, fmt.Errorf("error looking up invitations: %v", err)
+	}
+	invitations := []models.Invitation{}
+	if err := cursor.All(ctx, &invitations); err != nil {
+		return nil, fmt.Errorf("error looking up invitations: %v", err)
+	}
+	return invitations, nil
+}
+
+func (s *OrganizationService) RevokeInvitation(ctx context.Context, actorId, orgId, invitationId string, meta models.RequestMeta) error {
+	org, actorRole, err := s.actorMembership(ctx, actorId, orgId)
+	if err != nil {
+		return err
+	}
+	if !models.CanManageMembers(actorRole) {
+		return ErrOrgForbidden
+	}
+	objectId, err := primitive.ObjectIDFromHex(invitationId)
+	if err != nil {
+		return ErrInvitationNotFound
+	}
+
+	result, err := s.invitations.DeleteOne(ctx, bson.M{"_id": objectId, "org_id": org})
+	if err != nil {
+		return errors.New("failed to revoke invitation")
+	}
+	if result.DeletedCount == 0 {
+		return ErrInvitationNotFound
+	}
+
+	s.recordOrgEvent(ctx, models.AuditOrgInvitationRevoked, actorId, primitive.NilObjectID, org, meta, map[string]interface{}{"invitation_id": invitationId})
+	return nil
+}
+
+// Accept adds a signed-in user to the organization of an invitation sent to
+// their email address.
+func (s *OrganizationService) Accept(ctx context.Context, userId, token string, meta models.RequestMeta) (*models.Membership, error) {
+	user, err := s.findUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	invitation, org, err := s.pendingInvitation(ctx, token, user.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	if mail.LookupAddress(user.Email) != invitation.Email {
+		return nil, ErrInvitationEmailMismatch
+	}
+
+	if err := s.consume(ctx, invitation); err != nil {
+		return nil, err
+	}
+	if err := s.addMember(ctx, org.ID, user, invitation.Role); err != nil {
+		return nil, err
+	}
+
+	s.recordOrgEvent(ctx, models.AuditOrgInvitationAccepted, "", user.ID, org.ID, meta, map[string]interface{}{"role": invitation.Role})
+	return &models.Membership{OrgID: org.ID, UserID: user.ID, Email: user.Email, Role: invitation.Role}, nil
+}
+
+// AcceptWithSignUp creates an account for the invited email and adds it to
+// the organization. The emailed token proves the address, so the account is
+// active at once. Tokens are returned already acting in the organization.
+func (s *OrganizationService) AcceptWithSignUp(ctx context.Context, input models.AcceptInvitationInput) (*models.TokenResponse, error) {
+	invitation, org, err := s.pendingInvitation(ctx, input.Token, input.TenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.authService.createUser(ctx, models.SignUpInput{
+		Email:       invitation.Email,
+		Password:    input.Password,
+		RequestMeta: input.RequestMeta,
+	}, models.StatusActive, true)
+	if err == ErrEmailTaken {
+		return nil, ErrSignInToAccept
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The invitation is only consumed once the account exists, so a rejected
+	// password does not use it up. A concurrent accept that consumed it first
+	// wins, and the account made for this one is removed again.
+	if err := s.consume(ctx, invitation); err != nil {
+		if _, deleteErr := s.users.DeleteOne(ctx, bson.M{"_id": user.ID}); deleteErr != nil {
+			log.Printf("Failed to remove user %s after a lost invitation race: %v", user.ID.Hex(), deleteErr)
+		}
+		return nil, err
+	}
+	if err := s.addMember(ctx, org.ID, user, invitation.Role); err != nil {
+		return nil, err
+	}
+
+	s.recordOrgEvent(ctx, models.AuditOrgInvitationAccepted, "", user.ID, org.ID, input.RequestMeta, map[string]interface{}{"role": invitation.Role})
+	return s.authService.issueOrgTokens(ctx, user, s.authService.scopes.Default, activeOrg{ID: org.ID.Hex(), Role: invitation.Role})
+}
+
+// Decline uses up an invitation without joining. Anyone holding the token
+// may decline it.
+func (s *OrganizationService) Decline(ctx context.Context, input models.DeclineInvitationInput, meta models.RequestMeta) error {
+	invitation, org, err := s.pendingInvitation(ctx, input.Token, meta.TenantID)
+	if err != nil {
+		return err
+	}
+	if err := s.consume(ctx, invitation); err != nil {
+		return err
+	}
+
+	s.recordOrgEvent(ctx, models.AuditOrgInvitationDeclined, "", primitive.NilObjectID, org.ID, meta, map[string]interface{}{"email": invitation.Email})
+	return nil
+}
+
+// Switch reissues the user's tokens acting in another organization, or in
+// none when input.OrgID is empty. The new tokens keep scopes, the scope of
+// the access token presented.
+func (s *OrganizationService) Switch(ctx context.Context, userId string, scopes []string, input models.SwitchOrganizationInput) (*models.TokenResponse, error) {
+	user, err := s.findUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	org := activeOrg{}
+	if input.OrgID != "" {
+		role, err := s.authService.orgRole(ctx, input.OrgID, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		org = activeOrg{ID: input.OrgID, Role: role}
+	}
+	return s.authService.issueOrgTokens(ctx, user, scopes, org)
+}
+
+// orgRole returns the user's role in the organization orgId.
+func (s *AuthService) orgRole(ctx context.Context, orgId string, userId primitive.ObjectID) (string, error) {
+	objectId, err := primitive.ObjectIDFromHex(orgId)
+	if err != nil {
+		return "", ErrNotOrgMember
+	}
+	var membership models.Membership
+	err = s.memberships.FindOne(ctx, bson.M{"org_id": objectId, "user_id": userId}).Decode(&membership)
+	if err == mongo.ErrNoDocuments {
+		return "", ErrNotOrgMember
+	}
+	if err != nil {
+		return "", fmt.Errorf("error looking up membership: %v", err)
+	}
+	return membership.Role, nil
+}
+
+// actorMembership returns the organization and the acting user's role in it.
+func (s *OrganizationService) actorMembership(ctx context.Context, actorId, orgId string) (primitive.ObjectID, string, error) {
+	org, err := primitive.ObjectIDFromHex(orgId)
+	if err != nil {
+		return primitive.NilObjectID, "", ErrOrganizationNotFound
+	}
+	actor, err := primitive.ObjectIDFromHex(actorId)
+	if err != nil {
+		return primitive.NilObjectID, "", ErrUserNotFound
+	}
+	role, err := s.authService.orgRole(ctx, orgId, actor)
+	if err == ErrNotOrgMember {
+		// Outsiders cannot tell organizations they are not in from ones that
+		// do not exist
+		return primitive.NilObjectID, "", ErrOrganizationNotFound
+	}
+	return org, role, err
+}
+
+func (s *OrganizationService) membership(ctx context.Context, org primitive.ObjectID, userId string) (*models.Membership, error) {
+	objectId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	var membership models.Membership
+	if err := s.memberships.FindOne(ctx, bson.M{"org_id": org, "user_id": objectId}).Decode(&membership); err != nil {
+		return nil, ErrUserNotFound
+	}
+	return &membership, nil
+}
+
+// keepAnOwner fails unless the organization has more than one owner, so one
+// is left after an owner is demoted or removed.
+func (s *OrganizationService) keepAnOwner(ctx context.Context, org primitive.ObjectID) error {
+	owners, err := s.memberships.CountDocuments(ctx, bson.M{"org_id": org, "role": models.OrgRoleOwner})
+	if err != nil {
+		return fmt.Errorf("error counting owners: %v", err)
+	}
+	if owners < 2 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+func (s *OrganizationService) addMember(ctx context.Context, org primitive.ObjectID, user *models.User, role string) error {
+	_, err := s.memberships.InsertOne(ctx, models.Membership{
+		OrgID:     org,
+		UserID:    user.ID,
+		Email:     user.Email,
+		Role:      role,
+		CreatedAt: time.Now(),
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrAlreadyMember
+	}
+	if err != nil {
+		return errors.New("failed to add member")
+	}
+	return nil
+}
+
+// pendingInvitation finds an unused invitation by token, for an organization
+// in tenantId.
+func (s *OrganizationService) pendingInvitation(ctx context.Context, token, tenantId string) (*models.Invitation, *models.Organization, error) {
+	var invitation models.Invitation
+	err := s.invitations.FindOne(ctx, bson.M{
+		"token_hash":  utils.HashSecret(token),
+		"expires_at":  bson.M{"$gt": time.Now()},
+		"consumed_at": bson.M{"$exists": false},
+	}).Decode(&invitation)
+	if err != nil {
+		return nil, nil, ErrInvalidInvitation
+	}
+
+	var org models.Organization
+	if err := s.orgs.FindOne(ctx, bson.M{"_id": invitation.OrgID}).Decode(&org); err != nil || org.TenantID != tenantId {
+		return nil, nil, ErrInvalidInvitation
+	}
+	return &invitation, &org, nil
+}
+
+// consume marks an invitation used, failing if someone else got there first.
+func (s *OrganizationService) consume(ctx context.Context, invitation *models.Invitation) error {
+	result, err := s.invitations.UpdateOne(
+		ctx,
+		bson.M{"_id": invitation.ID, "consumed_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"consumed_at": time.Now()}},
+	)
+	if err != nil || result.ModifiedCount == 0 {
+		return ErrInvalidInvitation
+	}
+	return nil
+}
+
+func (s *OrganizationService) findUser(ctx context.Context, userId string) (*models.User, error) {
+	objectId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	var user models.User
+	if err := s.users.FindOne(ctx, bson.M{"_id": objectId}).Decode(&user); err != nil {
+		return nil, ErrUserNotFound
+	}
+	return &user, nil
+}
+
+// recordOrgEvent audits an action in org. actorId is empty when the user
+// acted on their own account.
+func (s *OrganizationService) recordOrgEvent(ctx context.Context, action, actorId string, userId, org primitive.ObjectID, meta models.RequestMeta, metadata map[string]interface{}) {
+	event := auditEvent(action, userId, "", meta)
+	if actorObjectId, err := primitive.ObjectIDFromHex(actorId); err == nil {
+		event.ActorID = &actorObjectId
+	}
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+	metadata["org_id"] = org.Hex()
+	event.Metadata = metadata
+	s.audit.Record(ctx, event)
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+    "context"
+    "regexp"
+    "testing"
+
+    "github.com/SinisterSup/auth-service/internal/models"
+    "github.com/SinisterSup/auth-service/utils"
+)
+
+func TestOrganizationInvitations(t *testing.T) {
+    cleanup := setupTestDB(t)
+    defer cleanup()
+
+    ctx := context.Background()
+    mailer := &recordingMailer{}
+    orgs := NewOrganizationService(testService, mailer)
+    meta := models.RequestMeta{}
+
+    owner, err := testService.SignUp(models.SignUpInput{Email: "owner@example.com", Password: "password123"})
+    if err != nil {
+        t.Fatalf("Failed to create owner: %v", err)
+    }
+    org, err := orgs.Create(ctx, owner.ID.Hex(), models.CreateOrganizationInput{Name: "Acme"}, meta)
+    if err != nil {
+        t.Fatalf("Failed to create organization: %v", err)
+    }
+
+    _, err = orgs.Invite(ctx, owner.ID.Hex(), org.ID.Hex(), models.InviteMemberInput{Email: "New@Example.com", Role: models.OrgRoleAdmin}, meta)
+    if err != nil {
+        t.Fatalf("Failed to invite: %v", err)
+    }
+    token := regexp.MustCompile(`Invitation token: (\S+)`).FindStringSubmatch(mailer.bodies[len(mailer.bodies)-1])[1]
+
+    tokens, err := orgs.AcceptWithSignUp(ctx, models.AcceptInvitationInput{Token: token, Password: "password123"})
+    if err != nil {
+        t.Fatalf("Failed to accept invitation: %v", err)
+    }
+    claims, err := utils.ValidateTokenWithOptions(tokens.AccessToken, true)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if claims.Email != "new@example.com" || claims.Org != org.ID.Hex() || claims.OrgRole != models.OrgRoleAdmin {
+        t.Errorf("Expected tokens acting in the organization as admin, got %+v", claims)
+    }
+    if _, err := orgs.AcceptWithSignUp(ctx, models.AcceptInvitationInput{Token: token, Password: "password123"}); err != ErrInvalidInvitation {
+        t.Errorf("Expected invitation to work once, got %v", err)
+    }
+
+    refreshed, err := testService.RefreshToken(tokens.RefreshToken)
+    if err != nil {
+        t.Fatalf("Failed to refresh: %v", err)
+    }
+    if claims, _ := utils.ValidateTokenWithOptions(refreshed.AccessToken, true); claims.Org != org.ID.Hex() {
+        t.Errorf("Expected refresh to keep the organization, got %q", claims.Org)
+    }
+
+    // Admins may not make owners, and the only owner may not step down
+    if err := orgs.UpdateMember(ctx, claims.UserId, org.ID.Hex(), owner.ID.Hex(), models.UpdateMemberInput{Role: models.OrgRoleMember}, meta); err != ErrOrgForbidden {
+        t.Errorf("Expected admin to be refused, got %v", err)
+    }
+    if err := orgs.RemoveMember(ctx, owner.ID.Hex(), org.ID.Hex(), owner.ID.Hex(), meta); err != ErrLastOwner {
+        t.Errorf("Expected last owner to stay, got %v", err)
+    }
+
+    if err := orgs.RemoveMember(ctx, owner.ID.Hex(), org.ID.Hex(), claims.UserId, meta); err != nil {
+        t.Fatalf("Failed to remove member: %v", err)
+    }
+    refreshed, err = testService.RefreshToken(tokens.RefreshToken)
+    if err != nil {
+        t.Fatalf("Failed to refresh: %v", err)
+    }
+    if claims, _ := utils.ValidateTokenWithOptions(refreshed.AccessToken, true); claims.Org != "" {
+        t.Errorf("Expected removed member to lose the organization, got %q", claims.Org)
+    }
+    if _, err := orgs.Members(ctx, claims.UserId, org.ID.Hex()); err != ErrOrganizationNotFound {
+        t.Errorf("Expected outsiders not to see members, got %v", err)
+    }
+}
+
+func TestOrganizationSwitch(t *testing.T) {
+    cleanup := setupTestDB(t)
+    defer cleanup()
+
+    ctx := context.Background()
+    mailer := &recordingMailer{}
+    orgs := NewOrganizationService(testService, mailer)
+    meta := models.RequestMeta{}
+
+    owner, err := testService.SignUp(models.SignUpInput{Email: "owner@example.com", Password: "password123"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    member, err := testService.SignUp(models.SignUpInput{Email: "member@example.com", Password: "password123"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    org, err := orgs.Create(ctx, owner.ID.Hex(), models.CreateOrganizationInput{Name: "Acme"}, meta)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if _, err := orgs.Switch(ctx, member.ID.Hex(), nil, models.SwitchOrganizationInput{OrgID: org.ID.Hex()}); err != ErrNotOrgMember {
+        t.Errorf("Expected switch to be refused to outsiders, got %v", err)
+    }
+
+    if _, err := orgs.Invite(ctx, owner.ID.Hex(), org.ID.Hex(), models.InviteMemberInput{Email: "other@example.com", Role: models.OrgRoleMember}, meta); err != nil {
+        t.Fatal(err)
+    }
+    token := regexp.MustCompile(`Invitation token: (\S+)`).FindStringSubmatch(mailer.bodies[len(mailer.bodies)-1])[1]
+    if _, err := orgs.Accept(ctx, member.ID.Hex(), token, meta); err != ErrInvitationEmailMismatch {
+        t.Errorf("Expected invitation for another email to be refused, got %v", err)
+    }
+
+    if _, err := orgs.Invite(ctx, owner.ID.Hex(), org.ID.Hex(), models.InviteMemberInput{Email: "member@example.com", Role: models.OrgRoleMember}, meta); err != nil {
+        t.Fatal(err)
+    }
+    token = regexp.MustCompile(`Invitation token: (\S+)`).FindStringSubmatch(mailer.bodies[len(mailer.bodies)-1])[1]
+    if _, err := orgs.Accept(ctx, member.ID.Hex(), token, meta); err != nil {
+        t.Fatalf("Failed to accept invitation: %v", err)
+    }
+
+    tokens, err := orgs.Switch(ctx, member.ID.Hex(), nil, models.SwitchOrganizationInput{OrgID: org.ID.Hex()})
+    if err != nil {
+        t.Fatalf("Failed to switch: %v", err)
+    }
+    claims, err := utils.ValidateTokenWithOptions(tokens.AccessToken, true)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if claims.Org != org.ID.Hex() || claims.OrgRole != models.OrgRoleMember {
+        t.Errorf("Expected tokens acting in the organization, got %+v", claims)
+    }
+
+    list, err := orgs.List(ctx, member.ID.Hex())
+    if err != nil || len(list) != 1 || list[0].Role != models.OrgRoleMember {
+        t.Errorf("Expected one membership, got %v, %v", list, err)
+    }
+}
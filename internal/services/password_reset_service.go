@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/SinisterSup/auth-service/db"
+	"github.com/SinisterSup/auth-service/internal/mail"
+	"github.com/SinisterSup/auth-service/internal/models"
+	"github.com/SinisterSup/auth-service/internal/passwordhash"
+	"github.com/SinisterSup/auth-service/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const passwordResetTokenSize = 32
+
+var ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+
+type PasswordResetService struct {
+	collection *mongo.Collection
+	users      *mongo.Collection
+	audit      *AuditService
+	auth       *AuthService
+	hasher     *passwordhash.Pool
+	mailer     mail.Mailer
+	ttl        time.Duration
+	resetURL   string
+}
+
+func NewPasswordResetService(authService *AuthService, mailer mail.Mailer) *PasswordResetService {
+	ttl, err := time.ParseDuration(os.Getenv("PASSWORD_RESET_EXPIRY"))
+	if err != nil || ttl <= 0 {
+		ttl = time.Hour
+	}
+
+	return &PasswordResetService{
+		collection: db.DB.Collection("password_resets"),
+		users:      db.DB.Collection("users"),
+		audit:      authService.audit,
+		auth:       authService,
+		hasher:     authService.hasher,
+		mailer:     mailer,
+		ttl:        ttl,
+		resetURL:   os.Getenv("PASSWORD_RESET_URL"),
+	}
+}
+
+// RequestReset emails a reset link. Unknown emails succeed silently.
+func (s *PasswordResetService) RequestReset(input models.ForgotPasswordInput, meta models.RequestMeta) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	filter := tenantFilter(meta.TenantID, bson.M{"email": mail.LookupAddress(input.Email), "deleted_at": bson.M{"$exists": false}})
+	err := s.users.FindOne(ctx, filter).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error looking up user: %v", err)
+	}
+
+	if err := s.sendReset(ctx, &user); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, auditEvent(models.AuditPasswordResetRequested, user.ID, user.Email, meta))
+	return nil
+}
+
+func (s *PasswordResetService) sendReset(ctx context.Context, user *models.User) error {
+	token, err := utils.GenerateOpaqueToken(passwordResetTokenSize)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.collection.DeleteMany(ctx, bson.M{"user_id": user.ID}); err != nil {
+		return fmt.Errorf("error clearing previous reset tokens: %v", err)
+	}
+
+	now := time.Now()
+	_, err = s.collection.InsertOne(ctx, models.PasswordReset{
+		UserID:    user.ID,
+		TokenHash: utils.HashSecret(token),
+		ExpiresAt: now.Add(s.ttl),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return errors.New("failed to store password reset token")
+	}
+
+	body := fmt.Sprintf("A password reset was requested for your account. The link expires in %s.\n\n", s.ttl)
+	if s.resetURL != "" {
+		body += fmt.Sprintf("%s?token=%s\n", s.resetURL, url.QueryEscape(token))
+	} else {
+		body += fmt.Sprintf("Reset token: %s\n", token)
+	}
+	body += "\nIf you did not request this, you can ignore this email.\n"
+
+	return s.mailer.Send(user.Email, "Reset your password", body)
+}
+
+// ResetPassword consumes a reset token, sets the new password and signs the
+// user out everywhere. A password rejected by the policy leaves the token
+// usable so the user can try another.
+func (s *PasswordResetService) ResetPassword(input models.ResetPasswordInput, meta models.RequestMeta) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"token_hash":  utils.HashSecret(input.Token),
+		"expires_at":  bson.M{"$gt": now},
+		"consumed_at": bson.M{"$exists": false},
+	}
+
+	var reset models.PasswordReset
+	if err := s.collection.FindOne(ctx, filter).Decode(&reset); err != nil {
+		return ErrInvalidResetToken
+	}
+	var user models.User
+	if err := s.users.FindOne(ctx, bson.M{"_id": reset.UserID}).Decode(&user); err != nil || user.TenantID != meta.TenantID {
+		return ErrInvalidResetToken
+	}
+	passwords, err := s.auth.passwordPolicy(ctx, user.TenantID)
+	if err != nil {
+		return err
+	}
+	if err := passwords.Validate(input.NewPassword, user.Email); err != nil {
+		return err
+	}
+
+	err = s.collection.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"consumed_at": now}}).Decode(&reset)
+	if err != nil {
+		return ErrInvalidResetToken
+	}
+
+	hashedPassword, err := s.hasher.Hash(ctx, input.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.users.UpdateOne(
+		ctx,
+		bson.M{"_id": reset.UserID, "deleted_at": bson.M{"$exists": false}},
+		bson.M{
+			"$set": bson.M{
+				"password":      hashedPassword,
+				"refresh_token": "",
+				"updated_at":    now,
+			},
+			"$inc":   bson.M{"token_generation": 1},
+			"$unset": bson.M{"password_reset_required": ""},
+		},
+	)
+	if err != nil {
+		return errors.New("failed to update password")
+	}
+	if result.MatchedCount == 0 {
+		return ErrInvalidResetToken
+	}
+
+	s.audit.Record(ctx, auditEvent(models.AuditPasswordReset, reset.UserID, "", meta))
+	return nil
+}
+
+// ForceReset requires the user to choose a new password before signing in
+// with one again, ends their sessions and emails them a reset link.
+func (s *PasswordResetService) ForceReset(ctx context.Context, userId primitive.ObjectID) error {
+	var user models.User
+	err := s.users.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": userId},
+		bson.M{
+			"$set": bson.M{
+				"password_reset_required": true,
+				"refresh_token":           "",
+				"updated_at":              time.Now(),
+			},
+			"$inc": bson.M{"token_generation": 1},
+		},
+	).Decode(&user)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	return s.sendReset(ctx, &user)
+}
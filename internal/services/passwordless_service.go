@@ -0,0 +1,227 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/SinisterSup/auth-service/db"
+	"github.com/SinisterSup/auth-service/internal/mail"
+	"github.com/SinisterSup/auth-service/internal/models"
+	"github.com/SinisterSup/auth-service/internal/scope"
+	"github.com/SinisterSup/auth-service/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	otpCodeDigits      = 6
+	maxOTPAttempts     = 5
+	magicLinkTokenSize = 32
+)
+
+var ErrInvalidLoginChallenge = errors.New("invalid or expired sign-in code")
+
+type PasswordlessService struct {
+	collection  *mongo.Collection
+	users       *mongo.Collection
+	authService *AuthService
+	mailer      mail.Mailer
+	ttl         time.Duration
+	linkURL     string
+}
+
+func NewPasswordlessService(authService *AuthService, mailer mail.Mailer) *PasswordlessService {
+	ttl, err := time.ParseDuration(os.Getenv("MAGIC_LINK_EXPIRY"))
+	if err != nil || ttl <= 0 {
+		ttl = 15 * time.Minute
+	}
+
+	return &PasswordlessService{
+		collection:  db.DB.Collection("login_challenges"),
+		users:       db.DB.Collection("users"),
+		authService: authService,
+		mailer:      mailer,
+		ttl:         ttl,
+		linkURL:     os.Getenv("MAGIC_LINK_URL"),
+	}
+}
+
+// RequestMagicLink emails a single-use link and code to a registered user.
+// Unknown emails succeed silently so the endpoint cannot be used to probe
+// accounts, and so do users of tenants that require MFA, for whom an email
+// alone is not enough to sign in.
+func (s *PasswordlessService) RequestMagicLink(input models.MagicLinkInput) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	err := s.users.FindOne(ctx, tenantFilter(input.TenantID, bson.M{"email": mail.LookupAddress(input.Email)})).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error looking up user: %v", err)
+	}
+
+	settings, err := s.authService.tenants.Settings(ctx, user.TenantID)
+	if err != nil {
+		return err
+	}
+	if settings.RequireMFA {
+		return nil
+	}
+
+	return s.sendChallenge(ctx, &user, false, "")
+}
+
+// SendSecondFactor emails a sign-in code to a user whose password was just
+// checked, for tenants that require MFA. Entering the code with VerifyOTP
+// issues tokens with the scopes granted at the password check.
+func (s *PasswordlessService) SendSecondFactor(ctx context.Context, mfa *MFARequiredError) error {
+	return s.sendChallenge(ctx, mfa.User, true, scope.Format(mfa.Scopes))
+}
+
+func (s *PasswordlessService) sendChallenge(ctx context.Context, user *models.User, secondFactor bool, scopes string) error {
+	token, err := utils.GenerateOpaqueToken(magicLinkTokenSize)
+	if err != nil {
+		return err
+	}
+	code, err := utils.GenerateNumericCode(otpCodeDigits)
+	if err != nil {
+		return err
+	}
+
+	// Only the most recent challenge stays usable
+	_, err = s.collection.DeleteMany(ctx, bson.M{"user_id": user.ID})
+	if err != nil {
+		return fmt.Errorf("error clearing previous challenges: %v", err)
+	}
+
+	now := time.Now()
+	challenge := models.LoginChallenge{
+		UserID:       user.ID,
+		TenantID:     user.TenantID,
+		Email:        user.Email,
+		TokenHash:    utils.HashSecret(token),
+		CodeHash:     utils.HashSecret(code),
+		ExpiresAt:    now.Add(s.ttl),
+		CreatedAt:    now,
+		SecondFactor: secondFactor,
+		Scope:        scopes,
+	}
+	if _, err := s.collection.InsertOne(ctx, challenge); err != nil {
+		return errors.New("failed to store sign-in challenge")
+	}
+
+	return s.mailer.Send(user.Email, "Your sign-in link", s.messageBody(token, code))
+}
+
+func (s *PasswordlessService) messageBody(token, code string) string {
+	body := fmt.Sprintf("Your sign-in code is %s. It expires in %s.\n", code, s.ttl)
+	if s.linkURL != "" {
+		body += fmt.Sprintf("\nOr sign in with this link:\n%s?token=%s\n", s.linkURL, url.QueryEscape(token))
+	} else {
+		body += fmt.Sprintf("\nOr use this sign-in token:\n%s\n", token)
+	}
+	return body + "\nIf you did not request this, you can ignore this email.\n"
+}
+
+func (s *PasswordlessService) VerifyMagicLink(input models.MagicLinkVerifyInput) (*models.TokenResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	var challenge models.LoginChallenge
+	err := s.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"token_hash":  utils.HashSecret(input.Token),
+			"expires_at":  bson.M{"$gt": now},
+			"consumed_at": bson.M{"$exists": false},
+		},
+		bson.M{"$set": bson.M{"consumed_at": now}},
+	).Decode(&challenge)
+	if err != nil {
+		return nil, ErrInvalidLoginChallenge
+	}
+
+	return s.signInChallengeUser(ctx, &challenge, input.TenantID)
+}
+
+// VerifyOTP counts the attempt before comparing the code, so concurrent
+// guesses can never exceed maxOTPAttempts for a challenge. Wrong codes also
+// count towards the sign-in lockout of the account, so requesting fresh
+// challenges does not buy more guesses.
+func (s *PasswordlessService) VerifyOTP(input models.OTPVerifyInput) (*models.TokenResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	email := mail.LookupAddress(input.Email)
+	login := tenantLogin(input.TenantID, email)
+	if err := s.authService.throttle.Check(ctx, login, input.IP); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var challenge models.LoginChallenge
+	err := s.collection.FindOneAndUpdate(
+		ctx,
+		tenantFilter(input.TenantID, bson.M{
+			"email":       email,
+			"expires_at":  bson.M{"$gt": now},
+			"consumed_at": bson.M{"$exists": false},
+			"attempts":    bson.M{"$lt": maxOTPAttempts},
+		}),
+		bson.M{"$inc": bson.M{"attempts": 1}},
+		options.FindOneAndUpdate().SetSort(bson.M{"created_at": -1}),
+	).Decode(&challenge)
+	if err != nil || !utils.SecretMatchesHash(input.Code, challenge.CodeHash) {
+		s.authService.recordSignInFailure(ctx, login, email, input.RequestMeta)
+		return nil, ErrInvalidLoginChallenge
+	}
+	if err := s.authService.throttle.RecordSuccess(ctx, login); err != nil {
+		log.Printf("Failed to reset sign-in failures: %v", err)
+	}
+
+	result, err := s.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": challenge.ID, "consumed_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"consumed_at": now}},
+	)
+	if err != nil || result.ModifiedCount == 0 {
+		return nil, ErrInvalidLoginChallenge
+	}
+
+	return s.signInChallengeUser(ctx, &challenge, input.TenantID)
+}
+
+// signInChallengeUser issues tokens for the user of a consumed challenge if
+// it belongs to tenantId. Tenants that require MFA only accept challenges
+// sent after a password check.
+func (s *PasswordlessService) signInChallengeUser(ctx context.Context, challenge *models.LoginChallenge, tenantId string) (*models.TokenResponse, error) {
+	var user models.User
+	err := s.users.FindOne(ctx, bson.M{"_id": challenge.UserID}).Decode(&user)
+	if err != nil || user.TenantID != tenantId {
+		return nil, ErrInvalidLoginChallenge
+	}
+
+	settings, err := s.authService.tenants.Settings(ctx, user.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	if settings.RequireMFA && !challenge.SecondFactor {
+		return nil, ErrInvalidLoginChallenge
+	}
+	if challenge.SecondFactor {
+		return s.authService.issueScopedTokens(ctx, &user, scope.Parse(challenge.Scope))
+	}
+
+	return s.authService.issueTokens(ctx, &user)
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+    "errors"
+    "regexp"
+    "testing"
+
+    "github.com/SinisterSup/auth-service/internal/models"
+)
+
+type recordingMailer struct {
+    bodies []string
+}
+
+func (m *recordingMailer) Send(to, subject, body string) error {
+    m.bodies = append(m.bodies, body)
+    return nil
+}
+
+func TestVerifyOTP(t *testing.T) {
+    cleanup := setupTestDB(t)
+    defer cleanup()
+
+    mailer := &recordingMailer{}
+    passwordless := NewPasswordlessService(testService, mailer)
+
+    _, err := testService.SignUp(models.SignUpInput{Email: "test@example.com", Password: "password123"})
+    if err != nil {
+        t.Fatalf("Failed to create test user: %v", err)
+    }
+
+    if err := passwordless.RequestMagicLink(models.MagicLinkInput{Email: "unknown@example.com"}); err != nil {
+        t.Fatalf("Expected silent success for unknown email, got %v", err)
+    }
+    if len(mailer.bodies) != 0 {
+        t.Fatal("Expected no email for unknown address")
+    }
+
+    if err := passwordless.RequestMagicLink(models.MagicLinkInput{Email: "test@example.com"}); err != nil {
+        t.Fatalf("Failed to request magic link: %v", err)
+    }
+    code := regexp.MustCompile(`\d{6}`).FindString(mailer.bodies[0])
+
+    _, err = passwordless.VerifyOTP(models.OTPVerifyInput{Email: "test@example.com", Code: "000000x"})
+    if err == nil {
+        t.Error("Expected error for wrong code, got nil")
+    }
+
+    tokens, err := passwordless.VerifyOTP(models.OTPVerifyInput{Email: "test@example.com", Code: code})
+    if err != nil {
+        t.Fatalf("Failed to verify code: %v", err)
+    }
+    if tokens.AccessToken == "" || tokens.RefreshToken == "" {
+        t.Error("Expected non-empty tokens")
+    }
+
+    _, err = passwordless.VerifyOTP(models.OTPVerifyInput{Email: "test@example.com", Code: code})
+    if err == nil {
+        t.Error("Expected error for reused code, got nil")
+    }
+}
+
+func TestOTPFailuresLockOutAcrossChallenges(t *testing.T) {
+    cleanup := setupTestDB(t)
+    defer cleanup()
+
+    mailer := &recordingMailer{}
+    passwordless := NewPasswordlessService(testService, mailer)
+    if _, err := testService.SignUp(models.SignUpInput{Email: "test@example.com", Password: "password123"}); err != nil {
+        t.Fatalf("Failed to create test user: %v", err)
+    }
+
+    // Each fresh challenge resets its own attempts, but not the account's
+    for i := 0; i < 5; i++ {
+        if err := passwordless.RequestMagicLink(models.MagicLinkInput{Email: "test@example.com"}); err != nil {
+            t.Fatal(err)
+        }
+        passwordless.VerifyOTP(models.OTPVerifyInput{Email: "test@example.com", Code: "wrong"})
+    }
+
+    if err := passwordless.RequestMagicLink(models.MagicLinkInput{Email: "test@example.com"}); err != nil {
+        t.Fatal(err)
+    }
+    code := regexp.MustCompile(`\d{6}`).FindString(mailer.bodies[len(mailer.bodies)-1])
+    if _, err := passwordless.VerifyOTP(models.OTPVerifyInput{Email: "test@example.com", Code: code}); !errors.Is(err, ErrTooManyAttempts) {
+        t.Errorf("Expected the account to be locked out, got %v", err)
+    }
+}
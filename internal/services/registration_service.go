@@ -0,0 +1,181 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/SinisterSup/auth-service/db"
+	"github.com/SinisterSup/auth-service/internal/mail"
+	"github.com/SinisterSup/auth-service/internal/models"
+	"github.com/SinisterSup/auth-service/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const emailVerificationTokenSize = 32
+
+var ErrInvalidVerificationToken = errors.New("invalid or expired email verification token")
+
+// RegistrationService is the public sign-up flow. It answers the same way
+// whether or not the email is already registered and tells the owner of the
+// address what happened by email, so sign-up cannot be used to find out which
+// accounts exist. New accounts stay unverified until the emailed token is
+// confirmed.
+type RegistrationService struct {
+	collection  *mongo.Collection
+	users       *mongo.Collection
+	authService *AuthService
+	audit       *AuditService
+	mailer      mail.Mailer
+	ttl         time.Duration
+	verifyURL   string
+	signInURL   string
+}
+
+func NewRegistrationService(authService *AuthService, mailer mail.Mailer) *RegistrationService {
+	ttl, err := time.ParseDuration(os.Getenv("SIGNUP_VERIFICATION_EXPIRY"))
+	if err != nil || ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+
+	return &RegistrationService{
+		collection:  db.DB.Collection("email_verifications"),
+		users:       db.DB.Collection("users"),
+		authService: authService,
+		audit:       authService.audit,
+		mailer:      mailer,
+		ttl:         ttl,
+		verifyURL:   os.Getenv("SIGNUP_VERIFICATION_URL"),
+		signInURL:   os.Getenv("SIGNIN_URL"),
+	}
+}
+
+// Register creates an unverified account and emails a verification link. If
+// the email is taken, the owner is emailed instead: a reminder for active
+// accounts, or a fresh link for accounts that were never verified. Password
+// policy and overload errors are returned either way, since they do not
+// depend on the account.
+func (s *RegistrationService) Register(ctx context.Context, input models.SignUpInput) error {
+	email, err := mail.NormalizeAddress(input.Email)
+	if err != nil {
+		return err
+	}
+	input.Email = email
+
+	user, err := s.authService.createUser(ctx, input, models.StatusUnverified, false)
+	if err == ErrEmailTaken {
+		return s.notifyExisting(ctx, input)
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.sendVerification(ctx, user)
+}
+
+func (s *RegistrationService) notifyExisting(ctx context.Context, input models.SignUpInput) error {
+	var user models.User
+	err := s.users.FindOne(ctx, tenantFilter(input.TenantID, bson.M{"email": input.Email})).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error looking up user: %v", err)
+	}
+
+	s.audit.Record(ctx, auditEvent(models.AuditSignUpDuplicate, user.ID, user.Email, input.RequestMeta))
+	switch user.EffectiveStatus(time.Now()) {
+	case models.StatusDeleted:
+		return nil
+	case models.StatusUnverified:
+		return s.sendVerification(ctx, &user)
+	}
+
+	body := "Someone tried to create an account with this email address, but you already have one.\n\n"
+	if s.signInURL != "" {
+		body += fmt.Sprintf("If it was you, sign in at %s or reset your password if you have forgotten it.\n", s.signInURL)
+	} else {
+		body += "If it was you, sign in or reset your password if you have forgotten it.\n"
+	}
+	body += "\nIf it was not you, you can ignore this email. Your account has not been changed.\n"
+
+	return s.mailer.Send(user.Email, "You already have an account", body)
+}
+
+func (s *RegistrationService) sendVerification(ctx context.Context, user *models.User) error {
+	token, err := utils.GenerateOpaqueToken(emailVerificationTokenSize)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.collection.DeleteMany(ctx, bson.M{"user_id": user.ID}); err != nil {
+		return fmt.Errorf("error clearing previous verification tokens: %v", err)
+	}
+
+	now := time.Now()
+	_, err = s.collection.InsertOne(ctx, models.EmailVerification{
+		UserID:    user.ID,
+		TokenHash: utils.HashSecret(token),
+		ExpiresAt: now.Add(s.ttl),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return errors.New("failed to store email verification token")
+	}
+
+	body := fmt.Sprintf("Confirm your email address to finish creating your account. The link expires in %s.\n\n", s.ttl)
+	if s.verifyURL != "" {
+		body += fmt.Sprintf("%s?token=%s\n", s.verifyURL, url.QueryEscape(token))
+	} else {
+		body += fmt.Sprintf("Verification token: %s\n", token)
+	}
+	body += "\nIf you did not sign up, you can ignore this email.\n"
+
+	return s.mailer.Send(user.Email, "Confirm your email address", body)
+}
+
+// VerifyEmail consumes a verification token and activates the account. An
+// account that was suspended or deleted in the meantime stays that way.
+func (s *RegistrationService) VerifyEmail(input models.VerifyEmailInput, meta models.RequestMeta) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	var verification models.EmailVerification
+	err := s.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"token_hash":  utils.HashSecret(input.Token),
+			"expires_at":  bson.M{"$gt": now},
+			"consumed_at": bson.M{"$exists": false},
+		},
+		bson.M{"$set": bson.M{"consumed_at": now}},
+	).Decode(&verification)
+	if err != nil {
+		return ErrInvalidVerificationToken
+	}
+
+	var user models.User
+	err = s.users.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": verification.UserID, "status": models.StatusUnverified},
+		bson.M{"$set": bson.M{"status": models.StatusActive, "email_verified_at": now, "updated_at": now}},
+	).Decode(&user)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return errors.New("failed to verify email")
+	}
+	if err == nil && user.TenantID == models.DefaultTenant && isBootstrapAdmin(user.Email) {
+		_, err = s.users.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$addToSet": bson.M{"roles": models.AdminRole}})
+		if err != nil {
+			return errors.New("failed to grant admin role")
+		}
+	}
+
+	s.audit.Record(ctx, auditEvent(models.AuditEmailVerified, verification.UserID, "", meta))
+	return nil
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SinisterSup/auth-service/db"
+	"github.com/SinisterSup/auth-service/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrRoleNotFound    = errors.New("role not found")
+	ErrUnknownRole     = errors.New("unknown role")
+	ErrBuiltInRole     = errors.New("the admin role cannot be deleted")
+	ErrInvalidRoleName = errors.New("role names must be non-empty and contain no whitespace")
+)
+
+// RoleService keeps role definitions and works out what a user may do. Access
+// tokens carry the result, so any change that alters a user's permissions
+// also cuts off their current access tokens; clients pick up the new
+// permissions with their next refresh.
+type RoleService struct {
+	collection *mongo.Collection
+	users      *mongo.Collection
+}
+
+func NewRoleService() *RoleService {
+	return &RoleService{
+		collection: db.DB.Collection("roles"),
+		users:      db.DB.Collection("users"),
+	}
+}
+
+// EnsureDefaults creates the admin role with every permission unless it
+// already exists. Edits made to it since are kept.
+func (s *RoleService) EnsureDefaults(ctx context.Context) error {
+	now := time.Now()
+	_, err := s.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": models.AdminRole},
+		bson.M{"$setOnInsert": bson.M{
+			"description": "Full access, including the admin API",
+			"permissions": []string{"*"},
+			"created_at":  now,
+			"updated_at":  now,
+		}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create default roles: %v", err)
+	}
+	return nil
+}
+
+func (s *RoleService) List(ctx context.Context) ([]models.Role, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	roles := []models.Role{}
+	if err := cursor.All(ctx, &roles); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (s *RoleService) Get(ctx context.Context, name string) (*models.Role, error) {
+	var role models.Role
+	if err := s.collection.FindOne(ctx, bson.M{"_id": name}).Decode(&role); err != nil {
+		return nil, ErrRoleNotFound
+	}
+	return &role, nil
+}
+
+// Put creates or replaces a role definition.
+func (s *RoleService) Put(ctx context.Context, name string, input models.RoleInput) (*models.Role, error) {
+	if name == "" || strings.ContainsAny(name, " \t\r\n") {
+		return nil, ErrInvalidRoleName
+	}
+	if err := models.ValidatePermissions(input.Permissions); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var role models.Role
+	err := s.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": name},
+		bson.M{
+			"$set":         bson.M{"description": input.Description, "permissions": input.Permissions, "updated_at": now},
+			"$setOnInsert": bson.M{"created_at": now},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&role)
+	if err != nil {
+		return nil, errors.New("failed to save role")
+	}
+
+	if err := s.expireAccessTokens(ctx, bson.M{"roles": name}); err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// Delete removes a role definition and takes the role away from every user
+// who has it.
+func (s *RoleService) Delete(ctx context.Context, name string) error {
+	if name == models.AdminRole {
+		return ErrBuiltInRole
+	}
+
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": name})
+	if err != nil {
+		return errors.New("failed to delete role")
+	}
+	if result.DeletedCount == 0 {
+		return ErrRoleNotFound
+	}
+
+	_, err = s.users.UpdateMany(ctx, bson.M{"roles": name}, bson.M{
+		"$pull": bson.M{"roles": name},
+		"$set":  bson.M{"updated_at": time.Now()},
+		"$inc":  bson.M{"token_generation": 1},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove role from users: %v", err)
+	}
+	return nil
+}
+
+// CheckRoles returns ErrUnknownRole unless every role is defined.
+func (s *RoleService) CheckRoles(ctx context.Context, roles []string) error {
+	if len(roles) == 0 {
+		return nil
+	}
+	count, err := s.collection.CountDocuments(ctx, bson.M{"_id": bson.M{"$in": roles}})
+	if err != nil {
+		return err
+	}
+	if int(count) != len(uniqueStrings(roles)) {
+		return ErrUnknownRole
+	}
+	return nil
+}
+
+// Permissions combines the user's own permissions with those of their roles.
+// Roles without a definition, such as ones mapped from a directory that no
+// one has defined yet, grant nothing.
+func (s *RoleService) Permissions(ctx context.Context, user *models.User) ([]string, error) {
+	permissions := append([]string{}, user.Permissions...)
+	if len(user.Roles) > 0 {
+		cursor, err := s.collection.Find(ctx, bson.M{"_id": bson.M{"$in": user.Roles}})
+		if err != nil {
+			return nil, fmt.Errorf("error looking up roles: %v", err)
+		}
+		var roles []models.Role
+		if err := cursor.All(ctx, &roles); err != nil {
+			return nil, fmt.Errorf("error looking up roles: %v", err)
+		}
+		for _, role := range roles {
+			permissions = append(permissions, role.Permissions...)
+		}
+	}
+	return uniqueStrings(permissions), nil
+}
+
+// expireAccessTokens makes matching users' current access tokens invalid.
+// Refresh tokens keep working, so clients only need to refresh.
+func (s *RoleService) expireAccessTokens(ctx context.Context, filter bson.M) error {
+	_, err := s.users.UpdateMany(ctx, filter, bson.M{"$inc": bson.M{"token_generation": 1}})
+	if err != nil {
+		return fmt.Errorf("failed to expire access tokens: %v", err)
+	}
+	return nil
+}
+
+// uniqueStrings returns values sorted with duplicates removed.
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := []string{}
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
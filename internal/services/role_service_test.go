@@ -0,0 +1,73 @@
+package services
+
+import (
+    "context"
+    "testing"
+
+    "github.com/SinisterSup/auth-service/internal/models"
+    "github.com/SinisterSup/auth-service/utils"
+)
+
+func TestRolesAndPermissionsInTokens(t *testing.T) {
+    cleanup := setupTestDB(t)
+    defer cleanup()
+
+    ctx := context.Background()
+    roles := NewRoleService()
+    if err := roles.EnsureDefaults(ctx); err != nil {
+        t.Fatal(err)
+    }
+    admin := NewAdminService(NewAccountService(testService), NewPasswordResetService(testService, &recordingMailer{}))
+
+    user, err := testService.SignUp(models.SignUpInput{Email: "test@example.com", Password: "password123"})
+    if err != nil {
+        t.Fatalf("Failed to create test user: %v", err)
+    }
+    userId := user.ID.Hex()
+
+    err = admin.UpdateRoles("", userId, models.UpdateRolesInput{Roles: []string{"editor"}}, models.RequestMeta{})
+    if err != ErrUnknownRole {
+        t.Errorf("Expected ErrUnknownRole for an undefined role, got %v", err)
+    }
+
+    if _, err := admin.PutRole("", "editor", models.RoleInput{Permissions: []string{"posts:*", "media:read"}}, models.RequestMeta{}); err != nil {
+        t.Fatalf("Failed to define role: %v", err)
+    }
+    if err := admin.UpdateRoles("", userId, models.UpdateRolesInput{Roles: []string{"editor"}}, models.RequestMeta{}); err != nil {
+        t.Fatalf("Failed to assign role: %v", err)
+    }
+    if err := admin.UpdatePermissions("", userId, models.UpdatePermissionsInput{Permissions: []string{"reports:read"}}, models.RequestMeta{}); err != nil {
+        t.Fatalf("Failed to grant permission: %v", err)
+    }
+
+    tokens, err := testService.SignIn(models.SignInInput{Email: "test@example.com", Password: "password123"})
+    if err != nil {
+        t.Fatalf("Failed to sign in: %v", err)
+    }
+    claims, err := utils.ValidateTokenWithOptions(tokens.AccessToken, true)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(claims.Roles) != 1 || claims.Roles[0] != "editor" {
+        t.Errorf("Expected editor role in token, got %v", claims.Roles)
+    }
+    for _, permission := range []string{"posts:publish", "media:read", "reports:read"} {
+        if !models.HasPermission(claims.Permissions, permission) {
+            t.Errorf("Expected token to grant %s, got %v", permission, claims.Permissions)
+        }
+    }
+
+    if err := admin.DeleteRole("", "editor", models.RequestMeta{}); err != nil {
+        t.Fatalf("Failed to delete role: %v", err)
+    }
+    if err := admin.DeleteRole("", models.AdminRole, models.RequestMeta{}); err != ErrBuiltInRole {
+        t.Errorf("Expected the admin role to be protected, got %v", err)
+    }
+    updated, err := admin.GetUser("", userId, models.RequestMeta{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(updated.Roles) != 0 {
+        t.Errorf("Expected deleted role to be removed from the user, got %v", updated.Roles)
+    }
+}
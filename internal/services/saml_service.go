@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/SinisterSup/auth-service/internal/models"
+	"github.com/SinisterSup/auth-service/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// SAML identities are stored as linked identities with a "saml:" provider
+// prefix so they cannot collide with OIDC connectors of the same name.
+const samlIdentityPrefix = "saml:"
+
+func (s *FederationService) SAMLMetadata(providerName string) ([]byte, error) {
+	provider, ok := s.samlProviders[providerName]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return provider.Metadata()
+}
+
+func (s *FederationService) BeginSAMLLogin(providerName string) (string, error) {
+	provider, ok := s.samlProviders[providerName]
+	if !ok {
+		return "", ErrUnknownProvider
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	relayState, err := utils.GenerateOpaqueToken(32)
+	if err != nil {
+		return "", err
+	}
+	redirectURL, requestID, err := provider.AuthnRequestURL(ctx, relayState)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	_, err = s.samlRequests.InsertOne(ctx, models.SAMLRequest{
+		RelayState: relayState,
+		Provider:   providerName,
+		RequestID:  requestID,
+		ExpiresAt:  now.Add(oidcStateTTL),
+		CreatedAt:  now,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return redirectURL, nil
+}
+
+// CompleteSAMLLogin validates the IdP's POST to the assertion consumer service
+// and signs the user in, provisioning a local account on first login.
+// IdP-initiated responses are rejected because they carry no RelayState.
+func (s *FederationService) CompleteSAMLLogin(providerName string, r *http.Request) (*models.TokenResponse, error) {
+	provider, ok := s.samlProviders[providerName]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	if err := r.ParseForm(); err != nil {
+		return nil, ErrInvalidLoginState
+	}
+
+	var request models.SAMLRequest
+	err := s.samlRequests.FindOneAndDelete(ctx, bson.M{
+		"relay_state": r.PostForm.Get("RelayState"),
+		"provider":    providerName,
+		"expires_at":  bson.M{"$gt": time.Now()},
+	}).Decode(&request)
+	if err != nil {
+		return nil, ErrInvalidLoginState
+	}
+
+	assertion, err := provider.ParseResponse(ctx, r, request.RequestID)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := models.LinkedIdentity{
+		Provider: samlIdentityPrefix + providerName,
+		Subject:  assertion.Subject,
+		Email:    assertion.Email,
+		LinkedAt: time.Now(),
+	}
+
+	// Email attributes come from an IdP the operator explicitly trusts
+	user, err := s.resolveUser(ctx, identity, true, assertion.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.authService.issueTokens(ctx, user)
+}
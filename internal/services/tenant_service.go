@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/SinisterSup/auth-service/db"
+	"github.com/SinisterSup/auth-service/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrTenantNotFound = errors.New("tenant not found")
+	ErrTenantInUse    = errors.New("tenant still has users")
+	ErrHostTaken      = errors.New("host is already used by another tenant")
+)
+
+// TenantService keeps the tenants this deployment serves and their
+// settings. The default tenant is implicit and has no document.
+type TenantService struct {
+	collection *mongo.Collection
+	users      *mongo.Collection
+}
+
+func NewTenantService() *TenantService {
+	return &TenantService{
+		collection: db.DB.Collection("tenants"),
+		users:      db.DB.Collection("users"),
+	}
+}
+
+func (s *TenantService) List(ctx context.Context) ([]models.Tenant, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	tenants := []models.Tenant{}
+	if err := cursor.All(ctx, &tenants); err != nil {
+		return nil, err
+	}
+	return tenants, nil
+}
+
+// Get returns the tenant with id. The default tenant always exists.
+func (s *TenantService) Get(ctx context.Context, id string) (*models.Tenant, error) {
+	if id == models.DefaultTenant {
+		return &models.Tenant{}, nil
+	}
+	var tenant models.Tenant
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&tenant)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrTenantNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error looking up tenant: %v", err)
+	}
+	return &tenant, nil
+}
+
+// ByHost returns the tenant serving host, which may include a port.
+func (s *TenantService) ByHost(ctx context.Context, host string) (*models.Tenant, error) {
+	var tenant models.Tenant
+	err := s.collection.FindOne(ctx, bson.M{"hosts": normalizeHost(host)}).Decode(&tenant)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrTenantNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error looking up tenant: %v", err)
+	}
+	return &tenant, nil
+}
+
+// Settings returns the settings of tenant id, or none if it does not exist.
+func (s *TenantService) Settings(ctx context.Context, id string) (models.TenantSettings, error) {
+	tenant, err := s.Get(ctx, id)
+	if err == ErrTenantNotFound {
+		return models.TenantSettings{}, nil
+	}
+	if err != nil {
+		return models.TenantSettings{}, err
+	}
+	return tenant.Settings, nil
+}
+
+// Put creates or replaces a tenant.
+func (s *TenantService) Put(ctx context.Context, id string, input models.TenantInput) (*models.Tenant, error) {
+	if err := models.ValidateTenantID(id); err != nil {
+		return nil, err
+	}
+	if err := input.Settings.Validate(); err != nil {
+		return nil, err
+	}
+	hosts := []string{}
+	for _, host := range input.Hosts {
+		if host = normalizeHost(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+
+	now := time.Now()
+	var tenant models.Tenant
+	err := s.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{
+			"$set":         bson.M{"name": input.Name, "hosts": uniqueStrings(hosts), "settings": input.Settings, "updated_at": now},
+			"$setOnInsert": bson.M{"created_at": now},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&tenant)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrHostTaken
+	}
+	if err != nil {
+		return nil, errors.New("failed to save tenant")
+	}
+	return &tenant, nil
+}
+
+// Delete removes a tenant that no longer has any users.
+func (s *TenantService) Delete(ctx context.Context, id string) error {
+	count, err := s.users.CountDocuments(ctx, bson.M{"tenant_id": id}, options.Count().SetLimit(1))
+	if err != nil {
+		return fmt.Errorf("error counting users: %v", err)
+	}
+	if count > 0 {
+		return ErrTenantInUse
+	}
+
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return errors.New("failed to delete tenant")
+	}
+	if result.DeletedCount == 0 {
+		return ErrTenantNotFound
+	}
+	return nil
+}
+
+// tenantLogin qualifies an email with its tenant for counters shared across
+// tenants, such as sign-in throttling. Default tenant emails are unchanged.
+func tenantLogin(tenantId, email string) string {
+	if tenantId == models.DefaultTenant {
+		return email
+	}
+	return tenantId + "/" + email
+}
+
+// tenantFilter restricts filter to users of tenantId. Default tenant users
+// have no tenant_id, which matches null.
+func tenantFilter(tenantId string, filter bson.M) bson.M {
+	if tenantId == models.DefaultTenant {
+		filter["tenant_id"] = nil
+	} else {
+		filter["tenant_id"] = tenantId
+	}
+	return filter
+}
+
+func normalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(host, ".")
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "regexp"
+    "testing"
+
+    "github.com/SinisterSup/auth-service/internal/models"
+    "github.com/SinisterSup/auth-service/internal/passwordpolicy"
+    "github.com/SinisterSup/auth-service/utils"
+)
+
+func TestTenantScopedUsers(t *testing.T) {
+    cleanup := setupTestDB(t)
+    defer cleanup()
+
+    minLength := 12
+    tenants := NewTenantService()
+    _, err := tenants.Put(context.Background(), "acme", models.TenantInput{
+        Name:     "Acme",
+        Hosts:    []string{"Auth.Acme.example:443"},
+        Settings: models.TenantSettings{PasswordMinLength: &minLength, AccessTokenLifetime: "15m"},
+    })
+    if err != nil {
+        t.Fatalf("Failed to create tenant: %v", err)
+    }
+    if tenant, err := tenants.ByHost(context.Background(), "auth.acme.example"); err != nil || tenant.ID != "acme" {
+        t.Errorf("Expected tenant by host, got %v, %v", tenant, err)
+    }
+
+    acme := models.RequestMeta{TenantID: "acme"}
+    if _, err := testService.SignUp(models.SignUpInput{Email: "test@example.com", Password: "password123"}); err != nil {
+        t.Fatalf("Failed to create default tenant user: %v", err)
+    }
+    _, err = testService.SignUp(models.SignUpInput{Email: "test@example.com", Password: "password123", RequestMeta: acme})
+    var policyErr *passwordpolicy.ViolationError
+    if !errors.As(err, &policyErr) {
+        t.Errorf("Expected the tenant password policy to apply, got %v", err)
+    }
+    if _, err := testService.SignUp(models.SignUpInput{Email: "Test@example.com", Password: "longer password123", RequestMeta: acme}); err != nil {
+        t.Fatalf("Expected the same email to register in another tenant, got %v", err)
+    }
+    if _, err := testService.SignUp(models.SignUpInput{Email: "test@example.com", Password: "longer password123", RequestMeta: acme}); err != ErrEmailTaken {
+        t.Errorf("Expected email to be unique within the tenant, got %v", err)
+    }
+
+    _, err = testService.SignIn(models.SignInInput{Email: "test@example.com", Password: "password123", RequestMeta: acme})
+    if err != ErrInvalidCredentials {
+        t.Errorf("Expected default tenant password to fail in the tenant, got %v", err)
+    }
+    tokens, err := testService.SignIn(models.SignInInput{Email: "test@example.com", Password: "longer password123", RequestMeta: acme})
+    if err != nil {
+        t.Fatalf("Failed to sign in to tenant: %v", err)
+    }
+    claims, err := utils.ValidateTokenWithOptions(tokens.AccessToken, true)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if claims.Tenant != "acme" {
+        t.Errorf("Expected tenant claim, got %q", claims.Tenant)
+    }
+    if lifetime := claims.ExpiresAt.Sub(claims.IssuedAt.Time); lifetime.Minutes() != 15 {
+        t.Errorf("Expected the tenant access token lifetime, got %v", lifetime)
+    }
+
+    if _, err := testService.RefreshToken(tokens.RefreshToken); err == nil {
+        t.Error("Expected refresh outside the tenant to fail")
+    }
+    if _, err := testService.Refresh(models.RefreshTokenInput{RefreshToken: tokens.RefreshToken, RequestMeta: acme}); err != nil {
+        t.Errorf("Failed to refresh within the tenant: %v", err)
+    }
+
+    if err := tenants.Delete(context.Background(), "acme"); err != ErrTenantInUse {
+        t.Errorf("Expected tenant with users to be kept, got %v", err)
+    }
+}
+
+func TestTenantRequiresMFA(t *testing.T) {
+    cleanup := setupTestDB(t)
+    defer cleanup()
+
+    _, err := NewTenantService().Put(context.Background(), "acme", models.TenantInput{Settings: models.TenantSettings{RequireMFA: true}})
+    if err != nil {
+        t.Fatalf("Failed to create tenant: %v", err)
+    }
+    mailer := &recordingMailer{}
+    passwordless := NewPasswordlessService(testService, mailer)
+
+    acme := models.RequestMeta{TenantID: "acme"}
+    if _, err := testService.SignUp(models.SignUpInput{Email: "test@example.com", Password: "password123", RequestMeta: acme}); err != nil {
+        t.Fatalf("Failed to create test user: %v", err)
+    }
+
+    if err := passwordless.RequestMagicLink(models.MagicLinkInput{Email: "test@example.com", RequestMeta: acme}); err != nil {
+        t.Fatal(err)
+    }
+    if len(mailer.bodies) != 0 {
+        t.Fatal("Expected no magic link for a tenant that requires MFA")
+    }
+
+    _, err = testService.SignIn(models.SignInInput{Email: "test@example.com", Password: "password123", RequestMeta: acme})
+    var mfa *MFARequiredError
+    if !errors.As(err, &mfa) {
+        t.Fatalf("Expected a second factor to be required, got %v", err)
+    }
+    if err := passwordless.SendSecondFactor(context.Background(), mfa); err != nil {
+        t.Fatalf("Failed to send sign-in code: %v", err)
+    }
+    code := regexp.MustCompile(`\d{6}`).FindString(mailer.bodies[0])
+
+    if _, err := passwordless.VerifyOTP(models.OTPVerifyInput{Email: "test@example.com", Code: code}); err == nil {
+        t.Error("Expected the code to only work within its tenant")
+    }
+    tokens, err := passwordless.VerifyOTP(models.OTPVerifyInput{Email: "test@example.com", Code: code, RequestMeta: acme})
+    if err != nil {
+        t.Fatalf("Failed to verify code: %v", err)
+    }
+    if tokens.AccessToken == "" {
+        t.Error("Expected tokens after the second factor")
+    }
+}
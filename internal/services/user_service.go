@@ -4,10 +4,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/SinisterSup/auth-service/db"
+	"github.com/SinisterSup/auth-service/internal/mail"
 	"github.com/SinisterSup/auth-service/internal/models"
+	"github.com/SinisterSup/auth-service/internal/passwordhash"
+	"github.com/SinisterSup/auth-service/internal/passwordpolicy"
+	"github.com/SinisterSup/auth-service/internal/scope"
 	"github.com/SinisterSup/auth-service/utils"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -15,64 +23,312 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
+var (
+	ErrAccountInactive        = models.ErrAccountInactive
+	ErrPasswordResetRequired  = errors.New("password reset required")
+	ErrInvalidCurrentPassword = errors.New("current password is incorrect")
+	ErrInvalidCredentials     = errors.New("invalid email or password")
+	ErrEmailTaken             = errors.New("already registered email")
+	ErrNoDirectory            = errors.New("no LDAP directory is configured")
+)
+
+// MFARequiredError is returned by sign-in when the password was right but the
+// user's tenant requires a second factor before tokens are issued.
+type MFARequiredError struct {
+	User   *models.User
+	Scopes []string
+}
+
+func (e *MFARequiredError) Error() string {
+	return "multi-factor authentication required"
+}
+
 type AuthService struct {
-	collection *mongo.Collection
+	collection    *mongo.Collection
+	authenticator Authenticator
+	audit         *AuditService
+	throttle      *LoginThrottle
+	passwords     *passwordpolicy.Policy
+	hasher        *passwordhash.Pool
+	roles         *RoleService
+	scopes        *scope.Config
+	tenants       *TenantService
+	memberships   *mongo.Collection
+}
+
+var (
+	hashPoolOnce sync.Once
+	hashPool     *passwordhash.Pool
+)
+
+// passwordHashPool builds the hashing pool on first use, so every AuthService
+// in the process shares one set of workers.
+func passwordHashPool() *passwordhash.Pool {
+	hashPoolOnce.Do(func() {
+		hasher, err := passwordhash.NewFromEnv()
+		if err != nil {
+			log.Fatal(err)
+		}
+		hashPool = passwordhash.NewPoolFromEnv(hasher)
+		hashPool.Publish()
+	})
+	return hashPool
 }
 
 func NewAuthService() *AuthService {
+	hasher := passwordHashPool()
+	scopes, err := scope.LoadConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	collection := db.DB.Collection("users")
 	return &AuthService{
-		collection: db.DB.Collection("users"),
+		collection:    collection,
+		authenticator: newAuthenticatorFromEnv(collection, hasher),
+		audit:         NewAuditService(),
+		throttle:      NewLoginThrottle(),
+		passwords:     passwordpolicy.NewPolicyFromEnv(),
+		hasher:        hasher,
+		roles:         NewRoleService(),
+		scopes:        scopes,
+		tenants:       NewTenantService(),
+		memberships:   db.DB.Collection("memberships"),
 	}
 }
 
 func (s *AuthService) SignUp(input models.SignUpInput) (*models.User, error) {
-	ctx := context.Background()
+	return s.SignUpContext(context.Background(), input)
+}
+
+// SignUpContext is SignUp bounded by ctx, which is given up on if it ends
+// while the password is still waiting to be hashed.
+func (s *AuthService) SignUpContext(ctx context.Context, input models.SignUpInput) (*models.User, error) {
+	return s.createUser(ctx, input, models.StatusActive, false)
+}
 
-	var existingUser models.User
-	err := s.collection.FindOne(ctx, bson.M{"email": input.Email}).Decode(&existingUser)
-	if err == nil {
-		return nil, errors.New("already registered email")
+// createUser hashes the password before looking for an existing account, so
+// a taken email takes as long to answer as a new one. emailVerified is set
+// when the caller already has proof the user owns the email.
+func (s *AuthService) createUser(ctx context.Context, input models.SignUpInput, status models.AccountStatus, emailVerified bool) (*models.User, error) {
+	email, err := mail.NormalizeAddress(input.Email)
+	if err != nil {
+		return nil, err
 	}
+	input.Email = email
 
-	hashedPassword, err := utils.HashPassword(input.Password)
+	passwords, err := s.passwordPolicy(ctx, input.TenantID)
 	if err != nil {
 		return nil, err
 	}
+	if err := passwords.Validate(input.Password, input.Email); err != nil {
+		return nil, err
+	}
 
+	hashedPassword, err := s.hasher.Hash(ctx, input.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
 	user := &models.User{
+		TenantID:  input.TenantID,
 		Email:     input.Email,
 		Password:  hashedPassword,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		Status:    status,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if emailVerified {
+		user.EmailVerifiedAt = &now
+		if input.TenantID == models.DefaultTenant && isBootstrapAdmin(input.Email) {
+			user.Roles = []string{models.AdminRole}
+		}
 	}
 
+	// The unique email index settles concurrent sign-ups for the same address
 	result, err := s.collection.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrEmailTaken
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	user.ID = result.InsertedID.(primitive.ObjectID)
+	s.audit.Record(ctx, auditEvent(models.AuditSignUp, user.ID, user.Email, input.RequestMeta))
 	return user, nil
 }
 
 func (s *AuthService) SignIn(input models.SignInInput) (*models.TokenResponse, error) {
-	ctx := context.Background()
+	return s.SignInContext(context.Background(), input)
+}
 
-	var user models.User
-	err := s.collection.FindOne(ctx, bson.M{"email": input.Email}).Decode(&user)
+// SignInContext is SignIn bounded by ctx, which is given up on if it ends
+// while the password is still waiting to be verified.
+func (s *AuthService) SignInContext(ctx context.Context, input models.SignInInput) (*models.TokenResponse, error) {
+	input.Email = mail.LookupAddress(input.Email)
+
+	granted, err := s.scopes.Grant(input.Scope)
 	if err != nil {
-		return nil, errors.New("invalid username or password credentials")
+		return nil, err
 	}
 
-	if !utils.CheckPassword(input.Password, user.Password) {
-		return nil, errors.New("invalid password credentials")
+	login := tenantLogin(input.TenantID, input.Email)
+	if err := s.throttle.Check(ctx, login, input.IP); err != nil {
+		return nil, err
 	}
 
-	accessToken, err := utils.GenerateToken(user.ID.Hex(), user.Email)
+	user, err := s.authenticator.Authenticate(ctx, input.TenantID, input.Email, input.Password)
+	if err != nil && (errors.Is(err, passwordhash.ErrSaturated) || ctx.Err() != nil) {
+		// The password was never checked, so this is not a failed attempt
+		return nil, err
+	}
 	if err != nil {
+		s.recordSignInFailure(ctx, login, input.Email, input.RequestMeta)
 		return nil, err
 	}
-	refreshToken, err := utils.GenerateRefreshToken(user.ID.Hex(), user.Email)
+	if user.EffectiveStatus(time.Now()) == models.StatusUnverified {
+		// Answering "not verified" would tell whoever just tried to sign up
+		// with this email that no one had registered it before
+		return nil, ErrInvalidCredentials
+	}
+	if err := s.throttle.RecordSuccess(ctx, login); err != nil {
+		log.Printf("Failed to reset sign-in failures: %v", err)
+	}
+	// issueOrgTokens checks this too, but no code should be emailed first
+	if user.PasswordResetRequired {
+		return nil, ErrPasswordResetRequired
+	}
+
+	settings, err := s.tenants.Settings(ctx, user.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	if settings.RequireMFA {
+		return nil, &MFARequiredError{User: user, Scopes: granted}
+	}
+
+	tokens, err := s.issueScopedTokens(ctx, user, granted)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit.Record(ctx, auditEvent(models.AuditSignIn, user.ID, user.Email, input.RequestMeta))
+	return tokens, nil
+}
+
+// recordSignInFailure counts a failed password or code check for login
+// towards its lockout, and audits the failure and any lockout it starts.
+func (s *AuthService) recordSignInFailure(ctx context.Context, login, email string, meta models.RequestMeta) {
+	s.audit.Record(ctx, auditEvent(models.AuditSignInFailed, primitive.NilObjectID, email, meta))
+	locked, err := s.throttle.RecordFailure(ctx, login, meta.IP)
+	if err != nil {
+		log.Printf("Failed to record sign-in failure: %v", err)
+	}
+	if locked {
+		s.audit.Record(ctx, auditEvent(models.AuditSignInLocked, primitive.NilObjectID, email, meta))
+	}
+}
+
+// isBootstrapAdmin reports whether email is listed in ADMIN_EMAILS, which
+// grants the admin role once the email is verified so a fresh deployment has
+// an operator. Granting it any earlier would make admin whoever registers the
+// address first.
+func isBootstrapAdmin(email string) bool {
+	for _, admin := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if admin = strings.TrimSpace(admin); admin != "" && strings.EqualFold(admin, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// passwordPolicy returns the password policy of a tenant: the service-wide
+// one with the tenant's overrides applied.
+func (s *AuthService) passwordPolicy(ctx context.Context, tenantId string) (*passwordpolicy.Policy, error) {
+	settings, err := s.tenants.Settings(ctx, tenantId)
+	if err != nil {
+		return nil, err
+	}
+	policy := *s.passwords
+	if settings.PasswordMinLength != nil {
+		policy.MinLength = *settings.PasswordMinLength
+	}
+	if settings.PasswordMinScore != nil {
+		policy.MinScore = *settings.PasswordMinScore
+	}
+	return &policy, nil
+}
+
+// activeOrg is the organization a token pair acts in, if any, and the user's
+// role there.
+type activeOrg struct {
+	ID   string
+	Role string
+}
+
+// generateAccessToken signs an access token carrying the user's tenant and
+// roles, the permissions those roles grant, the OAuth scopes granted and the
+// active organization, with the tenant's access token lifetime.
+func (s *AuthService) generateAccessToken(ctx context.Context, user *models.User, scopes []string, org activeOrg, settings models.TenantSettings) (string, error) {
+	permissions, err := s.roles.Permissions(ctx, user)
+	if err != nil {
+		return "", err
+	}
+	return utils.GenerateAccessToken(utils.JWTClaim{
+		Generation:  user.TokenGeneration,
+		UserId:      user.ID.Hex(),
+		Email:       user.Email,
+		Roles:       user.Roles,
+		Permissions: permissions,
+		Scope:       scope.Format(scopes),
+		Tenant:      user.TenantID,
+		Org:         org.ID,
+		OrgRole:     org.Role,
+	}, settings.AccessTokenTTL())
+}
+
+// issueTokens mints an access/refresh pair with the default scope for an
+// authenticated user and stores the refresh token so it can later be rotated
+// or revoked.
+func (s *AuthService) issueTokens(ctx context.Context, user *models.User) (*models.TokenResponse, error) {
+	return s.issueScopedTokens(ctx, user, s.scopes.Default)
+}
+
+// issueScopedTokens is issueTokens for the given scopes. The refresh token
+// carries them as the most any later refresh may grant.
+func (s *AuthService) issueScopedTokens(ctx context.Context, user *models.User, scopes []string) (*models.TokenResponse, error) {
+	return s.issueOrgTokens(ctx, user, scopes, activeOrg{})
+}
+
+// issueOrgTokens is issueScopedTokens acting in org. Refreshing keeps the
+// organization for as long as the user stays a member. Every way of signing
+// in ends here, so users who must reset their password get no tokens
+// however they sign in.
+func (s *AuthService) issueOrgTokens(ctx context.Context, user *models.User, scopes []string, org activeOrg) (*models.TokenResponse, error) {
+	if err := user.StatusError(time.Now()); err != nil {
+		return nil, err
+	}
+	if user.PasswordResetRequired {
+		return nil, ErrPasswordResetRequired
+	}
+
+	settings, err := s.tenants.Settings(ctx, user.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := s.generateAccessToken(ctx, user, scopes, org, settings)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := utils.GenerateRefreshTokenWithClaims(utils.JWTClaim{
+		UserId: user.ID.Hex(),
+		Email:  user.Email,
+		Scope:  scope.Format(scopes),
+		Tenant: user.TenantID,
+		Org:    org.ID,
+	}, settings.RefreshTokenTTL())
     if err != nil {
         return nil, err
     }
@@ -90,6 +346,7 @@ func (s *AuthService) SignIn(input models.SignInInput) (*models.TokenResponse, e
 	return &models.TokenResponse{
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
+		Scope:        scope.Format(scopes),
 	}, nil
 }
 
@@ -133,34 +390,176 @@ func (s *AuthService) RevokeToken(userId, token string) error {
         return errors.New("token already revoked")
     }
 
+	s.audit.Record(ctx, auditEvent(models.AuditTokenRevoked, objectId, "", models.RequestMeta{}))
+	return nil
+}
+
+
+// ChangePassword replaces a local password after checking the current one and
+// ends every session, including the caller's.
+func (s *AuthService) ChangePassword(userId string, input models.ChangePasswordInput, meta models.RequestMeta) error {
+	objectId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := s.collection.FindOne(ctx, bson.M{"_id": objectId}).Decode(&user); err != nil {
+		return errors.New("user not found")
+	}
+	if user.Password == "" {
+		return ErrInvalidCurrentPassword
+	}
+	// Wrong current passwords count towards the sign-in lockout, or a stolen
+	// access token would allow unlimited guesses
+	login := tenantLogin(user.TenantID, user.Email)
+	if err := s.throttle.Check(ctx, login, meta.IP); err != nil {
+		return err
+	}
+	ok, err := s.hasher.Verify(ctx, input.CurrentPassword, user.Password)
+	if errors.Is(err, passwordhash.ErrSaturated) {
+		return err
+	}
+	if !ok {
+		s.recordSignInFailure(ctx, login, user.Email, meta)
+		return ErrInvalidCurrentPassword
+	}
+	if err := s.throttle.RecordSuccess(ctx, login); err != nil {
+		log.Printf("Failed to reset sign-in failures: %v", err)
+	}
+	passwords, err := s.passwordPolicy(ctx, user.TenantID)
+	if err != nil {
+		return err
+	}
+	if err := passwords.Validate(input.NewPassword, user.Email); err != nil {
+		return err
+	}
+
+	hashedPassword, err := s.hasher.Hash(ctx, input.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	_, err = s.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": objectId},
+		bson.M{
+			"$set": bson.M{
+				"password":      hashedPassword,
+				"refresh_token": "",
+				"updated_at":    now,
+			},
+			"$inc":   bson.M{"token_generation": 1},
+			"$unset": bson.M{"password_reset_required": ""},
+		},
+	)
+	if err != nil {
+		return errors.New("failed to update password")
+	}
+
+	s.audit.Record(ctx, auditEvent(models.AuditPasswordChanged, objectId, user.Email, meta))
 	return nil
 }
 
+// LinkDirectory links the LDAP account input names to the user, who can sign
+// in with their directory password from then on.
+func (s *AuthService) LinkDirectory(userId string, input models.LinkDirectoryInput) error {
+	objectId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return err
+	}
+	directory, ok := s.authenticator.(*LDAPAuthenticator)
+	if !ok {
+		return ErrNoDirectory
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err = directory.Link(ctx, objectId, input.Email, input.Password)
+	return err
+}
 
 func (s *AuthService) RefreshToken(refreshToken string) (*models.TokenResponse, error) {
+    return s.Refresh(models.RefreshTokenInput{RefreshToken: refreshToken})
+}
+
+// Refresh rotates the refresh token and mints an access token with the
+// requested scope, which may not exceed the scope the refresh token was
+// granted. An empty request keeps the whole grant, and the new refresh token
+// keeps it either way. Refresh tokens only work within their own tenant.
+func (s *AuthService) Refresh(input models.RefreshTokenInput) (*models.TokenResponse, error) {
+    refreshToken := input.RefreshToken
     claims, err := utils.ValidateRefreshToken(refreshToken)
     if err != nil {
         return nil, err
     }
 
+    // Refresh tokens from before scopes were configured get the default scope
+    ceiling := scope.Parse(claims.Scope)
+    if claims.Scope == "" {
+        ceiling = s.scopes.Default
+    }
+    scopes, err := scope.Narrow(ceiling, input.Scope)
+    if err != nil {
+        return nil, err
+    }
+
+    objectId, err := primitive.ObjectIDFromHex(claims.UserId)
+    if err != nil {
+        return nil, errors.New("invalid refresh token")
+    }
+
     ctx := context.Background()
 
     // Check if refresh token exists in DB
     var user models.User
     err = s.collection.FindOne(ctx, bson.M{
-        "_id": claims.UserId,
+        "_id": objectId,
         "refresh_token": refreshToken,
     }).Decode(&user)
 
-    if err != nil {
+    if err != nil || user.TenantID != input.TenantID {
         return nil, errors.New("invalid refresh token")
     }
+    if err := user.StatusError(time.Now()); err != nil {
+        return nil, err
+    }
+    if user.PasswordResetRequired {
+        return nil, ErrPasswordResetRequired
+    }
 
-    newAccessToken, err := utils.GenerateToken(user.ID.Hex(), user.Email)
+    // Members who were removed fall back to no organization
+    org := activeOrg{}
+    if claims.Org != "" {
+        role, err := s.orgRole(ctx, claims.Org, user.ID)
+        if err != nil && err != ErrNotOrgMember {
+            return nil, err
+        }
+        if err == nil {
+            org = activeOrg{ID: claims.Org, Role: role}
+        }
+    }
+
+    settings, err := s.tenants.Settings(ctx, user.TenantID)
+    if err != nil {
+        return nil, err
+    }
+    newAccessToken, err := s.generateAccessToken(ctx, &user, scopes, org, settings)
     if err != nil {
         return nil, err
     }
-    newRefreshToken, err := utils.GenerateRefreshToken(user.ID.Hex(), user.Email)
+    newRefreshToken, err := utils.GenerateRefreshTokenWithClaims(utils.JWTClaim{
+        UserId: user.ID.Hex(),
+        Email:  user.Email,
+        Scope:  scope.Format(ceiling),
+        Tenant: user.TenantID,
+        Org:    org.ID,
+    }, settings.RefreshTokenTTL())
     if err != nil {
         return nil, err
     }
@@ -178,5 +577,6 @@ func (s *AuthService) RefreshToken(refreshToken string) (*models.TokenResponse,
     return &models.TokenResponse{
         AccessToken:  newAccessToken,
         RefreshToken: newRefreshToken,
+        Scope:        scope.Format(scopes),
     }, nil
 }
\ No newline at end of file
@@ -2,15 +2,22 @@ package services
 
 import (
     "context"
-    // "os"
+    "fmt"
+    "os"
+    "regexp"
+    "strings"
     "testing"
-    // "time"
+    "time"
 
     "github.com/SinisterSup/auth-service/db"
     "github.com/SinisterSup/auth-service/internal/models"
-    // "go.mongodb.org/mongo-driver/bson"
+    "github.com/SinisterSup/auth-service/internal/passwordpolicy"
+    "github.com/SinisterSup/auth-service/internal/scope"
+    "github.com/SinisterSup/auth-service/utils"
+    "go.mongodb.org/mongo-driver/bson"
     "go.mongodb.org/mongo-driver/mongo"
     "go.mongodb.org/mongo-driver/mongo/options"
+    "golang.org/x/crypto/bcrypt"
 )
 
 var testService *AuthService
@@ -23,6 +30,10 @@ func setupTestDB(t *testing.T) func() {
     }
 
     db.DB = client.Database("auth_service_test")
+    if err := db.EnsureIndexes(ctx); err != nil {
+        t.Fatal(err)
+    }
+    os.Setenv("PASSWORD_MIN_SCORE", "0")
     testService = NewAuthService()
 
     return func() {
@@ -85,3 +96,284 @@ func TestSignIn(t *testing.T) {
         t.Error("Expected error for invalid password, got nil")
     }
 }
+
+func TestChangePassword(t *testing.T) {
+    cleanup := setupTestDB(t)
+    defer cleanup()
+
+    user, err := testService.SignUp(models.SignUpInput{Email: "test@example.com", Password: "password123"})
+    if err != nil {
+        t.Fatalf("Failed to create test user: %v", err)
+    }
+    userId := user.ID.Hex()
+
+    err = testService.ChangePassword(userId, models.ChangePasswordInput{CurrentPassword: "wrong", NewPassword: "newpassword123"}, models.RequestMeta{})
+    if err != ErrInvalidCurrentPassword {
+        t.Errorf("Expected ErrInvalidCurrentPassword, got %v", err)
+    }
+
+    err = testService.ChangePassword(userId, models.ChangePasswordInput{CurrentPassword: "password123", NewPassword: "short"}, models.RequestMeta{})
+    if _, ok := err.(*passwordpolicy.ViolationError); !ok {
+        t.Errorf("Expected a policy violation for a short password, got %v", err)
+    }
+
+    before, err := testService.SignIn(models.SignInInput{Email: "test@example.com", Password: "password123"})
+    if err != nil {
+        t.Fatalf("Failed to sign in: %v", err)
+    }
+    err = testService.ChangePassword(userId, models.ChangePasswordInput{CurrentPassword: "password123", NewPassword: "newpassword123"}, models.RequestMeta{})
+    if err != nil {
+        t.Fatalf("Failed to change password: %v", err)
+    }
+    if _, err := utils.ValidateToken(before.AccessToken); err == nil {
+        t.Error("Expected tokens from before the change to be rejected")
+    }
+    // Tokens issued right after the change work, even within the same second
+    after, err := testService.SignIn(models.SignInInput{Email: "test@example.com", Password: "newpassword123"})
+    if err != nil {
+        t.Fatalf("Failed to sign in with new password: %v", err)
+    }
+    if _, err := utils.ValidateToken(after.AccessToken); err != nil {
+        t.Errorf("Expected the new token to be accepted, got %v", err)
+    }
+}
+
+func TestSignInRehashesLegacyPassword(t *testing.T) {
+    cleanup := setupTestDB(t)
+    defer cleanup()
+
+    legacy, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+    if err != nil {
+        t.Fatal(err)
+    }
+    _, err = testService.collection.InsertOne(context.Background(), models.User{
+        Email:     "legacy@example.com",
+        Password:  string(legacy),
+        Status:    models.StatusActive,
+        CreatedAt: time.Now(),
+        UpdatedAt: time.Now(),
+    })
+    if err != nil {
+        t.Fatalf("Failed to create legacy user: %v", err)
+    }
+
+    if _, err := testService.SignIn(models.SignInInput{Email: "legacy@example.com", Password: "password123"}); err != nil {
+        t.Fatalf("Failed to sign in with legacy hash: %v", err)
+    }
+
+    var user models.User
+    if err := testService.collection.FindOne(context.Background(), bson.M{"email": "legacy@example.com"}).Decode(&user); err != nil {
+        t.Fatal(err)
+    }
+    if !strings.HasPrefix(user.Password, "$argon2id$") {
+        t.Errorf("Expected password to be rehashed with argon2id, got %q", user.Password)
+    }
+    if _, err := testService.SignIn(models.SignInInput{Email: "legacy@example.com", Password: "password123"}); err != nil {
+        t.Errorf("Failed to sign in with rehashed password: %v", err)
+    }
+}
+
+func TestDummyHashMatchesLegacyBcrypt(t *testing.T) {
+    cleanup := setupTestDB(t)
+    defer cleanup()
+
+    authenticator, err := NewLocalAuthenticator(testService.collection, testService.hasher)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !strings.HasPrefix(authenticator.dummy, "$argon2id$") {
+        t.Errorf("Expected an argon2id dummy without legacy hashes, got %q", authenticator.dummy)
+    }
+
+    for _, cost := range []int{bcrypt.MinCost, bcrypt.MinCost + 2} {
+        legacy, err := bcrypt.GenerateFromPassword([]byte("password123"), cost)
+        if err != nil {
+            t.Fatal(err)
+        }
+        testService.collection.InsertOne(context.Background(), models.User{Email: fmt.Sprintf("legacy%d@example.com", cost), Password: string(legacy)})
+    }
+    authenticator, err = NewLocalAuthenticator(testService.collection, testService.hasher)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if cost, err := bcrypt.Cost([]byte(authenticator.dummy)); err != nil || cost != bcrypt.MinCost+2 {
+        t.Errorf("Expected a bcrypt dummy of the highest legacy cost, got %q", authenticator.dummy)
+    }
+}
+
+func TestSignInErrorsAreUniform(t *testing.T) {
+    cleanup := setupTestDB(t)
+    defer cleanup()
+
+    if _, err := testService.SignUp(models.SignUpInput{Email: "test@example.com", Password: "password123"}); err != nil {
+        t.Fatalf("Failed to create test user: %v", err)
+    }
+
+    _, wrongPassword := testService.SignIn(models.SignInInput{Email: "test@example.com", Password: "wrongpassword"})
+    _, unknownEmail := testService.SignIn(models.SignInInput{Email: "nobody@example.com", Password: "wrongpassword"})
+    if wrongPassword != ErrInvalidCredentials || unknownEmail != ErrInvalidCredentials {
+        t.Errorf("Expected ErrInvalidCredentials for both, got %v and %v", wrongPassword, unknownEmail)
+    }
+}
+
+func TestRegisterDoesNotRevealExistingAccounts(t *testing.T) {
+    cleanup := setupTestDB(t)
+    defer cleanup()
+
+    mailer := &recordingMailer{}
+    registrations := NewRegistrationService(testService, mailer)
+    input := models.SignUpInput{Email: "test@example.com", Password: "password123"}
+
+    if err := registrations.Register(context.Background(), input); err != nil {
+        t.Fatalf("Failed to register: %v", err)
+    }
+    if _, err := testService.SignIn(models.SignInInput{Email: input.Email, Password: input.Password}); err != ErrInvalidCredentials {
+        t.Errorf("Expected unverified account to be refused like a wrong password, got %v", err)
+    }
+
+    match := regexp.MustCompile(`Verification token: (\S+)`).FindStringSubmatch(mailer.bodies[0])
+    if match == nil {
+        t.Fatalf("Verification token not found in email: %q", mailer.bodies[0])
+    }
+    token := match[1]
+    if err := registrations.VerifyEmail(models.VerifyEmailInput{Token: token}, models.RequestMeta{}); err != nil {
+        t.Fatalf("Failed to verify email: %v", err)
+    }
+    if err := registrations.VerifyEmail(models.VerifyEmailInput{Token: token}, models.RequestMeta{}); err != ErrInvalidVerificationToken {
+        t.Errorf("Expected token to be single use, got %v", err)
+    }
+    if _, err := testService.SignIn(models.SignInInput{Email: input.Email, Password: input.Password}); err != nil {
+        t.Errorf("Failed to sign in after verifying: %v", err)
+    }
+
+    if err := registrations.Register(context.Background(), input); err != nil {
+        t.Errorf("Expected duplicate sign-up to succeed silently, got %v", err)
+    }
+    if len(mailer.bodies) != 2 || !strings.Contains(mailer.bodies[1], "you already have one") {
+        t.Errorf("Expected the owner to be told about the duplicate sign-up, got %q", mailer.bodies)
+    }
+}
+
+func TestConcurrentSignUpsCreateOneUser(t *testing.T) {
+    cleanup := setupTestDB(t)
+    defer cleanup()
+
+    emails := []string{"race@example.com", "Race@Example.com", " RACE@example.COM", "race@example.com"}
+    results := make(chan error, len(emails))
+    for _, email := range emails {
+        go func(email string) {
+            _, err := testService.SignUp(models.SignUpInput{Email: email, Password: "password123"})
+            results <- err
+        }(email)
+    }
+
+    created := 0
+    for range emails {
+        err := <-results
+        if err == nil {
+            created++
+        } else if err != ErrEmailTaken {
+            t.Errorf("Expected ErrEmailTaken for the losers, got %v", err)
+        }
+    }
+    if created != 1 {
+        t.Errorf("Expected exactly one sign-up to succeed, got %d", created)
+    }
+
+    count, err := testService.collection.CountDocuments(context.Background(), bson.M{"email": "race@example.com"})
+    if err != nil || count != 1 {
+        t.Errorf("Expected one stored user with the normalized email, got %d (%v)", count, err)
+    }
+}
+
+func TestSignInAndRefreshScopes(t *testing.T) {
+    t.Setenv("OAUTH_SCOPES", "profile email reports:read reports:write")
+    t.Setenv("OAUTH_DEFAULT_SCOPE", "profile")
+    cleanup := setupTestDB(t)
+    defer cleanup()
+
+    if _, err := testService.SignUp(models.SignUpInput{Email: "test@example.com", Password: "password123"}); err != nil {
+        t.Fatalf("Failed to create test user: %v", err)
+    }
+
+    _, err := testService.SignIn(models.SignInInput{Email: "test@example.com", Password: "password123", Scope: "profile admin"})
+    if err != scope.ErrInvalidScope {
+        t.Errorf("Expected unknown scope to be refused, got %v", err)
+    }
+
+    tokens, err := testService.SignIn(models.SignInInput{Email: "test@example.com", Password: "password123", Scope: "reports:read profile"})
+    if err != nil {
+        t.Fatalf("Failed to sign in: %v", err)
+    }
+    if tokens.Scope != "profile reports:read" {
+        t.Errorf("Expected granted scope in response, got %q", tokens.Scope)
+    }
+    claims, err := utils.ValidateTokenWithOptions(tokens.AccessToken, true)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if claims.Scope != "profile reports:read" {
+        t.Errorf("Expected scope claim, got %q", claims.Scope)
+    }
+
+    if _, err := testService.Refresh(models.RefreshTokenInput{RefreshToken: tokens.RefreshToken, Scope: "reports:write"}); err != scope.ErrInvalidScope {
+        t.Errorf("Expected wider scope to be refused on refresh, got %v", err)
+    }
+
+    narrowed, err := testService.Refresh(models.RefreshTokenInput{RefreshToken: tokens.RefreshToken, Scope: "reports:read"})
+    if err != nil {
+        t.Fatalf("Failed to refresh with narrower scope: %v", err)
+    }
+    if narrowed.Scope != "reports:read" {
+        t.Errorf("Expected narrowed scope, got %q", narrowed.Scope)
+    }
+
+    // The refresh token keeps the original grant
+    restored, err := testService.RefreshToken(narrowed.RefreshToken)
+    if err != nil {
+        t.Fatalf("Failed to refresh: %v", err)
+    }
+    if restored.Scope != "profile reports:read" {
+        t.Errorf("Expected the original grant after refreshing, got %q", restored.Scope)
+    }
+
+    defaults, err := testService.SignIn(models.SignInInput{Email: "test@example.com", Password: "password123"})
+    if err != nil {
+        t.Fatalf("Failed to sign in: %v", err)
+    }
+    if defaults.Scope != "profile" {
+        t.Errorf("Expected default scope, got %q", defaults.Scope)
+    }
+}
+
+func TestBootstrapAdminNeedsVerifiedEmail(t *testing.T) {
+    cleanup := setupTestDB(t)
+    defer cleanup()
+    os.Setenv("ADMIN_EMAILS", "ops@example.com")
+    defer os.Unsetenv("ADMIN_EMAILS")
+
+    mailer := &recordingMailer{}
+    registrations := NewRegistrationService(testService, mailer)
+    if err := registrations.Register(context.Background(), models.SignUpInput{Email: "ops@example.com", Password: "password123"}); err != nil {
+        t.Fatalf("Failed to register: %v", err)
+    }
+
+    var user models.User
+    if err := testService.collection.FindOne(context.Background(), bson.M{"email": "ops@example.com"}).Decode(&user); err != nil {
+        t.Fatal(err)
+    }
+    if len(user.Roles) != 0 {
+        t.Errorf("Expected no role before the email is verified, got %v", user.Roles)
+    }
+
+    token := regexp.MustCompile(`Verification token: (\S+)`).FindStringSubmatch(mailer.bodies[0])[1]
+    if err := registrations.VerifyEmail(models.VerifyEmailInput{Token: token}, models.RequestMeta{}); err != nil {
+        t.Fatalf("Failed to verify email: %v", err)
+    }
+    if err := testService.collection.FindOne(context.Background(), bson.M{"email": "ops@example.com"}).Decode(&user); err != nil {
+        t.Fatal(err)
+    }
+    if len(user.Roles) != 1 || user.Roles[0] != models.AdminRole {
+        t.Errorf("Expected the admin role once verified, got %v", user.Roles)
+    }
+}
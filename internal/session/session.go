@@ -0,0 +1,138 @@
+// Package session keeps browser sessions in cookies instead of handing
+// tokens to JavaScript. The access token is sent with every request, the
+// refresh token only to the refresh route, and both are HttpOnly. A CSRF
+// token, readable by scripts on the page, must be echoed in a header on
+// every state-changing request that relies on the cookies.
+package session
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/SinisterSup/auth-service/utils"
+)
+
+const (
+	AccessCookie  = "access_token"
+	RefreshCookie = "refresh_token"
+	CSRFCookie    = "csrf_token"
+	CSRFHeader    = "X-CSRF-Token"
+	// ModeHeader set to "cookie" on a sign-in asks for cookies rather than
+	// tokens in the response body.
+	ModeHeader = "X-Session-Mode"
+)
+
+type Config struct {
+	Enabled  bool
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+}
+
+// LoadConfigFromEnv reads SESSION_COOKIES, which turns cookie sessions on,
+// COOKIE_DOMAIN, COOKIE_SECURE (on unless "false") and COOKIE_SAMESITE
+// (lax, strict or none; lax by default).
+func LoadConfigFromEnv() (*Config, error) {
+	config := &Config{
+		Enabled:  os.Getenv("SESSION_COOKIES") == "true",
+		Domain:   os.Getenv("COOKIE_DOMAIN"),
+		Secure:   os.Getenv("COOKIE_SECURE") != "false",
+		SameSite: http.SameSiteLaxMode,
+	}
+	switch strings.ToLower(os.Getenv("COOKIE_SAMESITE")) {
+	case "", "lax":
+	case "strict":
+		config.SameSite = http.SameSiteStrictMode
+	case "none":
+		if !config.Secure {
+			return nil, fmt.Errorf("COOKIE_SAMESITE=none needs secure cookies")
+		}
+		config.SameSite = http.SameSiteNoneMode
+	default:
+		return nil, fmt.Errorf("COOKIE_SAMESITE must be lax, strict or none")
+	}
+	return config, nil
+}
+
+// Requested reports whether the client asked for a cookie session.
+func (c *Config) Requested(r *http.Request) bool {
+	return c.Enabled && strings.EqualFold(r.Header.Get(ModeHeader), "cookie")
+}
+
+// Tokens is what SetTokens puts in cookies. The refresh cookie is only sent
+// to RefreshPath.
+type Tokens struct {
+	Access         string
+	AccessExpires  time.Time
+	Refresh        string
+	RefreshExpires time.Time
+	RefreshPath    string
+	CSRF           string
+}
+
+func (c *Config) SetTokens(w http.ResponseWriter, tokens Tokens) {
+	http.SetCookie(w, c.cookie(AccessCookie, tokens.Access, "/", tokens.AccessExpires, true))
+	http.SetCookie(w, c.cookie(RefreshCookie, tokens.Refresh, tokens.RefreshPath, tokens.RefreshExpires, true))
+	http.SetCookie(w, c.cookie(CSRFCookie, tokens.CSRF, "/", tokens.RefreshExpires, false))
+}
+
+// Clear removes the session cookies, as on sign-out.
+func (c *Config) Clear(w http.ResponseWriter, refreshPath string) {
+	expired := time.Unix(0, 0)
+	http.SetCookie(w, c.cookie(AccessCookie, "", "/", expired, true))
+	http.SetCookie(w, c.cookie(RefreshCookie, "", refreshPath, expired, true))
+	http.SetCookie(w, c.cookie(CSRFCookie, "", "/", expired, false))
+}
+
+func (c *Config) cookie(name, value, path string, expires time.Time, httpOnly bool) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   c.Domain,
+		Expires:  expires,
+		Secure:   c.Secure,
+		HttpOnly: httpOnly,
+		SameSite: c.SameSite,
+	}
+	if value == "" {
+		cookie.MaxAge = -1
+	}
+	return cookie
+}
+
+// NewCSRFToken returns a CSRF token for subject, the user the session is
+// for. It is signed, so a token planted by someone else, for example through
+// a sibling subdomain, does not pass for the user's.
+func NewCSRFToken(subject string) (string, error) {
+	nonce, err := utils.GenerateOpaqueToken(16)
+	if err != nil {
+		return "", err
+	}
+	return nonce + "." + csrfSignature(subject, nonce), nil
+}
+
+// CheckCSRF reports whether r carries subject's CSRF token both in the CSRF
+// cookie and in the CSRF header.
+func CheckCSRF(r *http.Request, subject string) bool {
+	header := r.Header.Get(CSRFHeader)
+	cookie, err := r.Cookie(CSRFCookie)
+	if header == "" || err != nil || subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) != 1 {
+		return false
+	}
+	nonce, signature, ok := strings.Cut(header, ".")
+	return ok && subtle.ConstantTimeCompare([]byte(signature), []byte(csrfSignature(subject, nonce))) == 1
+}
+
+// Safe reports whether a request method only reads, so needs no CSRF token.
+func Safe(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+func csrfSignature(subject, nonce string) string {
+	return utils.HashSecret("csrf|" + subject + "|" + nonce)
+}
@@ -0,0 +1,72 @@
+package session
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+)
+
+func TestCSRF(t *testing.T) {
+    t.Setenv("JWT_SECRET", "test-secret")
+    token, err := NewCSRFToken("alice")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    request := func(cookie, header string) *http.Request {
+        r := httptest.NewRequest("POST", "/auth/revoke", nil)
+        if cookie != "" {
+            r.AddCookie(&http.Cookie{Name: CSRFCookie, Value: cookie})
+        }
+        if header != "" {
+            r.Header.Set(CSRFHeader, header)
+        }
+        return r
+    }
+
+    if !CheckCSRF(request(token, token), "alice") {
+        t.Error("Expected a matching cookie and header to pass")
+    }
+    if CheckCSRF(request(token, ""), "alice") || CheckCSRF(request("", token), "alice") {
+        t.Error("Expected the token to be needed in both the cookie and the header")
+    }
+    if CheckCSRF(request(token, token), "bob") {
+        t.Error("Expected another user's token to be refused")
+    }
+    forged := "nonce.signature"
+    if CheckCSRF(request(forged, forged), "alice") {
+        t.Error("Expected an unsigned token to be refused")
+    }
+}
+
+func TestSetTokens(t *testing.T) {
+    config := &Config{Enabled: true, Secure: true, SameSite: http.SameSiteStrictMode}
+    w := httptest.NewRecorder()
+    expires := time.Now().Add(time.Hour)
+    config.SetTokens(w, Tokens{Access: "a", AccessExpires: expires, Refresh: "r", RefreshExpires: expires, RefreshPath: "/auth/refresh", CSRF: "c"})
+
+    cookies := map[string]*http.Cookie{}
+    for _, cookie := range w.Result().Cookies() {
+        cookies[cookie.Name] = cookie
+    }
+    if cookies[RefreshCookie].Path != "/auth/refresh" || cookies[AccessCookie].Path != "/" {
+        t.Errorf("Unexpected cookie paths: refresh %q, access %q", cookies[RefreshCookie].Path, cookies[AccessCookie].Path)
+    }
+    if !cookies[AccessCookie].HttpOnly || !cookies[RefreshCookie].HttpOnly || cookies[CSRFCookie].HttpOnly {
+        t.Error("Expected the tokens but not the CSRF token to be HttpOnly")
+    }
+    for name, cookie := range cookies {
+        if !cookie.Secure || cookie.SameSite != http.SameSiteStrictMode {
+            t.Errorf("Expected cookie %s to be Secure and SameSite=Strict", name)
+        }
+    }
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+    t.Setenv("COOKIE_SECURE", "false")
+    t.Setenv("COOKIE_SAMESITE", "none")
+    if _, err := LoadConfigFromEnv(); err == nil {
+        t.Error("Expected SameSite=None without Secure to be refused")
+    }
+}
@@ -1,34 +1,45 @@
 package verify
 
 import (
+	"context"
+	"errors"
 	"strings"
 
+	"github.com/SinisterSup/auth-service/internal/models"
+	"github.com/SinisterSup/auth-service/internal/session"
 	"github.com/SinisterSup/auth-service/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
-func AuthVerify() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(401, gin.H{"error": "authorization header is required"})
-			c.Abort()
-			return
-		}
+// APIKeyAuthenticator checks an API key presented as a bearer token and
+// describes it as access token claims.
+type APIKeyAuthenticator interface {
+	Authenticate(ctx context.Context, token, ip string) (*utils.JWTClaim, error)
+}
 
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(401, gin.H{"error": "invalid authorization header format"})
-			c.Abort()
-			return
-		}
+var apiKeys APIKeyAuthenticator
 
-		tokenString := parts[1]
-		claims, err := utils.ValidateToken(tokenString)
+// AcceptAPIKeys makes AuthVerify accept API keys checked by authenticator
+// alongside JWTs. Call it once at startup, before serving requests.
+func AcceptAPIKeys(authenticator APIKeyAuthenticator) {
+	apiKeys = authenticator
+}
+
+// AuthVerify accepts a bearer access token or API key only within the tenant
+// it was issued for: the one the request was resolved to, or the default
+// tenant on routes that do not resolve tenants. Without an Authorization
+// header it falls back to the access token cookie of a cookie session, and
+// then requires a CSRF token on state-changing requests.
+func AuthVerify() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, tokenString, err := Authenticate(c, c.Request.Method)
 		if err != nil {
 			// log.Printf("Token validation has failed: %v", err)
-			c.JSON(401, gin.H{"error": err.Error()})
+			if err.Challenge != "" {
+				c.Header("WWW-Authenticate", err.Challenge)
+			}
+			c.JSON(err.Status, gin.H{"error": err.Message})
 			c.Abort()
 			return
 		}
@@ -36,8 +47,85 @@ func AuthVerify() gin.HandlerFunc {
 		c.Set("userId", claims.UserId)
 		c.Set("email", claims.Email)
 		c.Set("currentToken", tokenString) 
+		c.Set("claims", claims)
 
 		// log.Printf("Auth verify successful. UserID: %s, Token length: %d", claims.UserId, len(tokenString))
 		c.Next()
 	}
-}
\ No newline at end of file
+}
+
+// AuthError is why Authenticate turned a request away: the status to answer
+// with, the WWW-Authenticate challenge if any, and a message.
+type AuthError struct {
+	Status    int
+	Challenge string
+	Message   string
+}
+
+func (e *AuthError) Error() string {
+	return e.Message
+}
+
+// Authenticate checks a request's credentials the way AuthVerify does, for
+// callers that answer failures their own way. method is the method of the
+// request being authorized, which decides whether a cookie session needs a
+// CSRF token; it differs from c.Request.Method when authorizing on behalf of
+// a proxy.
+func Authenticate(c *gin.Context, method string) (*utils.JWTClaim, string, *AuthError) {
+	authHeader := c.GetHeader("Authorization")
+	fromCookie := false
+	var tokenString string
+	if authHeader == "" {
+		cookie, err := c.Request.Cookie(session.AccessCookie)
+		if err != nil || cookie.Value == "" {
+			return nil, "", &AuthError{401, "Bearer", "authorization header is required"}
+		}
+		tokenString, fromCookie = cookie.Value, true
+	} else {
+		parts := strings.Split(authHeader, " ")
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			return nil, "", &AuthError{401, `Bearer error="invalid_request"`, "invalid authorization header format"}
+		}
+		tokenString = parts[1]
+	}
+
+	claims, authErr := checkToken(c.Request.Context(), tokenString, c.ClientIP(), c.GetString("tenantId"), !fromCookie)
+	if authErr != nil {
+		return nil, "", authErr
+	}
+
+	// Browsers send cookies along with requests other sites make, so a
+	// request that changes something must also prove it came from our own
+	// pages.
+	if fromCookie && !session.Safe(method) && !session.CheckCSRF(c.Request, claims.UserId) {
+		return nil, "", &AuthError{403, "", "missing or invalid CSRF token"}
+	}
+	return claims, tokenString, nil
+}
+
+// CheckBearer checks a bearer access token or API key the way AuthVerify
+// does, for a request resolved to tenant and made from ip.
+func CheckBearer(ctx context.Context, token, ip, tenant string) (*utils.JWTClaim, *AuthError) {
+	return checkToken(ctx, token, ip, tenant, true)
+}
+
+func checkToken(ctx context.Context, token, ip, tenant string, acceptAPIKeys bool) (*utils.JWTClaim, *AuthError) {
+	var claims *utils.JWTClaim
+	var err error
+	if apiKeys != nil && acceptAPIKeys && models.IsAPIKey(token) {
+		claims, err = apiKeys.Authenticate(ctx, token, ip)
+	} else {
+		claims, err = utils.ValidateToken(token)
+	}
+	if errors.Is(err, models.ErrAccountInactive) {
+		return nil, &AuthError{403, "", err.Error()}
+	}
+	if err != nil {
+		return nil, &AuthError{401, `Bearer error="invalid_token"`, err.Error()}
+	}
+
+	if claims.Tenant != tenant {
+		return nil, &AuthError{401, `Bearer error="invalid_token"`, "token was issued for another tenant"}
+	}
+	return claims, nil
+}
@@ -0,0 +1,78 @@
+package verify
+
+import (
+	"github.com/SinisterSup/auth-service/internal/policy"
+	"github.com/SinisterSup/auth-service/internal/scope"
+	"github.com/SinisterSup/auth-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ResourceFunc describes the resource a request acts on to the policy
+// engine, for example by loading it from the :id route parameter. Returning
+// an error answers 404.
+type ResourceFunc func(c *gin.Context) (map[string]interface{}, error)
+
+// Authorize must run after AuthVerify. It asks engine whether the token's
+// subject may perform action on the resource that resource describes, which
+// may be nil for routes with no particular resource. Policies see the
+// request's method, path, route parameters and client IP as context.
+func Authorize(engine *policy.Engine, action string, resource ResourceFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := currentClaims(c)
+		if !ok {
+			return
+		}
+
+		input := policy.Input{Subject: Subject(claims), Action: action, Context: RequestContext(c)}
+		if resource != nil {
+			attributes, err := resource(c)
+			if err != nil {
+				c.JSON(404, gin.H{"error": err.Error()})
+				c.Abort()
+				return
+			}
+			input.Resource = attributes
+		}
+
+		decision := engine.Decide(input)
+		c.Set("decision", decision)
+		if !decision.Allowed {
+			c.JSON(403, gin.H{"error": "access denied"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// Subject describes the holder of an access token to the policy engine.
+func Subject(claims *utils.JWTClaim) map[string]interface{} {
+	return map[string]interface{}{
+		"sub":         claims.UserId,
+		"email":       claims.Email,
+		"roles":       claims.Roles,
+		"permissions": claims.Permissions,
+		"scopes":      scope.Parse(claims.Scope),
+		"tenant":      claims.Tenant,
+		"org":         claims.Org,
+		"org_role":    claims.OrgRole,
+		"key_id":      claims.KeyID,
+		"service":     claims.Service,
+	}
+}
+
+// RequestContext describes the request being authorized to the policy engine.
+func RequestContext(c *gin.Context) map[string]interface{} {
+	params := map[string]interface{}{}
+	for _, param := range c.Params {
+		params[param.Key] = param.Value
+	}
+	return map[string]interface{}{
+		"method": c.Request.Method,
+		"path":   c.Request.URL.Path,
+		"route":  c.FullPath(),
+		"params": params,
+		"ip":     c.ClientIP(),
+	}
+}
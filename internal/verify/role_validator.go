@@ -0,0 +1,110 @@
+package verify
+
+import (
+	"slices"
+
+	"github.com/SinisterSup/auth-service/internal/models"
+	"github.com/SinisterSup/auth-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole must run after AuthVerify. It lets the request through if the
+// access token carries any of roles. AuthVerify rejects tokens issued before
+// the user's roles last changed, so the claims are never stale.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := currentClaims(c)
+		if !ok {
+			return
+		}
+
+		for _, role := range roles {
+			if slices.Contains(claims.Roles, role) {
+				c.Set("roles", claims.Roles)
+				c.Next()
+				return
+			}
+		}
+		c.JSON(403, gin.H{"error": "insufficient role"})
+		c.Abort()
+	}
+}
+
+// RequirePermission must run after AuthVerify. It lets the request through
+// only if the access token grants every one of permissions, directly or
+// through a wildcard such as "reports:*".
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := currentClaims(c)
+		if !ok {
+			return
+		}
+
+		for _, permission := range permissions {
+			if !models.HasPermission(claims.Permissions, permission) {
+				c.JSON(403, gin.H{"error": "missing permission " + permission})
+				c.Abort()
+				return
+			}
+		}
+		c.Set("permissions", claims.Permissions)
+		c.Next()
+	}
+}
+
+// RequireOrgRole must run after AuthVerify. It lets the request through if
+// the access token acts in an organization with any of roles, and, on routes
+// with an :org parameter, only if that is the organization.
+func RequireOrgRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := currentClaims(c)
+		if !ok {
+			return
+		}
+
+		if claims.Org == "" || (c.Param("org") != "" && c.Param("org") != claims.Org) {
+			c.JSON(403, gin.H{"error": "token does not act in this organization"})
+			c.Abort()
+			return
+		}
+		if !slices.Contains(roles, claims.OrgRole) {
+			c.JSON(403, gin.H{"error": "insufficient organization role"})
+			c.Abort()
+			return
+		}
+		c.Set("orgId", claims.Org)
+		c.Set("orgRole", claims.OrgRole)
+		c.Next()
+	}
+}
+
+// RequireSession must run after AuthVerify. It turns away API keys, for
+// routes that create credentials or sessions, which a key should not be able
+// to extend itself into.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := currentClaims(c)
+		if !ok {
+			return
+		}
+
+		if claims.KeyID != "" {
+			c.JSON(403, gin.H{"error": "this requires signing in; API keys are not accepted"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func currentClaims(c *gin.Context) (*utils.JWTClaim, bool) {
+	value, _ := c.Get("claims")
+	claims, ok := value.(*utils.JWTClaim)
+	if !ok {
+		c.JSON(401, gin.H{"error": "claims not found in context"})
+		c.Abort()
+		return nil, false
+	}
+	return claims, true
+}
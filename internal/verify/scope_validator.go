@@ -0,0 +1,40 @@
+package verify
+
+import (
+	"fmt"
+
+	"github.com/SinisterSup/auth-service/internal/scope"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireScopes must run after AuthVerify. It lets the request through only
+// if the access token was granted every one of scopes, and otherwise answers
+// 403 insufficient_scope as RFC 6750 describes, naming the scopes needed.
+func RequireScopes(scopes ...string) gin.HandlerFunc {
+	required := scope.Format(scopes)
+	return func(c *gin.Context) {
+		claims, ok := currentClaims(c)
+		if !ok {
+			return
+		}
+
+		granted := scope.Parse(claims.Scope)
+		if !scope.Contains(granted, scopes...) {
+			description := "the access token does not grant the scope " + required
+			c.Header("WWW-Authenticate", fmt.Sprintf(
+				`Bearer error="insufficient_scope", error_description=%q, scope=%q`,
+				description, required,
+			))
+			c.JSON(403, gin.H{
+				"error":             "insufficient_scope",
+				"error_description": description,
+				"scope":             required,
+			})
+			c.Abort()
+			return
+		}
+		c.Set("scopes", granted)
+		c.Next()
+	}
+}
@@ -1,13 +1,24 @@
 package main
 
 import (
+	"context"
 	"github.com/SinisterSup/auth-service/api/routes"
+	"github.com/SinisterSup/auth-service/api/rpc"
 	"github.com/SinisterSup/auth-service/db"
+	"github.com/SinisterSup/auth-service/internal/extauthz"
+	"github.com/SinisterSup/auth-service/internal/mail"
+	"github.com/SinisterSup/auth-service/internal/ratelimit"
+	"github.com/SinisterSup/auth-service/internal/services"
 	"log"
+	"net"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 func main() {
@@ -15,10 +26,71 @@ func main() {
 		log.Fatal("Error loading the .env file")
 	}
 	db.ConnectDB()
+	if err := db.EnsureIndexes(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	if err := services.NewRoleService().EnsureDefaults(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+
+	// One auth service backs the REST API, the gRPC API and the purger, so
+	// they share the password hashing pool, sign-in lockouts and the
+	// authenticator
+	authService := services.NewAuthService()
+	mailer, err := mail.NewMailer()
+	if err != nil {
+		log.Fatalf("Mail: %v", err)
+	}
+	limiter, err := ratelimit.NewLimiterFromEnv()
+	if err != nil {
+		log.Fatalf("Rate limiting: %v", err)
+	}
+
+	purgeInterval, err := time.ParseDuration(os.Getenv("ACCOUNT_PURGE_INTERVAL"))
+	if err != nil || purgeInterval <= 0 {
+		purgeInterval = time.Hour
+	}
+	services.NewAccountService(authService).StartPurger(context.Background(), purgeInterval)
 
 	router := gin.Default()
+	// Client IPs, which sign-in lockouts and rate limits are keyed on, are
+	// only taken from X-Forwarded-For when the request came through one of
+	// TRUSTED_PROXIES
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	if err := router.SetTrustedProxies(proxies); err != nil {
+		log.Fatalf("Trusted proxies: %v", err)
+	}
 
-	routes.SetupAuthRoutes(router)
+	routes.SetupAuthRoutes(router, authService, mailer, limiter)
+
+	if port := os.Getenv("GRPC_PORT"); port != "" {
+		listener, err := net.Listen("tcp", ":"+port)
+		if err != nil {
+			log.Fatal(err)
+		}
+		authServer := rpc.NewServer(authService, services.NewRegistrationService(authService, mailer), services.NewPasswordlessService(authService, mailer), services.NewAPIKeyService(authService), services.NewTenantService())
+
+		options := []grpc.ServerOption{authServer.Interceptors(limiter)}
+		certFile, keyFile := os.Getenv("GRPC_TLS_CERT_FILE"), os.Getenv("GRPC_TLS_KEY_FILE")
+		if certFile != "" || keyFile != "" {
+			creds, err := credentials.NewServerTLSFromFile(certFile, keyFile)
+			if err != nil {
+				log.Fatalf("gRPC TLS: %v", err)
+			}
+			options = append(options, grpc.Creds(creds))
+		}
+		server := grpc.NewServer(options...)
+		authServer.Register(server)
+		extauthz.NewServer().Register(server)
+		go func() {
+			log.Fatal(server.Serve(listener))
+		}()
+	}
 
 	port := os.Getenv("PORT")
 	if port == "" {
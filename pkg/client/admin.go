@@ -0,0 +1,208 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// The methods in this file call the /admin API and need the tokens of a
+// signed-in admin. API keys are refused there.
+
+func (c *Client) SearchUsers(ctx context.Context, search UserSearch) (*UserPage, error) {
+	query := url.Values{}
+	for name, value := range map[string]string{"email": search.Email, "role": search.Role, "status": search.Status, "tenant": search.Tenant} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	if search.Deleted {
+		query.Set("deleted", "true")
+	}
+	if search.Page > 0 {
+		query.Set("page", strconv.FormatInt(search.Page, 10))
+	}
+	if search.Limit > 0 {
+		query.Set("limit", strconv.FormatInt(search.Limit, 10))
+	}
+
+	var page UserPage
+	if _, err := c.do(ctx, http.MethodGet, "/admin/users", query, nil, &page, true); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+func (c *Client) User(ctx context.Context, id string) (*User, error) {
+	var user User
+	if _, err := c.do(ctx, http.MethodGet, userPath(id), nil, nil, &user, true); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// DisableUser suspends a user, until the given time if it is not nil.
+func (c *Client) DisableUser(ctx context.Context, id, reason string, until *time.Time) error {
+	input := map[string]interface{}{"reason": reason, "until": until}
+	_, err := c.do(ctx, http.MethodPost, userPath(id, "disable"), nil, input, nil, true)
+	return err
+}
+
+func (c *Client) EnableUser(ctx context.Context, id string) error {
+	_, err := c.do(ctx, http.MethodPost, userPath(id, "enable"), nil, nil, nil, true)
+	return err
+}
+
+// SetUserStatus sets a user's account status, such as "active", "locked" or
+// "suspended".
+func (c *Client) SetUserStatus(ctx context.Context, id, status, reason string, until *time.Time) error {
+	input := map[string]interface{}{"status": status, "reason": reason, "until": until}
+	_, err := c.do(ctx, http.MethodPut, userPath(id, "status"), nil, input, nil, true)
+	return err
+}
+
+func (c *Client) UnlockUser(ctx context.Context, id string) error {
+	_, err := c.do(ctx, http.MethodPost, userPath(id, "unlock"), nil, nil, nil, true)
+	return err
+}
+
+func (c *Client) ForcePasswordReset(ctx context.Context, id string) error {
+	_, err := c.do(ctx, http.MethodPost, userPath(id, "force-password-reset"), nil, nil, nil, true)
+	return err
+}
+
+// LogoutUser signs a user out of all their sessions.
+func (c *Client) LogoutUser(ctx context.Context, id string) error {
+	_, err := c.do(ctx, http.MethodPost, userPath(id, "logout"), nil, nil, nil, true)
+	return err
+}
+
+func (c *Client) SetUserRoles(ctx context.Context, id string, roles []string) error {
+	_, err := c.do(ctx, http.MethodPut, userPath(id, "roles"), nil, map[string][]string{"roles": roles}, nil, true)
+	return err
+}
+
+func (c *Client) SetUserPermissions(ctx context.Context, id string, permissions []string) error {
+	_, err := c.do(ctx, http.MethodPut, userPath(id, "permissions"), nil, map[string][]string{"permissions": permissions}, nil, true)
+	return err
+}
+
+// DeleteUser schedules a user for deletion.
+func (c *Client) DeleteUser(ctx context.Context, id string) error {
+	_, err := c.do(ctx, http.MethodDelete, userPath(id), nil, nil, nil, true)
+	return err
+}
+
+// UserAudit returns a user's most recent audit events; limit may be 0 for the
+// service's default.
+func (c *Client) UserAudit(ctx context.Context, id string, limit int) ([]AuditEvent, error) {
+	query := url.Values{}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	var out struct {
+		Events []AuditEvent `json:"events"`
+	}
+	if _, err := c.do(ctx, http.MethodGet, userPath(id, "audit"), query, nil, &out, true); err != nil {
+		return nil, err
+	}
+	return out.Events, nil
+}
+
+// UnlockIP clears the sign-in lockout of an IP address.
+func (c *Client) UnlockIP(ctx context.Context, ip string) error {
+	_, err := c.do(ctx, http.MethodDelete, "/admin/lockouts/"+url.PathEscape(ip), nil, nil, nil, true)
+	return err
+}
+
+func (c *Client) Roles(ctx context.Context) ([]Role, error) {
+	var out struct {
+		Roles []Role `json:"roles"`
+	}
+	if _, err := c.do(ctx, http.MethodGet, "/admin/roles", nil, nil, &out, true); err != nil {
+		return nil, err
+	}
+	return out.Roles, nil
+}
+
+// PutRole creates or replaces a role.
+func (c *Client) PutRole(ctx context.Context, name, description string, permissions []string) (*Role, error) {
+	input := map[string]interface{}{"description": description, "permissions": permissions}
+	var role Role
+	if _, err := c.do(ctx, http.MethodPut, "/admin/roles/"+url.PathEscape(name), nil, input, &role, true); err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (c *Client) DeleteRole(ctx context.Context, name string) error {
+	_, err := c.do(ctx, http.MethodDelete, "/admin/roles/"+url.PathEscape(name), nil, nil, nil, true)
+	return err
+}
+
+func (c *Client) Tenants(ctx context.Context) ([]Tenant, error) {
+	var out struct {
+		Tenants []Tenant `json:"tenants"`
+	}
+	if _, err := c.do(ctx, http.MethodGet, "/admin/tenants", nil, nil, &out, true); err != nil {
+		return nil, err
+	}
+	return out.Tenants, nil
+}
+
+// PutTenant creates or replaces the tenant with tenant.ID.
+func (c *Client) PutTenant(ctx context.Context, tenant Tenant) (*Tenant, error) {
+	input := map[string]interface{}{"name": tenant.Name, "hosts": tenant.Hosts, "settings": tenant.Settings}
+	var out Tenant
+	if _, err := c.do(ctx, http.MethodPut, "/admin/tenants/"+url.PathEscape(tenant.ID), nil, input, &out, true); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) DeleteTenant(ctx context.Context, id string) error {
+	_, err := c.do(ctx, http.MethodDelete, "/admin/tenants/"+url.PathEscape(id), nil, nil, nil, true)
+	return err
+}
+
+// APIKeys lists API keys, optionally only of kind ("personal" or "service")
+// or only those of the user with ID userID.
+func (c *Client) APIKeys(ctx context.Context, kind, userID string) ([]APIKey, error) {
+	query := url.Values{}
+	if kind != "" {
+		query.Set("kind", kind)
+	}
+	if userID != "" {
+		query.Set("user", userID)
+	}
+	var out struct {
+		Keys []APIKey `json:"keys"`
+	}
+	if _, err := c.do(ctx, http.MethodGet, "/admin/api-keys", query, nil, &out, true); err != nil {
+		return nil, err
+	}
+	return out.Keys, nil
+}
+
+func (c *Client) CreateServiceKey(ctx context.Context, input ServiceKeyInput) (*CreatedAPIKey, error) {
+	var key CreatedAPIKey
+	if _, err := c.do(ctx, http.MethodPost, "/admin/api-keys", nil, input, &key, true); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (c *Client) RevokeAPIKey(ctx context.Context, id string) error {
+	_, err := c.do(ctx, http.MethodDelete, "/admin/api-keys/"+url.PathEscape(id), nil, nil, nil, true)
+	return err
+}
+
+func userPath(id string, parts ...string) string {
+	path := "/admin/users/" + url.PathEscape(id)
+	for _, part := range parts {
+		path += "/" + url.PathEscape(part)
+	}
+	return path
+}
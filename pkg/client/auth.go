@@ -0,0 +1,197 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// SignUp starts a registration; the account exists once the emailed token is
+// passed to VerifyEmail.
+func (c *Client) SignUp(ctx context.Context, email, password string) error {
+	_, err := c.do(ctx, http.MethodPost, "/auth/signup", nil, map[string]string{"email": email, "password": password}, nil, false)
+	return err
+}
+
+func (c *Client) VerifyEmail(ctx context.Context, token string) error {
+	_, err := c.do(ctx, http.MethodPost, "/auth/signup/verify", nil, map[string]string{"token": token}, nil, false)
+	return err
+}
+
+// SignIn signs in with a password and acts with the tokens issued from then
+// on. scope may be empty for the default scope. It returns ErrMFARequired
+// when a second factor is needed.
+func (c *Client) SignIn(ctx context.Context, email, password, scope string) (*Tokens, error) {
+	var tokens Tokens
+	input := map[string]string{"email": email, "password": password, "scope": scope}
+	status, err := c.do(ctx, http.MethodPost, "/auth/signin", nil, input, &tokens, false)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusAccepted {
+		return nil, ErrMFARequired
+	}
+	c.setTokens(&tokens)
+	return &tokens, nil
+}
+
+// Refresh exchanges the refresh token for new tokens now. Requests refresh
+// on their own when needed, so this is seldom called directly.
+func (c *Client) Refresh(ctx context.Context) (*Tokens, error) {
+	if err := c.refresh(ctx, c.Tokens().AccessToken); err != nil {
+		return nil, err
+	}
+	tokens := c.Tokens()
+	return &tokens, nil
+}
+
+// Revoke revokes the access token, or the API key, the client acts with and
+// forgets its tokens.
+func (c *Client) Revoke(ctx context.Context) error {
+	if _, err := c.do(ctx, http.MethodPost, "/auth/revoke", nil, nil, nil, true); err != nil {
+		return err
+	}
+	c.SetTokens(Tokens{})
+	return nil
+}
+
+func (c *Client) ForgotPassword(ctx context.Context, email string) error {
+	_, err := c.do(ctx, http.MethodPost, "/auth/password/forgot", nil, map[string]string{"email": email}, nil, false)
+	return err
+}
+
+func (c *Client) ResetPassword(ctx context.Context, token, newPassword string) error {
+	_, err := c.do(ctx, http.MethodPost, "/auth/password/reset", nil, map[string]string{"token": token, "new_password": newPassword}, nil, false)
+	return err
+}
+
+// ChangePassword changes the signed-in user's password. Their tokens stop
+// working, so the client forgets them; sign in again with the new password.
+func (c *Client) ChangePassword(ctx context.Context, currentPassword, newPassword string) error {
+	input := map[string]string{"current_password": currentPassword, "new_password": newPassword}
+	if _, err := c.do(ctx, http.MethodPost, "/auth/password/change", nil, input, nil, true); err != nil {
+		return err
+	}
+	c.SetTokens(Tokens{})
+	return nil
+}
+
+// RequestMagicLink emails a sign-in link and code, to be passed to
+// VerifyMagicLink or VerifyOTP.
+func (c *Client) RequestMagicLink(ctx context.Context, email string) error {
+	_, err := c.do(ctx, http.MethodPost, "/auth/magic-link", nil, map[string]string{"email": email}, nil, false)
+	return err
+}
+
+func (c *Client) VerifyMagicLink(ctx context.Context, token string) (*Tokens, error) {
+	return c.signIn(ctx, "/auth/magic-link/verify", map[string]string{"token": token})
+}
+
+// VerifyOTP signs in with an emailed code, either passwordless or as the
+// second factor after SignIn returned ErrMFARequired.
+func (c *Client) VerifyOTP(ctx context.Context, email, code string) (*Tokens, error) {
+	return c.signIn(ctx, "/auth/otp/verify", map[string]string{"email": email, "code": code})
+}
+
+// AcceptInvitationSignUp accepts an organization invitation for someone
+// without an account, creating one with password and signing them in.
+func (c *Client) AcceptInvitationSignUp(ctx context.Context, token, password string) (*Tokens, error) {
+	return c.signIn(ctx, "/auth/invitations/accept", map[string]string{"token": token, "password": password})
+}
+
+func (c *Client) DeclineInvitation(ctx context.Context, token string) error {
+	_, err := c.do(ctx, http.MethodPost, "/auth/invitations/decline", nil, map[string]string{"token": token}, nil, false)
+	return err
+}
+
+func (c *Client) signIn(ctx context.Context, path string, input interface{}) (*Tokens, error) {
+	var tokens Tokens
+	if _, err := c.do(ctx, http.MethodPost, path, nil, input, &tokens, false); err != nil {
+		return nil, err
+	}
+	c.setTokens(&tokens)
+	return &tokens, nil
+}
+
+func (c *Client) Profile(ctx context.Context) (*Profile, error) {
+	var profile Profile
+	if _, err := c.do(ctx, http.MethodGet, "/protected/profile", nil, nil, &profile, true); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// DeleteAccount schedules the signed-in user's account for deletion.
+func (c *Client) DeleteAccount(ctx context.Context, password string) error {
+	if _, err := c.do(ctx, http.MethodDelete, "/auth/account", nil, map[string]string{"password": password}, nil, true); err != nil {
+		return err
+	}
+	c.SetTokens(Tokens{})
+	return nil
+}
+
+func (c *Client) ExportAccount(ctx context.Context) (*AccountExport, error) {
+	var export AccountExport
+	if _, err := c.do(ctx, http.MethodGet, "/auth/account/export", nil, nil, &export, true); err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+func (c *Client) Identities(ctx context.Context) ([]Identity, error) {
+	var out struct {
+		Identities []Identity `json:"identities"`
+	}
+	if _, err := c.do(ctx, http.MethodGet, "/auth/identities", nil, nil, &out, true); err != nil {
+		return nil, err
+	}
+	return out.Identities, nil
+}
+
+// LinkIdentity returns the URL to send the user's browser to in order to
+// link an account at an OIDC provider to theirs.
+func (c *Client) LinkIdentity(ctx context.Context, provider string) (string, error) {
+	var out struct {
+		AuthorizationURL string `json:"authorization_url"`
+	}
+	if _, err := c.do(ctx, http.MethodPost, "/auth/oidc/"+url.PathEscape(provider)+"/link", nil, nil, &out, true); err != nil {
+		return "", err
+	}
+	return out.AuthorizationURL, nil
+}
+
+func (c *Client) UnlinkIdentity(ctx context.Context, provider, subject string) error {
+	_, err := c.do(ctx, http.MethodDelete, "/auth/identities/"+url.PathEscape(provider)+"/"+url.PathEscape(subject), nil, nil, nil, true)
+	return err
+}
+
+// CreatePersonalToken creates a personal access token. scope may be empty
+// and expiresAt nil for a token that does not expire.
+func (c *Client) CreatePersonalToken(ctx context.Context, name, scope string, expiresAt *time.Time) (*CreatedAPIKey, error) {
+	input := struct {
+		Name      string     `json:"name"`
+		Scope     string     `json:"scope,omitempty"`
+		ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	}{name, scope, expiresAt}
+	var key CreatedAPIKey
+	if _, err := c.do(ctx, http.MethodPost, "/auth/tokens", nil, input, &key, true); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (c *Client) PersonalTokens(ctx context.Context) ([]APIKey, error) {
+	var out struct {
+		Tokens []APIKey `json:"tokens"`
+	}
+	if _, err := c.do(ctx, http.MethodGet, "/auth/tokens", nil, nil, &out, true); err != nil {
+		return nil, err
+	}
+	return out.Tokens, nil
+}
+
+func (c *Client) RevokePersonalToken(ctx context.Context, id string) error {
+	_, err := c.do(ctx, http.MethodDelete, "/auth/tokens/"+url.PathEscape(id), nil, nil, nil, true)
+	return err
+}
@@ -0,0 +1,200 @@
+// Package client calls the auth service's REST API from Go. A Client keeps
+// the tokens it signed in with and refreshes the access token before it
+// expires, or once when the service rejects it, so callers need not.
+//
+//	c := client.New("https://auth.example.com", client.Options{})
+//	if _, err := c.SignIn(ctx, "alice@example.com", password, ""); err != nil { ... }
+//	profile, err := c.Profile(ctx)
+//
+// Error answers are returned as *Error, which errors.Is matches against
+// ErrUnauthorized, ErrForbidden and the other sentinels by status code.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// refreshBefore is how long before the access token expires it is refreshed.
+const refreshBefore = 30 * time.Second
+
+type Options struct {
+	HTTPClient *http.Client
+	// Tenant, if set, is sent in TenantHeader ("X-Tenant-ID" by default) with
+	// every request.
+	Tenant       string
+	TenantHeader string
+	// OnTokens is called with the new tokens after every sign-in and refresh,
+	// for example to persist them. It is not called by SetTokens.
+	OnTokens func(Tokens)
+}
+
+type Client struct {
+	baseURL string
+	options Options
+
+	mu     sync.Mutex
+	tokens Tokens
+	// refreshMu makes concurrent requests share one refresh, since a refresh
+	// token can only be used once.
+	refreshMu sync.Mutex
+}
+
+// New returns a client for the service at baseURL, such as
+// "https://auth.example.com".
+func New(baseURL string, options Options) *Client {
+	if options.HTTPClient == nil {
+		options.HTTPClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	if options.TenantHeader == "" {
+		options.TenantHeader = "X-Tenant-ID"
+	}
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), options: options}
+}
+
+// SetTokens makes the client act with tokens, such as ones saved from an
+// earlier session. A personal access token or service API key can be set as
+// the access token alone; it is never refreshed.
+func (c *Client) SetTokens(tokens Tokens) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens = tokens
+}
+
+// Tokens returns the tokens the client currently acts with.
+func (c *Client) Tokens() Tokens {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tokens
+}
+
+// setTokens stores tokens the service issued and tells OnTokens.
+func (c *Client) setTokens(tokens *Tokens) {
+	c.SetTokens(*tokens)
+	if c.options.OnTokens != nil {
+		c.options.OnTokens(*tokens)
+	}
+}
+
+// accessToken returns the access token to send, refreshing it first if it is
+// about to expire.
+func (c *Client) accessToken(ctx context.Context) (string, error) {
+	tokens := c.Tokens()
+	if tokens.RefreshToken != "" && expiresSoon(tokens.AccessToken) {
+		if err := c.refresh(ctx, tokens.AccessToken); err != nil {
+			return "", err
+		}
+		tokens = c.Tokens()
+	}
+	return tokens.AccessToken, nil
+}
+
+// refresh exchanges the refresh token for new tokens, unless another request
+// already replaced stale while this one waited.
+func (c *Client) refresh(ctx context.Context, stale string) error {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	tokens := c.Tokens()
+	if tokens.AccessToken != stale {
+		return nil
+	}
+
+	var refreshed Tokens
+	input := map[string]string{"refresh_token": tokens.RefreshToken}
+	if _, err := c.do(ctx, http.MethodPost, "/auth/refresh", nil, input, &refreshed, false); err != nil {
+		return err
+	}
+	c.setTokens(&refreshed)
+	return nil
+}
+
+func expiresSoon(token string) bool {
+	claims := jwt.RegisteredClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, &claims); err != nil || claims.ExpiresAt == nil {
+		// API keys are not JWTs and do not expire this way.
+		return false
+	}
+	return time.Until(claims.ExpiresAt.Time) < refreshBefore
+}
+
+// call makes an authenticated request. If the service rejects the access
+// token, it is refreshed and the request retried once.
+func (c *Client) call(ctx context.Context, method, path string, query url.Values, in, out interface{}) (int, error) {
+	token, err := c.accessToken(ctx)
+	if err != nil {
+		return 0, err
+	}
+	status, err := c.send(ctx, method, path, query, in, out, token)
+	if status != http.StatusUnauthorized || c.Tokens().RefreshToken == "" {
+		return status, err
+	}
+	if err := c.refresh(ctx, token); err != nil {
+		return status, err
+	}
+	return c.send(ctx, method, path, query, in, out, c.Tokens().AccessToken)
+}
+
+// do makes a request, authenticated if authed is set.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out interface{}, authed bool) (int, error) {
+	if authed {
+		return c.call(ctx, method, path, query, in, out)
+	}
+	return c.send(ctx, method, path, query, in, out, "")
+}
+
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, in, out interface{}, token string) (int, error) {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return 0, err
+		}
+		body = bytes.NewReader(data)
+	}
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if c.options.Tenant != "" {
+		req.Header.Set(c.options.TenantHeader, c.options.Tenant)
+	}
+
+	resp, err := c.options.HTTPClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if resp.StatusCode >= 400 {
+		return resp.StatusCode, errorFromResponse(resp, data)
+	}
+	if out != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return resp.StatusCode, err
+		}
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,172 @@
+package client
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/golang-jwt/jwt/v5"
+)
+
+// fakeService issues tokens and accepts only the access token it issued
+// last, like the auth service after a refresh.
+type fakeService struct {
+    mu        sync.Mutex
+    lifetime  time.Duration
+    access    string
+    refresh   string
+    refreshes int
+}
+
+func (s *fakeService) issue(w http.ResponseWriter) {
+    s.access, _ = jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+        ID:        time.Now().String(),
+        ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.lifetime)),
+    }).SignedString([]byte("secret"))
+    s.refresh = "refresh-" + s.access[len(s.access)-8:]
+    json.NewEncoder(w).Encode(Tokens{AccessToken: s.access, RefreshToken: s.refresh})
+}
+
+func (s *fakeService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    var input map[string]string
+    json.NewDecoder(r.Body).Decode(&input)
+
+    switch r.URL.Path {
+    case "/auth/signin":
+        switch input["password"] {
+        case "mfa":
+            w.WriteHeader(http.StatusAccepted)
+            json.NewEncoder(w).Encode(map[string]interface{}{"mfa_required": true})
+        case "locked":
+            w.Header().Set("Retry-After", "60")
+            w.WriteHeader(http.StatusTooManyRequests)
+            json.NewEncoder(w).Encode(map[string]string{"error": "too many failed sign-in attempts"})
+        default:
+            s.issue(w)
+        }
+    case "/auth/refresh":
+        if input["refresh_token"] != s.refresh {
+            w.WriteHeader(http.StatusUnauthorized)
+            json.NewEncoder(w).Encode(map[string]string{"error": "invalid refresh token"})
+            return
+        }
+        s.refreshes++
+        s.issue(w)
+    case "/auth/password/change":
+        w.WriteHeader(http.StatusBadRequest)
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "error":      "password does not meet the policy",
+            "violations": []Violation{{Code: "too_short", Message: "must be at least 12 characters"}},
+        })
+    case "/protected/profile":
+        if r.Header.Get("Authorization") != "Bearer "+s.access || r.Header.Get("X-Tenant-ID") != "acme" {
+            w.WriteHeader(http.StatusUnauthorized)
+            json.NewEncoder(w).Encode(map[string]string{"error": "invalid token"})
+            return
+        }
+        json.NewEncoder(w).Encode(Profile{UserID: "u1", Email: "alice@example.com"})
+    default:
+        w.WriteHeader(http.StatusNotFound)
+    }
+}
+
+func newTestClient(t *testing.T, lifetime time.Duration) (*Client, *fakeService) {
+    service := &fakeService{lifetime: lifetime}
+    server := httptest.NewServer(service)
+    t.Cleanup(server.Close)
+    return New(server.URL, Options{Tenant: "acme"}), service
+}
+
+func TestClientRefreshes(t *testing.T) {
+    c, service := newTestClient(t, time.Hour)
+    ctx := context.Background()
+    var saved []Tokens
+    c.options.OnTokens = func(tokens Tokens) { saved = append(saved, tokens) }
+
+    if _, err := c.SignIn(ctx, "alice@example.com", "password", ""); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := c.Profile(ctx); err != nil {
+        t.Fatal(err)
+    }
+    if service.refreshes != 0 {
+        t.Errorf("Expected no refresh while the token is fresh, got %d", service.refreshes)
+    }
+
+    // The service no longer accepts the access token, as after a revocation
+    // of it alone: the client refreshes and retries.
+    service.access = "revoked"
+    profile, err := c.Profile(ctx)
+    if err != nil || profile.UserID != "u1" {
+        t.Fatalf("Expected the request to be retried after refreshing, got %v, %v", profile, err)
+    }
+    if service.refreshes != 1 || len(saved) != 2 || c.Tokens() != saved[1] {
+        t.Errorf("Expected one refresh reported to OnTokens, got %d refreshes and %d saves", service.refreshes, len(saved))
+    }
+
+    // Without a usable refresh token the 401 is returned.
+    service.access, service.refresh = "revoked", "revoked"
+    if _, err := c.Profile(ctx); !errors.Is(err, ErrUnauthorized) {
+        t.Errorf("Expected ErrUnauthorized, got %v", err)
+    }
+}
+
+func TestClientRefreshesBeforeExpiry(t *testing.T) {
+    c, service := newTestClient(t, 10*time.Second)
+    ctx := context.Background()
+    if _, err := c.SignIn(ctx, "alice@example.com", "password", ""); err != nil {
+        t.Fatal(err)
+    }
+
+    var wg sync.WaitGroup
+    for i := 0; i < 5; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            if _, err := c.Profile(ctx); err != nil {
+                t.Error(err)
+            }
+        }()
+    }
+    wg.Wait()
+    // Each refresh issues another short-lived token, so every request may
+    // refresh once, but concurrent requests share a refresh.
+    if service.refreshes < 1 || service.refreshes > 5 {
+        t.Errorf("Expected the expiring token to be refreshed, got %d refreshes", service.refreshes)
+    }
+}
+
+func TestClientErrors(t *testing.T) {
+    c, _ := newTestClient(t, time.Hour)
+    ctx := context.Background()
+
+    if _, err := c.SignIn(ctx, "alice@example.com", "mfa", ""); err != ErrMFARequired {
+        t.Errorf("Expected ErrMFARequired, got %v", err)
+    }
+
+    _, err := c.SignIn(ctx, "alice@example.com", "locked", "")
+    var apiErr *Error
+    if !errors.Is(err, ErrRateLimited) || !errors.As(err, &apiErr) || apiErr.RetryAfter != time.Minute {
+        t.Errorf("Expected a rate limit error with Retry-After, got %#v", err)
+    }
+
+    c.SetTokens(Tokens{AccessToken: "aspat_token"})
+    err = c.ChangePassword(ctx, "old", "short")
+    if !errors.Is(err, ErrBadRequest) || !errors.As(err, &apiErr) || len(apiErr.Violations) != 1 {
+        t.Errorf("Expected the policy violations, got %#v", err)
+    }
+    if !strings.Contains(err.Error(), "400 password does not meet the policy") {
+        t.Errorf("Unexpected message %q", err.Error())
+    }
+    if _, err := c.Roles(ctx); !errors.Is(err, ErrNotFound) {
+        t.Errorf("Expected ErrNotFound, got %v", err)
+    }
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Errors an *Error matches with errors.Is, by status code.
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrRateLimited  = errors.New("rate limited")
+	ErrUnavailable  = errors.New("service unavailable")
+)
+
+// ErrMFARequired is returned by SignIn when the tenant requires a second
+// factor. A code has been emailed to the user; finish with VerifyOTP.
+var ErrMFARequired = errors.New("a sign-in code has been sent; verify it to finish signing in")
+
+// Violation is a password policy rule a new password broke.
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error is an error answer from the auth service.
+type Error struct {
+	StatusCode int
+	Message    string
+	// Description details OAuth-style errors such as invalid_scope.
+	Description string
+	Violations  []Violation
+	// RetryAfter is how long to wait before retrying a 429 or 503 answer,
+	// when the service said.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	message := e.Message
+	if message == "" {
+		message = http.StatusText(e.StatusCode)
+	}
+	if e.Description != "" {
+		message += ": " + e.Description
+	}
+	return fmt.Sprintf("auth service: %d %s", e.StatusCode, message)
+}
+
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrUnavailable:
+		return e.StatusCode == http.StatusServiceUnavailable
+	}
+	return false
+}
+
+func errorFromResponse(resp *http.Response, body []byte) *Error {
+	var payload struct {
+		Error       string      `json:"error"`
+		Description string      `json:"error_description"`
+		Violations  []Violation `json:"violations"`
+	}
+	json.Unmarshal(body, &payload)
+
+	e := &Error{
+		StatusCode:  resp.StatusCode,
+		Message:     payload.Error,
+		Description: payload.Description,
+		Violations:  payload.Violations,
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		e.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return e
+}
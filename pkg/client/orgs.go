@@ -0,0 +1,109 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+func (c *Client) CreateOrganization(ctx context.Context, name string) (*Organization, error) {
+	var org Organization
+	if _, err := c.do(ctx, http.MethodPost, "/orgs", nil, map[string]string{"name": name}, &org, true); err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// Organizations lists the organizations the signed-in user belongs to, with
+// their role in each.
+func (c *Client) Organizations(ctx context.Context) ([]Organization, error) {
+	var out struct {
+		Organizations []Organization `json:"organizations"`
+	}
+	if _, err := c.do(ctx, http.MethodGet, "/orgs", nil, nil, &out, true); err != nil {
+		return nil, err
+	}
+	return out.Organizations, nil
+}
+
+// SwitchOrganization gets tokens acting in the organization orgID, or in none
+// when it is empty, and acts with them from then on.
+func (c *Client) SwitchOrganization(ctx context.Context, orgID string) (*Tokens, error) {
+	var tokens Tokens
+	if _, err := c.do(ctx, http.MethodPost, "/orgs/switch", nil, map[string]string{"org_id": orgID}, &tokens, true); err != nil {
+		return nil, err
+	}
+	c.setTokens(&tokens)
+	return &tokens, nil
+}
+
+// AcceptInvitation accepts an invitation for the signed-in user.
+func (c *Client) AcceptInvitation(ctx context.Context, token string) (*Membership, error) {
+	var membership Membership
+	if _, err := c.do(ctx, http.MethodPost, "/orgs/invitations/accept", nil, map[string]string{"token": token}, &membership, true); err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+func (c *Client) Members(ctx context.Context, orgID string) ([]Membership, error) {
+	var out struct {
+		Members []Membership `json:"members"`
+	}
+	if _, err := c.do(ctx, http.MethodGet, orgPath(orgID, "members"), nil, nil, &out, true); err != nil {
+		return nil, err
+	}
+	return out.Members, nil
+}
+
+func (c *Client) UpdateMember(ctx context.Context, orgID, userID, role string) error {
+	_, err := c.do(ctx, http.MethodPut, orgPath(orgID, "members", userID), nil, map[string]string{"role": role}, nil, true)
+	return err
+}
+
+func (c *Client) RemoveMember(ctx context.Context, orgID, userID string) error {
+	_, err := c.do(ctx, http.MethodDelete, orgPath(orgID, "members", userID), nil, nil, nil, true)
+	return err
+}
+
+func (c *Client) InviteMember(ctx context.Context, orgID, email, role string) (*Invitation, error) {
+	var invitation Invitation
+	if _, err := c.do(ctx, http.MethodPost, orgPath(orgID, "invitations"), nil, map[string]string{"email": email, "role": role}, &invitation, true); err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+func (c *Client) Invitations(ctx context.Context, orgID string) ([]Invitation, error) {
+	var out struct {
+		Invitations []Invitation `json:"invitations"`
+	}
+	if _, err := c.do(ctx, http.MethodGet, orgPath(orgID, "invitations"), nil, nil, &out, true); err != nil {
+		return nil, err
+	}
+	return out.Invitations, nil
+}
+
+func (c *Client) RevokeInvitation(ctx context.Context, orgID, invitationID string) error {
+	_, err := c.do(ctx, http.MethodDelete, orgPath(orgID, "invitations", invitationID), nil, nil, nil, true)
+	return err
+}
+
+// Check asks whether the signed-in user may take action on resource under
+// the service's policies. attributes are sent as the request's context.
+func (c *Client) Check(ctx context.Context, action string, resource, attributes map[string]interface{}) (*Decision, error) {
+	input := map[string]interface{}{"action": action, "resource": resource, "context": attributes}
+	var decision Decision
+	if _, err := c.do(ctx, http.MethodPost, "/authz/check", nil, input, &decision, true); err != nil {
+		return nil, err
+	}
+	return &decision, nil
+}
+
+func orgPath(orgID string, parts ...string) string {
+	path := "/orgs/" + url.PathEscape(orgID)
+	for _, part := range parts {
+		path += "/" + url.PathEscape(part)
+	}
+	return path
+}
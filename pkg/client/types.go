@@ -0,0 +1,178 @@
+package client
+
+import "time"
+
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+type Profile struct {
+	UserID string `json:"user_id"`
+	Email  string `json:"email"`
+}
+
+type Identity struct {
+	Provider string    `json:"provider"`
+	Subject  string    `json:"subject"`
+	Email    string    `json:"email,omitempty"`
+	LinkedAt time.Time `json:"linked_at"`
+}
+
+type User struct {
+	ID                    string     `json:"id"`
+	TenantID              string     `json:"tenant_id,omitempty"`
+	Email                 string     `json:"email"`
+	Name                  string     `json:"name,omitempty"`
+	Roles                 []string   `json:"roles,omitempty"`
+	Permissions           []string   `json:"permissions,omitempty"`
+	Status                string     `json:"status,omitempty"`
+	StatusReason          string     `json:"status_reason,omitempty"`
+	StatusUntil           *time.Time `json:"status_until,omitempty"`
+	PasswordResetRequired bool       `json:"password_reset_required,omitempty"`
+	Identities            []Identity `json:"identities,omitempty"`
+	DeletedAt             *time.Time `json:"deleted_at,omitempty"`
+	PurgeAfter            *time.Time `json:"purge_after,omitempty"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
+}
+
+type UserSearch struct {
+	Email   string
+	Role    string
+	Status  string
+	Tenant  string
+	Deleted bool
+	Page    int64
+	Limit   int64
+}
+
+type UserPage struct {
+	Users []User `json:"users"`
+	Page  int64  `json:"page"`
+	Limit int64  `json:"limit"`
+	Total int64  `json:"total"`
+}
+
+type AuditEvent struct {
+	ID        string                 `json:"id"`
+	UserID    string                 `json:"user_id,omitempty"`
+	ActorID   string                 `json:"actor_id,omitempty"`
+	Action    string                 `json:"action"`
+	Email     string                 `json:"email,omitempty"`
+	IP        string                 `json:"ip,omitempty"`
+	UserAgent string                 `json:"user_agent,omitempty"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+type SessionExport struct {
+	Kind      string     `json:"kind"`
+	IssuedAt  *time.Time `json:"issued_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// AccountExport is everything the service holds about the signed-in user.
+// Login challenges are left as JSON.
+type AccountExport struct {
+	ExportedAt      time.Time                `json:"exported_at"`
+	User            User                     `json:"user"`
+	Sessions        []SessionExport          `json:"sessions"`
+	LoginChallenges []map[string]interface{} `json:"login_challenges"`
+	AuditEvents     []AuditEvent             `json:"audit_events"`
+}
+
+type Role struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type TenantSettings struct {
+	PasswordMinLength *int `json:"password_min_length,omitempty"`
+	PasswordMinScore  *int `json:"password_min_score,omitempty"`
+	RequireMFA        bool `json:"require_mfa,omitempty"`
+	// Token lifetimes are Go durations such as "15m" or "72h".
+	AccessTokenLifetime  string `json:"access_token_lifetime,omitempty"`
+	RefreshTokenLifetime string `json:"refresh_token_lifetime,omitempty"`
+}
+
+type Tenant struct {
+	ID        string         `json:"id"`
+	Name      string         `json:"name,omitempty"`
+	Hosts     []string       `json:"hosts,omitempty"`
+	Settings  TenantSettings `json:"settings"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+type Organization struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Role is the caller's role, set when listing their organizations.
+	Role string `json:"role,omitempty"`
+}
+
+type Membership struct {
+	OrgID     string    `json:"org_id"`
+	UserID    string    `json:"user_id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Invitation struct {
+	ID        string    `json:"id"`
+	OrgID     string    `json:"org_id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	InvitedBy string    `json:"invited_by"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type APIKey struct {
+	ID          string     `json:"id"`
+	Kind        string     `json:"kind"`
+	Tenant      string     `json:"tenant,omitempty"`
+	UserID      string     `json:"user_id,omitempty"`
+	Service     string     `json:"service,omitempty"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"`
+	Scopes      []string   `json:"scopes,omitempty"`
+	Permissions []string   `json:"permissions,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP  string     `json:"last_used_ip,omitempty"`
+	CreatedBy   string     `json:"created_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+}
+
+// CreatedAPIKey is a new key with its token, which is only ever shown once.
+type CreatedAPIKey struct {
+	APIKey
+	Token string `json:"token"`
+}
+
+type ServiceKeyInput struct {
+	Name        string     `json:"name"`
+	Service     string     `json:"service"`
+	Tenant      string     `json:"tenant,omitempty"`
+	Permissions []string   `json:"permissions,omitempty"`
+	Scope       string     `json:"scope,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+type Decision struct {
+	Allowed bool   `json:"allowed"`
+	Policy  string `json:"policy,omitempty"`
+	Reason  string `json:"reason"`
+}
@@ -0,0 +1,125 @@
+package jwk
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// Cache holds the keys last fetched from a JWKS URL. When a fetch fails the
+// keys already held keep being used. Fetches happen outside the lock and
+// concurrent ones are shared, so a slow issuer only holds up tokens naming a
+// key the cache has never seen; stale keys are served while they are
+// refreshed in the background.
+type Cache struct {
+	url    string
+	client *http.Client
+	// ttl is how long fetched keys are used before fetching them again. A
+	// token naming an unknown key triggers a fetch sooner, at most every
+	// minRefresh.
+	ttl        time.Duration
+	minRefresh time.Duration
+	group      singleflight.Group
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+}
+
+func NewCache(url string, client *http.Client, ttl, minRefresh time.Duration) *Cache {
+	return &Cache{url: url, client: client, ttl: ttl, minRefresh: minRefresh}
+}
+
+// Key returns the key named kid. A token without a kid gets the only key of
+// a set that has just one.
+func (c *Cache) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	c.mu.Lock()
+	key, known := c.lookup(kid)
+	stale := time.Since(c.fetchedAt) > c.ttl
+	throttled := time.Since(c.attemptedAt) < c.minRefresh
+	c.mu.Unlock()
+
+	switch {
+	case known && !stale:
+		return key, nil
+	case known:
+		if !throttled {
+			go c.refresh(context.Background())
+		}
+		return key, nil
+	case throttled:
+		return nil, ErrUnknownKey
+	}
+
+	if err := c.refresh(ctx); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if key, ok := c.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+func (c *Cache) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(c.keys) == 1 {
+		for _, key := range c.keys {
+			return key, true
+		}
+	}
+	key, ok := c.keys[kid]
+	return key, ok
+}
+
+// refresh fetches the keys, sharing a fetch already under way. The fetch is
+// not cancelled with ctx, since other callers may be waiting on it.
+func (c *Cache) refresh(ctx context.Context) error {
+	_, err, _ := c.group.Do("jwks", func() (interface{}, error) {
+		keys, err := c.fetch(context.WithoutCancel(ctx))
+
+		// The attempt is recorded once it is over, so callers arriving
+		// meanwhile wait for it rather than being throttled.
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.attemptedAt = time.Now()
+		if err != nil {
+			return nil, err
+		}
+		c.keys, c.fetchedAt = keys, c.attemptedAt
+		return nil, nil
+	})
+	return err
+}
+
+func (c *Cache) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching JWKS: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching JWKS: %s", resp.Status)
+	}
+
+	var set Set
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %v", err)
+	}
+	return set.PublicKeys(), nil
+}
@@ -0,0 +1,47 @@
+package jwk
+
+import (
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/rsa"
+    "testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+    rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+    if err != nil {
+        t.Fatal(err)
+    }
+    ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var set Set
+    for kid, public := range map[string]interface{}{"rsa": &rsaKey.PublicKey, "ec": &ecKey.PublicKey} {
+        key, err := New(kid, "", public)
+        if err != nil {
+            t.Fatal(err)
+        }
+        set.Keys = append(set.Keys, key)
+    }
+    keys := set.PublicKeys()
+    if !rsaKey.PublicKey.Equal(keys["rsa"]) || !ecKey.PublicKey.Equal(keys["ec"]) {
+        t.Errorf("Expected both keys to decode to themselves, got %v", keys)
+    }
+}
+
+func TestPublicKeysSkipsUnusableKeys(t *testing.T) {
+    set := Set{Keys: []Key{
+        {Kty: "RSA", Kid: "enc", Use: "enc", N: "AQAB", E: "AQAB"},
+        {Kty: "oct", Kid: "secret"},
+        {Kty: "EC", Kid: "curve", Crv: "P-192"},
+        {Kty: "RSA", Kid: "broken", N: "!!", E: "AQAB"},
+        {Kty: "RSA", Kid: "ok", N: "AQAB", E: "AQAB"},
+    }}
+    keys := set.PublicKeys()
+    if _, ok := keys["ok"]; !ok || len(keys) != 1 {
+        t.Errorf("Expected only the usable signature key, got %v", keys)
+    }
+}
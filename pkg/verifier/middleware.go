@@ -0,0 +1,89 @@
+package verifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type contextKey struct{}
+
+var errInvalidHeader = errors.New("invalid authorization header format")
+
+// ClaimsFromContext returns the claims Middleware or Gin verified for the
+// request with this context.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(contextKey{}).(*Claims)
+	return claims, ok
+}
+
+// Middleware lets through requests with a valid bearer token in the
+// Authorization header, answering others 401 like the auth service does.
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := v.verifyRequest(r)
+		if err != nil {
+			status, challenge := failure(err)
+			if challenge != "" {
+				w.Header().Set("WWW-Authenticate", challenge)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, claims)))
+	})
+}
+
+// Gin is Middleware for gin. Like the auth service's own middleware it sets
+// "claims", "userId" and "email" on the gin context.
+func (v *Verifier) Gin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := v.verifyRequest(c.Request)
+		if err != nil {
+			status, challenge := failure(err)
+			if challenge != "" {
+				c.Header("WWW-Authenticate", challenge)
+			}
+			c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), contextKey{}, claims))
+		c.Set("claims", claims)
+		c.Set("userId", claims.UserID)
+		c.Set("email", claims.Email)
+		c.Next()
+	}
+}
+
+func (v *Verifier) verifyRequest(r *http.Request) (*Claims, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return nil, ErrNoToken
+	}
+	parts := strings.Split(header, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return nil, errInvalidHeader
+	}
+	return v.Verify(r.Context(), parts[1])
+}
+
+// failure picks the status and WWW-Authenticate challenge for a failed
+// verification. Errors that are not the token's fault, such as a revocation
+// check that could not be made, answer 503.
+func failure(err error) (int, string) {
+	switch {
+	case errors.Is(err, ErrNoToken):
+		return http.StatusUnauthorized, "Bearer"
+	case errors.Is(err, ErrInvalidToken), errors.Is(err, ErrExpired), errors.Is(err, ErrRevoked), errors.Is(err, ErrWrongTenant):
+		return http.StatusUnauthorized, `Bearer error="invalid_token"`
+	case errors.Is(err, errInvalidHeader):
+		return http.StatusUnauthorized, `Bearer error="invalid_request"`
+	}
+	return http.StatusServiceUnavailable, ""
+}
@@ -0,0 +1,163 @@
+// Package verifier checks access tokens issued by the auth service without
+// calling it for every request. Signatures are checked against the keys the
+// service publishes at /.well-known/jwks.json, which are cached; whether a
+// token has been revoked early is left to a pluggable RevocationChecker.
+//
+//	v, err := verifier.New(verifier.Config{JWKSURL: "https://auth.example.com/.well-known/jwks.json"})
+//	mux.Handle("/reports", v.Middleware(reportsHandler))
+package verifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/SinisterSup/auth-service/pkg/jwk"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrNoToken      = errors.New("no bearer token")
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpired      = errors.New("token expired")
+	ErrRevoked      = errors.New("token has been revoked")
+	ErrWrongTenant  = errors.New("token was issued for another tenant")
+)
+
+// tokenTypeAccess is the typ claim of access tokens. Refresh tokens carry
+// "refresh" and are signed with the same secret, so Verify checks it.
+const tokenTypeAccess = "access"
+
+// Claims are the claims of an access token issued by the auth service.
+type Claims struct {
+	UserID      string   `json:"user_id"`
+	Email       string   `json:"email"`
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	// Scope is the space-separated OAuth scope the token was granted.
+	Scope string `json:"scope,omitempty"`
+	// Tenant is empty for the default tenant.
+	Tenant  string `json:"tenant,omitempty"`
+	Org     string `json:"org,omitempty"`
+	OrgRole string `json:"org_role,omitempty"`
+	// Type is "access" for access tokens.
+	Type string `json:"typ,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// RevocationChecker reports whether a token that is otherwise valid has been
+// revoked, for example by looking its ID up in a shared store or asking the
+// auth service. Errors fail the verification.
+type RevocationChecker interface {
+	Revoked(ctx context.Context, token string, claims *Claims) (bool, error)
+}
+
+// RevocationFunc adapts a function to RevocationChecker.
+type RevocationFunc func(ctx context.Context, token string, claims *Claims) (bool, error)
+
+func (f RevocationFunc) Revoked(ctx context.Context, token string, claims *Claims) (bool, error) {
+	return f(ctx, token, claims)
+}
+
+type Config struct {
+	// JWKSURL is where the auth service publishes its keys.
+	JWKSURL string
+	// Secret, if set, also accepts HS256 tokens signed with the service's
+	// JWT_SECRET, for services trusted with it.
+	Secret []byte
+	// Tenant is the tenant tokens must belong to; empty accepts the default
+	// tenant only.
+	Tenant string
+	// Revocation, if set, is asked about every token that passes the other
+	// checks.
+	Revocation RevocationChecker
+	HTTPClient *http.Client
+	// CacheTTL is how long fetched keys are used before fetching them again;
+	// 5 minutes by default. A token naming an unknown key triggers a fetch
+	// sooner, at most every MinRefreshInterval (30 seconds by default).
+	CacheTTL           time.Duration
+	MinRefreshInterval time.Duration
+	// Leeway allows for clock skew when checking expiry.
+	Leeway time.Duration
+}
+
+type Verifier struct {
+	config Config
+	// keys is nil without a JWKS URL.
+	keys   *jwk.Cache
+	parser *jwt.Parser
+}
+
+func New(config Config) (*Verifier, error) {
+	if config.JWKSURL == "" && len(config.Secret) == 0 {
+		return nil, errors.New("verifier needs a JWKS URL or a secret")
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if config.CacheTTL <= 0 {
+		config.CacheTTL = 5 * time.Minute
+	}
+	if config.MinRefreshInterval <= 0 {
+		config.MinRefreshInterval = 30 * time.Second
+	}
+
+	methods := []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}
+	if len(config.Secret) > 0 {
+		methods = append(methods, "HS256")
+	}
+	v := &Verifier{
+		config: config,
+		parser: jwt.NewParser(jwt.WithValidMethods(methods), jwt.WithLeeway(config.Leeway), jwt.WithExpirationRequired()),
+	}
+	if config.JWKSURL != "" {
+		v.keys = jwk.NewCache(config.JWKSURL, config.HTTPClient, config.CacheTTL, config.MinRefreshInterval)
+	}
+	return v, nil
+}
+
+// Verify checks token's signature, expiry, type and tenant, and then asks the
+// revocation checker, if any.
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	if token == "" {
+		return nil, ErrNoToken
+	}
+
+	claims := &Claims{}
+	_, err := v.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); ok {
+			return v.config.Secret, nil
+		}
+		if v.keys == nil {
+			return nil, jwk.ErrUnknownKey
+		}
+		kid, _ := t.Header["kid"].(string)
+		return v.keys.Key(ctx, kid)
+	})
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, ErrExpired
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if claims.Type != tokenTypeAccess {
+		return nil, fmt.Errorf("%w: not an access token", ErrInvalidToken)
+	}
+
+	if claims.Tenant != v.config.Tenant {
+		return nil, ErrWrongTenant
+	}
+	if v.config.Revocation != nil {
+		revoked, err := v.config.Revocation.Revoked(ctx, token, claims)
+		if err != nil {
+			return nil, fmt.Errorf("error checking token status: %w", err)
+		}
+		if revoked {
+			return nil, ErrRevoked
+		}
+	}
+	return claims, nil
+}
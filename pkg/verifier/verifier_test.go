@@ -0,0 +1,254 @@
+package verifier
+
+import (
+    "context"
+    "crypto/rand"
+    "crypto/rsa"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "github.com/SinisterSup/auth-service/pkg/jwk"
+
+    "github.com/gin-gonic/gin"
+    "github.com/golang-jwt/jwt/v5"
+)
+
+type testIssuer struct {
+    keys    map[string]*rsa.PrivateKey
+    fetches atomic.Int32
+}
+
+func (i *testIssuer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    i.fetches.Add(1)
+    var set jwk.Set
+    for kid, key := range i.keys {
+        public, _ := jwk.New(kid, "RS256", &key.PublicKey)
+        set.Keys = append(set.Keys, public)
+    }
+    json.NewEncoder(w).Encode(set)
+}
+
+func (i *testIssuer) sign(t *testing.T, kid string, claims Claims) string {
+    if claims.ExpiresAt == nil {
+        claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Hour))
+    }
+    if claims.Type == "" {
+        claims.Type = tokenTypeAccess
+    }
+    token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+    token.Header["kid"] = kid
+    signed, err := token.SignedString(i.keys[kid])
+    if err != nil {
+        t.Fatal(err)
+    }
+    return signed
+}
+
+func newTestIssuer(t *testing.T, kids ...string) (*testIssuer, *httptest.Server) {
+    issuer := &testIssuer{keys: map[string]*rsa.PrivateKey{}}
+    for _, kid := range kids {
+        key, err := rsa.GenerateKey(rand.Reader, 2048)
+        if err != nil {
+            t.Fatal(err)
+        }
+        issuer.keys[kid] = key
+    }
+    server := httptest.NewServer(issuer)
+    t.Cleanup(server.Close)
+    return issuer, server
+}
+
+func TestVerify(t *testing.T) {
+    issuer, server := newTestIssuer(t, "k1")
+    v, err := New(Config{JWKSURL: server.URL, Tenant: "acme"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    ctx := context.Background()
+
+    claims, err := v.Verify(ctx, issuer.sign(t, "k1", Claims{UserID: "u1", Tenant: "acme", Roles: []string{"admin"}}))
+    if err != nil || claims.UserID != "u1" || claims.Roles[0] != "admin" {
+        t.Fatalf("Expected the token to verify, got %v, %v", claims, err)
+    }
+
+    tests := []struct {
+        name  string
+        token string
+        want  error
+    }{
+        {"expired", issuer.sign(t, "k1", Claims{UserID: "u1", Tenant: "acme", RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute))}}), ErrExpired},
+        {"other tenant", issuer.sign(t, "k1", Claims{UserID: "u1"}), ErrWrongTenant},
+        {"tampered", issuer.sign(t, "k1", Claims{UserID: "u1", Tenant: "acme"}) + "x", ErrInvalidToken},
+        {"HS256 without a secret", hs256(t, []byte("secret"), Claims{UserID: "u1", Tenant: "acme"}), ErrInvalidToken},
+        {"refresh token", issuer.sign(t, "k1", Claims{UserID: "u1", Tenant: "acme", Type: "refresh"}), ErrInvalidToken},
+        {"empty", "", ErrNoToken},
+    }
+    for _, tt := range tests {
+        if _, err := v.Verify(ctx, tt.token); !errors.Is(err, tt.want) {
+            t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+        }
+    }
+}
+
+func TestVerifyCachesKeys(t *testing.T) {
+    issuer, server := newTestIssuer(t, "k1")
+    v, _ := New(Config{JWKSURL: server.URL, MinRefreshInterval: time.Nanosecond})
+    ctx := context.Background()
+
+    for i := 0; i < 3; i++ {
+        if _, err := v.Verify(ctx, issuer.sign(t, "k1", Claims{UserID: "u1"})); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if n := issuer.fetches.Load(); n != 1 {
+        t.Errorf("Expected the keys to be fetched once, got %d", n)
+    }
+
+    // A rotated key is picked up on first sight.
+    key, _ := rsa.GenerateKey(rand.Reader, 2048)
+    issuer.keys["k2"] = key
+    if _, err := v.Verify(ctx, issuer.sign(t, "k2", Claims{UserID: "u1"})); err != nil {
+        t.Errorf("Expected a new key to be fetched, got %v", err)
+    }
+}
+
+func TestVerifySecret(t *testing.T) {
+    secret := []byte("secret")
+    v, _ := New(Config{Secret: secret})
+    ctx := context.Background()
+
+    if _, err := v.Verify(ctx, hs256(t, secret, Claims{UserID: "u1"})); err != nil {
+        t.Errorf("Expected an HS256 access token to verify, got %v", err)
+    }
+    if _, err := v.Verify(ctx, hs256(t, secret, Claims{UserID: "u1", Type: "refresh"})); !errors.Is(err, ErrInvalidToken) {
+        t.Errorf("Expected a refresh token to be refused, got %v", err)
+    }
+}
+
+func TestVerifyServesStaleKeys(t *testing.T) {
+    issuer, server := newTestIssuer(t, "k1")
+    v, _ := New(Config{JWKSURL: server.URL, CacheTTL: time.Nanosecond, MinRefreshInterval: time.Nanosecond})
+    ctx := context.Background()
+    token := issuer.sign(t, "k1", Claims{UserID: "u1"})
+    if _, err := v.Verify(ctx, token); err != nil {
+        t.Fatal(err)
+    }
+
+    // With the issuer down, the stale key is still served and the background
+    // refresh fails without dropping it.
+    server.Close()
+    for i := 0; i < 3; i++ {
+        if _, err := v.Verify(ctx, token); err != nil {
+            t.Fatalf("Expected the stale key to be used, got %v", err)
+        }
+    }
+}
+
+func TestVerifySharesFetches(t *testing.T) {
+    issuer, _ := newTestIssuer(t, "k1")
+    release := make(chan struct{})
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        <-release
+        issuer.ServeHTTP(w, r)
+    }))
+    t.Cleanup(server.Close)
+    v, _ := New(Config{JWKSURL: server.URL})
+    token := issuer.sign(t, "k1", Claims{UserID: "u1"})
+
+    var wg sync.WaitGroup
+    errs := make(chan error, 5)
+    for i := 0; i < 5; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            _, err := v.Verify(context.Background(), token)
+            errs <- err
+        }()
+    }
+    time.Sleep(50 * time.Millisecond)
+    close(release)
+    wg.Wait()
+    close(errs)
+    for err := range errs {
+        if err != nil {
+            t.Errorf("Expected the token to verify, got %v", err)
+        }
+    }
+    if n := issuer.fetches.Load(); n != 1 {
+        t.Errorf("Expected one shared fetch, got %d", n)
+    }
+}
+
+func TestVerifyRevocation(t *testing.T) {
+    issuer, server := newTestIssuer(t, "k1")
+    revoked := map[string]bool{}
+    v, _ := New(Config{JWKSURL: server.URL, Revocation: RevocationFunc(func(ctx context.Context, token string, claims *Claims) (bool, error) {
+        if claims.UserID == "broken" {
+            return false, errors.New("store unavailable")
+        }
+        return revoked[token], nil
+    })})
+    ctx := context.Background()
+
+    token := issuer.sign(t, "k1", Claims{UserID: "u1"})
+    if _, err := v.Verify(ctx, token); err != nil {
+        t.Fatal(err)
+    }
+    revoked[token] = true
+    if _, err := v.Verify(ctx, token); !errors.Is(err, ErrRevoked) {
+        t.Errorf("Expected ErrRevoked, got %v", err)
+    }
+    if _, err := v.Verify(ctx, issuer.sign(t, "k1", Claims{UserID: "broken"})); err == nil {
+        t.Error("Expected a failed revocation check to fail verification")
+    }
+}
+
+func TestMiddleware(t *testing.T) {
+    issuer, server := newTestIssuer(t, "k1")
+    v, _ := New(Config{JWKSURL: server.URL})
+    token := issuer.sign(t, "k1", Claims{UserID: "u1", Email: "alice@example.com"})
+
+    handler := v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        claims, _ := ClaimsFromContext(r.Context())
+        w.Write([]byte(claims.Email))
+    }))
+    gin.SetMode(gin.TestMode)
+    router := gin.New()
+    router.GET("/", v.Gin(), func(c *gin.Context) {
+        c.String(200, c.GetString("email"))
+    })
+
+    for name, h := range map[string]http.Handler{"net/http": handler, "gin": router} {
+        w := httptest.NewRecorder()
+        req := httptest.NewRequest("GET", "/", nil)
+        req.Header.Set("Authorization", "Bearer "+token)
+        h.ServeHTTP(w, req)
+        if w.Code != http.StatusOK || w.Body.String() != "alice@example.com" {
+            t.Errorf("%s: expected the request through, got %d %s", name, w.Code, w.Body.String())
+        }
+
+        w = httptest.NewRecorder()
+        h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+        if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != "Bearer" {
+            t.Errorf("%s: expected 401 without a token, got %d", name, w.Code)
+        }
+    }
+}
+
+func hs256(t *testing.T, secret []byte, claims Claims) string {
+    claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Hour))
+    if claims.Type == "" {
+        claims.Type = tokenTypeAccess
+    }
+    signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return signed
+}
@@ -0,0 +1,64 @@
+package utils
+
+import (
+    "os"
+    "testing"
+)
+
+func TestGenerateNumericCode(t *testing.T) {
+    code, err := GenerateNumericCode(6)
+    if err != nil {
+        t.Fatalf("Failed to generate code: %v", err)
+    }
+    if len(code) != 6 {
+        t.Errorf("Expected 6 digits, got %q", code)
+    }
+    for _, c := range code {
+        if c < '0' || c > '9' {
+            t.Errorf("Expected only digits, got %q", code)
+        }
+    }
+}
+
+func TestHashSecret(t *testing.T) {
+    os.Setenv("JWT_SECRET", "test-secret")
+
+    token, err := GenerateOpaqueToken(32)
+    if err != nil {
+        t.Fatalf("Failed to generate token: %v", err)
+    }
+
+    hash := HashSecret(token)
+    if hash == token {
+        t.Error("Expected hash to differ from the secret")
+    }
+    if !SecretMatchesHash(token, hash) {
+        t.Error("Expected secret to match its hash")
+    }
+    if SecretMatchesHash(token+"x", hash) {
+        t.Error("Expected different secret not to match")
+    }
+}
+
+func TestPrefixedToken(t *testing.T) {
+    token, err := GeneratePrefixedToken("aspat_")
+    if err != nil {
+        t.Fatalf("Failed to generate token: %v", err)
+    }
+    if len(token) != len("aspat_")+36 || !CheckPrefixedToken(token, "aspat_") {
+        t.Errorf("Expected a valid prefixed token, got %q", token)
+    }
+    if CheckPrefixedToken(token, "assk_") {
+        t.Error("Expected another prefix not to match")
+    }
+
+    tampered := []byte(token)
+    if tampered[10] == 'a' {
+        tampered[10] = 'b'
+    } else {
+        tampered[10] = 'a'
+    }
+    if CheckPrefixedToken(string(tampered), "aspat_") {
+        t.Error("Expected a changed token to fail its checksum")
+    }
+}
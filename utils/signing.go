@@ -0,0 +1,186 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/SinisterSup/auth-service/pkg/jwk"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Access tokens are signed with JWT_SECRET (HS256) unless JWT_SIGNING_KEY_FILE
+// names a PEM RSA or EC private key. Then they are signed with that key and
+// its public half is published at /.well-known/jwks.json, so other services
+// can verify tokens without the secret. JWT_PREVIOUS_SIGNING_KEY_FILE keeps a
+// replaced key published and accepted until its tokens have expired. HS256
+// access tokens issued before the switch are accepted until the RFC 3339 time
+// in JWT_ACCEPT_HS256_UNTIL, and not at all when it is empty, so JWT_SECRET
+// stops minting access tokens once the rotation window has passed. Refresh
+// tokens are only ever read by this service and stay HS256.
+
+var errHS256Retired = errors.New("HS256 access tokens are no longer accepted")
+
+type signingKey struct {
+	id     string
+	method jwt.SigningMethod
+	key    crypto.Signer
+}
+
+var (
+	signingKeysMu sync.Mutex
+	signingKeys   = map[string]*signingKey{}
+)
+
+// JWKS returns the public keys access tokens may be signed with, empty when
+// they are signed with JWT_SECRET.
+func JWKS() (jwk.Set, error) {
+	set := jwk.Set{Keys: []jwk.Key{}}
+	for _, name := range []string{"JWT_SIGNING_KEY_FILE", "JWT_PREVIOUS_SIGNING_KEY_FILE"} {
+		key, err := loadSigningKey(os.Getenv(name))
+		if err != nil {
+			return set, err
+		}
+		if key != nil {
+			public, err := jwk.New(key.id, key.method.Alg(), key.key.Public())
+			if err != nil {
+				return set, err
+			}
+			set.Keys = append(set.Keys, public)
+		}
+	}
+	return set, nil
+}
+
+func signAccessToken(claims JWTClaim) (string, error) {
+	key, err := loadSigningKey(os.Getenv("JWT_SIGNING_KEY_FILE"))
+	if err != nil {
+		return "", err
+	}
+	if key == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(os.Getenv("JWT_SECRET")))
+	}
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.id
+	return token.SignedString(key.key)
+}
+
+// accessTokenKey finds the key to check an access token's signature with:
+// JWT_SECRET for HS256 tokens, while they are accepted, or the published key
+// the token names.
+func accessTokenKey(token *jwt.Token) (interface{}, error) {
+	current, err := loadSigningKey(os.Getenv("JWT_SIGNING_KEY_FILE"))
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if current != nil {
+			if err := checkHS256Accepted(); err != nil {
+				return nil, err
+			}
+		}
+		return []byte(os.Getenv("JWT_SECRET")), nil
+	}
+	previous, err := loadSigningKey(os.Getenv("JWT_PREVIOUS_SIGNING_KEY_FILE"))
+	if err != nil {
+		return nil, err
+	}
+	kid, _ := token.Header["kid"].(string)
+	for _, key := range []*signingKey{current, previous} {
+		if key != nil && key.id == kid && key.method.Alg() == token.Method.Alg() {
+			return key.key.Public(), nil
+		}
+	}
+	return nil, errors.New("unknown signing key")
+}
+
+// checkHS256Accepted reports whether HS256 access tokens are still accepted
+// alongside a signing key, per JWT_ACCEPT_HS256_UNTIL.
+func checkHS256Accepted() error {
+	value := os.Getenv("JWT_ACCEPT_HS256_UNTIL")
+	if value == "" {
+		return errHS256Retired
+	}
+	until, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return fmt.Errorf("invalid JWT_ACCEPT_HS256_UNTIL: %v", err)
+	}
+	if !time.Now().Before(until) {
+		return errHS256Retired
+	}
+	return nil
+}
+
+// loadSigningKey reads and caches the key in the PEM file at path, returning
+// nil when path is empty.
+func loadSigningKey(path string) (*signingKey, error) {
+	if path == "" {
+		return nil, nil
+	}
+	signingKeysMu.Lock()
+	defer signingKeysMu.Unlock()
+	if key, ok := signingKeys[path]; ok {
+		return key, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading signing key: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("signing key %s is not PEM", path)
+	}
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key %s: %v", path, err)
+	}
+
+	key := &signingKey{}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.method, key.key = jwt.SigningMethodRS256, k
+	case *ecdsa.PrivateKey:
+		key.key = k
+		switch k.Curve {
+		case elliptic.P256():
+			key.method = jwt.SigningMethodES256
+		case elliptic.P384():
+			key.method = jwt.SigningMethodES384
+		case elliptic.P521():
+			key.method = jwt.SigningMethodES512
+		default:
+			return nil, fmt.Errorf("signing key %s uses an unsupported curve", path)
+		}
+	default:
+		return nil, fmt.Errorf("signing key %s must be an RSA or EC key", path)
+	}
+	der, err := x509.MarshalPKIXPublicKey(key.key.Public())
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(der)
+	key.id = base64.RawURLEncoding.EncodeToString(sum[:])[:16]
+
+	signingKeys[path] = key
+	return key, nil
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/x509"
+    "encoding/pem"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+func TestSigningKey(t *testing.T) {
+    t.Setenv("JWT_SECRET", "test-secret")
+    t.Setenv("JWT_SIGNING_KEY_FILE", "")
+    legacy, err := GenerateAccessToken(JWTClaim{UserId: "u1"}, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    private, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    der, _ := x509.MarshalECPrivateKey(private)
+    path := filepath.Join(t.TempDir(), "signing.pem")
+    if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+        t.Fatal(err)
+    }
+    t.Setenv("JWT_SIGNING_KEY_FILE", path)
+
+    token, err := GenerateAccessToken(JWTClaim{UserId: "u1"}, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    claims, err := ValidateTokenWithOptions(token, true)
+    if err != nil || claims.UserId != "u1" {
+        t.Fatalf("Expected the signed token to validate, got %v", err)
+    }
+    if _, err := ValidateTokenWithOptions(legacy, true); err == nil {
+        t.Error("Expected an HS256 token to be rejected without JWT_ACCEPT_HS256_UNTIL")
+    }
+    t.Setenv("JWT_ACCEPT_HS256_UNTIL", time.Now().Add(time.Hour).Format(time.RFC3339))
+    if _, err := ValidateTokenWithOptions(legacy, true); err != nil {
+        t.Errorf("Expected an HS256 token to validate during the rotation window, got %v", err)
+    }
+    t.Setenv("JWT_ACCEPT_HS256_UNTIL", time.Now().Add(-time.Minute).Format(time.RFC3339))
+    if _, err := ValidateTokenWithOptions(legacy, true); err == nil {
+        t.Error("Expected an HS256 token to be rejected after the rotation window")
+    }
+
+    set, err := JWKS()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(set.Keys) != 1 || set.Keys[0].Kty != "EC" || set.Keys[0].Alg != "ES256" || set.Keys[0].Crv != "P-256" {
+        t.Errorf("Unexpected key set: %+v", set)
+    }
+    if _, err := ValidateRefreshToken(token); err == nil {
+        t.Error("Expected an access token signed with the key not to pass as a refresh token")
+    }
+}
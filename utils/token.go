@@ -8,29 +8,73 @@ import (
 	"time"
 
 	"github.com/SinisterSup/auth-service/db"
+	"github.com/SinisterSup/auth-service/internal/models"
 
 	"github.com/golang-jwt/jwt/v5"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type JWTClaim struct {
-	UserId string `json:"user_id"`
-	Email  string `json:"email"`
+	UserId      string   `json:"user_id"`
+	Email       string   `json:"email"`
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	// Scope is the space-separated OAuth scope the token was granted. On a
+	// refresh token it is the most that refreshing may grant.
+	Scope string `json:"scope,omitempty"`
+	// Tenant is the tenant the user belongs to, empty for the default.
+	Tenant string `json:"tenant,omitempty"`
+	// Org is the organization the user is acting in and OrgRole their role
+	// there, both empty when no organization is selected.
+	Org     string `json:"org,omitempty"`
+	OrgRole string `json:"org_role,omitempty"`
+	// KeyID is set when the request used an API key rather than a JWT, and
+	// Service when that key belongs to a service instead of a user.
+	KeyID   string `json:"key_id,omitempty"`
+	Service string `json:"service,omitempty"`
+	// Generation is the user's token generation when the token was issued.
+	Generation int64 `json:"gen,omitempty"`
+	// Type tells access and refresh tokens apart, so neither is accepted in
+	// place of the other.
+	Type string `json:"typ,omitempty"`
 	jwt.RegisteredClaims
 }
 
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
+var (
+	accessTokenMethods  = []string{"HS256", "RS256", "ES256", "ES384", "ES512"}
+	refreshTokenMethods = []string{"HS256"}
+	errWrongTokenType   = errors.New("wrong token type")
+)
+
+const (
+	defaultAccessTokenTTL  = 24 * time.Hour
+	defaultRefreshTokenTTL = 120 * time.Hour // 5 days
+)
+
 func GenerateToken(userId, email string) (string, error) {
-	claims := JWTClaim{
-		UserId: userId,
-		Email:  email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+	return GenerateAccessToken(JWTClaim{UserId: userId, Email: email}, 0)
+}
+
+// GenerateAccessToken signs an access token carrying claims, with the issue
+// time filled in and an expiry ttl from now, or 24 hours if ttl is zero.
+func GenerateAccessToken(claims JWTClaim, ttl time.Duration) (string, error) {
+	if ttl <= 0 {
+		ttl = defaultAccessTokenTTL
+	}
+	claims.Type = TokenTypeAccess
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	return signAccessToken(claims)
 }
 
 // func ValidateToken(tokenString string) (*JWTClaim, error) {
@@ -50,7 +94,7 @@ func GenerateToken(userId, email string) (string, error) {
 // 		return nil, errors.New("token expired")
 // 	}
 
-// 	revoked, err := isTokenRevoked(claims.UserId, tokenString)
+// 	revoked, err := isTokenRevoked(claims, tokenString)
 // 	// log.Println("token revoked? -", revoked)
 // 	if err != nil {
 // 		return nil, errors.New("error checking token status")
@@ -67,9 +111,7 @@ func ValidateToken(tokenString string) (*JWTClaim, error) {
 }
 
 func ValidateTokenWithOptions(tokenString string, skipRevocationCheck bool) (*JWTClaim, error) {
-    token, err := jwt.ParseWithClaims(tokenString, &JWTClaim{}, func(token *jwt.Token) (interface{}, error) {
-        return []byte(os.Getenv("JWT_SECRET")), nil
-    })
+    token, err := jwt.ParseWithClaims(tokenString, &JWTClaim{}, accessTokenKey, jwt.WithValidMethods(accessTokenMethods))
 
     if err != nil {
         return nil, err
@@ -79,13 +121,19 @@ func ValidateTokenWithOptions(tokenString string, skipRevocationCheck bool) (*JW
     if !ok {
         return nil, errors.New("couldn't parse JWTclaims")
     }
+    if claims.Type != TokenTypeAccess {
+        return nil, errWrongTokenType
+    }
 
     if claims.ExpiresAt.Time.Before(time.Now()) {
         return nil, errors.New("token expired")
     }
 
     if !skipRevocationCheck {
-        revoked, err := isTokenRevoked(claims.UserId, tokenString)
+        revoked, err := isTokenRevoked(claims, tokenString)
+        if errors.Is(err, models.ErrAccountInactive) {
+            return nil, err
+        }
         if err != nil {
             return nil, errors.New("error checking token status")
         }
@@ -97,8 +145,12 @@ func ValidateTokenWithOptions(tokenString string, skipRevocationCheck bool) (*JW
     return claims, nil
 }
 
-func isTokenRevoked(userId string, tokenString string) (bool, error) {
-	objectId, err := primitive.ObjectIDFromHex(userId)
+// isTokenRevoked rejects tokens that were revoked individually, tokens of
+// users that are gone, and tokens from an earlier generation than the user's
+// current one, which is raised to invalidate their sessions. Users whose
+// account is not active get an *models.AccountStatusError instead.
+func isTokenRevoked(claims *JWTClaim, tokenString string) (bool, error) {
+	objectId, err := primitive.ObjectIDFromHex(claims.UserId)
 	if err != nil {
 		return true, fmt.Errorf("invalid user ID: %v", err)
 	}
@@ -108,13 +160,24 @@ func isTokenRevoked(userId string, tokenString string) (bool, error) {
 
 	collection := db.DB.Collection("users")
 
-    userCount, err := collection.CountDocuments(ctx, bson.M{"_id": objectId})
+	var user models.User
+	err = collection.FindOne(
+		ctx,
+		bson.M{"_id": objectId},
+		options.FindOne().SetProjection(bson.M{"status": 1, "status_until": 1, "deleted_at": 1, "token_generation": 1}),
+	).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return false, errors.New("user not found")
+	}
 	if err != nil {
-        return false, fmt.Errorf("database error checking user: %v", err)
-    }
-    if userCount == 0 {
-        return false, errors.New("user not found")
-    }
+		return false, fmt.Errorf("database error checking user: %v", err)
+	}
+	if err := user.StatusError(time.Now()); err != nil {
+		return true, err
+	}
+	if claims.Generation < user.TokenGeneration {
+		return true, nil
+	}
 
     filter := bson.M{
         "_id": objectId,
@@ -133,36 +196,24 @@ func isTokenRevoked(userId string, tokenString string) (bool, error) {
         return false, fmt.Errorf("database error checking revoked tokens: %v", err)
     }
 
-	// var user struct {
-	// 	RevokedTokens []struct {
-	// 		Token string `bson:"token"`
-	// 	} `bson:"revoked_tokens"`
-	// }
-
-	// err = collection.FindOne(ctx, bson.M{
-	// 	"_id": objectId,
-	// 	"revoked_tokens": bson.M{
-	// 		"$elemMatch": bson.M{
-	// 			"token": tokenString,
-	// 		},
-	// 	},
-	// }).Decode(&user)
-
-	// if err.Error() == "mongo: no documents in result" {
-	// 	return false, nil
-	// }
-
 	return count > 0, nil
 }
 
 func GenerateRefreshToken(userId, email string) (string, error) {
-    claims := JWTClaim{
-        UserId: userId,
-        Email:  email,
-        RegisteredClaims: jwt.RegisteredClaims{
-            ExpiresAt: jwt.NewNumericDate(time.Now().Add(120 * time.Hour)), // 5 days
-            IssuedAt:  jwt.NewNumericDate(time.Now()),
-        },
+    return GenerateRefreshTokenWithClaims(JWTClaim{UserId: userId, Email: email}, 0)
+}
+
+// GenerateRefreshTokenWithClaims signs a refresh token carrying claims, with
+// an expiry ttl from now, or 5 days if ttl is zero. Its scope is the most
+// that refreshing may grant.
+func GenerateRefreshTokenWithClaims(claims JWTClaim, ttl time.Duration) (string, error) {
+    if ttl <= 0 {
+        ttl = defaultRefreshTokenTTL
+    }
+    claims.Type = TokenTypeRefresh
+    claims.RegisteredClaims = jwt.RegisteredClaims{
+        ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+        IssuedAt:  jwt.NewNumericDate(time.Now()),
     }
     token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
     return token.SignedString([]byte(os.Getenv("JWT_SECRET")))
@@ -171,7 +222,7 @@ func GenerateRefreshToken(userId, email string) (string, error) {
 func ValidateRefreshToken(tokenString string) (*JWTClaim, error) {
     token, err := jwt.ParseWithClaims(tokenString, &JWTClaim{}, func(token *jwt.Token) (interface{}, error) {
         return []byte(os.Getenv("JWT_SECRET")), nil
-    })
+    }, jwt.WithValidMethods(refreshTokenMethods))
 
     if err != nil {
         return nil, err
@@ -181,10 +232,29 @@ func ValidateRefreshToken(tokenString string) (*JWTClaim, error) {
     if !ok {
         return nil, errors.New("couldn't parse claims")
     }
+    if claims.Type != TokenTypeRefresh {
+        return nil, errWrongTokenType
+    }
 
     if claims.ExpiresAt.Time.Before(time.Now()) {
         return nil, errors.New("refresh token expired")
     }
 
     return claims, nil
-}
\ No newline at end of file
+}
+
+// TokenLifetime reads the issued and expiry times of a token without
+// verifying it. It is only meant for describing tokens we stored ourselves.
+func TokenLifetime(tokenString string) (issuedAt, expiresAt *time.Time) {
+    claims := &JWTClaim{}
+    if _, _, err := jwt.NewParser().ParseUnverified(tokenString, claims); err != nil {
+        return nil, nil
+    }
+    if claims.IssuedAt != nil {
+        issuedAt = &claims.IssuedAt.Time
+    }
+    if claims.ExpiresAt != nil {
+        expiresAt = &claims.ExpiresAt.Time
+    }
+    return issuedAt, expiresAt
+}
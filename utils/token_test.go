@@ -81,6 +81,41 @@ func TestTokenExpiry(t *testing.T) {
     }
 }
 
+func TestTokenTypes(t *testing.T) {
+    os.Setenv("JWT_SECRET", "test-secret")
+
+    access, err := GenerateToken("507f1f77bcf86cd799439011", "test@example.com")
+    if err != nil {
+        t.Fatalf("Failed to generate access token: %v", err)
+    }
+    refresh, err := GenerateRefreshToken("507f1f77bcf86cd799439011", "test@example.com")
+    if err != nil {
+        t.Fatalf("Failed to generate refresh token: %v", err)
+    }
+
+    if _, err := ValidateTokenWithOptions(refresh, true); err == nil {
+        t.Error("Expected a refresh token to be rejected as an access token")
+    }
+    if _, err := ValidateRefreshToken(access); err == nil {
+        t.Error("Expected an access token to be rejected as a refresh token")
+    }
+    if _, err := ValidateRefreshToken(refresh); err != nil {
+        t.Errorf("Expected the refresh token to be valid, got %v", err)
+    }
+
+    claims := JWTClaim{
+        UserId: "507f1f77bcf86cd799439011",
+        Type:   TokenTypeRefresh,
+        RegisteredClaims: jwt.RegisteredClaims{
+            ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+        },
+    }
+    hs512, _ := jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString([]byte("test-secret"))
+    if _, err := ValidateRefreshToken(hs512); err == nil {
+        t.Error("Expected a refresh token signed with HS512 to be rejected")
+    }
+}
+
 // func TestTokenRevocation(t *testing.T) {
 //     cleanup := setupTestDB(t)
 //     defer cleanup()